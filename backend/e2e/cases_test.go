@@ -0,0 +1,706 @@
+package e2e
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/kakke18/platform-security-poc/backend/e2e/harness"
+	gatewayv1 "github.com/kakke18/platform-security-poc/backend/gen/gateway/v1"
+	"github.com/kakke18/platform-security-poc/backend/gen/gateway/v1/gatewayv1connect"
+	identityv1 "github.com/kakke18/platform-security-poc/backend/gen/identity/v1"
+	"github.com/kakke18/platform-security-poc/backend/gen/identity/v1/identityv1connect"
+	userv1 "github.com/kakke18/platform-security-poc/backend/gen/user/v1"
+	"github.com/kakke18/platform-security-poc/backend/gen/user/v1/userv1connect"
+	"github.com/kakke18/platform-security-poc/backend/platform/fakeidp"
+	"github.com/kakke18/platform-security-poc/backend/platform/principal"
+	"github.com/kakke18/platform-security-poc/backend/platform/tenantctx"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+// シードデータ（e2e/seed.yaml）に登録されているユーザー
+const (
+	// user01 は3つのテナントに所属するワークスペースws-001のユーザー
+	user01             = "auth0|6952b421821fed371daac9df"
+	user01WorkspaceUID = "wsu-001"
+	user02             = "auth0|user002"
+	workspaceID        = "ws-001"
+	workspaceUsers     = 5
+	// otherUser は別のワークスペースws-002に1人だけ所属するユーザー
+	otherUser         = "auth0|other001"
+	otherWorkspaceUID = "wsu-101"
+	otherTenantID     = "tenant-101"
+	// dpopUser はDPoPを必須とするワークスペースws-003のユーザー
+	dpopUser        = "auth0|dpop001"
+	dpopWorkspaceID = "ws-003"
+	unknownUser     = "auth0|unknown"
+)
+
+// e2e/routes.yamlでUpdateMeに要求するステップアップ認証
+const (
+	acrMFA       = "http://schemas.openid.net/pape/policies/2007/06/multi-factor"
+	stepUpMaxAge = 5 * time.Minute
+)
+
+// mfaClaims は指定された時刻に多要素認証したことを示すクレームを返す
+func mfaClaims(authTime time.Time) map[string]any {
+	return map[string]any{
+		"acr":       acrMFA,
+		"amr":       []string{"pwd", "mfa"},
+		"auth_time": authTime.Unix(),
+	}
+}
+
+// testCase はGatewayを経由して検証する1つのシナリオ
+type testCase struct {
+	name string
+	run  func(ctx context.Context, s *suite) error
+}
+
+// suite はケースから使用するハーネスとクライアント
+type suite struct {
+	h             *harness.Harness
+	me            gatewayv1connect.MeServiceClient
+	users         identityv1connect.UserServiceClient
+	workspaceUser identityv1connect.WorkspaceUserServiceClient
+	tenantUsers   userv1connect.TenantUserServiceClient
+}
+
+// newSuite はGatewayに接続するクライアントを作成する
+func newSuite(h *harness.Harness) *suite {
+	url := h.GatewayURL()
+	return &suite{
+		h:             h,
+		me:            gatewayv1connect.NewMeServiceClient(http.DefaultClient, url),
+		users:         identityv1connect.NewUserServiceClient(http.DefaultClient, url),
+		workspaceUser: identityv1connect.NewWorkspaceUserServiceClient(http.DefaultClient, url),
+		tenantUsers:   userv1connect.NewTenantUserServiceClient(http.DefaultClient, url),
+	}
+}
+
+// token は指定されたユーザーのトークンを発行する（失敗した場合はpanicする）
+func (s *suite) token(subject string, extra map[string]any) string {
+	token, err := s.h.Token(subject, extra)
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
+
+// authorize はリクエストにBearerトークンを設定する
+func authorize[T any](req *connect.Request[T], token string) *connect.Request[T] {
+	if token != "" {
+		req.Header().Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+// expectCode はエラーが指定されたConnectのコードであることを検証する
+func expectCode(err error, want connect.Code) error {
+	if err == nil {
+		return fmt.Errorf("expected %s, got success", want)
+	}
+	if got := connect.CodeOf(err); got != want {
+		return fmt.Errorf("expected %s, got %s: %v", want, got, err)
+	}
+	return nil
+}
+
+// getMeWithToken はトークンでGetMeを呼び出し、期待するコードであることを検証する
+func getMeWithToken(token func(s *suite) string, want connect.Code) func(ctx context.Context, s *suite) error {
+	return func(ctx context.Context, s *suite) error {
+		_, err := s.me.GetMe(ctx, authorize(connect.NewRequest(&gatewayv1.GetMeRequest{}), token(s)))
+		return expectCode(err, want)
+	}
+}
+
+// getMeAcceptsToken はトークンでGetMeを呼び出し、成功することを検証する
+func getMeAcceptsToken(token func(s *suite) string) func(ctx context.Context, s *suite) error {
+	return func(ctx context.Context, s *suite) error {
+		_, err := s.me.GetMe(ctx, authorize(connect.NewRequest(&gatewayv1.GetMeRequest{}), token(s)))
+		return err
+	}
+}
+
+// getMeURL はGetMeのURL（DPoPプルーフのhtu）を返す
+func (s *suite) getMeURL() string {
+	return s.h.GatewayURL() + gatewayv1connect.MeServiceGetMeProcedure
+}
+
+// getMeWithDPoP はDPoPスキームのトークンとDPoPプルーフ（空の場合は付与しない）でGetMeを呼び出す
+func (s *suite) getMeWithDPoP(ctx context.Context, token, proof string) error {
+	req := connect.NewRequest(&gatewayv1.GetMeRequest{})
+	req.Header().Set("Authorization", "DPoP "+token)
+	if proof != "" {
+		req.Header().Set("DPoP", proof)
+	}
+	_, err := s.me.GetMe(ctx, req)
+	return err
+}
+
+// updateMeRequiresStepUp はクレームを追加したトークンでUpdateMeを呼び出し、
+// 満たしていない要件と再認証で要求する値がエラーの詳細で返されることを検証する
+func updateMeRequiresStepUp(extra map[string]any, wantUnmet string) func(ctx context.Context, s *suite) error {
+	return func(ctx context.Context, s *suite) error {
+		name := "Step-up " + time.Now().Format(time.TimeOnly)
+		_, err := s.users.UpdateMe(ctx, authorize(connect.NewRequest(&identityv1.UpdateMeRequest{Name: &name}), s.token(user01, extra)))
+		if err := expectCode(err, connect.CodeUnauthenticated); err != nil {
+			return err
+		}
+		var connectErr *connect.Error
+		if !errors.As(err, &connectErr) {
+			return fmt.Errorf("not a connect error: %v", err)
+		}
+		for _, d := range connectErr.Details() {
+			v, err := d.Value()
+			if err != nil {
+				return err
+			}
+			info, ok := v.(*errdetails.ErrorInfo)
+			if !ok || info.Reason != "STEP_UP_REQUIRED" {
+				continue
+			}
+			want := map[string]string{
+				"unmet":      wantUnmet,
+				"acr_values": acrMFA,
+				"amr":        "mfa",
+				"max_age":    fmt.Sprint(int(stepUpMaxAge.Seconds())),
+			}
+			if !maps.Equal(info.Metadata, want) {
+				return fmt.Errorf("unexpected metadata: %v", info.Metadata)
+			}
+			return nil
+		}
+		return fmt.Errorf("no STEP_UP_REQUIRED detail: %v", err)
+	}
+}
+
+// cases は実行するケースの一覧
+var cases = []testCase{
+	{
+		name: "GetMe/returns workspace user and tenants",
+		run: func(ctx context.Context, s *suite) error {
+			resp, err := s.me.GetMe(ctx, authorize(connect.NewRequest(&gatewayv1.GetMeRequest{}), s.token(user01, nil)))
+			if err != nil {
+				return err
+			}
+			if resp.Msg.WorkspaceUserId != user01WorkspaceUID || resp.Msg.WorkspaceId != workspaceID {
+				return fmt.Errorf("unexpected workspace user: %s/%s", resp.Msg.WorkspaceId, resp.Msg.WorkspaceUserId)
+			}
+			if len(resp.Msg.Tenants) == 0 {
+				return errors.New("expected tenants")
+			}
+			if len(resp.Msg.DegradedFields) > 0 {
+				return fmt.Errorf("unexpected degraded fields: %v", resp.Msg.DegradedFields)
+			}
+			return nil
+		},
+	},
+	{
+		name: "GetMe/unknown user is not found",
+		run: func(ctx context.Context, s *suite) error {
+			_, err := s.me.GetMe(ctx, authorize(connect.NewRequest(&gatewayv1.GetMeRequest{}), s.token(unknownUser, nil)))
+			return expectCode(err, connect.CodeNotFound)
+		},
+	},
+	{
+		name: "ListWorkspaceUsers/paginates without duplicates",
+		run: func(ctx context.Context, s *suite) error {
+			token := s.token(user01, nil)
+			var seen []string
+			pageToken := ""
+			for page := 0; ; page++ {
+				if page > workspaceUsers {
+					return errors.New("pagination did not terminate")
+				}
+				resp, err := s.me.ListWorkspaceUsers(ctx, authorize(connect.NewRequest(&gatewayv1.ListWorkspaceUsersRequest{
+					PageSize:  2,
+					PageToken: pageToken,
+				}), token))
+				if err != nil {
+					return err
+				}
+				if len(resp.Msg.Users) > 2 {
+					return fmt.Errorf("page %d has %d users, want at most 2", page, len(resp.Msg.Users))
+				}
+				for _, u := range resp.Msg.Users {
+					if slices.Contains(seen, u.WorkspaceUserId) {
+						return fmt.Errorf("duplicate user across pages: %s", u.WorkspaceUserId)
+					}
+					seen = append(seen, u.WorkspaceUserId)
+				}
+				if pageToken = resp.Msg.NextPageToken; pageToken == "" {
+					break
+				}
+			}
+			if len(seen) != workspaceUsers {
+				return fmt.Errorf("got %d users, want %d: %v", len(seen), workspaceUsers, seen)
+			}
+			return nil
+		},
+	},
+	{
+		name: "Isolation/workspace users are scoped to the caller's workspace",
+		run: func(ctx context.Context, s *suite) error {
+			resp, err := s.me.ListWorkspaceUsers(ctx, authorize(connect.NewRequest(&gatewayv1.ListWorkspaceUsersRequest{}), s.token(otherUser, nil)))
+			if err != nil {
+				return err
+			}
+			if len(resp.Msg.Users) != 1 || resp.Msg.Users[0].WorkspaceUserId != otherWorkspaceUID {
+				var got []string
+				for _, u := range resp.Msg.Users {
+					got = append(got, u.WorkspaceUserId)
+				}
+				return fmt.Errorf("got users %v, want only %s", got, otherWorkspaceUID)
+			}
+			return nil
+		},
+	},
+	{
+		name: "Isolation/tenant of another workspace is denied",
+		run: func(ctx context.Context, s *suite) error {
+			req := authorize(connect.NewRequest(&gatewayv1.GetMeRequest{}), s.token(user01, nil))
+			req.Header().Set(tenantctx.HeaderTenantID, otherTenantID)
+			_, err := s.me.GetMe(ctx, req)
+			return expectCode(err, connect.CodePermissionDenied)
+		},
+	},
+	{
+		name: "UpdateMe/updates the authenticated user's profile",
+		run: func(ctx context.Context, s *suite) error {
+			name := "Renamed " + time.Now().Format(time.TimeOnly)
+			resp, err := s.users.UpdateMe(ctx, authorize(connect.NewRequest(&identityv1.UpdateMeRequest{Name: &name}), s.token(user01, mfaClaims(time.Now()))))
+			if err != nil {
+				return err
+			}
+			if resp.Msg.Auth0UserId != user01 || resp.Msg.Name != name {
+				return fmt.Errorf("unexpected response: user=%s name=%q", resp.Msg.Auth0UserId, resp.Msg.Name)
+			}
+			return nil
+		},
+	},
+	{
+		name: "StepUp/update without MFA is rejected with the required acr and max_age",
+		run:  updateMeRequiresStepUp(nil, "acr"),
+	},
+	{
+		name: "StepUp/update without the required amr is rejected",
+		run: updateMeRequiresStepUp(map[string]any{
+			"acr":       acrMFA,
+			"amr":       []string{"pwd"},
+			"auth_time": time.Now().Unix(),
+		}, "amr"),
+	},
+	{
+		name: "StepUp/update with a stale authentication is rejected",
+		run:  updateMeRequiresStepUp(mfaClaims(time.Now().Add(-stepUpMaxAge-time.Minute)), "auth_time"),
+	},
+	{
+		name: "StepUp/update without auth_time is rejected",
+		run: updateMeRequiresStepUp(map[string]any{
+			"acr": acrMFA,
+			"amr": []string{"mfa"},
+		}, "auth_time"),
+	},
+	{
+		name: "StepUp/other procedures of the service do not require MFA",
+		run: func(ctx context.Context, s *suite) error {
+			_, err := s.users.GetMe(ctx, authorize(connect.NewRequest(&identityv1.GetMeRequest{}), s.token(user01, nil)))
+			return err
+		},
+	},
+	{
+		name: "DPoP/bound token with a valid proof is accepted",
+		run: func(ctx context.Context, s *suite) error {
+			key := newDPoPKey()
+			token := s.token(user01, key.confirmation())
+			return s.getMeWithDPoP(ctx, token, key.proof(http.MethodPost, s.getMeURL(), token))
+		},
+	},
+	{
+		name: "DPoP/bound token as a bearer token is unauthenticated",
+		run: func(ctx context.Context, s *suite) error {
+			key := newDPoPKey()
+			token := s.token(user01, key.confirmation())
+			req := authorize(connect.NewRequest(&gatewayv1.GetMeRequest{}), token)
+			req.Header().Set("DPoP", key.proof(http.MethodPost, s.getMeURL(), token))
+			_, err := s.me.GetMe(ctx, req)
+			return expectCode(err, connect.CodeUnauthenticated)
+		},
+	},
+	{
+		name: "DPoP/rejected proof returns a DPoP challenge",
+		run: func(ctx context.Context, s *suite) error {
+			token := s.token(user01, newDPoPKey().confirmation())
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.getMeURL(), strings.NewReader("{}"))
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "DPoP "+token)
+			req.Header.Set("DPoP", newDPoPKey().proof(http.MethodPost, s.getMeURL(), token))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			challenge := resp.Header.Get("WWW-Authenticate")
+			if resp.StatusCode != http.StatusUnauthorized || !strings.HasPrefix(challenge, "DPoP ") || !strings.Contains(challenge, `error="invalid_dpop_proof"`) {
+				return fmt.Errorf("unexpected response: status=%d WWW-Authenticate=%q", resp.StatusCode, challenge)
+			}
+			return nil
+		},
+	},
+	{
+		name: "DPoP/bound token without a proof is unauthenticated",
+		run: func(ctx context.Context, s *suite) error {
+			token := s.token(user01, newDPoPKey().confirmation())
+			return expectCode(s.getMeWithDPoP(ctx, token, ""), connect.CodeUnauthenticated)
+		},
+	},
+	{
+		name: "DPoP/replayed proof is unauthenticated",
+		run: func(ctx context.Context, s *suite) error {
+			key := newDPoPKey()
+			token := s.token(user01, key.confirmation())
+			proof := key.proof(http.MethodPost, s.getMeURL(), token)
+			if err := s.getMeWithDPoP(ctx, token, proof); err != nil {
+				return fmt.Errorf("first use: %w", err)
+			}
+			return expectCode(s.getMeWithDPoP(ctx, token, proof), connect.CodeUnauthenticated)
+		},
+	},
+	{
+		name: "DPoP/proof for another procedure is unauthenticated",
+		run: func(ctx context.Context, s *suite) error {
+			key := newDPoPKey()
+			token := s.token(user01, key.confirmation())
+			url := s.h.GatewayURL() + gatewayv1connect.MeServiceListWorkspaceUsersProcedure
+			return expectCode(s.getMeWithDPoP(ctx, token, key.proof(http.MethodPost, url, token)), connect.CodeUnauthenticated)
+		},
+	},
+	{
+		name: "DPoP/proof signed by another key is unauthenticated",
+		run: func(ctx context.Context, s *suite) error {
+			token := s.token(user01, newDPoPKey().confirmation())
+			proof := newDPoPKey().proof(http.MethodPost, s.getMeURL(), token)
+			return expectCode(s.getMeWithDPoP(ctx, token, proof), connect.CodeUnauthenticated)
+		},
+	},
+	{
+		name: "DPoP/bearer token with the DPoP scheme is unauthenticated",
+		run: func(ctx context.Context, s *suite) error {
+			token := s.token(user01, nil)
+			return expectCode(s.getMeWithDPoP(ctx, token, newDPoPKey().proof(http.MethodPost, s.getMeURL(), token)), connect.CodeUnauthenticated)
+		},
+	},
+	{
+		name: "DPoP/bearer token of a client that requires DPoP is unauthenticated",
+		run: func(ctx context.Context, s *suite) error {
+			token := s.token(user01, map[string]any{"azp": harness.DPoPClientID})
+			_, err := s.me.GetMe(ctx, authorize(connect.NewRequest(&gatewayv1.GetMeRequest{}), token))
+			return expectCode(err, connect.CodeUnauthenticated)
+		},
+	},
+	{
+		name: "DPoP/bound token of a client that requires DPoP is accepted",
+		run: func(ctx context.Context, s *suite) error {
+			key := newDPoPKey()
+			token := s.token(user01, map[string]any{"azp": harness.DPoPClientID, "cnf": key.confirmation()["cnf"]})
+			return s.getMeWithDPoP(ctx, token, key.proof(http.MethodPost, s.getMeURL(), token))
+		},
+	},
+	{
+		name: "DPoP/bearer token in a workspace that requires DPoP is unauthenticated",
+		run: func(ctx context.Context, s *suite) error {
+			_, err := s.me.GetMe(ctx, authorize(connect.NewRequest(&gatewayv1.GetMeRequest{}), s.token(dpopUser, nil)))
+			return expectCode(err, connect.CodeUnauthenticated)
+		},
+	},
+	{
+		name: "DPoP/bound token in a workspace that requires DPoP is accepted",
+		run: func(ctx context.Context, s *suite) error {
+			key := newDPoPKey()
+			token := s.token(dpopUser, key.confirmation())
+			return s.getMeWithDPoP(ctx, token, key.proof(http.MethodPost, s.getMeURL(), token))
+		},
+	},
+	{
+		name: "Introspection/active opaque token is accepted",
+		run: getMeAcceptsToken(func(s *suite) string {
+			return s.h.OpaqueToken(user01, nil)
+		}),
+	},
+	{
+		name: "Introspection/unknown opaque token is unauthenticated",
+		run: getMeWithToken(func(s *suite) string {
+			return "unknown-opaque-token"
+		}, connect.CodeUnauthenticated),
+	},
+	{
+		name: "Introspection/revoked opaque token is unauthenticated",
+		run: getMeWithToken(func(s *suite) string {
+			token := s.h.OpaqueToken(user01, nil)
+			s.h.IdP.RevokeOpaque(token)
+			return token
+		}, connect.CodeUnauthenticated),
+	},
+	{
+		name: "Introspection/opaque token for another audience is unauthenticated",
+		run: getMeWithToken(func(s *suite) string {
+			return s.h.OpaqueToken(user01, map[string]any{"aud": "https://other.example.com"})
+		}, connect.CodeUnauthenticated),
+	},
+	{
+		name: "Introspection/opaque token of an unapproved client is unauthenticated",
+		run: getMeWithToken(func(s *suite) string {
+			return s.h.OpaqueToken(user01, map[string]any{"client_id": "unapproved-partner"})
+		}, connect.CodeUnauthenticated),
+	},
+	{
+		name: "Introspection/opaque token without exp is unauthenticated",
+		run: getMeWithToken(func(s *suite) string {
+			return s.h.OpaqueToken(user01, map[string]any{"exp": nil})
+		}, connect.CodeUnauthenticated),
+	},
+	{
+		name: "Introspection/result is cached until exp",
+		run: func(ctx context.Context, s *suite) error {
+			exp := time.Now().Add(2 * time.Second)
+			token := s.h.OpaqueToken(user01, map[string]any{"exp": exp.Unix()})
+			req := func() error {
+				_, err := s.me.GetMe(ctx, authorize(connect.NewRequest(&gatewayv1.GetMeRequest{}), token))
+				return err
+			}
+			if err := req(); err != nil {
+				return err
+			}
+			before := s.h.IdP.Introspections()
+			if err := req(); err != nil {
+				return err
+			}
+			if n := s.h.IdP.Introspections() - before; n != 0 {
+				return fmt.Errorf("cached token was introspected %d more time(s)", n)
+			}
+			// expはUNIX秒のため、切り捨てた分を超えて待つ
+			time.Sleep(time.Until(exp) + time.Second)
+			if err := expectCode(req(), connect.CodeUnauthenticated); err != nil {
+				return fmt.Errorf("expired token: %w", err)
+			}
+			if s.h.IdP.Introspections() == before {
+				return errors.New("expired token was served from the cache")
+			}
+			return nil
+		},
+	},
+	{
+		name: "Introspection/endpoint outage is unavailable",
+		run: func(ctx context.Context, s *suite) error {
+			token := s.h.OpaqueToken(user01, nil)
+			s.h.IdP.SetOutage(http.StatusServiceUnavailable)
+			defer s.h.IdP.SetOutage(0)
+			_, err := s.me.GetMe(ctx, authorize(connect.NewRequest(&gatewayv1.GetMeRequest{}), token))
+			return expectCode(err, connect.CodeUnavailable)
+		},
+	},
+	{
+		name: "Introspection/DPoP-bound opaque token as a bearer token is unauthenticated",
+		run: getMeWithToken(func(s *suite) string {
+			return s.h.OpaqueToken(user01, newDPoPKey().confirmation())
+		}, connect.CodeUnauthenticated),
+	},
+	{
+		name: "Introspection/DPoP-bound opaque token with a proof is accepted",
+		run: func(ctx context.Context, s *suite) error {
+			key := newDPoPKey()
+			token := s.h.OpaqueToken(user01, key.confirmation())
+			return s.getMeWithDPoP(ctx, token, key.proof(http.MethodPost, s.getMeURL(), token))
+		},
+	},
+	{
+		name: "Spoofing/subject header is replaced with the verified subject",
+		run: func(ctx context.Context, s *suite) error {
+			req := authorize(connect.NewRequest(&identityv1.GetMeRequest{}), s.token(user01, nil))
+			req.Header().Set(principal.HeaderSubject, user02)
+			resp, err := s.users.GetMe(ctx, req)
+			if err != nil {
+				return err
+			}
+			if resp.Msg.Auth0UserId != user01 {
+				return fmt.Errorf("spoofed subject reached the backend: %s", resp.Msg.Auth0UserId)
+			}
+			return nil
+		},
+	},
+	{
+		name: "Spoofing/workspace user header is replaced with the resolved workspace user",
+		run: func(ctx context.Context, s *suite) error {
+			user01Tenants, err := s.tenantUsers.GetTenantUsers(ctx, authorize(connect.NewRequest(&userv1.GetTenantUsersRequest{}), s.token(user01, nil)))
+			if err != nil {
+				return err
+			}
+
+			req := authorize(connect.NewRequest(&userv1.GetTenantUsersRequest{}), s.token(user02, nil))
+			req.Header().Set(principal.HeaderWorkspaceUserID, user01WorkspaceUID)
+			resp, err := s.tenantUsers.GetTenantUsers(ctx, req)
+			if err != nil {
+				return err
+			}
+			if len(user01Tenants.Msg.Users) > 0 && len(resp.Msg.Users) == len(user01Tenants.Msg.Users) {
+				return fmt.Errorf("spoofed workspace user %s reached the backend", user01WorkspaceUID)
+			}
+			return nil
+		},
+	},
+	{
+		name: "Spoofing/tenant header for a tenant the user does not belong to is denied",
+		run: func(ctx context.Context, s *suite) error {
+			req := authorize(connect.NewRequest(&gatewayv1.GetMeRequest{}), s.token(user01, nil))
+			req.Header().Set(tenantctx.HeaderTenantID, "tenant-not-a-member")
+			_, err := s.me.GetMe(ctx, req)
+			return expectCode(err, connect.CodePermissionDenied)
+		},
+	},
+	{
+		name: "Routing/internal-only procedure is denied",
+		run: func(ctx context.Context, s *suite) error {
+			_, err := s.workspaceUser.GetWorkspaceUser(ctx, authorize(connect.NewRequest(&identityv1.GetWorkspaceUserRequest{}), s.token(user01, nil)))
+			return expectCode(err, connect.CodePermissionDenied)
+		},
+	},
+	{
+		name: "Routing/method other than GET and POST is not allowed",
+		run: func(ctx context.Context, s *suite) error {
+			url := s.h.GatewayURL() + identityv1connect.UserServiceGetMeProcedure
+			req, err := http.NewRequestWithContext(ctx, "PROPFIND", url, nil)
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Authorization", "Bearer "+s.token(user01, nil))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusMethodNotAllowed {
+				return fmt.Errorf("expected 405, got %d", resp.StatusCode)
+			}
+			return nil
+		},
+	},
+	{
+		name: "Token/missing token is unauthenticated",
+		run:  getMeWithToken(func(s *suite) string { return "" }, connect.CodeUnauthenticated),
+	},
+	{
+		name: "Token/expired token is unauthenticated",
+		run: getMeWithToken(func(s *suite) string {
+			past := time.Now().Add(-time.Hour)
+			return s.token(user01, map[string]any{"iat": past.Add(-time.Hour).Unix(), "exp": past.Unix()})
+		}, connect.CodeUnauthenticated),
+	},
+	{
+		name: "Token/not yet valid token is unauthenticated",
+		run: getMeWithToken(func(s *suite) string {
+			return s.token(user01, map[string]any{"nbf": time.Now().Add(time.Hour).Unix()})
+		}, connect.CodeUnauthenticated),
+	},
+	{
+		name: "Token/wrong audience is unauthenticated",
+		run: getMeWithToken(func(s *suite) string {
+			return s.token(user01, map[string]any{"aud": "https://other-api.example.com"})
+		}, connect.CodeUnauthenticated),
+	},
+	{
+		name: "Token/wrong issuer is unauthenticated",
+		run: getMeWithToken(func(s *suite) string {
+			return s.token(user01, map[string]any{"iss": "https://attacker.example.com/"})
+		}, connect.CodeUnauthenticated),
+	},
+	{
+		name: "Token/tampered payload is unauthenticated",
+		run: getMeWithToken(func(s *suite) string {
+			parts := strings.Split(s.token(user01, nil), ".")
+			other := strings.Split(s.token(user02, nil), ".")
+			return parts[0] + "." + other[1] + "." + parts[2]
+		}, connect.CodeUnauthenticated),
+	},
+	{
+		name: "Token/signed by an untrusted key is unauthenticated",
+		run: getMeWithToken(func(s *suite) string {
+			// 同じ発行者を名乗る別の鍵で署名する
+			other, err := fakeidp.New(s.h.IdP.Issuer())
+			if err != nil {
+				panic(err)
+			}
+			token, err := other.Mint(map[string]any{"sub": user01, "aud": harness.Audience, "azp": harness.ClientID})
+			if err != nil {
+				panic(err)
+			}
+			return token
+		}, connect.CodeUnauthenticated),
+	},
+	{
+		name: "Token/expired within the clock skew leeway is accepted",
+		run: getMeAcceptsToken(func(s *suite) string {
+			now := time.Now()
+			return s.token(user01, map[string]any{"iat": now.Add(-time.Hour).Unix(), "exp": now.Add(-5 * time.Second).Unix()})
+		}),
+	},
+	{
+		name: "Token/missing exp is unauthenticated",
+		run: getMeWithToken(func(s *suite) string {
+			return s.token(user01, map[string]any{"exp": nil})
+		}, connect.CodeUnauthenticated),
+	},
+	{
+		name: "Token/missing iat is unauthenticated",
+		run: getMeWithToken(func(s *suite) string {
+			return s.token(user01, map[string]any{"iat": nil})
+		}, connect.CodeUnauthenticated),
+	},
+	{
+		name: "Token/iat in the future is unauthenticated",
+		run: getMeWithToken(func(s *suite) string {
+			return s.token(user01, map[string]any{"iat": time.Now().Add(time.Hour).Unix()})
+		}, connect.CodeUnauthenticated),
+	},
+	{
+		name: "Token/lifetime over the maximum is unauthenticated",
+		run: getMeWithToken(func(s *suite) string {
+			now := time.Now()
+			return s.token(user01, map[string]any{"iat": now.Unix(), "exp": now.Add(30 * 24 * time.Hour).Unix()})
+		}, connect.CodeUnauthenticated),
+	},
+	{
+		name: "Token/unapproved client is unauthenticated",
+		run: getMeWithToken(func(s *suite) string {
+			return s.token(user01, map[string]any{"azp": "unapproved-client"})
+		}, connect.CodeUnauthenticated),
+	},
+	{
+		name: "Token/missing azp is unauthenticated",
+		run: getMeWithToken(func(s *suite) string {
+			return s.token(user01, map[string]any{"azp": nil})
+		}, connect.CodeUnauthenticated),
+	},
+	{
+		name: "Token/approved client_id without azp is accepted",
+		run: getMeAcceptsToken(func(s *suite) string {
+			return s.token(user01, map[string]any{"azp": nil, "client_id": harness.ClientID})
+		}),
+	},
+	{
+		name: "Token/alg none is unauthenticated",
+		run: getMeWithToken(func(s *suite) string {
+			parts := strings.Split(s.token(user01, nil), ".")
+			return "eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0." + parts[1] + "."
+		}, connect.CodeUnauthenticated),
+	},
+}
@@ -0,0 +1,71 @@
+package e2e
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// dpopKey はクライアントがDPoPプルーフ（RFC 9449）に署名する鍵
+type dpopKey struct {
+	key *ecdsa.PrivateKey
+	jwk map[string]string
+}
+
+// newDPoPKey はP-256の鍵を生成する（失敗した場合はpanicする）
+func newDPoPKey() *dpopKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	b, err := key.PublicKey.Bytes()
+	if err != nil {
+		panic(err)
+	}
+	return &dpopKey{key: key, jwk: map[string]string{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(b[1:33]),
+		"y":   base64.RawURLEncoding.EncodeToString(b[33:]),
+	}}
+}
+
+// thumbprint はアクセストークンのcnf.jktに設定するJWK SHA-256 Thumbprint（RFC 7638）を返す
+func (k *dpopKey) thumbprint() string {
+	b, err := json.Marshal(k.jwk)
+	if err != nil {
+		panic(err)
+	}
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// confirmation は鍵に結び付けるトークンに追加するcnfクレームを返す
+func (k *dpopKey) confirmation() map[string]any {
+	return map[string]any{"cnf": map[string]string{"jkt": k.thumbprint()}}
+}
+
+// proof はアクセストークンを使用するリクエストのメソッドとURLに対するDPoPプルーフを返す
+func (k *dpopKey) proof(method, url, token string) string {
+	ath := sha256.Sum256([]byte(token))
+	proof := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"jti": rand.Text(),
+		"htm": method,
+		"htu": url,
+		"iat": time.Now().Unix(),
+		"ath": base64.RawURLEncoding.EncodeToString(ath[:]),
+	})
+	proof.Header["typ"] = "dpop+jwt"
+	proof.Header["jwk"] = k.jwk
+	signed, err := proof.SignedString(k.key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
@@ -0,0 +1,77 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kakke18/platform-security-poc/backend/e2e/harness"
+)
+
+// seedFile は統合テストのシードデータ
+const seedFile = "seed.yaml"
+
+// routesFile はUpdateMeにステップアップ認証を要求するルーティングテーブル
+const routesFile = "routes.yaml"
+
+// TestE2E はGateway・Identity API・User APIを偽のIdPとともにプロセス内で起動し、全てのケースを実行する
+// サービスのログは-vの場合は標準エラー出力に、それ以外は失敗した場合にのみ出力する
+func TestE2E(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration tests in short mode")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	logs := &syncBuffer{}
+	var output io.Writer = logs
+	if testing.Verbose() {
+		output = os.Stderr
+	}
+	h, err := harness.Start(ctx, harness.Options{
+		SeedFile:    seedFile,
+		RoutesFile:  routesFile,
+		GatewayArgs: []string{"-dpop.required-workspace-ids=" + dpopWorkspaceID},
+		Output:      output,
+	})
+	if err != nil {
+		t.Fatalf("failed to start services: %v\n%s", err, logs)
+	}
+	t.Cleanup(func() {
+		h.Close()
+		if t.Failed() && !testing.Verbose() {
+			t.Logf("service logs:\n%s", logs)
+		}
+	})
+
+	s := newSuite(h)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.run(ctx, s); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// syncBuffer は複数のゴルーチンから書き込まれるサービスのログを保持する
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
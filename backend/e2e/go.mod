@@ -0,0 +1,65 @@
+module github.com/kakke18/platform-security-poc/backend/e2e
+
+go 1.25.5
+
+replace github.com/kakke18/platform-security-poc/backend/gateway => ../gateway
+
+replace github.com/kakke18/platform-security-poc/backend/gen => ../gen
+
+replace github.com/kakke18/platform-security-poc/backend/identity => ../identity
+
+replace github.com/kakke18/platform-security-poc/backend/platform => ../platform
+
+replace github.com/kakke18/platform-security-poc/backend/user => ../user
+
+require (
+	connectrpc.com/connect v1.19.1
+	github.com/golang-jwt/jwt/v5 v5.3.0
+	github.com/kakke18/platform-security-poc/backend/gateway v0.0.0-00010101000000-000000000000
+	github.com/kakke18/platform-security-poc/backend/gen v0.0.0-00010101000000-000000000000
+	github.com/kakke18/platform-security-poc/backend/identity v0.0.0-00010101000000-000000000000
+	github.com/kakke18/platform-security-poc/backend/platform v0.0.0-00010101000000-000000000000
+	github.com/kakke18/platform-security-poc/backend/user v0.0.0-00010101000000-000000000000
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260526163538-3dc84a4a5aaa
+)
+
+require (
+	connectrpc.com/grpchealth v1.4.0 // indirect
+	connectrpc.com/otelconnect v0.9.0 // indirect
+	github.com/BurntSushi/toml v1.6.0 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cenkalti/backoff/v5 v5.0.3 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/felixge/httpsnoop v1.0.4 // indirect
+	github.com/fsnotify/fsnotify v1.9.0 // indirect
+	github.com/go-logr/logr v1.4.3 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/grpc-ecosystem/grpc-gateway/v2 v2.29.0 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_golang v1.23.2 // indirect
+	github.com/prometheus/client_model v0.6.2 // indirect
+	github.com/prometheus/common v0.66.1 // indirect
+	github.com/prometheus/procfs v0.16.1 // indirect
+	github.com/rs/cors v1.11.1 // indirect
+	go.opentelemetry.io/auto/sdk v1.2.1 // indirect
+	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.69.0 // indirect
+	go.opentelemetry.io/otel v1.44.0 // indirect
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace v1.44.0 // indirect
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.44.0 // indirect
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.44.0 // indirect
+	go.opentelemetry.io/otel/metric v1.44.0 // indirect
+	go.opentelemetry.io/otel/sdk v1.44.0 // indirect
+	go.opentelemetry.io/otel/trace v1.44.0 // indirect
+	go.opentelemetry.io/proto/otlp v1.10.0 // indirect
+	go.yaml.in/yaml/v2 v2.4.2 // indirect
+	golang.org/x/net v0.55.0 // indirect
+	golang.org/x/sync v0.20.0 // indirect
+	golang.org/x/sys v0.45.0 // indirect
+	golang.org/x/text v0.37.0 // indirect
+	golang.org/x/time v0.9.0 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20260526163538-3dc84a4a5aaa // indirect
+	google.golang.org/grpc v1.81.1 // indirect
+	google.golang.org/protobuf v1.36.11 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,311 @@
+// Package harness はGateway・Identity API・User APIをローカルの偽のIdPとともにプロセス内で起動する
+// Auth0やネットワークに接続せずにサービス間の統合テストを実行するために使用する
+package harness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	gatewayapp "github.com/kakke18/platform-security-poc/backend/gateway/app"
+	identityapp "github.com/kakke18/platform-security-poc/backend/identity/app"
+	"github.com/kakke18/platform-security-poc/backend/platform/fakeidp"
+	userapp "github.com/kakke18/platform-security-poc/backend/user/app"
+)
+
+// Audience はGatewayが受け付けるトークンのオーディエンス
+const Audience = "https://e2e.platform-security-poc.local"
+
+// ClientID はGatewayが受け付けるトークンのクライアント（azp）
+const ClientID = "e2e-frontend"
+
+// DPoPClientID はGatewayが受け付け、DPoPで送信者制約されたトークンを必須とするクライアント（azp）
+const DPoPClientID = "e2e-dpop"
+
+// PartnerClientID はGatewayが受け付ける、opaqueトークンを使用するクライアント（client_id）
+const PartnerClientID = "e2e-partner"
+
+// eventsSecret はGatewayとIdentity API・User APIが共有する変更イベントのシークレット
+const eventsSecret = "e2e-events-secret"
+
+// readyTimeout はサービスがレディになるまで待機する上限時間
+const readyTimeout = 30 * time.Second
+
+// shutdownTimeout はサービスのグレースフルシャットダウンを待機する上限時間
+const shutdownTimeout = 10 * time.Second
+
+// Options はハーネスの起動オプション
+type Options struct {
+	// SeedFile はIdentity API・User APIに登録するシードデータのパス
+	// 空の場合は各サービスに組み込みのシードデータを使用する
+	SeedFile string
+
+	// RoutesFile はGatewayのルーティングテーブルのパス
+	// 空の場合はGatewayのデフォルトのルーティングテーブルを使用する
+	RoutesFile string
+
+	// GatewayArgs はGatewayに追加で渡すコマンドラインフラグ（例: -dpop.required-workspace-ids=ws-003）
+	GatewayArgs []string
+
+	// Output はサービスのログの出力先（nilの場合は出力しない）
+	// サービスはプロセス全体のデフォルトのロガーに出力するため、起動中はslogのデフォルトを差し替える
+	Output io.Writer
+}
+
+// startFunc は待ち受け済みのリスナーでサービスを起動する関数
+type startFunc func(args []string, ln, adminLn net.Listener) (server, error)
+
+// server は起動したサービス
+type server interface {
+	Done() <-chan error
+	Shutdown(ctx context.Context) error
+}
+
+// service はハーネスが起動するサービス
+type service struct {
+	name    string
+	ln      net.Listener
+	adminLn net.Listener
+	server  server
+}
+
+// url は公開ポートのURLを返す
+func (s *service) url() string {
+	return "http://" + s.ln.Addr().String()
+}
+
+// adminURL は管理ポートのURLを返す
+func (s *service) adminURL() string {
+	return "http://" + s.adminLn.Addr().String()
+}
+
+// Harness は起動したサービス群
+type Harness struct {
+	// IdP はGatewayが信頼する偽のOIDCプロバイダー
+	IdP *fakeidp.IdP
+
+	services      []*service
+	defaultLogger *slog.Logger
+}
+
+// Start は偽のIdPとサービスを起動し、レディになるまで待機する
+// 全てのサービスのリスナーを先に作成するため、サービス間で互いのアドレスを設定できる
+func Start(ctx context.Context, opts Options) (_ *Harness, err error) {
+	output := opts.Output
+	if output == nil {
+		output = io.Discard
+	}
+	h := &Harness{defaultLogger: slog.Default()}
+	slog.SetDefault(slog.New(slog.NewTextHandler(output, nil)))
+	defer func() {
+		if err != nil {
+			h.Close()
+		}
+	}()
+
+	if h.IdP, err = fakeidp.Start(); err != nil {
+		return nil, err
+	}
+
+	identity, err := h.listen("identity")
+	if err != nil {
+		return nil, err
+	}
+	user, err := h.listen("user")
+	if err != nil {
+		return nil, err
+	}
+	gateway, err := h.listen("gateway")
+	if err != nil {
+		return nil, err
+	}
+
+	var seedArgs []string
+	if opts.SeedFile != "" {
+		seedArgs = []string{"-seed-file=" + opts.SeedFile}
+	}
+	var routesArgs []string
+	if opts.RoutesFile != "" {
+		routesArgs = []string{"-routes-file=" + opts.RoutesFile}
+	}
+
+	eventsArgs := []string{"-events-url=" + gateway.adminURL() + "/internal/events", "-events-secret=" + eventsSecret}
+	if err := h.start(identity, adapt(identityapp.Start), slices.Concat(eventsArgs, seedArgs)); err != nil {
+		return nil, err
+	}
+	if err := h.start(user, adapt(userapp.Start), slices.Concat(eventsArgs, seedArgs)); err != nil {
+		return nil, err
+	}
+	if err := h.start(gateway, adapt(gatewayapp.Start), slices.Concat([]string{
+		"-identity-api-url=" + identity.url(),
+		"-user-api-url=" + user.url(),
+		"-auth0-issuer=" + h.IdP.Issuer(),
+		"-auth0-audience=" + Audience,
+		"-jwt-allowed-client-ids=" + ClientID + "," + DPoPClientID + "," + PartnerClientID,
+		"-dpop.required-client-ids=" + DPoPClientID,
+		"-dpop.public-origin=" + gateway.url(),
+		"-introspection.endpoint=" + h.IdP.Issuer() + "oauth/introspect",
+		"-introspection.client-id=" + fakeidp.IntrospectionClientID,
+		"-introspection.client-secret=" + fakeidp.IntrospectionClientSecret,
+		"-cors.allowed-origins=http://localhost:3000",
+		"-events-secret=" + eventsSecret,
+	}, routesArgs, opts.GatewayArgs)); err != nil {
+		return nil, err
+	}
+
+	for _, s := range h.services {
+		if err := s.waitReady(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// adapt は各サービスのappパッケージのStartをstartFuncに変換する
+func adapt[S server](start func(args []string, ln, adminLn net.Listener) (S, error)) startFunc {
+	return func(args []string, ln, adminLn net.Listener) (server, error) {
+		return start(args, ln, adminLn)
+	}
+}
+
+// GatewayURL はGatewayの公開ポートのURLを返す
+func (h *Harness) GatewayURL() string {
+	return h.service("gateway").url()
+}
+
+// ServiceURL は指定されたサービス（identity・user・gateway）の公開ポートのURLを返す
+// Gatewayを経由しない直接のアクセスを検証する場合に使用する
+func (h *Harness) ServiceURL(name string) string {
+	return h.service(name).url()
+}
+
+// Token は指定されたユーザーのGateway向けのトークンを発行する
+// extraで任意のクレームを追加・上書きでき、値がnilのクレームは削除する
+func (h *Harness) Token(subject string, extra map[string]any) (string, error) {
+	claims := map[string]any{
+		"sub": subject,
+		"aud": Audience,
+		"azp": ClientID,
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	return h.IdP.Mint(claims)
+}
+
+// OpaqueToken は指定されたユーザーのGateway向けのopaqueトークンをPartnerClientIDに発行する
+// extraで任意のクレームを追加・上書きでき、値がnilのクレームは削除する
+func (h *Harness) OpaqueToken(subject string, extra map[string]any) string {
+	claims := map[string]any{
+		"sub":       subject,
+		"aud":       Audience,
+		"client_id": PartnerClientID,
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	return h.IdP.MintOpaque(claims)
+}
+
+// Close は全てのサービスと偽のIdPを停止し、slogのデフォルトを元に戻す
+func (h *Harness) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for i := len(h.services) - 1; i >= 0; i-- {
+		s := h.services[i]
+		if s.server != nil {
+			_ = s.server.Shutdown(ctx)
+		}
+		// 起動前に失敗した場合もリスナーを閉じる（起動後はShutdownで閉じられている）
+		s.ln.Close()
+		s.adminLn.Close()
+	}
+	if h.IdP != nil {
+		h.IdP.Close()
+	}
+	slog.SetDefault(h.defaultLogger)
+}
+
+// service は名前に対応する起動済みのサービスを返す
+func (h *Harness) service(name string) *service {
+	for _, s := range h.services {
+		if s.name == name {
+			return s
+		}
+	}
+	panic("harness: unknown service " + name)
+}
+
+// listen はサービスの公開ポートと管理ポートのリスナーを作成する
+// サービスを起動するまで接続はキューに保持されるため、ポートを解放して再利用する競合は起きない
+func (h *Harness) listen(name string) (*service, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for %s: %w", name, err)
+	}
+	adminLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to listen for %s admin: %w", name, err)
+	}
+	s := &service{name: name, ln: ln, adminLn: adminLn}
+	h.services = append(h.services, s)
+	return s, nil
+}
+
+// start はサービスを起動する
+// 引数は共通の設定、サービスごとの設定の順で渡し、後の値で上書きする
+func (h *Harness) start(s *service, start startFunc, args []string) error {
+	srv, err := start(slices.Concat([]string{
+		"-port=" + port(s.ln),
+		"-admin-port=" + port(s.adminLn),
+		"-trusted-proxies=127.0.0.1/32,::1/128",
+	}, args), s.ln, s.adminLn)
+	if err != nil {
+		return fmt.Errorf("failed to start %s: %w", s.name, err)
+	}
+	s.server = srv
+	return nil
+}
+
+// port はリスナーのポート番号を返す
+func port(ln net.Listener) string {
+	return fmt.Sprint(ln.Addr().(*net.TCPAddr).Port)
+}
+
+// waitReady は管理ポートの/readyzが成功するまで待機する
+func (s *service) waitReady(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+
+	url := s.adminURL() + "/readyz"
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+
+		select {
+		case err := <-s.server.Done():
+			if err == nil {
+				err = errors.New("server closed")
+			}
+			return fmt.Errorf("%s stopped before becoming ready: %w", s.name, err)
+		case <-ctx.Done():
+			return fmt.Errorf("%s did not become ready: %w", s.name, ctx.Err())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
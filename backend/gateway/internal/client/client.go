@@ -0,0 +1,77 @@
+package client
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/kakke18/platform-security-poc/backend/gateway/internal/config"
+	"github.com/kakke18/platform-security-poc/backend/gateway/internal/resilience"
+	"github.com/kakke18/platform-security-poc/backend/gen/identity/v1/identityv1connect"
+	"github.com/kakke18/platform-security-poc/backend/gen/user/v1/userv1connect"
+	"github.com/kakke18/platform-security-poc/backend/platform/metrics"
+	"github.com/kakke18/platform-security-poc/backend/platform/requestid"
+	"github.com/kakke18/platform-security-poc/backend/platform/telemetry"
+	"golang.org/x/net/http2"
+)
+
+// Clients はGatewayから呼び出すバックエンドサービスのクライアント群
+type Clients struct {
+	// WorkspaceUser はIdentity APIのWorkspaceUserServiceクライアント
+	WorkspaceUser identityv1connect.WorkspaceUserServiceClient
+
+	// TenantUser はUser APIのTenantUserServiceクライアント
+	TenantUser userv1connect.TenantUserServiceClient
+}
+
+// New はバックエンドサービスのクライアント群を作成する
+// gRPCプロトコル（HTTP/2 over cleartext）を使用してバックエンドサービスと通信
+// バックエンドごとにデッドライン、リトライ、サーキットブレーカーを設定する
+func New(cfg *config.Config) *Clients {
+	h2cClient := NewH2CClient()
+
+	return &Clients{
+		WorkspaceUser: identityv1connect.NewWorkspaceUserServiceClient(
+			h2cClient,
+			cfg.IdentityAPIURL,
+			connect.WithGRPC(), // gRPCプロトコルを使用
+			connect.WithInterceptors(telemetry.Interceptor(), requestid.NewClientInterceptor()),
+			resilienceInterceptors("identity", cfg.IdentityAPITimeout, cfg),
+		),
+		TenantUser: userv1connect.NewTenantUserServiceClient(
+			h2cClient,
+			cfg.UserAPIURL,
+			connect.WithGRPC(), // gRPCプロトコルを使用
+			connect.WithInterceptors(telemetry.Interceptor(), requestid.NewClientInterceptor()),
+			resilienceInterceptors("user", cfg.UserAPITimeout, cfg),
+		),
+	}
+}
+
+// resilienceInterceptors はバックエンド呼び出し用のインターセプターを構築する
+// CircuitBreaker -> Timeout -> Retry -> Metrics の順に適用し、ブレーカーはリトライを含めた最終結果で判定する
+// メトリクスはリトライの内側で記録し、バックエンドへの個々の呼び出しの所要時間を計測する
+func resilienceInterceptors(name string, timeout time.Duration, cfg *config.Config) connect.ClientOption {
+	return connect.WithInterceptors(
+		resilience.NewCircuitBreaker(name, cfg.BreakerThreshold, cfg.BreakerOpenDuration),
+		resilience.NewTimeoutInterceptor(timeout),
+		resilience.NewRetryInterceptor(cfg.BackendMaxRetries),
+		metrics.NewInterceptor(),
+	)
+}
+
+// NewH2CClient はHTTP/2クライアントを作成する（h2c: HTTP/2 Cleartext）
+func NewH2CClient() *http.Client {
+	return &http.Client{
+		Transport: &http2.Transport{
+			// h2c (HTTP/2 without TLS) を許可
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				// TLSダイヤルの代わりに通常のダイヤルを使用
+				return net.Dial(network, addr)
+			},
+		},
+	}
+}
@@ -2,65 +2,475 @@ package config
 
 import (
 	"fmt"
-	"os"
-)
+	"net/url"
+	"strings"
+	"time"
 
-const (
-	defaultIdentityAPIURL = "http://localhost:8081"
-	defaultUserAPIURL     = "http://localhost:8082"
-	defaultPort           = "8080"
+	"github.com/kakke18/platform-security-poc/backend/platform/clientip"
+	"github.com/kakke18/platform-security-poc/backend/platform/conf"
+	"github.com/kakke18/platform-security-poc/backend/platform/logging"
+	platformmiddleware "github.com/kakke18/platform-security-poc/backend/platform/middleware"
+	"github.com/kakke18/platform-security-poc/backend/platform/requestid"
+	"github.com/kakke18/platform-security-poc/backend/platform/telemetry"
+	"github.com/kakke18/platform-security-poc/backend/platform/tenantctx"
 )
 
 // Config はアプリケーション設定を保持する
+// 設定ファイル（-config・CONFIG_FILE）、環境変数、コマンドラインフラグの順で上書きする
 type Config struct {
 	// IdentityAPIURL はIdentity APIのベースURL
-	IdentityAPIURL string
+	IdentityAPIURL string `yaml:"identity_api_url" env:"IDENTITY_API_URL" usage:"Identity APIのベースURL"`
 
 	// UserAPIURL はUser APIのベースURL
-	UserAPIURL string
+	UserAPIURL string `yaml:"user_api_url" env:"USER_API_URL" usage:"User APIのベースURL"`
 
 	// Port はサーバーのポート番号
-	Port string
+	Port string `yaml:"port" env:"PORT" usage:"公開ポート"`
+
+	// AdminPort は内部向け管理エンドポイント（イベント受信、メトリクス）のポート番号
+	// 公開ポートとは分離し、外部からは到達できないネットワークで使用する
+	AdminPort string `yaml:"admin_port" env:"ADMIN_PORT" usage:"管理ポート"`
+
+	// EventsSecret はIdentity API・User APIと共有する、変更イベントの受信に必要なシークレット（EVENTS_SECRET_FILEでファイルから読み込める）
+	// 未設定の場合はイベントを受信せず、GetMeキャッシュは有効期間（get_me_cache_ttl）でのみ更新される
+	EventsSecret string `yaml:"events_secret" env:"EVENTS_SECRET" secret:"true" usage:"変更イベントの送信元と共有するシークレット（未設定の場合は受信しない）"`
 
 	// Auth0Domain はAuth0のドメイン
-	Auth0Domain string
+	Auth0Domain string `yaml:"auth0_domain" env:"AUTH0_DOMAIN" usage:"Auth0のドメイン"`
+
+	// Auth0Issuer はトークンの発行者（末尾のスラッシュを含む）。JWKSは<発行者>.well-known/jwks.jsonから取得する
+	// 未設定の場合はhttps://<Auth0Domain>/を使用する（ローカルの偽のIdPを使用する場合に指定する）
+	Auth0Issuer string `yaml:"auth0_issuer" env:"AUTH0_ISSUER" usage:"トークンの発行者（未設定の場合はhttps://<auth0_domain>/）"`
 
 	// Auth0Audience はAuth0のオーディエンス
-	Auth0Audience string
+	Auth0Audience string `yaml:"auth0_audience" env:"AUTH0_AUDIENCE" usage:"Auth0のオーディエンス"`
+
+	// RevokedKeyIDs は失効させる署名鍵のkid（JWKSに含まれていても拒否する）
+	RevokedKeyIDs []string `yaml:"revoked_key_ids" env:"JWT_REVOKED_KEY_IDS" usage:"失効させる署名鍵のkid（カンマ区切り）"`
+
+	// JWTLeeway はexp・nbf・iatの検証で許容する時計のずれ
+	JWTLeeway time.Duration `yaml:"jwt_leeway" env:"JWT_LEEWAY" usage:"exp・nbf・iatの検証で許容する時計のずれ"`
+
+	// JWTMaxTokenLifetime はトークンのiatからexpまでの期間の上限（デフォルトはAuth0のアクセストークンの有効期間と同じ24時間）
+	JWTMaxTokenLifetime time.Duration `yaml:"jwt_max_token_lifetime" env:"JWT_MAX_TOKEN_LIFETIME" usage:"トークンのiatからexpまでの期間の上限"`
+
+	// JWTAllowedClientIDs はトークンのazp（ない場合はclient_id）として受け入れるクライアントID
+	// フロントエンドのアプリケーション（Terraformのfrontend_client_id）と承認したM2Mクライアントを指定する（必須）
+	JWTAllowedClientIDs []string `yaml:"jwt_allowed_client_ids" env:"JWT_ALLOWED_CLIENT_IDS" usage:"トークンのazp・client_idとして受け入れるクライアントID（カンマ区切り、必須）"`
+
+	// DPoP はDPoP（RFC 9449）で送信者制約されたトークンの設定
+	DPoP DPoP `yaml:"dpop"`
+
+	// Introspection はJWTではないトークン（opaqueトークン）をトークンイントロスペクションで検証する設定
+	Introspection Introspection `yaml:"introspection"`
+
+	// IdentityAPITimeout はIdentity API呼び出しのデッドライン（リトライを含む）
+	IdentityAPITimeout time.Duration `yaml:"identity_api_timeout" env:"IDENTITY_API_TIMEOUT" usage:"Identity API呼び出しのデッドライン"`
+
+	// UserAPITimeout はUser API呼び出しのデッドライン（リトライを含む）
+	UserAPITimeout time.Duration `yaml:"user_api_timeout" env:"USER_API_TIMEOUT" usage:"User API呼び出しのデッドライン"`
+
+	// BackendMaxRetries は冪等なバックエンド呼び出しのリトライ回数
+	BackendMaxRetries int `yaml:"backend_max_retries" env:"BACKEND_MAX_RETRIES" usage:"冪等なバックエンド呼び出しのリトライ回数"`
+
+	// BreakerThreshold はバックエンドごとのサーキットブレーカーを開くまでの連続失敗回数
+	BreakerThreshold int `yaml:"breaker_threshold" env:"BREAKER_THRESHOLD" usage:"サーキットブレーカーを開くまでの連続失敗回数"`
+
+	// BreakerOpenDuration はサーキットブレーカーが呼び出しを遮断する期間
+	BreakerOpenDuration time.Duration `yaml:"breaker_open_duration" env:"BREAKER_OPEN_DURATION" usage:"サーキットブレーカーが呼び出しを遮断する期間"`
+
+	// GetMePartialResponse はUser APIの障害時にGetMeで部分応答を返すかどうか
+	GetMePartialResponse bool `yaml:"get_me_partial_response" env:"GET_ME_PARTIAL_RESPONSE" usage:"User APIの障害時にGetMeで部分応答を返す"`
+
+	// GetMeCacheTTL はGetMeレスポンスをキャッシュする期間（0の場合はキャッシュしない）
+	GetMeCacheTTL time.Duration `yaml:"get_me_cache_ttl" env:"GET_ME_CACHE_TTL" usage:"GetMeレスポンスのキャッシュ期間（0で無効）"`
+
+	// GetMeCacheSize はGetMeレスポンスをキャッシュするユーザーの数の上限（上限に達した場合は最も長く参照されていないものから削除する）
+	GetMeCacheSize int `yaml:"get_me_cache_size" env:"GET_ME_CACHE_SIZE" usage:"GetMeレスポンスをキャッシュするユーザーの数の上限"`
+
+	// RequestTimeout はリクエスト全体の処理に設定するデッドライン
+	RequestTimeout time.Duration `yaml:"request_timeout" env:"REQUEST_TIMEOUT" usage:"リクエスト全体のデッドライン"`
+
+	// TrustedProxies はX-Forwarded-For・Forwarded・PROXYプロトコルを信頼するプロキシのアドレス範囲
+	// 未設定の場合は接続元のアドレスをクライアントIPとする
+	TrustedProxies clientip.Prefixes `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" usage:"転送ヘッダーを信頼するプロキシのCIDR（カンマ区切り）"`
+
+	// ForwardedHeader は信頼するプロキシがクライアントのアドレスを付与する転送ヘッダー
+	// もう一方のヘッダーはクライアントが偽装できるため読まない
+	ForwardedHeader clientip.Header `yaml:"forwarded_header" env:"FORWARDED_HEADER" usage:"クライアントのアドレスを読む転送ヘッダー（x-forwarded-for・forwarded）"`
+
+	// ProxyProtocol は公開ポートでPROXYプロトコル（v1・v2）のヘッダーを受け付けるかどうか
+	ProxyProtocol bool `yaml:"proxy_protocol" env:"PROXY_PROTOCOL" usage:"公開ポートでPROXYプロトコルを受け付ける"`
+
+	// RoutesFile はリバースプロキシのルーティングテーブル（YAML・TOML）のパス
+	// 未設定の場合はデフォルトのルーティングテーブルを使用する
+	RoutesFile string `yaml:"routes_file" env:"ROUTES_FILE" usage:"ルーティングテーブル（YAML・TOML）のパス"`
+
+	// CORS はブラウザからのクロスオリジンリクエストの設定
+	CORS CORS `yaml:"cors"`
+
+	// Server はタイムアウトとリクエストサイズの上限
+	// ルートごとのボディサイズの上限はルーティングテーブル（max_body_bytes）で指定する
+	Server conf.Server `yaml:"server"`
+
+	// SecurityHeaders はブラウザ向けのセキュリティヘッダーの設定
+	SecurityHeaders platformmiddleware.SecurityHeadersConfig `yaml:"security_headers"`
+
+	// TLS は公開ポートのTLS設定
+	TLS conf.TLS `yaml:"tls"`
+
+	// RateLimit は公開ポートのクライアントIPごとのレート制限
+	RateLimit conf.RateLimit `yaml:"rate_limit"`
+
+	// Logging はログ出力の設定
+	Logging logging.Config `yaml:"logging"`
+
+	// Tracing はトレースの設定
+	Tracing telemetry.Config `yaml:"tracing"`
+}
+
+// DPoP はDPoPで送信者制約されたトークンの設定
+// cnf.jktを含むトークンは常にDPoPプルーフを検証し、required_client_ids・required_workspace_idsに該当するBearerトークンを拒否する
+type DPoP struct {
+	// RequiredClientIDs はDPoPを必須とするクライアント（azp・client_id）
+	RequiredClientIDs []string `yaml:"required_client_ids" env:"DPOP_REQUIRED_CLIENT_IDS" usage:"DPoPを必須とするクライアントID（カンマ区切り）"`
+
+	// RequiredWorkspaceIDs はDPoPを必須とするワークスペース
+	// 送信者制約されていないトークンごとにIdentity APIでワークスペースを解決する
+	RequiredWorkspaceIDs []string `yaml:"required_workspace_ids" env:"DPOP_REQUIRED_WORKSPACE_IDS" usage:"DPoPを必須とするワークスペースID（カンマ区切り）"`
+
+	// ProofMaxAge はDPoPプルーフのiatからの有効期間
+	ProofMaxAge time.Duration `yaml:"proof_max_age" env:"DPOP_PROOF_MAX_AGE" usage:"DPoPプルーフのiatからの有効期間"`
+
+	// PublicOrigin はhtuの検証に使用するGatewayの公開オリジン
+	// TLSを終端するロードバランサーの背後で待ち受ける場合に指定する。未設定の場合はリクエストのHostと接続から判断する
+	PublicOrigin string `yaml:"public_origin" env:"DPOP_PUBLIC_ORIGIN" usage:"htuの検証に使用する公開オリジン（例: https://api.example.com）"`
+
+	// ReplayCacheSize はリプレイを検出するために記録するjtiの数の上限（上限に達した場合は新しいプルーフを拒否する）
+	ReplayCacheSize int `yaml:"replay_cache_size" env:"DPOP_REPLAY_CACHE_SIZE" usage:"記録するDPoPプルーフのjtiの数の上限"`
+
+	// ReplayCachePerKey は1つの鍵（jkt）で署名されたプルーフについて記録するjtiの数の上限
+	// 1つのクライアントがキャッシュを占有して他のクライアントのプルーフを拒否させることを防ぐ
+	ReplayCachePerKey int `yaml:"replay_cache_per_key" env:"DPOP_REPLAY_CACHE_PER_KEY" usage:"1つの鍵あたりに記録するDPoPプルーフのjtiの数の上限"`
+}
+
+// Introspection はトークンイントロスペクション（RFC 7662）の設定
+// endpointを指定した場合、JWS compact形式ではないトークンをエンドポイントに問い合わせ、JWTと同じオーディエンス・有効期間・クライアントの検証を適用する
+type Introspection struct {
+	// Endpoint はイントロスペクションエンドポイントのURL（未設定の場合はJWTのみを受け入れる）
+	Endpoint string `yaml:"endpoint" env:"INTROSPECTION_ENDPOINT" usage:"イントロスペクションエンドポイントのURL（未設定の場合はJWTのみ）"`
+
+	// ClientID はエンドポイントのクライアント認証に使用するクライアントID
+	ClientID string `yaml:"client_id" env:"INTROSPECTION_CLIENT_ID" usage:"イントロスペクションのクライアントID"`
+
+	// ClientSecret はエンドポイントのクライアント認証に使用するシークレット（INTROSPECTION_CLIENT_SECRET_FILEでファイルから読み込める）
+	ClientSecret string `yaml:"client_secret" env:"INTROSPECTION_CLIENT_SECRET" secret:"true" usage:"イントロスペクションのクライアントシークレット"`
+
+	// Timeout はエンドポイントの呼び出しのタイムアウト
+	Timeout time.Duration `yaml:"timeout" env:"INTROSPECTION_TIMEOUT" usage:"イントロスペクションのタイムアウト"`
+
+	// CacheTTL はactiveの結果をキャッシュする期間（トークンのexpを超えない、0の場合はキャッシュしない）
+	// 失効したトークンはこの期間だけ受け入れ続けるため短くする
+	CacheTTL time.Duration `yaml:"cache_ttl" env:"INTROSPECTION_CACHE_TTL" usage:"イントロスペクションの結果のキャッシュ期間（0で無効）"`
+
+	// CacheSize はキャッシュするトークンの数の上限
+	CacheSize int `yaml:"cache_size" env:"INTROSPECTION_CACHE_SIZE" usage:"イントロスペクションの結果をキャッシュするトークンの数の上限"`
+}
+
+// CORS はクロスオリジンリクエストの設定
+// allowed_originsのオリジンには共通の設定を適用し、originsでオリジンごとに個別の設定を指定できる
+type CORS struct {
+	// AllowedOrigins は共通の設定で許可するオリジン（スキーム・ホスト・ポート）
+	AllowedOrigins []string `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS" usage:"許可するオリジン（カンマ区切り）"`
+
+	// AllowedHeaders は許可するリクエストヘッダー（Connect・gRPC-Webのヘッダーに限定する）
+	AllowedHeaders []string `yaml:"allowed_headers" env:"CORS_ALLOWED_HEADERS" usage:"許可するリクエストヘッダー（カンマ区切り）"`
+
+	// ExposedHeaders はクライアントに公開するレスポンスヘッダー
+	ExposedHeaders []string `yaml:"exposed_headers" env:"CORS_EXPOSED_HEADERS" usage:"公開するレスポンスヘッダー（カンマ区切り）"`
+
+	// AllowCredentials はCookieなどの認証情報の送信を許可するかどうか
+	AllowCredentials bool `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS" usage:"認証情報の送信を許可する"`
+
+	// MaxAge はプリフライトリクエストの結果をキャッシュする期間
+	MaxAge time.Duration `yaml:"max_age" env:"CORS_MAX_AGE" usage:"プリフライトリクエストのキャッシュ期間"`
+
+	// Origins はオリジンごとの個別の設定（設定ファイルでのみ指定できる）
+	Origins []CORSOrigin `yaml:"origins"`
+}
+
+// CORSOrigin はオリジンごとのCORSの設定
+// ヘッダーの一覧を省略した場合は共通の設定を使用する
+type CORSOrigin struct {
+	// Origin は許可するオリジン
+	Origin string `yaml:"origin"`
+
+	// AllowedHeaders は許可するリクエストヘッダー
+	AllowedHeaders []string `yaml:"allowed_headers"`
+
+	// ExposedHeaders はクライアントに公開するレスポンスヘッダー
+	ExposedHeaders []string `yaml:"exposed_headers"`
+
+	// AllowCredentials はCookieなどの認証情報の送信を許可するかどうか
+	AllowCredentials bool `yaml:"allow_credentials"`
+}
+
+// maxJWTLeeway は許容する時計のずれの上限（大きすぎると期限切れのトークンを受け入れる）
+const maxJWTLeeway = 5 * time.Minute
+
+// maxDPoPProofMaxAge はDPoPプルーフの有効期間の上限（長すぎると漏えいしたプルーフを再利用できる期間が延びる）
+const maxDPoPProofMaxAge = 5 * time.Minute
+
+// maxIntrospectionCacheTTL はイントロスペクションの結果のキャッシュ期間の上限（長すぎると失効したトークンを受け入れ続ける）
+const maxIntrospectionCacheTTL = 5 * time.Minute
+
+// defaultConfig はデフォルト設定を返す
+func defaultConfig() *Config {
+	return &Config{
+		IdentityAPIURL:      "http://localhost:8081",
+		UserAPIURL:          "http://localhost:8082",
+		Port:                "8080",
+		AdminPort:           "9080",
+		IdentityAPITimeout:  3 * time.Second,
+		UserAPITimeout:      3 * time.Second,
+		BackendMaxRetries:   2,
+		BreakerThreshold:    5,
+		BreakerOpenDuration: 30 * time.Second,
+		GetMeCacheTTL:       30 * time.Second,
+		GetMeCacheSize:      10000,
+		JWTLeeway:           30 * time.Second,
+		JWTMaxTokenLifetime: 24 * time.Hour,
+		RequestTimeout:      30 * time.Second,
+		ForwardedHeader:     clientip.XForwardedFor,
+		DPoP: DPoP{
+			ProofMaxAge:       time.Minute,
+			ReplayCacheSize:   100000,
+			ReplayCachePerKey: 1000,
+		},
+		Introspection: Introspection{
+			Timeout:   3 * time.Second,
+			CacheTTL:  time.Minute,
+			CacheSize: 10000,
+		},
+		Server: conf.DefaultServer(),
+		CORS: CORS{
+			AllowedOrigins:   []string{"http://localhost:3000"},
+			AllowedHeaders:   defaultCORSAllowedHeaders(),
+			ExposedHeaders:   defaultCORSExposedHeaders(),
+			AllowCredentials: true,
+			MaxAge:           2 * time.Hour,
+		},
+		SecurityHeaders: platformmiddleware.DefaultSecurityHeadersConfig(),
+		Logging:         logging.DefaultConfig(),
+		Tracing:         telemetry.DefaultConfig("gateway"),
+	}
+}
+
+// Load は設定ファイル・環境変数・コマンドラインフラグから設定を読み込む
+// -print-configが指定された場合は有効な設定を出力してconf.ErrPrintedを返す
+func Load(args []string) (*Config, error) {
+	cfg := defaultConfig()
+	if err := conf.Load(cfg, args); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
 
-// Load は環境変数から設定を読み込む
-func Load() (*Config, error) {
-	identityAPIURL := os.Getenv("IDENTITY_API_URL")
-	if identityAPIURL == "" {
-		identityAPIURL = defaultIdentityAPIURL
+// Validate は設定の妥当性を検証し、全てのエラーをまとめて返す
+func (c *Config) Validate() error {
+	var errs conf.Errors
+	errs.URL("identity_api_url", c.IdentityAPIURL)
+	errs.URL("user_api_url", c.UserAPIURL)
+	errs.Port("port", c.Port)
+	errs.Port("admin_port", c.AdminPort)
+	if c.AdminPort == c.Port {
+		errs.Addf("admin_port", "must differ from port")
+	}
+	if c.Auth0Issuer == "" {
+		errs.Required("auth0_domain", c.Auth0Domain)
+	} else {
+		errs.URL("auth0_issuer", c.Auth0Issuer)
+		if !strings.HasSuffix(c.Auth0Issuer, "/") {
+			errs.Addf("auth0_issuer", "must end with a slash: %q", c.Auth0Issuer)
+		}
+	}
+	errs.Required("auth0_audience", c.Auth0Audience)
+	errs.NonNegative("jwt_leeway", c.JWTLeeway)
+	if c.JWTLeeway > maxJWTLeeway {
+		errs.Addf("jwt_leeway", "must be at most %s: %s", maxJWTLeeway, c.JWTLeeway)
+	}
+	errs.Positive("jwt_max_token_lifetime", c.JWTMaxTokenLifetime)
+	// 未設定の場合に発行者の全てのクライアントのトークンを受け入れないよう、必須とする
+	if len(c.JWTAllowedClientIDs) == 0 {
+		errs.Addf("jwt_allowed_client_ids", "is required")
+	}
+	for _, id := range c.JWTAllowedClientIDs {
+		if strings.TrimSpace(id) == "" {
+			errs.Addf("jwt_allowed_client_ids", "must not contain empty client IDs")
+		}
+	}
+	for _, id := range c.DPoP.RequiredClientIDs {
+		if strings.TrimSpace(id) == "" {
+			errs.Addf("dpop.required_client_ids", "must not contain empty client IDs")
+		}
+	}
+	for _, id := range c.DPoP.RequiredWorkspaceIDs {
+		if strings.TrimSpace(id) == "" {
+			errs.Addf("dpop.required_workspace_ids", "must not contain empty workspace IDs")
+		}
+	}
+	errs.Positive("dpop.proof_max_age", c.DPoP.ProofMaxAge)
+	if c.DPoP.ProofMaxAge > maxDPoPProofMaxAge {
+		errs.Addf("dpop.proof_max_age", "must be at most %s: %s", maxDPoPProofMaxAge, c.DPoP.ProofMaxAge)
+	}
+	// DPoPを必須とする場合、htuをクライアントが偽装できるHostヘッダーと比較しないよう公開オリジンを必須とする
+	if c.DPoP.PublicOrigin == "" && (len(c.DPoP.RequiredClientIDs) > 0 || len(c.DPoP.RequiredWorkspaceIDs) > 0) {
+		errs.Addf("dpop.public_origin", "is required when dpop.required_client_ids or dpop.required_workspace_ids is set")
+	}
+	if c.DPoP.PublicOrigin != "" {
+		if u, err := url.Parse(c.DPoP.PublicOrigin); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+			errs.Addf("dpop.public_origin", "must be an origin such as https://api.example.com: %q", c.DPoP.PublicOrigin)
+		}
+	}
+	if c.DPoP.ReplayCacheSize <= 0 {
+		errs.Addf("dpop.replay_cache_size", "must be positive: %d", c.DPoP.ReplayCacheSize)
+	}
+	if c.DPoP.ReplayCachePerKey <= 0 || c.DPoP.ReplayCachePerKey > c.DPoP.ReplayCacheSize {
+		errs.Addf("dpop.replay_cache_per_key", "must be between 1 and dpop.replay_cache_size: %d", c.DPoP.ReplayCachePerKey)
+	}
+	if c.Introspection.Endpoint != "" {
+		errs.URL("introspection.endpoint", c.Introspection.Endpoint)
+		errs.Required("introspection.client_id", c.Introspection.ClientID)
+		errs.Required("introspection.client_secret", c.Introspection.ClientSecret)
+	}
+	errs.Positive("introspection.timeout", c.Introspection.Timeout)
+	errs.NonNegative("introspection.cache_ttl", c.Introspection.CacheTTL)
+	if c.Introspection.CacheTTL > maxIntrospectionCacheTTL {
+		errs.Addf("introspection.cache_ttl", "must be at most %s: %s", maxIntrospectionCacheTTL, c.Introspection.CacheTTL)
+	}
+	if c.Introspection.CacheSize <= 0 {
+		errs.Addf("introspection.cache_size", "must be positive: %d", c.Introspection.CacheSize)
+	}
+	errs.Positive("identity_api_timeout", c.IdentityAPITimeout)
+	errs.Positive("user_api_timeout", c.UserAPITimeout)
+	if c.BackendMaxRetries < 0 {
+		errs.Addf("backend_max_retries", "must be non-negative: %d", c.BackendMaxRetries)
+	}
+	if c.BreakerThreshold <= 0 {
+		errs.Addf("breaker_threshold", "must be positive: %d", c.BreakerThreshold)
+	}
+	errs.Positive("breaker_open_duration", c.BreakerOpenDuration)
+	errs.NonNegative("get_me_cache_ttl", c.GetMeCacheTTL)
+	if c.GetMeCacheSize <= 0 {
+		errs.Addf("get_me_cache_size", "must be positive: %d", c.GetMeCacheSize)
+	}
+	errs.Positive("request_timeout", c.RequestTimeout)
+	if err := c.ForwardedHeader.Validate(); err != nil {
+		errs.Addf("forwarded_header", "%v", err)
+	}
+	errs.File("routes_file", c.RoutesFile)
+
+	seen := make(map[string]bool)
+	origin := func(key, origin string) {
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+			errs.Addf(key, "must be an origin such as https://app.example.com: %q", origin)
+		}
+		if seen[origin] {
+			errs.Addf(key, "duplicate origin: %q", origin)
+		}
+		seen[origin] = true
+	}
+	for _, o := range c.CORS.AllowedOrigins {
+		origin("cors.allowed_origins", o)
+	}
+	for _, o := range c.CORS.Origins {
+		origin("cors.origins", o.Origin)
+	}
+	errs.NonNegative("cors.max_age", c.CORS.MaxAge)
+	if err := c.SecurityHeaders.Validate(); err != nil {
+		errs.Addf("security_headers", "%v", err)
 	}
 
-	userAPIURL := os.Getenv("USER_API_URL")
-	if userAPIURL == "" {
-		userAPIURL = defaultUserAPIURL
+	errs.Server("server", c.Server)
+	errs.TLS("tls", c.TLS)
+	errs.RateLimit("rate_limit", c.RateLimit)
+	if err := c.Logging.Validate(); err != nil {
+		errs.Addf("logging", "%v", err)
+	}
+	if err := c.Tracing.Validate(); err != nil {
+		errs.Addf("tracing", "%v", err)
 	}
+	return errs.Err()
+}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = defaultPort
+// Issuer はトークンの発行者を返す
+func (c *Config) Issuer() string {
+	if c.Auth0Issuer != "" {
+		return c.Auth0Issuer
 	}
+	return fmt.Sprintf("https://%s/", c.Auth0Domain)
+}
 
-	auth0Domain := os.Getenv("AUTH0_DOMAIN")
-	if auth0Domain == "" {
-		return nil, fmt.Errorf("AUTH0_DOMAIN must be set")
+// RestartRequired はnextとの差分のうち、再読み込みでは反映できず再起動が必要な項目のキーを返す
+// 再読み込みで反映できるのはrevoked_key_ids・request_timeout・trusted_proxies・forwarded_header・routes_file・cors・security_headers・rate_limitのみ
+func (c *Config) RestartRequired(next *Config) []string {
+	var keys []string
+	check := func(key string, changed bool) {
+		if changed {
+			keys = append(keys, key)
+		}
 	}
+	check("identity_api_url", c.IdentityAPIURL != next.IdentityAPIURL)
+	check("user_api_url", c.UserAPIURL != next.UserAPIURL)
+	check("port", c.Port != next.Port)
+	check("admin_port", c.AdminPort != next.AdminPort)
+	check("events_secret", c.EventsSecret != next.EventsSecret)
+	check("auth0_domain", c.Auth0Domain != next.Auth0Domain)
+	check("auth0_issuer", c.Auth0Issuer != next.Auth0Issuer)
+	check("auth0_audience", c.Auth0Audience != next.Auth0Audience)
+	check("introspection", c.Introspection != next.Introspection)
+	check("identity_api_timeout", c.IdentityAPITimeout != next.IdentityAPITimeout)
+	check("user_api_timeout", c.UserAPITimeout != next.UserAPITimeout)
+	check("backend_max_retries", c.BackendMaxRetries != next.BackendMaxRetries)
+	check("breaker_threshold", c.BreakerThreshold != next.BreakerThreshold)
+	check("breaker_open_duration", c.BreakerOpenDuration != next.BreakerOpenDuration)
+	check("get_me_partial_response", c.GetMePartialResponse != next.GetMePartialResponse)
+	check("get_me_cache_ttl", c.GetMeCacheTTL != next.GetMeCacheTTL)
+	check("get_me_cache_size", c.GetMeCacheSize != next.GetMeCacheSize)
+	check("proxy_protocol", c.ProxyProtocol != next.ProxyProtocol)
+	check("server", c.Server != next.Server)
+	check("tls", c.TLS != next.TLS)
+	check("logging", c.Logging != next.Logging)
+	check("tracing", c.Tracing != next.Tracing)
+	return keys
+}
 
-	auth0Audience := os.Getenv("AUTH0_AUDIENCE")
-	if auth0Audience == "" {
-		return nil, fmt.Errorf("AUTH0_AUDIENCE must be set")
+// defaultCORSAllowedHeaders はConnect・gRPC-Webのクライアントが送信するリクエストヘッダー
+func defaultCORSAllowedHeaders() []string {
+	return []string{
+		"Content-Type",
+		"Connect-Protocol-Version",
+		"Connect-Timeout-Ms",
+		"Connect-Accept-Encoding",
+		"Connect-Content-Encoding",
+		"Grpc-Timeout",
+		"X-Grpc-Web",
+		"X-User-Agent",
+		"Authorization",
+		"DPoP",
+		requestid.HeaderRequestID,
+		tenantctx.HeaderTenantID,
 	}
+}
 
-	return &Config{
-		IdentityAPIURL: identityAPIURL,
-		UserAPIURL:     userAPIURL,
-		Port:           port,
-		Auth0Domain:    auth0Domain,
-		Auth0Audience:  auth0Audience,
-	}, nil
+// defaultCORSExposedHeaders はConnect・gRPC-Webのクライアントが読み取るレスポンスヘッダー
+func defaultCORSExposedHeaders() []string {
+	return []string{
+		"Grpc-Status",
+		"Grpc-Message",
+		"Grpc-Status-Details-Bin",
+		"WWW-Authenticate",
+		requestid.HeaderRequestID,
+	}
 }
@@ -0,0 +1,185 @@
+package me
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	gatewayv1 "github.com/kakke18/platform-security-poc/backend/gen/gateway/v1"
+	"github.com/kakke18/platform-security-poc/backend/platform/event"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// cacheLookups はGetMeキャッシュの参照の結果（hit・miss）ごとの件数
+	cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_getme_cache_lookups_total",
+		Help: "Number of GetMe cache lookups, by result.",
+	}, []string{"result"})
+
+	// cacheEvictions はGetMeキャッシュから削除したエントリの理由（invalidated・expired・capacity）ごとの件数
+	cacheEvictions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_getme_cache_evictions_total",
+		Help: "Number of GetMe cache entries evicted, by reason.",
+	}, []string{"reason"})
+)
+
+// cacheEntry はキャッシュされたGetMeレスポンス
+type cacheEntry struct {
+	subject   string
+	resp      *gatewayv1.GetMeResponse
+	expiresAt time.Time
+}
+
+// Cache はPrincipalごとにGetMeの統合レスポンスを短時間キャッシュする
+// 同時に発生した同一ユーザーのリクエストはsingleflightで1回のバックエンド呼び出しにまとめる
+// 上限に達した場合は最も長く参照されていないエントリから削除する
+type Cache struct {
+	ttl   time.Duration
+	size  int
+	group singleflight.Group
+
+	mu sync.Mutex
+	// entries はキャッシュキー（Auth0ユーザーID）から参照順のリストの要素への索引
+	entries map[string]*list.Element
+	// lru は最近参照した順のエントリのリスト（先頭が最新）
+	lru *list.List
+	// workspaceUsers はワークスペースユーザーIDからキャッシュキー（Auth0ユーザーID）への索引
+	workspaceUsers map[string]string
+	// generation は無効化のたびに増加し、無効化前に開始した取得結果の保存を防ぐ
+	generation uint64
+}
+
+// NewCache は新しいCacheを作成する
+func NewCache(ttl time.Duration, size int) *Cache {
+	return &Cache{
+		ttl:            ttl,
+		size:           size,
+		entries:        make(map[string]*list.Element),
+		lru:            list.New(),
+		workspaceUsers: make(map[string]string),
+	}
+}
+
+// Get はsubjectのGetMeレスポンスをキャッシュから返す
+// キャッシュにない場合はloadで取得し、部分応答でなければキャッシュに保存する
+func (c *Cache) Get(ctx context.Context, subject string, load func(ctx context.Context) (*gatewayv1.GetMeResponse, error)) (*gatewayv1.GetMeResponse, error) {
+	if resp, ok := c.lookup(subject); ok {
+		cacheLookups.WithLabelValues("hit").Inc()
+		return resp, nil
+	}
+	cacheLookups.WithLabelValues("miss").Inc()
+
+	v, err, _ := c.group.Do(subject, func() (any, error) {
+		generation := c.currentGeneration()
+
+		// 先頭のリクエストがキャンセルされても他の待機中リクエストに影響しないようにする
+		resp, err := load(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.DegradedFields) == 0 {
+			c.store(subject, resp, generation)
+		}
+		return resp, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return proto.CloneOf(v.(*gatewayv1.GetMeResponse)), nil
+}
+
+// Invalidate はイベントの対象ユーザーのキャッシュを削除する
+// 対象を指定しない所属の変更イベントの場合は全てのキャッシュを削除する
+func (c *Cache) Invalidate(ctx context.Context, e event.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+
+	if e.Type == event.TypeMembershipChanged && e.Subject == "" && e.WorkspaceUserID == "" {
+		cacheEvictions.WithLabelValues("invalidated").Add(float64(c.lru.Len()))
+		clear(c.entries)
+		clear(c.workspaceUsers)
+		c.lru.Init()
+		return
+	}
+
+	subject := e.Subject
+	if subject == "" {
+		subject = c.workspaceUsers[e.WorkspaceUserID]
+	}
+	if subject == "" {
+		return
+	}
+
+	if elem, ok := c.entries[subject]; ok {
+		c.remove(elem)
+		cacheEvictions.WithLabelValues("invalidated").Inc()
+	}
+}
+
+// lookup は有効期限内のキャッシュを返す
+func (c *Cache) lookup(subject string) (*gatewayv1.GetMeResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[subject]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.remove(elem)
+		cacheEvictions.WithLabelValues("expired").Inc()
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return proto.CloneOf(entry.resp), true
+}
+
+// currentGeneration は現在の無効化世代を返す
+func (c *Cache) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// store はレスポンスをキャッシュに保存する
+// 取得中に無効化が発生していた場合は古い可能性があるため保存しない
+func (c *Cache) store(subject string, resp *gatewayv1.GetMeResponse, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generation != generation {
+		return
+	}
+
+	if elem, ok := c.entries[subject]; ok {
+		c.remove(elem)
+	}
+	for c.lru.Len() >= c.size {
+		c.remove(c.lru.Back())
+		cacheEvictions.WithLabelValues("capacity").Inc()
+	}
+
+	c.entries[subject] = c.lru.PushFront(&cacheEntry{
+		subject:   subject,
+		resp:      resp,
+		expiresAt: time.Now().Add(c.ttl),
+	})
+	c.workspaceUsers[resp.WorkspaceUserId] = subject
+}
+
+// remove はエントリをキャッシュと索引から削除する（c.muを保持して呼び出す）
+func (c *Cache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.subject)
+	if c.workspaceUsers[entry.resp.WorkspaceUserId] == entry.subject {
+		delete(c.workspaceUsers, entry.resp.WorkspaceUserId)
+	}
+}
@@ -0,0 +1,80 @@
+package me
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gatewayv1 "github.com/kakke18/platform-security-poc/backend/gen/gateway/v1"
+	"github.com/kakke18/platform-security-poc/backend/platform/event"
+)
+
+// get はsubjectのGetMeレスポンスを取得し、バックエンドから取得したかどうかを返す
+func get(t *testing.T, c *Cache, subject string) bool {
+	t.Helper()
+	loaded := false
+	_, err := c.Get(context.Background(), subject, func(ctx context.Context) (*gatewayv1.GetMeResponse, error) {
+		loaded = true
+		return &gatewayv1.GetMeResponse{WorkspaceUserId: "wu-" + subject}, nil
+	})
+	if err != nil {
+		t.Fatalf("Get(%q) error = %v", subject, err)
+	}
+	return loaded
+}
+
+func TestCache(t *testing.T) {
+	type step struct {
+		subject    string
+		invalidate *event.Event
+		wantLoad   bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{name: "cached until invalidated by subject", steps: []step{
+			{subject: "a", wantLoad: true},
+			{subject: "a"},
+			{invalidate: &event.Event{Type: event.TypeProfileChanged, Subject: "a"}},
+			{subject: "a", wantLoad: true},
+		}},
+		{name: "invalidated by workspace user", steps: []step{
+			{subject: "a", wantLoad: true},
+			{invalidate: &event.Event{Type: event.TypeMembershipChanged, WorkspaceUserID: "wu-a"}},
+			{subject: "a", wantLoad: true},
+		}},
+		{name: "membership change without a target purges all", steps: []step{
+			{subject: "a", wantLoad: true},
+			{subject: "b", wantLoad: true},
+			{invalidate: &event.Event{Type: event.TypeMembershipChanged}},
+			{subject: "a", wantLoad: true},
+			{subject: "b", wantLoad: true},
+		}},
+		{name: "least recently used entry is evicted", steps: []step{
+			{subject: "a", wantLoad: true},
+			{subject: "b", wantLoad: true},
+			{subject: "a"},
+			{subject: "c", wantLoad: true},
+			{subject: "a"},
+			{subject: "b", wantLoad: true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCache(time.Minute, 2)
+			for i, s := range tt.steps {
+				if s.invalidate != nil {
+					c.Invalidate(context.Background(), *s.invalidate)
+					continue
+				}
+				if got := get(t, c, s.subject); got != s.wantLoad {
+					t.Errorf("step %d: Get(%q) loaded = %v, want %v", i, s.subject, got, s.wantLoad)
+				}
+			}
+			if len(c.entries) != c.lru.Len() || len(c.workspaceUsers) != c.lru.Len() {
+				t.Errorf("index sizes = %d, %d, want %d", len(c.entries), len(c.workspaceUsers), c.lru.Len())
+			}
+		})
+	}
+}
@@ -2,52 +2,48 @@ package me
 
 import (
 	"context"
-	"crypto/tls"
-	"net"
-	"net/http"
+	"errors"
+	"log/slog"
+	"sync"
 
 	"connectrpc.com/connect"
-	"golang.org/x/net/http2"
+	"github.com/kakke18/platform-security-poc/backend/gateway/internal/client"
+	"github.com/kakke18/platform-security-poc/backend/gateway/internal/tenant"
 	gatewayv1 "github.com/kakke18/platform-security-poc/backend/gen/gateway/v1"
 	"github.com/kakke18/platform-security-poc/backend/gen/gateway/v1/gatewayv1connect"
 	identityv1 "github.com/kakke18/platform-security-poc/backend/gen/identity/v1"
 	"github.com/kakke18/platform-security-poc/backend/gen/identity/v1/identityv1connect"
 	userv1 "github.com/kakke18/platform-security-poc/backend/gen/user/v1"
 	"github.com/kakke18/platform-security-poc/backend/gen/user/v1/userv1connect"
+	"github.com/kakke18/platform-security-poc/backend/platform/principal"
+	"github.com/kakke18/platform-security-poc/backend/platform/tenantctx"
 )
 
+// degradedFieldTenants はUser APIの障害時に取得できなかったことを表すフィールド名
+const degradedFieldTenants = "tenants"
+
+// errBackend はバックエンドの呼び出しに失敗した場合にクライアントへ返すエラー
+var errBackend = errors.New("backend request failed")
+
 // Handler はMeServiceの実装
 type Handler struct {
 	workspaceUserClient identityv1connect.WorkspaceUserServiceClient
 	tenantUserClient    userv1connect.TenantUserServiceClient
+
+	// partialResponse はUser APIの障害時に部分応答を返すかどうか
+	partialResponse bool
+
+	// cache はGetMeレスポンスのキャッシュ（nilの場合はキャッシュしない）
+	cache *Cache
 }
 
 // NewHandler は新しいMeハンドラーを作成する
-// gRPCプロトコル（HTTP/2 over cleartext）を使用してバックエンドサービスと通信
-func NewHandler(identityAPIURL, userAPIURL string) *Handler {
-	// HTTP/2クライアントを作成（h2c: HTTP/2 Cleartext）
-	h2cClient := &http.Client{
-		Transport: &http2.Transport{
-			// h2c (HTTP/2 without TLS) を許可
-			AllowHTTP: true,
-			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
-				// TLSダイヤルの代わりに通常のダイヤルを使用
-				return net.Dial(network, addr)
-			},
-		},
-	}
-
+func NewHandler(clients *client.Clients, partialResponse bool, cache *Cache) *Handler {
 	return &Handler{
-		workspaceUserClient: identityv1connect.NewWorkspaceUserServiceClient(
-			h2cClient,
-			identityAPIURL,
-			connect.WithGRPC(), // gRPCプロトコルを使用
-		),
-		tenantUserClient: userv1connect.NewTenantUserServiceClient(
-			h2cClient,
-			userAPIURL,
-			connect.WithGRPC(), // gRPCプロトコルを使用
-		),
+		workspaceUserClient: clients.WorkspaceUser,
+		tenantUserClient:    clients.TenantUser,
+		partialResponse:     partialResponse,
+		cache:               cache,
 	}
 }
 
@@ -59,48 +55,131 @@ func (h *Handler) GetMe(
 	ctx context.Context,
 	req *connect.Request[gatewayv1.GetMeRequest],
 ) (*connect.Response[gatewayv1.GetMeResponse], error) {
-	// JWTミドルウェアで設定されたAuth0ユーザーIDを取得
-	auth0UserID := req.Header().Get("X-Auth0-User-ID")
-	if auth0UserID == "" {
-		return nil, connect.NewError(connect.CodeUnauthenticated, nil)
+	// JWTミドルウェアで検証済みのPrincipalを取得
+	p := principal.MustFrom(ctx)
+
+	// テナント選択時はテナントミドルウェアが所属情報を解決済みのため、バックエンドを再度呼び出さない
+	if m, ok := tenant.FromContext(ctx); ok && m.Tenant != nil {
+		return connect.NewResponse(fromMembership(m)), nil
 	}
 
-	// Identity APIからWorkspaceUser情報を取得
-	workspaceUserReq := connect.NewRequest(&identityv1.GetWorkspaceUserRequest{})
-	workspaceUserReq.Header().Set("X-Auth0-User-ID", auth0UserID)
+	if h.cache == nil {
+		resp, err := h.getMe(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		return connect.NewResponse(resp), nil
+	}
 
-	workspaceUserResp, err := h.workspaceUserClient.GetWorkspaceUser(ctx, workspaceUserReq)
+	resp, err := h.cache.Get(ctx, p.Subject, func(ctx context.Context) (*gatewayv1.GetMeResponse, error) {
+		return h.getMe(ctx, p)
+	})
 	if err != nil {
-		return nil, connect.NewError(connect.CodeInternal, err)
+		return nil, err
 	}
+	return connect.NewResponse(resp), nil
+}
 
-	// User APIからTenantUser情報を取得
-	tenantUsersReq := connect.NewRequest(&userv1.GetTenantUsersRequest{})
-	tenantUsersReq.Header().Set("X-Workspace-User-ID", workspaceUserResp.Msg.WorkspaceUserId)
+// getMe はIdentity APIとUser APIを呼び出して統合レスポンスを作成する
+// WorkspaceUserIDが解決済みの場合はIdentity APIとUser APIを並行に呼び出す
+func (h *Handler) getMe(ctx context.Context, p *principal.Principal) (*gatewayv1.GetMeResponse, error) {
+	var (
+		workspaceUserResp *connect.Response[identityv1.GetWorkspaceUserResponse]
+		tenantUsersResp   *connect.Response[userv1.GetTenantUsersResponse]
+		workspaceUserErr  error
+		tenantUsersErr    error
+	)
 
-	tenantUsersResp, err := h.tenantUserClient.GetTenantUsers(ctx, tenantUsersReq)
-	if err != nil {
-		return nil, connect.NewError(connect.CodeInternal, err)
+	if p.WorkspaceUserID != "" {
+		// テナント選択時などWorkspaceUserIDが解決済みの場合は両サービスを並行に呼び出す
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			workspaceUserResp, workspaceUserErr = h.getWorkspaceUser(ctx, p.Subject)
+		})
+		wg.Go(func() {
+			tenantUsersResp, tenantUsersErr = h.getTenantUsers(ctx, p.WorkspaceUserID)
+		})
+		wg.Wait()
+	} else {
+		// WorkspaceUserIDが未解決の場合はIdentity APIの結果を待ってからUser APIを呼び出す
+		workspaceUserResp, workspaceUserErr = h.getWorkspaceUser(ctx, p.Subject)
+		if workspaceUserErr == nil {
+			tenantUsersResp, tenantUsersErr = h.getTenantUsers(ctx, workspaceUserResp.Msg.WorkspaceUserId)
+		}
+	}
+
+	// Identity APIの情報はレスポンスの必須項目のため、失敗した場合はエラーを返す
+	if workspaceUserErr != nil {
+		return nil, toConnectError(ctx, workspaceUserErr)
+	}
+
+	resp := &gatewayv1.GetMeResponse{
+		WorkspaceId:     workspaceUserResp.Msg.WorkspaceId,
+		WorkspaceUserId: workspaceUserResp.Msg.WorkspaceUserId,
+		Email:           workspaceUserResp.Msg.Email,
+		Name:            workspaceUserResp.Msg.Name,
+	}
+
+	if tenantUsersErr != nil {
+		if !h.partialResponse {
+			return nil, toConnectError(ctx, tenantUsersErr)
+		}
+
+		// User APIの障害時はテナント情報を欠いた部分応答を返す
+		slog.WarnContext(ctx, "returning partial GetMe response",
+			slog.String("degraded_field", degradedFieldTenants),
+			slog.String("error", tenantUsersErr.Error()),
+		)
+		resp.DegradedFields = append(resp.DegradedFields, degradedFieldTenants)
+		return resp, nil
 	}
 
 	// TenantUser情報をTenantUserInfo形式に変換
-	tenantInfos := make([]*gatewayv1.TenantUserInfo, len(tenantUsersResp.Msg.Users))
+	resp.Tenants = make([]*gatewayv1.TenantUserInfo, len(tenantUsersResp.Msg.Users))
 	for i, tu := range tenantUsersResp.Msg.Users {
-		tenantInfos[i] = &gatewayv1.TenantUserInfo{
+		resp.Tenants[i] = &gatewayv1.TenantUserInfo{
 			TenantId:     tu.TenantId,
 			TenantUserId: tu.TenantUserId,
 			Role:         convertRole(tu.Role),
 		}
 	}
 
-	// レスポンスを統合
-	return connect.NewResponse(&gatewayv1.GetMeResponse{
-		WorkspaceId:     workspaceUserResp.Msg.WorkspaceId,
-		WorkspaceUserId: workspaceUserResp.Msg.WorkspaceUserId,
-		Email:           workspaceUserResp.Msg.Email,
-		Name:            workspaceUserResp.Msg.Name,
-		Tenants:         tenantInfos,
-	}), nil
+	return resp, nil
+}
+
+// fromMembership はテナントミドルウェアが解決した所属情報からレスポンスを作成する
+func fromMembership(m *tenant.Membership) *gatewayv1.GetMeResponse {
+	resp := &gatewayv1.GetMeResponse{
+		WorkspaceId:     m.WorkspaceID,
+		WorkspaceUserId: m.WorkspaceUserID,
+		Email:           m.Email,
+		Name:            m.Name,
+		Tenants:         make([]*gatewayv1.TenantUserInfo, len(m.Tenants)),
+	}
+	for i, tc := range m.Tenants {
+		resp.Tenants[i] = &gatewayv1.TenantUserInfo{
+			TenantId:     tc.TenantID,
+			TenantUserId: tc.TenantUserID,
+			Role:         convertTenantRole(tc.Role),
+		}
+	}
+	return resp
+}
+
+// getWorkspaceUser はIdentity APIからWorkspaceUser情報を取得する
+func (h *Handler) getWorkspaceUser(ctx context.Context, auth0UserID string) (*connect.Response[identityv1.GetWorkspaceUserResponse], error) {
+	workspaceUserReq := connect.NewRequest(&identityv1.GetWorkspaceUserRequest{})
+	workspaceUserReq.Header().Set(principal.HeaderSubject, auth0UserID)
+
+	return h.workspaceUserClient.GetWorkspaceUser(ctx, workspaceUserReq)
+}
+
+// getTenantUsers はUser APIからTenantUser情報を取得する
+func (h *Handler) getTenantUsers(ctx context.Context, workspaceUserID string) (*connect.Response[userv1.GetTenantUsersResponse], error) {
+	tenantUsersReq := connect.NewRequest(&userv1.GetTenantUsersRequest{})
+	tenantUsersReq.Header().Set(principal.HeaderWorkspaceUserID, workspaceUserID)
+
+	return h.tenantUserClient.GetTenantUsers(ctx, tenantUsersReq)
 }
 
 // ListWorkspaceUsers はワークスペース内のユーザー一覧を取得する
@@ -108,22 +187,19 @@ func (h *Handler) ListWorkspaceUsers(
 	ctx context.Context,
 	req *connect.Request[gatewayv1.ListWorkspaceUsersRequest],
 ) (*connect.Response[gatewayv1.ListWorkspaceUsersResponse], error) {
-	// JWTミドルウェアで設定されたAuth0ユーザーIDを取得
-	auth0UserID := req.Header().Get("X-Auth0-User-ID")
-	if auth0UserID == "" {
-		return nil, connect.NewError(connect.CodeUnauthenticated, nil)
-	}
+	// JWTミドルウェアで検証済みのPrincipalからAuth0ユーザーIDを取得
+	auth0UserID := principal.MustFrom(ctx).Subject
 
 	// Identity APIからワークスペース内のユーザー一覧を取得
 	listReq := connect.NewRequest(&identityv1.ListWorkspaceUsersRequest{
 		PageSize:  req.Msg.PageSize,
 		PageToken: req.Msg.PageToken,
 	})
-	listReq.Header().Set("X-Auth0-User-ID", auth0UserID)
+	listReq.Header().Set(principal.HeaderSubject, auth0UserID)
 
 	listResp, err := h.workspaceUserClient.ListWorkspaceUsers(ctx, listReq)
 	if err != nil {
-		return nil, connect.NewError(connect.CodeInternal, err)
+		return nil, toConnectError(ctx, err)
 	}
 
 	// Identity APIのWorkspaceUserをGatewayのWorkspaceUserに変換
@@ -142,6 +218,19 @@ func (h *Handler) ListWorkspaceUsers(
 	}), nil
 }
 
+// toConnectError はバックエンドのエラーをクライアント向けのConnectエラーに変換する
+// バックエンドが返したエラーコードのみを維持し、それ以外のエラーはInternalとして扱う
+// バックエンドのエラーメッセージは内部の情報を含み得るため、サーバー側のログにのみ記録する
+func toConnectError(ctx context.Context, err error) error {
+	code := connect.CodeInternal
+	var connectErr *connect.Error
+	if errors.As(err, &connectErr) {
+		code = connectErr.Code()
+	}
+	slog.WarnContext(ctx, "backend request failed", slog.String("code", code.String()), slog.String("error", err.Error()))
+	return connect.NewError(code, errBackend)
+}
+
 // convertRole はUser ServiceのRoleをGatewayのRoleに変換する
 func convertRole(role userv1.Role) gatewayv1.Role {
 	switch role {
@@ -155,3 +244,17 @@ func convertRole(role userv1.Role) gatewayv1.Role {
 		return gatewayv1.Role_ROLE_UNSPECIFIED
 	}
 }
+
+// convertTenantRole はテナントコンテキストのRoleをGatewayのRoleに変換する
+func convertTenantRole(role tenantctx.Role) gatewayv1.Role {
+	switch role {
+	case tenantctx.RoleAdmin:
+		return gatewayv1.Role_ROLE_ADMIN
+	case tenantctx.RoleMember:
+		return gatewayv1.Role_ROLE_MEMBER
+	case tenantctx.RoleViewer:
+		return gatewayv1.Role_ROLE_VIEWER
+	default:
+		return gatewayv1.Role_ROLE_UNSPECIFIED
+	}
+}
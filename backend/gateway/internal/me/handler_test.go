@@ -0,0 +1,96 @@
+package me
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/kakke18/platform-security-poc/backend/gateway/internal/client"
+	"github.com/kakke18/platform-security-poc/backend/gateway/internal/tenant"
+	gatewayv1 "github.com/kakke18/platform-security-poc/backend/gen/gateway/v1"
+	identityv1 "github.com/kakke18/platform-security-poc/backend/gen/identity/v1"
+	"github.com/kakke18/platform-security-poc/backend/gen/identity/v1/identityv1connect"
+	userv1 "github.com/kakke18/platform-security-poc/backend/gen/user/v1"
+	"github.com/kakke18/platform-security-poc/backend/gen/user/v1/userv1connect"
+	"github.com/kakke18/platform-security-poc/backend/platform/principal"
+	"github.com/kakke18/platform-security-poc/backend/platform/tenantctx"
+)
+
+// fakeWorkspaceUserClient は呼び出し回数を記録するIdentity APIのクライアント
+type fakeWorkspaceUserClient struct {
+	identityv1connect.WorkspaceUserServiceClient
+	calls int
+}
+
+func (c *fakeWorkspaceUserClient) GetWorkspaceUser(ctx context.Context, req *connect.Request[identityv1.GetWorkspaceUserRequest]) (*connect.Response[identityv1.GetWorkspaceUserResponse], error) {
+	c.calls++
+	return connect.NewResponse(&identityv1.GetWorkspaceUserResponse{WorkspaceId: "ws-1", WorkspaceUserId: "wu-1", Email: "alice@example.com", Name: "Alice"}), nil
+}
+
+// fakeTenantUserClient は呼び出し回数を記録し、失敗を返すUser APIのクライアント
+type fakeTenantUserClient struct {
+	userv1connect.TenantUserServiceClient
+	calls int
+}
+
+func (c *fakeTenantUserClient) GetTenantUsers(ctx context.Context, req *connect.Request[userv1.GetTenantUsersRequest]) (*connect.Response[userv1.GetTenantUsersResponse], error) {
+	c.calls++
+	return nil, connect.NewError(connect.CodeUnavailable, errors.New("down"))
+}
+
+func TestGetMe(t *testing.T) {
+	membership := &tenant.Membership{
+		WorkspaceID:     "ws-1",
+		WorkspaceUserID: "wu-1",
+		Email:           "alice@example.com",
+		Name:            "Alice",
+		Tenants: []*tenantctx.Context{
+			{TenantID: "tenant-1", TenantUserID: "tu-1", Role: tenantctx.RoleAdmin},
+			{TenantID: "tenant-2", TenantUserID: "tu-2", Role: tenantctx.RoleViewer},
+		},
+	}
+	membership.Tenant = membership.Tenants[1]
+
+	tests := []struct {
+		name       string
+		membership *tenant.Membership
+		wantCalls  int
+		wantCode   connect.Code
+	}{
+		{name: "tenant resolved by the middleware is reused", membership: membership},
+		{name: "backends are called without a resolved tenant", wantCalls: 2, wantCode: connect.CodeUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspaceUsers := &fakeWorkspaceUserClient{}
+			tenantUsers := &fakeTenantUserClient{}
+			h := NewHandler(&client.Clients{WorkspaceUser: workspaceUsers, TenantUser: tenantUsers}, false, nil)
+
+			ctx := principal.NewContext(context.Background(), &principal.Principal{Subject: "auth0|alice", WorkspaceUserID: "wu-1"})
+			if tt.membership != nil {
+				ctx = tenant.NewContext(ctx, tt.membership)
+			}
+			resp, err := h.GetMe(ctx, connect.NewRequest(&gatewayv1.GetMeRequest{}))
+
+			if calls := workspaceUsers.calls + tenantUsers.calls; calls != tt.wantCalls {
+				t.Errorf("backend calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantCode != 0 {
+				if connect.CodeOf(err) != tt.wantCode {
+					t.Fatalf("error = %v, want code %v", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if resp.Msg.WorkspaceUserId != "wu-1" || resp.Msg.Email != "alice@example.com" || len(resp.Msg.Tenants) != 2 {
+				t.Fatalf("response = %v", resp.Msg)
+			}
+			if got := resp.Msg.Tenants[1]; got.TenantId != "tenant-2" || got.TenantUserId != "tu-2" || got.Role != gatewayv1.Role_ROLE_VIEWER {
+				t.Errorf("tenant = %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/cors"
+)
+
+// corsRejections はCORSで拒否したリクエストの理由ごとの件数
+var corsRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_cors_rejections_total",
+	Help: "Number of cross-origin requests rejected by the CORS policy, by reason.",
+}, []string{"reason"})
+
+// corsAllowedMethods はConnectが使用するメソッド（GETは冪等なプロシージャの呼び出し）
+var corsAllowedMethods = []string{http.MethodGet, http.MethodPost}
+
+// CORSPolicy はオリジンごとのCORSポリシー
+type CORSPolicy struct {
+	// Origin は許可するオリジン（完全一致）
+	Origin string
+
+	// AllowedHeaders は許可するリクエストヘッダー
+	AllowedHeaders []string
+
+	// ExposedHeaders はクライアントに公開するレスポンスヘッダー
+	ExposedHeaders []string
+
+	// AllowCredentials はCookieなどの認証情報の送信を許可するかどうか
+	AllowCredentials bool
+
+	// MaxAge はプリフライトリクエストの結果をキャッシュする期間
+	MaxAge time.Duration
+}
+
+// CORS はオリジンごとの許可リストに基づいてクロスオリジンリクエストを処理する
+type CORS struct {
+	policies map[string]CORSPolicy
+}
+
+// NewCORS は新しいCORSを作成する
+func NewCORS(policies []CORSPolicy) *CORS {
+	m := make(map[string]CORSPolicy, len(policies))
+	for _, p := range policies {
+		m[p.Origin] = p
+	}
+	return &CORS{policies: m}
+}
+
+// Middleware はオリジンに対応するポリシーでCORSヘッダーを付与する
+// 許可されていないオリジン・メソッド・ヘッダーのプリフライトリクエストは403で拒否して記録する
+// 許可されていないオリジンからの単純リクエストはCORSヘッダーを付与せずに処理する（ブラウザがレスポンスを破棄する）
+func (c *CORS) Middleware(next http.Handler) http.Handler {
+	handlers := make(map[string]http.Handler, len(c.policies))
+	for origin, p := range c.policies {
+		handlers[origin] = cors.New(cors.Options{
+			AllowedOrigins:   []string{origin},
+			AllowedMethods:   corsAllowedMethods,
+			AllowedHeaders:   p.AllowedHeaders,
+			ExposedHeaders:   p.ExposedHeaders,
+			AllowCredentials: p.AllowCredentials,
+			MaxAge:           int(p.MaxAge.Seconds()),
+		}).Handler(next)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		p, ok := c.policies[origin]
+		if !ok {
+			rejectCORS(w, r, next, preflight, "origin", origin)
+			return
+		}
+
+		if preflight {
+			if method := r.Header.Get("Access-Control-Request-Method"); !slices.Contains(corsAllowedMethods, method) {
+				rejectCORS(w, r, next, true, "method", origin, slog.String("method", method))
+				return
+			}
+			if header, ok := disallowedHeader(r.Header.Get("Access-Control-Request-Headers"), p.AllowedHeaders); !ok {
+				rejectCORS(w, r, next, true, "header", origin, slog.String("header", header))
+				return
+			}
+		}
+
+		handlers[origin].ServeHTTP(w, r)
+	})
+}
+
+// rejectCORS はCORSポリシーで拒否したリクエストを記録する
+// プリフライトリクエストは403を返し、それ以外はCORSヘッダーを付与せずに処理する
+// プリフライトではないリクエストはOriginを付けて大量に送信できるため、ログはデバッグレベルとしメトリクスのみ全件を記録する
+func rejectCORS(w http.ResponseWriter, r *http.Request, next http.Handler, preflight bool, reason, origin string, attrs ...any) {
+	corsRejections.WithLabelValues(reason).Inc()
+	attrs = append([]any{slog.String("reason", reason), slog.String("origin", origin), slog.Bool("preflight", preflight)}, attrs...)
+
+	if preflight {
+		slog.WarnContext(r.Context(), "CORS request rejected", attrs...)
+		http.Error(w, "CORS request not allowed", http.StatusForbidden)
+		return
+	}
+	slog.DebugContext(r.Context(), "CORS request rejected", attrs...)
+	next.ServeHTTP(w, r)
+}
+
+// disallowedHeader はAccess-Control-Request-Headersのうち許可されていない最初のヘッダーを返す
+func disallowedHeader(requested string, allowed []string) (string, bool) {
+	for _, h := range strings.Split(requested, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		if !slices.ContainsFunc(allowed, func(a string) bool { return strings.EqualFold(a, h) }) {
+			return h, false
+		}
+	}
+	return "", true
+}
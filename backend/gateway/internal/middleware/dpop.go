@@ -0,0 +1,499 @@
+package middleware
+
+import (
+	"container/heap"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kakke18/platform-security-poc/backend/gateway/internal/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// HeaderDPoP はDPoPプルーフ（RFC 9449）を送るリクエストヘッダー
+const HeaderDPoP = "DPoP"
+
+// DPoPProofType はDPoPプルーフのヘッダーのtyp
+const DPoPProofType = "dpop+jwt"
+
+// DPoPAlgs はDPoPプルーフの署名に受け入れるアルゴリズム（非対称鍵のみ）
+var DPoPAlgs = []string{"ES256", "ES384", "RS256", "PS256"}
+
+const (
+	// defaultDPoPProofMaxAge はSetDPoPPolicyで設定するまでのDPoPプルーフのiatからの有効期間
+	defaultDPoPProofMaxAge = time.Minute
+
+	// defaultDPoPReplayCacheSize はSetDPoPPolicyで設定するまでのリプレイキャッシュの上限
+	defaultDPoPReplayCacheSize = 100000
+
+	// defaultDPoPReplayCachePerKey はSetDPoPPolicyで設定するまでの1つの鍵あたりのリプレイキャッシュの上限
+	defaultDPoPReplayCachePerKey = 1000
+
+	// maxDPoPProofBytes はDPoPプルーフの長さの上限
+	maxDPoPProofBytes = 8 << 10
+
+	// maxDPoPJTIBytes はDPoPプルーフのjtiの長さの上限（リプレイキャッシュのキーに使用する）
+	maxDPoPJTIBytes = 256
+)
+
+var (
+	// errDPoPRequired はDPoPを必須とするクライアント・ワークスペースのBearerトークン
+	errDPoPRequired = errors.New("DPoP-bound token required")
+	// errDPoPMissingProof はDPoPで送信者制約されたトークンにDPoPプルーフがない
+	errDPoPMissingProof = errors.New("missing DPoP proof")
+	// errDPoPInvalidProof はDPoPプルーフの形式・署名・クレームが不正
+	errDPoPInvalidProof = errors.New("invalid DPoP proof")
+	// errDPoPKeyMismatch はDPoPプルーフの鍵がトークンのcnf.jktと一致しない
+	errDPoPKeyMismatch = errors.New("DPoP proof key does not match cnf.jkt")
+	// errDPoPReplay は使用済みのjtiのDPoPプルーフ
+	errDPoPReplay = errors.New("DPoP proof replayed")
+	// errDPoPReplayCacheFull はリプレイキャッシュが上限に達している
+	errDPoPReplayCacheFull = errors.New("DPoP replay cache is full")
+	// errDPoPBoundBearer はDPoPで送信者制約されたトークンをBearerトークンとして使用した
+	errDPoPBoundBearer = errors.New("DPoP-bound token presented as a bearer token")
+	// errDPoPUnboundToken はDPoPスキームで送信者制約されていないトークンを使用した
+	errDPoPUnboundToken = errors.New("DPoP scheme used with a token that is not DPoP-bound")
+)
+
+// dpopVerifications はDPoPによる送信者制約の検証の結果（失敗時はその理由）ごとの件数
+var dpopVerifications = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_dpop_verifications_total",
+	Help: "Number of DPoP sender-constraint checks, by result.",
+}, []string{"result"})
+
+// dpopResult はDPoPの検証エラーをメトリクスのresultラベルに分類する
+func dpopResult(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, errDPoPRequired):
+		return "dpop_required"
+	case errors.Is(err, errDPoPMissingProof):
+		return "dpop_missing_proof"
+	case errors.Is(err, errDPoPKeyMismatch):
+		return "dpop_key_mismatch"
+	case errors.Is(err, errDPoPReplay):
+		return "dpop_replay"
+	case errors.Is(err, errDPoPReplayCacheFull):
+		return "dpop_replay_cache_full"
+	case errors.Is(err, errDPoPBoundBearer):
+		return "dpop_bound_bearer"
+	case errors.Is(err, errDPoPUnboundToken):
+		return "dpop_unbound_token"
+	default:
+		return "dpop_invalid_proof"
+	}
+}
+
+// DPoPChallenge はDPoPの検証に失敗した場合のWWW-Authenticateヘッダーの値を返す（RFC 9449 7.1）
+func DPoPChallenge(reason string) string {
+	errorCode := "invalid_token"
+	switch reason {
+	case "dpop_missing_proof", "dpop_invalid_proof", "dpop_key_mismatch", "dpop_replay":
+		errorCode = "invalid_dpop_proof"
+	}
+	return fmt.Sprintf(`DPoP error=%q, algs=%q`, errorCode, strings.Join(DPoPAlgs, " "))
+}
+
+// DPoPPolicy はDPoP（RFC 9449）による送信者制約の設定
+// cnf.jktを含むトークンは常にDPoPプルーフを検証し、それ以外のトークンはRequiredClientIDs・RequiredWorkspaceIDsに該当する場合のみ拒否する
+type DPoPPolicy struct {
+	// RequiredClientIDs はDPoPで送信者制約されたトークンを必須とするクライアント（azp・client_id）
+	RequiredClientIDs []string
+
+	// RequiredWorkspaceIDs はDPoPで送信者制約されたトークンを必須とするワークスペース
+	RequiredWorkspaceIDs []string
+
+	// ProofMaxAge はDPoPプルーフのiatからの有効期間
+	ProofMaxAge time.Duration
+
+	// PublicOrigin はhtuの検証に使用するGatewayの公開オリジン（空の場合はリクエストのHostと接続から判断する）
+	PublicOrigin string
+
+	// ReplayCacheSize はリプレイを検出するために記録するjtiの数の上限
+	ReplayCacheSize int
+
+	// ReplayCachePerKey は1つの鍵（jkt）で署名されたプルーフについて記録するjtiの数の上限
+	ReplayCachePerKey int
+}
+
+// WorkspaceLookup はユーザーが所属するワークスペースを解決する
+// ワークスペースごとにDPoPを必須とする場合に使用する
+type WorkspaceLookup interface {
+	ResolveWorkspaceUser(ctx context.Context, auth0UserID string) (*tenant.Membership, error)
+}
+
+// Confirmation はトークンを送信者に結び付ける鍵（RFC 7800）
+type Confirmation struct {
+	// JKT はDPoPの鍵のJWK SHA-256 Thumbprint（RFC 9449 6.1）
+	JKT string `json:"jkt"`
+}
+
+// SetWorkspaceLookup はワークスペースごとにDPoPを必須とする場合に使用するワークスペースの解決方法を設定する
+// WithPolicyで作成したミドルウェアと共有する
+func (m *JWTMiddleware) SetWorkspaceLookup(l WorkspaceLookup) {
+	m.workspaces = l
+}
+
+// VerifySenderConstraint はトークンの送信者制約を検証する
+// cnf.jktを含むトークンはDPoPスキームとDPoPプルーフを必須とし、含まないトークンはDPoPを必須とするクライアント・ワークスペースでは拒否する
+// 検証に失敗した場合は*VerificationErrorを返し、ワークスペースの解決に失敗した場合はそのエラーを返す
+func (m *JWTMiddleware) VerifySenderConstraint(r *http.Request, scheme, token string, claims *JWTClaims) (err error) {
+	ctx, span := tracer.Start(r.Context(), "dpop.verify")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "DPoP verification failed")
+		}
+		span.End()
+
+		// ワークスペースの解決の失敗は検証の結果ではないためそのまま返す
+		if errors.Is(err, errWorkspaceLookup) {
+			return
+		}
+		result := dpopResult(err)
+		dpopVerifications.WithLabelValues(result).Inc()
+		if err != nil {
+			err = &VerificationError{Reason: result, Err: err}
+		}
+	}()
+
+	policy := m.dpop
+
+	if claims.Confirmation == nil || claims.Confirmation.JKT == "" {
+		if scheme == SchemeDPoP {
+			return errDPoPUnboundToken
+		}
+		required, err := m.dpopRequired(ctx, policy, claims)
+		if err != nil {
+			return err
+		}
+		if required {
+			return errDPoPRequired
+		}
+		return nil
+	}
+
+	span.SetAttributes(attribute.Bool("dpop.bound", true))
+	if scheme != SchemeDPoP {
+		return errDPoPBoundBearer
+	}
+	proofs := r.Header.Values(HeaderDPoP)
+	if len(proofs) == 0 {
+		return errDPoPMissingProof
+	}
+	if len(proofs) > 1 {
+		return fmt.Errorf("%w: multiple DPoP headers", errDPoPInvalidProof)
+	}
+
+	proof, err := parseDPoPProof(proofs[0])
+	if err != nil {
+		return err
+	}
+	if err := proof.validate(r, token, policy, m.policy.Leeway); err != nil {
+		return err
+	}
+	if proof.jkt != claims.Confirmation.JKT {
+		return errDPoPKeyMismatch
+	}
+
+	// 有効期間を過ぎたプルーフはiatの検証で拒否するため、それまでの間だけjtiを記録する
+	expiry := proof.claims.IssuedAt.Add(policy.ProofMaxAge)
+	return m.replays.add(proof.jkt, proof.claims.ID, expiry, time.Now(), policy.ReplayCacheSize, policy.ReplayCachePerKey)
+}
+
+// errWorkspaceLookup はワークスペースごとにDPoPを必須とするかの判断でワークスペースを解決できなかった
+var errWorkspaceLookup = errors.New("failed to resolve workspace for DPoP policy")
+
+// dpopRequired は送信者制約されていないトークンを拒否すべきクライアント・ワークスペースかどうかを返す
+func (m *JWTMiddleware) dpopRequired(ctx context.Context, policy *DPoPPolicy, claims *JWTClaims) (bool, error) {
+	if slices.Contains(policy.RequiredClientIDs, claims.ClientID()) {
+		return true, nil
+	}
+	if len(policy.RequiredWorkspaceIDs) == 0 || m.workspaces == nil {
+		return false, nil
+	}
+	membership, err := m.workspaces.ResolveWorkspaceUser(ctx, claims.Subject)
+	if errors.Is(err, tenant.ErrNotMember) {
+		// ワークスペースに所属していない場合は後続の認可で拒否する
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", errWorkspaceLookup, err)
+	}
+	return slices.Contains(policy.RequiredWorkspaceIDs, membership.WorkspaceID), nil
+}
+
+// dpopClaims はDPoPプルーフのクレーム
+type dpopClaims struct {
+	jwt.RegisteredClaims
+	HTM string `json:"htm"`
+	HTU string `json:"htu"`
+	ATH string `json:"ath"`
+}
+
+// dpopProof は署名を検証したDPoPプルーフ
+type dpopProof struct {
+	claims *dpopClaims
+	// jkt はプルーフのヘッダーのjwkのJWK SHA-256 Thumbprint
+	jkt string
+}
+
+// parseDPoPProof はDPoPプルーフのヘッダー（typ・alg・jwk）を検証し、jwkの公開鍵で署名を検証する
+func parseDPoPProof(s string) (*dpopProof, error) {
+	if len(s) > maxDPoPProofBytes || !isCompactJWS(s) {
+		return nil, fmt.Errorf("%w: malformed", errDPoPInvalidProof)
+	}
+
+	proof := &dpopProof{claims: &dpopClaims{}}
+	_, err := jwt.ParseWithClaims(s, proof.claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != DPoPProofType {
+			return nil, fmt.Errorf("unexpected typ %q", token.Header["typ"])
+		}
+		jwk, ok := token.Header["jwk"].(map[string]any)
+		if !ok {
+			return nil, errors.New("missing jwk")
+		}
+		key, jkt, err := dpopPublicKey(jwk, token.Method.Alg())
+		if err != nil {
+			return nil, err
+		}
+		proof.jkt = jkt
+		return key, nil
+	}, jwt.WithValidMethods(DPoPAlgs), jwt.WithStrictDecoding(), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errDPoPInvalidProof, err)
+	}
+	return proof, nil
+}
+
+// validate はDPoPプルーフのjti・htm・htu・iat・athを検証する
+// leewayはクレームの検証と同じ、未来のiatに許容する時計のずれ
+func (p *dpopProof) validate(r *http.Request, token string, policy *DPoPPolicy, leeway time.Duration) error {
+	c := p.claims
+	if c.ID == "" || len(c.ID) > maxDPoPJTIBytes {
+		return fmt.Errorf("%w: invalid jti", errDPoPInvalidProof)
+	}
+	if c.HTM != r.Method {
+		return fmt.Errorf("%w: htm %q does not match %s", errDPoPInvalidProof, c.HTM, r.Method)
+	}
+	if !matchHTU(c.HTU, requestURI(r, policy.PublicOrigin)) {
+		return fmt.Errorf("%w: htu does not match the request", errDPoPInvalidProof)
+	}
+	if c.IssuedAt == nil {
+		return fmt.Errorf("%w: missing iat", errDPoPInvalidProof)
+	}
+	now := time.Now()
+	if c.IssuedAt.Before(now.Add(-policy.ProofMaxAge)) || c.IssuedAt.After(now.Add(leeway)) {
+		return fmt.Errorf("%w: iat out of range", errDPoPInvalidProof)
+	}
+	if c.ATH != tokenHash(token) {
+		return fmt.Errorf("%w: ath does not match the access token", errDPoPInvalidProof)
+	}
+	return nil
+}
+
+// tokenHash はアクセストークンのハッシュ（ath: SHA-256のbase64url）を返す
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// requestURI はhtuと比較するリクエストのURI（クエリとフラグメントを除く）を返す
+func requestURI(r *http.Request, publicOrigin string) *url.URL {
+	if publicOrigin != "" {
+		if u, err := url.Parse(publicOrigin); err == nil {
+			return &url.URL{Scheme: u.Scheme, Host: u.Host, Path: r.URL.Path}
+		}
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return &url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path}
+}
+
+// matchHTU はhtuがリクエストのURIと一致するかを返す
+// スキームとホストは大文字・小文字を区別せず、デフォルトのポートを省略して比較し、クエリとフラグメントは無視する（RFC 9449 4.3）
+func matchHTU(htu string, want *url.URL) bool {
+	u, err := url.Parse(htu)
+	if err != nil || u.User != nil || u.Opaque != "" {
+		return false
+	}
+	path := func(p string) string {
+		if p == "" {
+			return "/"
+		}
+		return p
+	}
+	return strings.EqualFold(u.Scheme, want.Scheme) &&
+		strings.EqualFold(normalizeHost(u.Scheme, u.Host), normalizeHost(want.Scheme, want.Host)) &&
+		path(u.EscapedPath()) == path(want.EscapedPath())
+}
+
+// normalizeHost はスキームのデフォルトのポートを省略したホストを返す
+func normalizeHost(scheme, host string) string {
+	switch {
+	case strings.EqualFold(scheme, "http"):
+		return strings.TrimSuffix(host, ":80")
+	case strings.EqualFold(scheme, "https"):
+		return strings.TrimSuffix(host, ":443")
+	}
+	return host
+}
+
+// jwkPrivateMembers はJWKの秘密鍵のメンバー（DPoPプルーフのjwkに含まれてはならない）
+var jwkPrivateMembers = []string{"d", "p", "q", "dp", "dq", "qi", "oth", "k"}
+
+// dpopPublicKey はDPoPプルーフのヘッダーのjwkから公開鍵とJWK SHA-256 Thumbprint（RFC 7638）を返す
+// 鍵の種類と曲線は署名アルゴリズムと一致し、RSA鍵はJWKSの鍵と同じ基準（2048ビット以上など）を満たすこと
+func dpopPublicKey(jwk map[string]any, alg string) (crypto.PublicKey, string, error) {
+	for _, member := range jwkPrivateMembers {
+		if _, ok := jwk[member]; ok {
+			return nil, "", errors.New("jwk contains a private key")
+		}
+	}
+	str := func(name string) string {
+		s, _ := jwk[name].(string)
+		return s
+	}
+
+	var (
+		key        crypto.PublicKey
+		thumbprint map[string]string
+	)
+	switch kty := str("kty"); {
+	case kty == "EC" && (alg == "ES256" || alg == "ES384"):
+		curve, size := elliptic.P256(), 32
+		if alg == "ES384" {
+			curve, size = elliptic.P384(), 48
+		}
+		if str("crv") != curve.Params().Name {
+			return nil, "", fmt.Errorf("crv %q does not match %s", str("crv"), alg)
+		}
+		x, errX := base64.RawURLEncoding.Strict().DecodeString(str("x"))
+		y, errY := base64.RawURLEncoding.Strict().DecodeString(str("y"))
+		if errX != nil || errY != nil || len(x) != size || len(y) != size {
+			return nil, "", errors.New("invalid EC coordinates")
+		}
+		pub, err := ecdsa.ParseUncompressedPublicKey(curve, slices.Concat([]byte{4}, x, y))
+		if err != nil {
+			return nil, "", err
+		}
+		key = pub
+		thumbprint = map[string]string{"crv": str("crv"), "kty": kty, "x": str("x"), "y": str("y")}
+	case kty == "RSA" && (alg == "RS256" || alg == "PS256"):
+		pub, err := JWKSKey{N: str("n"), E: str("e")}.RSAPublicKey()
+		if err != nil {
+			return nil, "", err
+		}
+		key = pub
+		thumbprint = map[string]string{"e": str("e"), "kty": kty, "n": str("n")}
+	default:
+		return nil, "", fmt.Errorf("kty %q does not match %s", kty, alg)
+	}
+
+	jkt, err := JWKThumbprint(thumbprint)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, jkt, nil
+}
+
+// JWKThumbprint は必須のメンバーのみのJWKからJWK SHA-256 Thumbprint（RFC 7638）を返す
+// encoding/jsonはマップのキーを辞書順に並べ、空白を含めずに出力する
+func JWKThumbprint(members map[string]string) (string, error) {
+	b, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// replayCache はDPoPプルーフのjtiを有効期間の間だけ記録し、再利用を検出する
+// 期限の早い順のヒープで期限切れを先頭から削除するため、記録と削除はO(log n)で行える
+type replayCache struct {
+	mu     sync.Mutex
+	seen   map[string]time.Time
+	expiry replayHeap
+	perKey map[string]int
+}
+
+// replayEntry はリプレイキャッシュに記録したjti
+type replayEntry struct {
+	key    string
+	jkt    string
+	expiry time.Time
+}
+
+// replayHeap は期限の早い順に並べたreplayEntryのヒープ（container/heap.Interface）
+type replayHeap []replayEntry
+
+func (h replayHeap) Len() int           { return len(h) }
+func (h replayHeap) Less(i, j int) bool { return h[i].expiry.Before(h[j].expiry) }
+func (h replayHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *replayHeap) Push(x any)        { *h = append(*h, x.(replayEntry)) }
+func (h *replayHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// newReplayCache は新しいreplayCacheを作成する
+func newReplayCache() *replayCache {
+	return &replayCache{
+		seen:   make(map[string]time.Time),
+		perKey: make(map[string]int),
+	}
+}
+
+// add はjktの鍵で署名されたプルーフのjtiを期限まで記録する
+// 期限内に記録済みの場合はerrDPoPReplayを返す
+// 期限切れを削除しても全体でlimit、同じ鍵でperKeyLimitに達している場合はerrDPoPReplayCacheFullを返す
+// （1つの鍵が大量のプルーフでキャッシュを占有し、他のクライアントのプルーフを拒否させることを防ぐ）
+func (c *replayCache) add(jkt, jti string, expiry, now time.Time, limit, perKeyLimit int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for c.expiry.Len() > 0 && !now.Before(c.expiry[0].expiry) {
+		e := heap.Pop(&c.expiry).(replayEntry)
+		delete(c.seen, e.key)
+		if c.perKey[e.jkt]--; c.perKey[e.jkt] <= 0 {
+			delete(c.perKey, e.jkt)
+		}
+	}
+
+	key := jkt + ":" + jti
+	if _, ok := c.seen[key]; ok {
+		return errDPoPReplay
+	}
+	// 記録できないプルーフを受け入れるとリプレイを検出できないため拒否する
+	if len(c.seen) >= limit {
+		return errDPoPReplayCacheFull
+	}
+	if c.perKey[jkt] >= perKeyLimit {
+		return fmt.Errorf("%w: too many proofs for the key", errDPoPReplayCacheFull)
+	}
+	c.seen[key] = expiry
+	c.perKey[jkt]++
+	heap.Push(&c.expiry, replayEntry{key: key, jkt: jkt, expiry: expiry})
+	return nil
+}
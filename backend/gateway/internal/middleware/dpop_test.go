@@ -0,0 +1,380 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"maps"
+	mathrand "math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// dpopURL はDPoPプルーフのhtuに指定するリクエストのURL
+const dpopURL = "https://fuzz.platform-security-poc.local/gateway.v1.MeService/GetMe"
+
+// dpopKey はDPoPプルーフの署名鍵とそのJWK
+type dpopKey struct {
+	key *ecdsa.PrivateKey
+	jwk map[string]string
+	jkt string
+}
+
+// loadDPoPKey はPEMからP-256のDPoPプルーフの署名鍵を読み込む
+func loadDPoPKey(b []byte) (*dpopKey, error) {
+	key, err := jwt.ParseECPrivateKeyFromPEM(b)
+	if err != nil {
+		return nil, err
+	}
+	return newDPoPKey(key)
+}
+
+// generateDPoPKey はP-256のDPoPプルーフの署名鍵を生成する
+func generateDPoPKey() (*dpopKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return newDPoPKey(key)
+}
+
+// newDPoPKey は署名鍵のJWKとサムプリントを計算する
+func newDPoPKey(key *ecdsa.PrivateKey) (*dpopKey, error) {
+	b, err := key.PublicKey.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	jwk := map[string]string{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(b[1:33]),
+		"y":   base64.RawURLEncoding.EncodeToString(b[33:]),
+	}
+	jkt, err := JWKThumbprint(jwk)
+	if err != nil {
+		return nil, err
+	}
+	return &dpopKey{key: key, jwk: jwk, jkt: jkt}, nil
+}
+
+// proofClaims はdpopURLへのPOSTに対する、アクセストークンに結び付いたDPoPプルーフのクレームを返す
+func proofClaims(token string) jwt.MapClaims {
+	ath := sha256.Sum256([]byte(token))
+	return jwt.MapClaims{
+		"jti": rand.Text(),
+		"htm": http.MethodPost,
+		"htu": dpopURL,
+		"iat": time.Now().Unix(),
+		"ath": base64.RawURLEncoding.EncodeToString(ath[:]),
+	}
+}
+
+// sign はヘッダーにjwkを含むDPoPプルーフに署名する
+func (k *dpopKey) sign(claims jwt.Claims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = DPoPProofType
+	token.Header["jwk"] = k.jwk
+	signed, err := token.SignedString(k.key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+// signed はプルーフがsignで署名したものかどうかを返す
+// ヘッダーのtyp・alg・jwkと、署名の検証・エンコードが厳密に一致することを確認する
+func (k *dpopKey) signed(proof string) bool {
+	i := strings.LastIndexByte(proof, '.')
+	if i < 0 {
+		return false
+	}
+	header, _, _ := strings.Cut(proof, ".")
+	b, err := base64.RawURLEncoding.DecodeString(header)
+	if err != nil {
+		return false
+	}
+	var h struct {
+		Typ string            `json:"typ"`
+		Alg string            `json:"alg"`
+		JWK map[string]string `json:"jwk"`
+	}
+	if err := json.Unmarshal(b, &h); err != nil || h.Typ != DPoPProofType || h.Alg != "ES256" || !maps.Equal(h.JWK, k.jwk) {
+		return false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(proof[i+1:])
+	if err != nil || base64.RawURLEncoding.EncodeToString(signature) != proof[i+1:] {
+		return false
+	}
+	return jwt.SigningMethodES256.Verify(proof[:i], signature, &k.key.PublicKey) == nil
+}
+
+// issueBound はdpopKeyに結び付いた（cnf.jktを含む）トークンを発行する
+func (e *testEnvironment) issueBound(subject string) string {
+	claims := e.claims(subject)
+	claims["cnf"] = map[string]string{"jkt": e.dpop.jkt}
+	return e.sign(kidGood, claims)
+}
+
+// issueProof はトークンに結び付いた有効なDPoPプルーフを発行する
+func (e *testEnvironment) issueProof(token string) string {
+	return e.dpop.sign(proofClaims(token))
+}
+
+// dpopRequest はdpopURLへのPOSTにAuthorizationヘッダーとDPoPヘッダー（空の場合は付与しない）を設定する
+func dpopRequest(authorization, proof string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, dpopURL, nil)
+	r.Header.Set("Authorization", authorization)
+	if proof != "" {
+		r.Header.Set(HeaderDPoP, proof)
+	}
+	return r
+}
+
+// verifyRequest はJWTミドルウェアと同じ順序でAuthorizationヘッダーのトークンと送信者制約を検証する
+func (e *testEnvironment) verifyRequest(r *http.Request) error {
+	scheme, token, err := ParseAuthorization(r.Header.Get("Authorization"))
+	if err != nil {
+		return err
+	}
+	claims, err := e.jwt.VerifyToken(r.Context(), token)
+	if err != nil {
+		return err
+	}
+	return e.jwt.VerifySenderConstraint(r, scheme, token, claims)
+}
+
+func TestVerifySenderConstraintAcceptsProofOnce(t *testing.T) {
+	e := newTestEnvironment(t)
+	rng := mathrand.New(mathrand.NewPCG(1, 2))
+
+	// 他のテストが常に拒否されるだけで成功しないように、正しいプルーフが1回だけ受け入れられることを確認する
+	for range iterations {
+		token := e.issueBound(randomSubject(rng))
+		r := dpopRequest("DPoP "+token, e.issueProof(token))
+		if err := e.verifyRequest(r); err != nil {
+			t.Fatalf("issued proof was rejected: %v", err)
+		}
+		if err := e.verifyRequest(r); err == nil {
+			t.Fatal("replayed proof was accepted")
+		}
+	}
+}
+
+func TestVerifySenderConstraintRejects(t *testing.T) {
+	e := newTestEnvironment(t)
+	other, err := generateDPoPKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// signedProof はDPoPの鍵でヘッダーを変えて署名したプルーフを返す
+	signedProof := func(method jwt.SigningMethod, key any, header map[string]any, claims jwt.MapClaims) string {
+		proof := jwt.NewWithClaims(method, claims)
+		maps.Copy(proof.Header, header)
+		signed, err := proof.SignedString(key)
+		if err != nil {
+			panic(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name    string
+		request func(rng *mathrand.Rand, token string, claims jwt.MapClaims) *http.Request
+	}{
+		{
+			name: "bound token used as a bearer token",
+			request: func(_ *mathrand.Rand, token string, _ jwt.MapClaims) *http.Request {
+				return dpopRequest("Bearer "+token, e.issueProof(token))
+			},
+		},
+		{
+			name: "missing proof",
+			request: func(_ *mathrand.Rand, token string, _ jwt.MapClaims) *http.Request {
+				return dpopRequest("DPoP "+token, "")
+			},
+		},
+		{
+			name: "key different from cnf.jkt",
+			request: func(_ *mathrand.Rand, token string, claims jwt.MapClaims) *http.Request {
+				return dpopRequest("DPoP "+token, other.sign(claims))
+			},
+		},
+		{
+			name: "different method",
+			request: func(_ *mathrand.Rand, token string, claims jwt.MapClaims) *http.Request {
+				claims["htm"] = http.MethodGet
+				return dpopRequest("DPoP "+token, e.dpop.sign(claims))
+			},
+		},
+		{
+			name: "different URL",
+			request: func(_ *mathrand.Rand, token string, claims jwt.MapClaims) *http.Request {
+				claims["htu"] = strings.Replace(dpopURL, "GetMe", "ListWorkspaceUsers", 1)
+				return dpopRequest("DPoP "+token, e.dpop.sign(claims))
+			},
+		},
+		{
+			name: "different access token",
+			request: func(rng *mathrand.Rand, token string, claims jwt.MapClaims) *http.Request {
+				claims["ath"] = proofClaims(e.issueBound(randomSubject(rng)))["ath"]
+				return dpopRequest("DPoP "+token, e.dpop.sign(claims))
+			},
+		},
+		{
+			name: "iat in the past",
+			request: func(rng *mathrand.Rand, token string, claims jwt.MapClaims) *http.Request {
+				claims["iat"] = time.Now().Add(-time.Duration(2+rng.IntN(60)) * time.Minute).Unix()
+				return dpopRequest("DPoP "+token, e.dpop.sign(claims))
+			},
+		},
+		{
+			name: "iat in the future",
+			request: func(rng *mathrand.Rand, token string, claims jwt.MapClaims) *http.Request {
+				claims["iat"] = time.Now().Add(time.Duration(2+rng.IntN(60)) * time.Minute).Unix()
+				return dpopRequest("DPoP "+token, e.dpop.sign(claims))
+			},
+		},
+		{
+			name: "missing jti",
+			request: func(_ *mathrand.Rand, token string, claims jwt.MapClaims) *http.Request {
+				delete(claims, "jti")
+				return dpopRequest("DPoP "+token, e.dpop.sign(claims))
+			},
+		},
+		{
+			// アクセストークンなど、typが異なるJWT
+			name: "typ other than dpop+jwt",
+			request: func(_ *mathrand.Rand, token string, claims jwt.MapClaims) *http.Request {
+				proof := signedProof(jwt.SigningMethodES256, e.dpop.key, map[string]any{"typ": "JWT", "jwk": e.dpop.jwk}, claims)
+				return dpopRequest("DPoP "+token, proof)
+			},
+		},
+		{
+			name: "jwk containing the private key",
+			request: func(_ *mathrand.Rand, token string, claims jwt.MapClaims) *http.Request {
+				jwk := map[string]string{"kty": "EC", "crv": "P-256", "x": e.dpop.jwk["x"], "y": e.dpop.jwk["y"], "d": "AA"}
+				proof := signedProof(jwt.SigningMethodES256, e.dpop.key, map[string]any{"typ": DPoPProofType, "jwk": jwk}, claims)
+				return dpopRequest("DPoP "+token, proof)
+			},
+		},
+		{
+			// jwkを共通鍵とするHMACの署名
+			name: "HMAC signed with the jwk",
+			request: func(_ *mathrand.Rand, token string, claims jwt.MapClaims) *http.Request {
+				jwk := map[string]string{"kty": "oct", "k": "c2VjcmV0"}
+				proof := signedProof(jwt.SigningMethodHS256, []byte("secret"), map[string]any{"typ": DPoPProofType, "jwk": jwk}, claims)
+				return dpopRequest("DPoP "+token, proof)
+			},
+		},
+		{
+			name: "bearer token with the DPoP scheme",
+			request: func(rng *mathrand.Rand, _ string, _ jwt.MapClaims) *http.Request {
+				token := e.issue(randomSubject(rng))
+				return dpopRequest("DPoP "+token, e.issueProof(token))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rng := mathrand.New(mathrand.NewPCG(1, 2))
+			for range iterations {
+				token := e.issueBound(randomSubject(rng))
+				r := tt.request(rng, token, proofClaims(token))
+				if err := e.verifyRequest(r); err == nil {
+					t.Fatalf("request was accepted: authorization=%q dpop=%q", r.Header.Get("Authorization"), r.Header.Get(HeaderDPoP))
+				}
+			}
+		})
+	}
+}
+
+func TestReplayCache(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	type add struct {
+		jkt, jti string
+		expiry   time.Duration
+		at       time.Duration
+		want     error
+	}
+	tests := []struct {
+		name string
+		adds []add
+	}{
+		{name: "replay within the expiry", adds: []add{
+			{jkt: "a", jti: "1", expiry: time.Minute},
+			{jkt: "a", jti: "1", expiry: time.Minute, at: 30 * time.Second, want: errDPoPReplay},
+		}},
+		{name: "same jti for another key", adds: []add{
+			{jkt: "a", jti: "1", expiry: time.Minute},
+			{jkt: "b", jti: "1", expiry: time.Minute},
+		}},
+		{name: "expired entries are evicted", adds: []add{
+			{jkt: "a", jti: "1", expiry: time.Minute},
+			{jkt: "b", jti: "1", expiry: time.Minute},
+			{jkt: "c", jti: "1", expiry: 2 * time.Minute},
+			{jkt: "d", jti: "1", expiry: time.Minute, want: errDPoPReplayCacheFull},
+			{jkt: "d", jti: "1", expiry: 2 * time.Minute, at: time.Minute},
+			{jkt: "a", jti: "1", expiry: 2 * time.Minute, at: time.Minute},
+			{jkt: "c", jti: "1", expiry: 2 * time.Minute, at: time.Minute, want: errDPoPReplay},
+		}},
+		{name: "cache full", adds: []add{
+			{jkt: "a", jti: "1", expiry: time.Minute},
+			{jkt: "b", jti: "1", expiry: time.Minute},
+			{jkt: "c", jti: "1", expiry: time.Minute},
+			{jkt: "d", jti: "1", expiry: time.Minute, want: errDPoPReplayCacheFull},
+		}},
+		{name: "per-key limit does not affect other keys", adds: []add{
+			{jkt: "a", jti: "1", expiry: time.Minute},
+			{jkt: "a", jti: "2", expiry: 2 * time.Minute},
+			{jkt: "a", jti: "3", expiry: time.Minute, want: errDPoPReplayCacheFull},
+			{jkt: "b", jti: "1", expiry: time.Minute},
+			{jkt: "a", jti: "3", expiry: 2 * time.Minute, at: time.Minute},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newReplayCache()
+			for i, a := range tt.adds {
+				err := c.add(a.jkt, a.jti, now.Add(a.expiry), now.Add(a.at), 3, 2)
+				if !errors.Is(err, a.want) || (a.want == nil && err != nil) {
+					t.Fatalf("add #%d (%s:%s) = %v, want %v", i, a.jkt, a.jti, err, a.want)
+				}
+			}
+			if len(c.seen) != c.expiry.Len() {
+				t.Errorf("%d entries but %d in the expiry heap", len(c.seen), c.expiry.Len())
+			}
+		})
+	}
+}
+
+// FuzzDPoPProof はDPoPで送信者制約されたトークンに任意のDPoPプルーフを組み合わせ、
+// 発行したプルーフそのもの以外を受け入れず、発行したプルーフも2回目以降は拒否することを検証する
+func FuzzDPoPProof(f *testing.F) {
+	e := newTestEnvironment(f)
+	token := e.issueBound("auth0|seed")
+	f.Add(e.issueProof(token))
+
+	accepted := make(map[string]bool)
+	f.Fuzz(func(t *testing.T, proof string) {
+		if err := e.verifyRequest(dpopRequest("DPoP "+token, proof)); err != nil {
+			return
+		}
+		if !e.dpop.signed(proof) {
+			t.Fatalf("accepted a DPoP proof that was not issued: %q", proof)
+		}
+		if accepted[proof] {
+			t.Fatalf("accepted a replayed DPoP proof: %q", proof)
+		}
+		accepted[proof] = true
+	})
+}
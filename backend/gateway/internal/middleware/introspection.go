@@ -0,0 +1,289 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kakke18/platform-security-poc/backend/platform/telemetry"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"golang.org/x/sync/singleflight"
+)
+
+// maxIntrospectionBytes はイントロスペクションのレスポンスの上限
+const maxIntrospectionBytes = 64 << 10
+
+var (
+	// errTokenInactive はイントロスペクションでactiveではないトークン（失効・期限切れ・未知のトークン）
+	errTokenInactive = errors.New("inactive token")
+	// errIntrospection はイントロスペクションエンドポイントの呼び出しに失敗した（トークンの検証の結果ではない）
+	errIntrospection = errors.New("token introspection failed")
+)
+
+var (
+	// opaqueVerifications はイントロスペクションによるトークン検証の結果（失敗時はその理由）ごとの件数
+	opaqueVerifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_opaque_token_verifications_total",
+		Help: "Number of opaque token verifications via introspection, by result.",
+	}, []string{"result"})
+
+	// introspections はイントロスペクションエンドポイントの呼び出しの結果ごとの件数（キャッシュから返した場合はcache_hit）
+	introspections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_token_introspections_total",
+		Help: "Number of token introspection lookups, by result.",
+	}, []string{"result"})
+)
+
+// IntrospectionConfig はトークンイントロスペクション（RFC 7662）の設定
+type IntrospectionConfig struct {
+	// Endpoint はイントロスペクションエンドポイントのURL
+	Endpoint string
+
+	// ClientID・ClientSecret はエンドポイントのクライアント認証（HTTP Basic認証）に使用する
+	ClientID     string
+	ClientSecret string
+
+	// Timeout はエンドポイントの呼び出しのタイムアウト
+	Timeout time.Duration
+
+	// CacheTTL はactiveの結果をキャッシュする期間（トークンのexpを超えない、0の場合はキャッシュしない）
+	CacheTTL time.Duration
+
+	// CacheSize はキャッシュするトークンの数の上限
+	CacheSize int
+}
+
+// introspectionEntry はキャッシュしたイントロスペクションの結果
+type introspectionEntry struct {
+	claims    *JWTClaims
+	expiresAt time.Time
+}
+
+// Introspector はJWTではないトークン（opaqueトークン）をイントロスペクションエンドポイントに問い合わせる
+// activeの結果のみをトークンのハッシュをキーにキャッシュし、同時に発生した同じトークンの問い合わせは1回にまとめる
+// 任意のトークンでキャッシュを埋められないよう、activeではない結果はキャッシュしない
+type Introspector struct {
+	config IntrospectionConfig
+	client *http.Client
+	group  singleflight.Group
+
+	mu      sync.Mutex
+	entries map[string]introspectionEntry
+}
+
+// NewIntrospector は新しいIntrospectorを作成する
+func NewIntrospector(c IntrospectionConfig) *Introspector {
+	return &Introspector{
+		config: c,
+		client: &http.Client{
+			Timeout:   c.Timeout,
+			Transport: telemetry.Transport(http.DefaultTransport),
+		},
+		entries: make(map[string]introspectionEntry),
+	}
+}
+
+// SetIntrospector はJWS compact形式ではないトークンを検証するIntrospectorを設定する（nilの場合はJWTのみを受け入れる）
+// WithPolicyで作成したミドルウェアと共有する
+func (m *JWTMiddleware) SetIntrospector(i *Introspector) {
+	m.introspector = i
+}
+
+// Introspect はトークンのイントロスペクションの結果をクレームとして返す
+// activeではない場合はerrTokenInactiveを返し、エンドポイントの呼び出しに失敗した場合はerrIntrospectionをラップしたエラーを返す
+func (i *Introspector) Introspect(ctx context.Context, token string) (*JWTClaims, error) {
+	key := tokenHash(token)
+	if claims, ok := i.lookup(key, time.Now()); ok {
+		introspections.WithLabelValues("cache_hit").Inc()
+		return claims, nil
+	}
+
+	v, err, _ := i.group.Do(key, func() (any, error) {
+		// 先頭のリクエストがキャンセルされても他の待機中リクエストに影響しないようにする
+		claims, err := i.introspect(context.WithoutCancel(ctx), token)
+		switch {
+		case errors.Is(err, errTokenInactive):
+			introspections.WithLabelValues("inactive").Inc()
+		case err != nil:
+			introspections.WithLabelValues("failure").Inc()
+		default:
+			introspections.WithLabelValues("active").Inc()
+			i.store(key, claims, time.Now())
+		}
+		return claims, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 呼び出し元でクレームを変更してもキャッシュに影響しないように複製する
+	claims := *v.(*JWTClaims)
+	return &claims, nil
+}
+
+// introspect はイントロスペクションエンドポイントにトークンを問い合わせる
+func (i *Introspector) introspect(ctx context.Context, token string) (*JWTClaims, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.config.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errIntrospection, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// RFC 6749 2.3.1に従い、クライアントIDとシークレットをURLエンコードしてからBasic認証に使用する
+	req.SetBasicAuth(url.QueryEscape(i.config.ClientID), url.QueryEscape(i.config.ClientSecret))
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errIntrospection, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status=%d", errIntrospection, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxIntrospectionBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errIntrospection, err)
+	}
+	if len(body) > maxIntrospectionBytes {
+		return nil, fmt.Errorf("%w: response exceeds %d bytes", errIntrospection, maxIntrospectionBytes)
+	}
+	return ParseIntrospectionResponse(body)
+}
+
+// ParseIntrospectionResponse はイントロスペクションのレスポンスを解析し、activeのトークンのクレームを返す
+// active以外のメンバー（scope・client_id・sub・aud・exp・cnfなど）はJWTのクレームと同じ名前のため、JWTClaimsにそのまま読み込む
+// activeではない場合はerrTokenInactiveを返し、JSONとして不正な場合はerrIntrospectionをラップしたエラーを返す
+func ParseIntrospectionResponse(b []byte) (*JWTClaims, error) {
+	// 構造体への読み込みは未知のメンバーを無視するため、全メンバーを値まで読み込んで不正な数値などを含むレスポンスを拒否する
+	var members map[string]any
+	if err := json.Unmarshal(b, &members); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode response: %w", errIntrospection, err)
+	}
+	// encoding/jsonは構造体のフィールドを大文字・小文字を区別せずに読み込むため、activeは名前が完全に一致するtrueのみを受け入れる
+	if members["active"] != true {
+		return nil, errTokenInactive
+	}
+	var claims JWTClaims
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode response: %w", errIntrospection, err)
+	}
+	return &claims, nil
+}
+
+// lookup は有効期限内のキャッシュを返す
+func (i *Introspector) lookup(key string, now time.Time) (*JWTClaims, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	entry, ok := i.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(entry.expiresAt) {
+		delete(i.entries, key)
+		return nil, false
+	}
+	claims := *entry.claims
+	return &claims, true
+}
+
+// store はactiveの結果をCacheTTLとexpの早い方までキャッシュする
+// 期限切れを削除しても上限に達している場合はキャッシュしない
+func (i *Introspector) store(key string, claims *JWTClaims, now time.Time) {
+	if i.config.CacheTTL <= 0 || claims.ExpiresAt == nil {
+		return
+	}
+	expiresAt := now.Add(i.config.CacheTTL)
+	if claims.ExpiresAt.Before(expiresAt) {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	if !now.Before(expiresAt) {
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if len(i.entries) >= i.config.CacheSize {
+		for k, e := range i.entries {
+			if !now.Before(e.expiresAt) {
+				delete(i.entries, k)
+			}
+		}
+		if len(i.entries) >= i.config.CacheSize {
+			return
+		}
+	}
+	i.entries[key] = introspectionEntry{claims: claims, expiresAt: expiresAt}
+}
+
+// VerifyOpaqueToken はJWTではないトークンをイントロスペクションで検証する
+// active、exp・nbf・iat、オーディエンス、有効期間の上限、クライアントをJWTと同じ設定で検証する
+// issはレスポンスで省略できるため、ある場合のみ設定した発行者と一致するかを検証する
+// 検証に失敗した場合は*VerificationErrorを返し、エンドポイントの呼び出しに失敗した場合はerrIntrospectionをラップしたエラーを返す
+func (m *JWTMiddleware) VerifyOpaqueToken(ctx context.Context, token string) (_ *JWTClaims, err error) {
+	ctx, span := tracer.Start(ctx, "token.introspect")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "token introspection failed")
+		}
+		span.End()
+
+		// エンドポイントの呼び出しの失敗は検証の結果ではないためそのまま返す
+		if errors.Is(err, errIntrospection) {
+			opaqueVerifications.WithLabelValues("introspection_failure").Inc()
+			return
+		}
+		result := verificationResult(err)
+		opaqueVerifications.WithLabelValues(result).Inc()
+		if err != nil {
+			err = &VerificationError{Reason: result, Err: err}
+		}
+	}()
+
+	if m.introspector == nil {
+		return nil, fmt.Errorf("%w: introspection is not configured", jwt.ErrTokenMalformed)
+	}
+	claims, err := m.introspector.Introspect(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("token.client_id", claims.ClientID()))
+
+	policy := m.policy
+
+	// キャッシュした結果もexpを過ぎれば拒否するよう、問い合わせの結果にかかわらず時刻を検証する
+	if claims.ExpiresAt == nil {
+		return nil, errMissingExpiration
+	}
+	if err := jwt.NewValidator(jwt.WithLeeway(policy.Leeway), jwt.WithIssuedAt()).Validate(claims); err != nil {
+		return nil, err
+	}
+
+	if claims.Issuer != "" && claims.Issuer != m.issuer {
+		return nil, fmt.Errorf("%w: expected=%s, got=%s", errInvalidIssuer, m.issuer, claims.Issuer)
+	}
+
+	if m.audience != "" && !slices.Contains(claims.Audience, m.audience) {
+		return nil, errInvalidAudience
+	}
+
+	// iatはイントロスペクションのレスポンスでは省略できるため、ある場合のみ有効期間の上限を検証する
+	if err := policy.validateLifetimeAndClient(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
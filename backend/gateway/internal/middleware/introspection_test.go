@@ -0,0 +1,274 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// testIntrospectionClientID・testIntrospectionClientSecret はテスト用のイントロスペクションエンドポイントのクライアント認証の資格情報
+	testIntrospectionClientID     = "gateway"
+	testIntrospectionClientSecret = "s3cret&?"
+)
+
+// newIntrospectionServer はクライアント認証を検証し、respondの結果を返すイントロスペクションエンドポイントを起動する
+func newIntrospectionServer(t *testing.T, respond func(token string) (int, map[string]any)) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		id, secret, ok := r.BasicAuth()
+		if ok {
+			id, _ = url.QueryUnescape(id)
+			secret, _ = url.QueryUnescape(secret)
+		}
+		if !ok || id != testIntrospectionClientID || secret != testIntrospectionClientSecret {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		status, body := respond(r.PostFormValue("token"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+// activeResponse は検証に成功するactiveのレスポンスを返す
+func activeResponse() map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"active":    true,
+		"iss":       testIssuer,
+		"sub":       "auth0|partner",
+		"aud":       testAudience,
+		"client_id": testClientID,
+		"iat":       now.Unix(),
+		"exp":       now.Add(time.Hour).Unix(),
+	}
+}
+
+func TestVerifyOpaqueToken(t *testing.T) {
+	tests := []struct {
+		name         string
+		modify       func(resp map[string]any)
+		status       int
+		clientSecret string
+		wantReason   string
+		wantFailure  bool
+	}{
+		{name: "active token"},
+		{name: "issuer omitted", modify: func(resp map[string]any) { delete(resp, "iss") }},
+		{name: "inactive token", modify: func(resp map[string]any) { clear(resp); resp["active"] = false }, wantReason: "inactive"},
+		{name: "other issuer", modify: func(resp map[string]any) { resp["iss"] = "https://other.example.com/" }, wantReason: "invalid_issuer"},
+		{name: "other audience", modify: func(resp map[string]any) { resp["aud"] = "https://other.example.com" }, wantReason: "invalid_audience"},
+		{name: "audience omitted", modify: func(resp map[string]any) { delete(resp, "aud") }, wantReason: "invalid_audience"},
+		{name: "client not allowed", modify: func(resp map[string]any) { resp["client_id"] = "other-client" }, wantReason: "unauthorized_client"},
+		{name: "client omitted", modify: func(resp map[string]any) { delete(resp, "client_id") }, wantReason: "unauthorized_client"},
+		{name: "expired", modify: func(resp map[string]any) { resp["exp"] = time.Now().Add(-time.Minute).Unix() }, wantReason: "expired"},
+		{name: "exp omitted", modify: func(resp map[string]any) { delete(resp, "exp") }, wantReason: "missing_exp"},
+		{name: "endpoint error", status: http.StatusInternalServerError, wantFailure: true},
+		{name: "wrong client credentials", clientSecret: "wrong", wantFailure: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnvironment(t)
+			srv, _ := newIntrospectionServer(t, func(token string) (int, map[string]any) {
+				if tt.status != 0 {
+					return tt.status, nil
+				}
+				resp := activeResponse()
+				if tt.modify != nil {
+					tt.modify(resp)
+				}
+				return http.StatusOK, resp
+			})
+			secret := tt.clientSecret
+			if secret == "" {
+				secret = testIntrospectionClientSecret
+			}
+			e.jwt.SetIntrospector(NewIntrospector(IntrospectionConfig{
+				Endpoint:     srv.URL,
+				ClientID:     testIntrospectionClientID,
+				ClientSecret: secret,
+				Timeout:      time.Second,
+			}))
+
+			claims, err := e.jwt.VerifyOpaqueToken(context.Background(), "opaque-token")
+			switch {
+			case tt.wantFailure:
+				var verr *VerificationError
+				if !errors.Is(err, errIntrospection) || errors.As(err, &verr) {
+					t.Fatalf("error = %v, want an introspection failure", err)
+				}
+			case tt.wantReason != "":
+				var verr *VerificationError
+				if !errors.As(err, &verr) || verr.Reason != tt.wantReason {
+					t.Fatalf("error = %v, want reason %q", err, tt.wantReason)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("VerifyOpaqueToken() error = %v", err)
+				}
+				if claims.Subject != "auth0|partner" || claims.ClientID() != testClientID {
+					t.Errorf("claims = %+v", claims)
+				}
+			}
+		})
+	}
+}
+
+func TestIntrospectorCache(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	claims := func(exp time.Time) *JWTClaims {
+		return &JWTClaims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(exp)}}
+	}
+
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		claims    *JWTClaims
+		wantUntil time.Time
+	}{
+		{name: "bounded by ttl", ttl: time.Minute, claims: claims(now.Add(time.Hour)), wantUntil: now.Add(time.Minute)},
+		{name: "bounded by exp", ttl: time.Hour, claims: claims(now.Add(time.Minute)), wantUntil: now.Add(time.Minute)},
+		{name: "cache disabled", claims: claims(now.Add(time.Hour))},
+		{name: "exp omitted", ttl: time.Hour, claims: &JWTClaims{}},
+		{name: "already expired", ttl: time.Hour, claims: claims(now)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := NewIntrospector(IntrospectionConfig{CacheTTL: tt.ttl, CacheSize: 10})
+			i.store("key", tt.claims, now)
+
+			if tt.wantUntil.IsZero() {
+				if _, ok := i.lookup("key", now); ok {
+					t.Fatal("result was cached")
+				}
+				return
+			}
+			if _, ok := i.lookup("key", tt.wantUntil.Add(-time.Second)); !ok {
+				t.Fatal("result was not cached")
+			}
+			if _, ok := i.lookup("key", tt.wantUntil); ok {
+				t.Fatal("result was returned after it expired")
+			}
+			// 期限切れのエントリはlookupで削除する
+			if len(i.entries) != 0 {
+				t.Errorf("entries = %d, want the expired entry to be removed", len(i.entries))
+			}
+		})
+	}
+}
+
+func TestIntrospectorCacheCapacity(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	i := NewIntrospector(IntrospectionConfig{CacheTTL: time.Hour, CacheSize: 2})
+	claims := func(exp time.Time) *JWTClaims {
+		return &JWTClaims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(exp)}}
+	}
+
+	i.store("short", claims(now.Add(time.Second)), now)
+	i.store("long", claims(now.Add(time.Hour)), now)
+
+	// 上限に達した場合は期限切れのエントリのみを削除して空きを作る
+	later := now.Add(time.Minute)
+	i.store("new", claims(now.Add(time.Hour)), later)
+	if _, ok := i.entries["short"]; ok {
+		t.Error("expired entry was not purged")
+	}
+	if _, ok := i.lookup("new", later); !ok {
+		t.Error("entry was not cached after purging expired entries")
+	}
+
+	// 期限内のエントリは追い出さず、新しい結果をキャッシュしない
+	i.store("rejected", claims(now.Add(time.Hour)), later)
+	if _, ok := i.lookup("rejected", later); ok {
+		t.Error("entry was cached beyond the capacity")
+	}
+	for _, key := range []string{"long", "new"} {
+		if _, ok := i.lookup(key, later); !ok {
+			t.Errorf("live entry %q was evicted", key)
+		}
+	}
+}
+
+func TestIntrospectorCollapsesConcurrentRequests(t *testing.T) {
+	const callers = 10
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	srv, calls := newIntrospectionServer(t, func(token string) (int, map[string]any) {
+		once.Do(func() { close(started) })
+		<-release
+		return http.StatusOK, activeResponse()
+	})
+	// キャッシュしない設定で、同時の問い合わせが1回にまとまることを検証する
+	i := NewIntrospector(IntrospectionConfig{
+		Endpoint:     srv.URL,
+		ClientID:     testIntrospectionClientID,
+		ClientSecret: testIntrospectionClientSecret,
+		Timeout:      5 * time.Second,
+	})
+
+	var wg sync.WaitGroup
+	results := make([]*JWTClaims, callers)
+	errs := make([]error, callers)
+	for n := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[n], errs[n] = i.Introspect(context.Background(), "opaque-token")
+		}()
+	}
+	<-started
+	// 全ての呼び出し元が問い合わせの完了を待機するまで待つ
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("endpoint calls = %d, want 1", got)
+	}
+	for n := range callers {
+		if errs[n] != nil || results[n].Subject != "auth0|partner" {
+			t.Fatalf("caller %d: claims = %+v, error = %v", n, results[n], errs[n])
+		}
+	}
+	// 呼び出し元ごとに複製したクレームを返す
+	results[0].Subject = "changed"
+	if results[1].Subject != "auth0|partner" {
+		t.Error("callers share the same claims")
+	}
+}
+
+// FuzzParseIntrospectionResponse はレスポンスのトップレベルのactiveがtrueの場合のみトークンを受け入れることを検証する
+func FuzzParseIntrospectionResponse(f *testing.F) {
+	e := newTestEnvironment(f)
+	f.Add([]byte(`{"active":true,"sub":"auth0|seed","aud":"` + testAudience + `","client_id":"partner","exp":4102444800,"cnf":{"jkt":"` + e.dpop.jkt + `"}}`))
+	f.Add([]byte(`{"active":false}`))
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		if _, err := ParseIntrospectionResponse(input); err != nil {
+			return
+		}
+		var members map[string]any
+		if err := json.Unmarshal(input, &members); err != nil {
+			t.Fatalf("accepted an invalid response: %v", err)
+		}
+		if members["active"] != true {
+			t.Fatalf("accepted a response with active=%v", members["active"])
+		}
+	})
+}
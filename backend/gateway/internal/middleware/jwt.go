@@ -1,25 +1,200 @@
 package middleware
 
 import (
+	"context"
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
 	"math/big"
 	"net/http"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/kakke18/platform-security-poc/backend/platform/clientip"
+	"github.com/kakke18/platform-security-poc/backend/platform/logging"
+	"github.com/kakke18/platform-security-poc/backend/platform/principal"
+	"github.com/kakke18/platform-security-poc/backend/platform/telemetry"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
+// tracer はJWT検証とJWKS取得のスパンを作成する
+var tracer = telemetry.Tracer("github.com/kakke18/platform-security-poc/backend/gateway/internal/middleware")
+
+var (
+	// errUnexpectedSigningMethod はRSA以外の署名方式
+	errUnexpectedSigningMethod = errors.New("unexpected signing method")
+	// errUnknownKid はJWKSに存在しないkid
+	errUnknownKid = errors.New("unknown kid")
+	// errInvalidAudience はオーディエンスの不一致
+	errInvalidAudience = errors.New("invalid audience")
+	// errInvalidIssuer は発行者の不一致
+	errInvalidIssuer = errors.New("invalid issuer")
+	// errRevokedKid は失効させた鍵のkid
+	errRevokedKid = errors.New("revoked kid")
+	// errMissingExpiration はexpクレームがない
+	errMissingExpiration = errors.New("missing exp claim")
+	// errMissingIssuedAt はiatクレームがない
+	errMissingIssuedAt = errors.New("missing iat claim")
+	// errTokenLifetime はiatからexpまでの期間が上限を超えている
+	errTokenLifetime = errors.New("token lifetime exceeds the maximum")
+	// errUnauthorizedClient はazp・client_idが許可されたクライアントではない
+	errUnauthorizedClient = errors.New("unauthorized client")
+	// errMissingAuthorization はAuthorizationヘッダーがない
+	errMissingAuthorization = errors.New("missing authorization header")
+	// errMalformedAuthorization はAuthorizationヘッダーがBearer・DPoPトークンの形式ではない
+	errMalformedAuthorization = errors.New("malformed authorization header")
+	// errInvalidKeyEncoding はJWKの値がbase64urlとして不正
+	errInvalidKeyEncoding = errors.New("invalid key encoding")
+	// errInvalidModulus はRSAのモジュラスが空
+	errInvalidModulus = errors.New("invalid RSA modulus")
+	// errInvalidExponent はRSAの指数が範囲外
+	errInvalidExponent = errors.New("invalid RSA exponent")
+	// errWeakKey はモジュラスがminRSAKeyBits未満の鍵
+	errWeakKey = errors.New("weak RSA key")
+	// errMissingKeyID はkidのない鍵
+	errMissingKeyID = errors.New("missing kid")
+	// errKeyAlgMismatch はalgがRSAの署名アルゴリズムではない鍵
+	errKeyAlgMismatch = errors.New("alg does not match key")
+	// errDuplicateKid は同じkidで異なる鍵
+	errDuplicateKid = errors.New("duplicate kid with different key material")
+)
+
+var (
+	// jwtVerifications はJWT検証の結果（失敗時はその理由）ごとの件数
+	jwtVerifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_jwt_verifications_total",
+		Help: "Number of JWT verifications, by result.",
+	}, []string{"result"})
+
+	// jwksRefreshes はJWKSの取得結果ごとの件数
+	jwksRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_jwks_refreshes_total",
+		Help: "Number of JWKS fetches, by result.",
+	}, []string{"result"})
+
+	// jwksKeyRejections はJWKSから取り込まなかった鍵の理由ごとの件数
+	jwksKeyRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_jwks_key_rejections_total",
+		Help: "Number of JWKS keys refused on ingest, by reason.",
+	}, []string{"reason"})
+
+	// jwksKeys は保持しているJWKSの鍵の数
+	jwksKeys = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gateway_jwks_keys",
+		Help: "Number of signing keys currently loaded from JWKS.",
+	})
+
+	// jwksLastRefresh はJWKSの取得に最後に成功した時刻（UnixNano）
+	jwksLastRefresh atomic.Int64
+
+	// jwksAge はJWKSの取得に最後に成功してからの経過時間
+	jwksAge = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "gateway_jwks_age_seconds",
+		Help: "Seconds since the JWKS was last fetched successfully.",
+	}, func() float64 {
+		last := jwksLastRefresh.Load()
+		if last == 0 {
+			return 0
+		}
+		return time.Since(time.Unix(0, last)).Seconds()
+	})
+)
+
+// verificationResult はJWT検証エラーをメトリクスのresultラベルに分類する
+func verificationResult(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return "malformed"
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return "expired"
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return "not_yet_valid"
+	case errors.Is(err, errUnexpectedSigningMethod):
+		return "unexpected_signing_method"
+	case errors.Is(err, errUnknownKid):
+		return "unknown_kid"
+	case errors.Is(err, errRevokedKid):
+		return "revoked_kid"
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return "invalid_signature"
+	case errors.Is(err, errInvalidAudience):
+		return "invalid_audience"
+	case errors.Is(err, errInvalidIssuer):
+		return "invalid_issuer"
+	case errors.Is(err, errMissingExpiration):
+		return "missing_exp"
+	case errors.Is(err, errMissingIssuedAt):
+		return "missing_iat"
+	case errors.Is(err, errTokenLifetime):
+		return "lifetime_exceeded"
+	case errors.Is(err, errUnauthorizedClient):
+		return "unauthorized_client"
+	case errors.Is(err, errTokenInactive):
+		return "inactive"
+	default:
+		return "invalid"
+	}
+}
+
+// VerificationError はJWT検証の失敗で、どの検証に失敗したかを表す
+type VerificationError struct {
+	// Reason は失敗した検証（メトリクスのresultラベル・セキュリティイベントの理由と同じ値）
+	// 例: malformed、expired、invalid_signature、lifetime_exceeded、unauthorized_client
+	Reason string
+
+	Err error
+}
+
+func (e *VerificationError) Error() string {
+	return e.Reason + ": " + e.Err.Error()
+}
+
+func (e *VerificationError) Unwrap() error {
+	return e.Err
+}
+
+// keyRejectionReason はJWKSの鍵を取り込まなかった理由をメトリクスのreasonラベルに分類する
+func keyRejectionReason(err error) string {
+	switch {
+	case errors.Is(err, errInvalidKeyEncoding):
+		return "invalid_encoding"
+	case errors.Is(err, errInvalidModulus):
+		return "invalid_modulus"
+	case errors.Is(err, errInvalidExponent):
+		return "invalid_exponent"
+	case errors.Is(err, errWeakKey):
+		return "weak_key"
+	case errors.Is(err, errMissingKeyID):
+		return "missing_kid"
+	case errors.Is(err, errKeyAlgMismatch):
+		return "alg_mismatch"
+	case errors.Is(err, errDuplicateKid):
+		return "duplicate_kid"
+	default:
+		return "invalid"
+	}
+}
+
 // JWKSKey はAuth0のJWKSから取得した単一の鍵を表す
 type JWKSKey struct {
 	Kty string   `json:"kty"`
 	Kid string   `json:"kid"`
 	Use string   `json:"use"`
+	Alg string   `json:"alg"`
 	N   string   `json:"n"`
 	E   string   `json:"e"`
 	X5c []string `json:"x5c"`
@@ -30,45 +205,307 @@ type JWKS struct {
 	Keys []JWKSKey `json:"keys"`
 }
 
+// maxJWKSBytes はJWKSのレスポンスの上限
+const maxJWKSBytes = 1 << 20
+
+// minRSAKeyBits は取り込むRSA鍵のモジュラスの最小ビット数
+const minRSAKeyBits = 2048
+
+// keyAlgs は鍵のalgとして受け入れる署名アルゴリズム（署名の検証はSigningMethodRSAのみ）
+var keyAlgs = []string{"RS256", "RS384", "RS512"}
+
+// SigningKey はJWKSから取り込んだ署名検証用の鍵
+type SigningKey struct {
+	// Key はRSA公開鍵
+	Key *rsa.PublicKey
+
+	// Alg は鍵に指定された署名アルゴリズム（未指定の場合は空で、RSAの署名アルゴリズムを全て許可する）
+	Alg string
+}
+
+// equal は同じ鍵かどうかを返す
+func (k *SigningKey) equal(other *SigningKey) bool {
+	return k.Key.Equal(other.Key) && k.Alg == other.Alg
+}
+
+// KeyRejection はJWKSから取り込まなかった鍵とその理由
+type KeyRejection struct {
+	Kid string
+	Err error
+}
+
+// RSAPublicKey はJWKのモジュラスと指数からRSA公開鍵を作成する
+// minRSAKeyBits未満のモジュラス、intに収まらない指数や偶数・3未満の指数を拒否する
+func (k JWKSKey) RSAPublicKey() (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("%w: n: %v", errInvalidKeyEncoding, err)
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("%w: e: %v", errInvalidKeyEncoding, err)
+	}
+
+	n := new(big.Int).SetBytes(nBytes)
+	if n.Sign() == 0 {
+		return nil, errInvalidModulus
+	}
+	if n.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("%w: %d bits", errWeakKey, n.BitLen())
+	}
+
+	// 上位のバイトから順に読み、桁あふれする前に打ち切る
+	var e uint64
+	for _, b := range eBytes {
+		e = e<<8 | uint64(b)
+		if e > math.MaxInt32 {
+			return nil, fmt.Errorf("%w: exceeds %d", errInvalidExponent, math.MaxInt32)
+		}
+	}
+	if e < 3 || e%2 == 0 {
+		return nil, fmt.Errorf("%w: %d", errInvalidExponent, e)
+	}
+
+	return &rsa.PublicKey{N: n, E: int(e)}, nil
+}
+
+// ParseJWKS はJWKSを解析し、署名用のRSA鍵をkidごとの署名検証用の鍵に変換する
+// RSA以外の鍵と署名用（use=sig）以外の鍵は対象外とし、検証に失敗した鍵は除外してrejectedに理由を返す
+// JSONとして不正な場合のみエラーを返す
+func ParseJWKS(b []byte) (keys map[string]*SigningKey, rejected []KeyRejection, err error) {
+	var jwks JWKS
+	if err := json.Unmarshal(b, &jwks); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	var signing []JWKSKey
+	for _, key := range jwks.Keys {
+		if key.Kty == "RSA" && key.Use == "sig" {
+			signing = append(signing, key)
+		}
+	}
+
+	// 同じkidで異なる鍵がある場合はどちらが正しいか判断できないため、そのkidの鍵は全て取り込まない
+	material := make(map[string]JWKSKey)
+	ambiguous := make(map[string]bool)
+	for _, key := range signing {
+		if prev, ok := material[key.Kid]; ok && (prev.N != key.N || prev.E != key.E || prev.Alg != key.Alg) {
+			ambiguous[key.Kid] = true
+		}
+		material[key.Kid] = key
+	}
+
+	keys = make(map[string]*SigningKey)
+	for _, key := range signing {
+		if ambiguous[key.Kid] {
+			if _, ok := material[key.Kid]; ok {
+				rejected = append(rejected, KeyRejection{Kid: key.Kid, Err: errDuplicateKid})
+				delete(material, key.Kid)
+			}
+			continue
+		}
+		if key.Kid == "" {
+			rejected = append(rejected, KeyRejection{Kid: key.Kid, Err: errMissingKeyID})
+			continue
+		}
+		if key.Alg != "" && !slices.Contains(keyAlgs, key.Alg) {
+			rejected = append(rejected, KeyRejection{Kid: key.Kid, Err: fmt.Errorf("%w: %s", errKeyAlgMismatch, key.Alg)})
+			continue
+		}
+		pub, err := key.RSAPublicKey()
+		if err != nil {
+			rejected = append(rejected, KeyRejection{Kid: key.Kid, Err: err})
+			continue
+		}
+		keys[key.Kid] = &SigningKey{Key: pub, Alg: key.Alg}
+	}
+	return keys, rejected, nil
+}
+
 // JWTClaims はJWTのクレームを表す
 type JWTClaims struct {
 	jwt.RegisteredClaims
-	Email         string `json:"email"`
-	EmailVerified bool   `json:"email_verified"`
-	Name          string `json:"name"`
-	Picture       string `json:"picture"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Name          string   `json:"name"`
+	Picture       string   `json:"picture"`
+	Scope         string   `json:"scope"`
+	Permissions   []string `json:"permissions"`
+
+	// AuthorizedParty はトークンを取得したクライアント（Auth0はazpに設定する）
+	AuthorizedParty string `json:"azp"`
+	// ClientIDClaim はトークンを取得したクライアント（RFC 9068、azpがない場合に使用する）
+	ClientIDClaim string `json:"client_id"`
+
+	// ACR・AMR・AuthTime はユーザーの認証の強度と時刻（OIDC Core、ステップアップ認証の判定に使用する）
+	ACR      string           `json:"acr"`
+	AMR      []string         `json:"amr"`
+	AuthTime *jwt.NumericDate `json:"auth_time"`
+
+	// Confirmation はDPoPで送信者制約されたトークンの鍵（RFC 9449、ない場合はBearerトークン）
+	Confirmation *Confirmation `json:"cnf"`
+}
+
+// ClientID はトークンを取得したクライアントのIDを返す
+func (c *JWTClaims) ClientID() string {
+	if c.AuthorizedParty != "" {
+		return c.AuthorizedParty
+	}
+	return c.ClientIDClaim
+}
+
+// ClaimPolicy は署名・発行者・オーディエンス以外のクレームの検証の設定
+type ClaimPolicy struct {
+	// Leeway はexp・nbf・iatの検証で許容する時計のずれ
+	Leeway time.Duration
+
+	// MaxLifetime はiatからexpまでの期間の上限（0の場合は検証しない）
+	MaxLifetime time.Duration
+
+	// AllowedClientIDs はazp（ない場合はclient_id）として受け入れるクライアントID（空の場合は全て拒否する）
+	AllowedClientIDs []string
+}
+
+// validate はexp・iatの有無、有効期間の上限、クライアントを検証する
+// exp・nbf・iatの時刻はトークンの解析時にLeewayを考慮して検証済み
+func (p *ClaimPolicy) validate(c *JWTClaims) error {
+	if c.ExpiresAt == nil {
+		return errMissingExpiration
+	}
+	if c.IssuedAt == nil {
+		return errMissingIssuedAt
+	}
+	return p.validateLifetimeAndClient(c)
+}
+
+// validateLifetimeAndClient はexpの有無、iatがある場合は有効期間の上限、クライアントを検証する
+func (p *ClaimPolicy) validateLifetimeAndClient(c *JWTClaims) error {
+	if c.ExpiresAt == nil {
+		return errMissingExpiration
+	}
+	if p.MaxLifetime > 0 && c.IssuedAt != nil {
+		if lifetime := c.ExpiresAt.Sub(c.IssuedAt.Time); lifetime > p.MaxLifetime {
+			return fmt.Errorf("%w: %s > %s", errTokenLifetime, lifetime, p.MaxLifetime)
+		}
+	}
+	if !slices.Contains(p.AllowedClientIDs, c.ClientID()) {
+		return fmt.Errorf("%w: %q", errUnauthorizedClient, c.ClientID())
+	}
+	return nil
+}
+
+// Scopes はscopeクレームとpermissionsクレームを合わせたスコープの一覧を返す
+func (c *JWTClaims) Scopes() []string {
+	scopes := strings.Fields(c.Scope)
+	for _, p := range c.Permissions {
+		if !slices.Contains(scopes, p) {
+			scopes = append(scopes, p)
+		}
+	}
+	return scopes
+}
+
+// Policy は設定の再読み込みで差し替えるJWT検証の設定
+type Policy struct {
+	// RevokedKeyIDs は失効させる鍵のkid（JWKSに含まれていても、これらの鍵で署名されたトークンは拒否する）
+	RevokedKeyIDs []string
+
+	// Claims はクレームの検証の設定
+	Claims ClaimPolicy
+
+	// DPoP はDPoPによる送信者制約の設定
+	DPoP DPoPPolicy
 }
 
 // JWTMiddleware はJWT検証ミドルウェアを提供する
+// 検証の設定は不変で、設定を差し替える場合はWithPolicyで鍵やキャッシュを共有する新しいミドルウェアを作成する
 type JWTMiddleware struct {
-	domain    string
+	*verifier
+
+	// revoked は失効させる鍵のkid
+	revoked map[string]bool
+
+	// policy はクレームの検証の設定
+	policy *ClaimPolicy
+
+	// dpop はDPoPによる送信者制約の設定
+	dpop *DPoPPolicy
+}
+
+// verifier は設定を差し替えたJWTMiddlewareの間で共有する、JWKSの鍵とキャッシュ
+type verifier struct {
+	issuer    string
+	jwksURL   string
 	audience  string
-	keys      map[string]*rsa.PublicKey
+	keys      map[string]*SigningKey
 	keysMu    sync.RWMutex
 	lastFetch time.Time
+
+	// replays は使用済みのDPoPプルーフのjti
+	replays *replayCache
+	// workspaces はワークスペースごとにDPoPを必須とする場合にワークスペースを解決する
+	workspaces WorkspaceLookup
+
+	// introspector はJWTではないトークンをイントロスペクションで検証する（nilの場合はJWTのみを受け入れる）
+	introspector *Introspector
+
+	// refreshMu は未知のkidによるJWKSの再取得を1つに制限する
+	refreshMu sync.Mutex
+}
+
+// jwksMaxAge はJWKSを再取得せずに使用し続けてよい期間（レディネスチェックで確認）
+const jwksMaxAge = time.Hour
+
+// jwksClient はJWKS取得用のHTTPクライアント（トレースコンテキストを伝播する）
+var jwksClient = &http.Client{
+	Timeout:   10 * time.Second,
+	Transport: telemetry.Transport(http.DefaultTransport),
 }
 
 // NewJWTMiddleware は新しいJWTミドルウェアを作成する
-func NewJWTMiddleware(domain, audience string) (*JWTMiddleware, error) {
+// issuerは末尾のスラッシュを含む発行者（例: https://your-tenant.auth0.com/）で、JWKSは<issuer>.well-known/jwks.jsonから取得する
+func NewJWTMiddleware(issuer, audience string) (*JWTMiddleware, error) {
 	m := &JWTMiddleware{
-		domain:   domain,
-		audience: audience,
-		keys:     make(map[string]*rsa.PublicKey),
+		verifier: &verifier{
+			issuer:   issuer,
+			jwksURL:  issuer + ".well-known/jwks.json",
+			audience: audience,
+			keys:     make(map[string]*SigningKey),
+			replays:  newReplayCache(),
+		},
+		policy: &ClaimPolicy{},
+		dpop:   &DPoPPolicy{ProofMaxAge: defaultDPoPProofMaxAge, ReplayCacheSize: defaultDPoPReplayCacheSize, ReplayCachePerKey: defaultDPoPReplayCachePerKey},
 	}
 
 	// 初期化時にJWKS鍵を取得
-	if err := m.fetchJWKS(); err != nil {
+	if err := m.fetchJWKS(context.Background()); err != nil {
 		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
 	}
 
 	return m, nil
 }
 
-// fetchJWKS はAuth0からJWKSを取得する
-func (m *JWTMiddleware) fetchJWKS() error {
-	jwksURL := fmt.Sprintf("https://%s/.well-known/jwks.json", m.domain)
+// fetchJWKS は発行者からJWKSを取得する
+func (m *JWTMiddleware) fetchJWKS(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "jwks.fetch")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "failed to fetch JWKS")
+			jwksRefreshes.WithLabelValues("failure").Inc()
+		} else {
+			jwksRefreshes.WithLabelValues("success").Inc()
+		}
+		span.End()
+	}()
+
+	span.SetAttributes(attribute.String("jwks.url", m.jwksURL))
 
-	resp, err := http.Get(jwksURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.jwksURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+	resp, err := jwksClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to fetch JWKS: %w", err)
 	}
@@ -78,55 +515,99 @@ func (m *JWTMiddleware) fetchJWKS() error {
 		return fmt.Errorf("failed to fetch JWKS: status=%d", resp.StatusCode)
 	}
 
-	var jwks JWKS
-	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
-		return fmt.Errorf("failed to decode JWKS: %w", err)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSBytes+1))
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS: %w", err)
+	}
+	if len(body) > maxJWKSBytes {
+		return fmt.Errorf("JWKS exceeds %d bytes", maxJWKSBytes)
+	}
+
+	keys, rejected, err := ParseJWKS(body)
+	if err != nil {
+		return err
 	}
 
 	m.keysMu.Lock()
 	defer m.keysMu.Unlock()
 
-	// JWKSをRSA公開鍵に変換
-	for _, key := range jwks.Keys {
-		if key.Kty != "RSA" || key.Use != "sig" {
+	for kid, key := range keys {
+		// 取り込み済みのkidの鍵が差し替えられた場合は、取り込み済みの鍵を使用し続ける
+		if loaded, ok := m.keys[kid]; ok && !loaded.equal(key) {
+			rejected = append(rejected, KeyRejection{Kid: kid, Err: fmt.Errorf("%w: differs from the loaded key", errDuplicateKid)})
 			continue
 		}
+		m.keys[kid] = key
+	}
+	for _, r := range rejected {
+		rejectKey(ctx, r)
+	}
 
-		// N（モジュラス）をデコード
-		nBytes, err := base64.RawURLEncoding.DecodeString(key.N)
-		if err != nil {
-			slog.Warn("failed to decode N", slog.String("kid", key.Kid), slog.String("error", err.Error()))
-			continue
-		}
+	m.lastFetch = time.Now()
+	jwksLastRefresh.Store(m.lastFetch.UnixNano())
+	jwksKeys.Set(float64(len(m.keys)))
+	span.SetAttributes(attribute.Int("jwks.keys", len(m.keys)))
 
-		// E（指数）をデコード
-		eBytes, err := base64.RawURLEncoding.DecodeString(key.E)
-		if err != nil {
-			slog.Warn("failed to decode E", slog.String("kid", key.Kid), slog.String("error", err.Error()))
-			continue
-		}
+	return nil
+}
 
-		// RSA公開鍵を作成
-		var e int
-		for _, b := range eBytes {
-			e = e<<8 + int(b)
-		}
+// rejectKey はJWKSの鍵を取り込まなかったことをメトリクス・ログ・セキュリティイベントに記録する
+func rejectKey(ctx context.Context, r KeyRejection) {
+	reason := keyRejectionReason(r.Err)
+	jwksKeyRejections.WithLabelValues(reason).Inc()
+	slog.WarnContext(ctx, "Rejected JWKS key",
+		slog.String("kid", r.Kid),
+		slog.String("reason", reason),
+		slog.String("error", r.Err.Error()),
+	)
+	logging.EmitSecurityEvent(ctx, logging.SecurityEvent{
+		Category: logging.CategoryConfiguration,
+		Action:   logging.ActionJWKSKeyRejection,
+		Reason:   fmt.Sprintf("%s: kid=%s", reason, r.Kid),
+	})
+}
 
-		pubKey := &rsa.PublicKey{
-			N: new(big.Int).SetBytes(nBytes),
-			E: e,
-		}
+// CheckJWKS はJWKSの鍵を保持しており、一定期間内に取得できていることを確認する
+// 取得から時間が経っている場合は再取得を試みる
+func (m *JWTMiddleware) CheckJWKS(ctx context.Context) error {
+	m.keysMu.RLock()
+	age := time.Since(m.lastFetch)
+	m.keysMu.RUnlock()
 
-		m.keys[key.Kid] = pubKey
+	if age > jwksMaxAge {
+		if err := m.fetchJWKS(ctx); err != nil {
+			return fmt.Errorf("JWKS is stale (fetched %s ago): %w", age.Round(time.Second), err)
+		}
 	}
 
-	m.lastFetch = time.Now()
-
+	m.keysMu.RLock()
+	defer m.keysMu.RUnlock()
+	if len(m.keys) == 0 {
+		return errors.New("no signing keys loaded from JWKS")
+	}
 	return nil
 }
 
-// getKey は指定されたkidの公開鍵を返す
-func (m *JWTMiddleware) getKey(kid string) (*rsa.PublicKey, error) {
+// WithPolicy はJWKSの鍵・DPoPプルーフのjti・イントロスペクションの結果を共有し、検証の設定のみをpに差し替えたミドルウェアを返す
+func (m *JWTMiddleware) WithPolicy(p Policy) *JWTMiddleware {
+	revoked := make(map[string]bool, len(p.RevokedKeyIDs))
+	for _, kid := range p.RevokedKeyIDs {
+		revoked[kid] = true
+	}
+	return &JWTMiddleware{
+		verifier: m.verifier,
+		revoked:  revoked,
+		policy:   &p.Claims,
+		dpop:     &p.DPoP,
+	}
+}
+
+// getKey は指定されたkidの署名検証用の鍵を返す
+func (m *JWTMiddleware) getKey(ctx context.Context, kid string) (*SigningKey, error) {
+	if m.revoked[kid] {
+		return nil, fmt.Errorf("%w: %s", errRevokedKid, kid)
+	}
+
 	m.keysMu.RLock()
 	key, exists := m.keys[kid]
 	m.keysMu.RUnlock()
@@ -136,28 +617,62 @@ func (m *JWTMiddleware) getKey(kid string) (*rsa.PublicKey, error) {
 	}
 
 	// 鍵が見つからない場合、JWKSを更新（最大1分に1回）
-	m.keysMu.Lock()
-	defer m.keysMu.Unlock()
+	// fetchJWKSがkeysMuを取得するため、ここではrefreshMuのみを保持する
+	m.refreshMu.Lock()
+	defer m.refreshMu.Unlock()
+
+	m.keysMu.RLock()
+	key, exists = m.keys[kid]
+	lastFetch := m.lastFetch
+	m.keysMu.RUnlock()
+
+	// 待機中に他のリクエストが再取得した場合
+	if exists {
+		return key, nil
+	}
 
-	if time.Since(m.lastFetch) > time.Minute {
-		if err := m.fetchJWKS(); err != nil {
+	if time.Since(lastFetch) > time.Minute {
+		if err := m.fetchJWKS(ctx); err != nil {
 			return nil, fmt.Errorf("failed to refresh JWKS: %w", err)
 		}
 
-		if key, exists := m.keys[kid]; exists {
+		m.keysMu.RLock()
+		key, exists = m.keys[kid]
+		m.keysMu.RUnlock()
+		if exists {
 			return key, nil
 		}
 	}
 
-	return nil, fmt.Errorf("key with kid=%s not found", kid)
+	return nil, fmt.Errorf("%w: %s", errUnknownKid, kid)
 }
 
 // VerifyToken はJWTトークンを検証する
-func (m *JWTMiddleware) VerifyToken(tokenString string) (*JWTClaims, error) {
+// 検証に失敗した場合は失敗した検証を表す*VerificationErrorを返す
+func (m *JWTMiddleware) VerifyToken(ctx context.Context, tokenString string) (_ *JWTClaims, err error) {
+	ctx, span := tracer.Start(ctx, "jwt.verify")
+	defer func() {
+		result := verificationResult(err)
+		if err != nil {
+			err = &VerificationError{Reason: result, Err: err}
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "JWT verification failed")
+		}
+		jwtVerifications.WithLabelValues(result).Inc()
+		span.End()
+	}()
+
+	policy := m.policy
+
+	// base64urlのデコードは改行を読み飛ばすため、compact形式以外の文字を含むトークンは先に拒否する
+	if !isCompactJWS(tokenString) {
+		return nil, fmt.Errorf("failed to parse token: %w: unexpected characters", jwt.ErrTokenMalformed)
+	}
+
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
 		// 署名方式を検証
 		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			return nil, fmt.Errorf("%w: %v", errUnexpectedSigningMethod, token.Header["alg"])
 		}
 
 		// ヘッダーからkidを取得
@@ -167,8 +682,18 @@ func (m *JWTMiddleware) VerifyToken(tokenString string) (*JWTClaims, error) {
 		}
 
 		// 公開鍵を取得
-		return m.getKey(kid)
-	})
+		span.SetAttributes(attribute.String("jwt.kid", kid))
+		key, err := m.getKey(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+
+		// 鍵にalgが指定されている場合は、トークンの署名アルゴリズムと一致すること
+		if key.Alg != "" && key.Alg != token.Method.Alg() {
+			return nil, fmt.Errorf("%w: %s does not match key alg %s", errUnexpectedSigningMethod, token.Method.Alg(), key.Alg)
+		}
+		return key.Key, nil
+	}, jwt.WithStrictDecoding(), jwt.WithLeeway(policy.Leeway), jwt.WithIssuedAt())
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
@@ -189,49 +714,175 @@ func (m *JWTMiddleware) VerifyToken(tokenString string) (*JWTClaims, error) {
 			}
 		}
 		if !found {
-			return nil, fmt.Errorf("invalid audience")
+			return nil, errInvalidAudience
 		}
 	}
 
 	// 発行者を検証
-	expectedIssuer := fmt.Sprintf("https://%s/", m.domain)
-	if claims.Issuer != expectedIssuer {
-		return nil, fmt.Errorf("invalid issuer: expected=%s, got=%s", expectedIssuer, claims.Issuer)
+	if claims.Issuer != m.issuer {
+		return nil, fmt.Errorf("%w: expected=%s, got=%s", errInvalidIssuer, m.issuer, claims.Issuer)
+	}
+
+	// exp・iatの有無、有効期間の上限、クライアントを検証
+	if err := policy.validate(claims); err != nil {
+		return nil, err
 	}
 
 	return claims, nil
 }
 
-// Middleware はJWTを検証し、subをX-Auth0-User-IDヘッダーとして下流サービスに転送する
+// Authorizationヘッダーのスキーム
+const (
+	// SchemeBearer はBearerトークン（RFC 6750）
+	SchemeBearer = "Bearer"
+
+	// SchemeDPoP はDPoPで送信者制約されたトークン（RFC 9449）
+	SchemeDPoP = "DPoP"
+)
+
+// ParseAuthorization はAuthorizationヘッダーからスキーム（SchemeBearerまたはSchemeDPoP）とトークンを取り出す
+// スキームは大文字・小文字を区別せず、トークンはb64tokenの文字のみを許可する
+func ParseAuthorization(header string) (scheme, token string, err error) {
+	if header == "" {
+		return "", "", errMissingAuthorization
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !isB64Token(token) {
+		return "", "", errMalformedAuthorization
+	}
+	switch {
+	case strings.EqualFold(scheme, SchemeBearer):
+		return SchemeBearer, token, nil
+	case strings.EqualFold(scheme, SchemeDPoP):
+		return SchemeDPoP, token, nil
+	default:
+		return "", "", errMalformedAuthorization
+	}
+}
+
+// isB64Token はRFC 6750のb64token（1*( ALPHA / DIGIT / "-" / "." / "_" / "~" / "+" / "/" ) *"="）かどうかを返す
+func isB64Token(s string) bool {
+	body := strings.TrimRight(s, "=")
+	if body == "" {
+		return false
+	}
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("-._~+/", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isCompactJWS はトークンがbase64urlの文字からなる3つのセグメント（JWS compact形式）かどうかを返す
+func isCompactJWS(s string) bool {
+	segments := 1
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '.':
+			segments++
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return segments == 3
+}
+
+// Middleware はJWT（イントロスペクションを設定している場合はopaqueトークンも）を検証し、Principalをcontextに格納して下流サービスにヘッダーとして転送する
 func (m *JWTMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// クライアントが偽装した検証済みヘッダーを削除
+		principal.DelHeader(r.Header)
+
 		// Authorizationヘッダーからトークンを抽出
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
+		scheme, tokenString, err := ParseAuthorization(r.Header.Get("Authorization"))
+		if errors.Is(err, errMissingAuthorization) {
+			jwtVerifications.WithLabelValues("missing_header").Inc()
+			emitAuthenticationFailure(r, "missing_header")
 			http.Error(w, "Missing Authorization header", http.StatusUnauthorized)
 			return
 		}
-
-		// "Bearer <token>"をパース
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
+		if err != nil {
+			jwtVerifications.WithLabelValues("malformed_header").Inc()
+			emitAuthenticationFailure(r, "malformed_header")
 			http.Error(w, "Invalid Authorization header format", http.StatusUnauthorized)
 			return
 		}
 
-		tokenString := parts[1]
-
 		// トークンを検証
-		claims, err := m.VerifyToken(tokenString)
+		claims, err := m.verify(r.Context(), tokenString)
+		if errors.Is(err, errIntrospection) {
+			slog.ErrorContext(r.Context(), "failed to introspect token", slog.String("error", err.Error()))
+			http.Error(w, "Failed to introspect token", http.StatusBadGateway)
+			return
+		}
 		if err != nil {
-			slog.Warn("JWT verification failed", slog.String("error", err.Error()))
+			// エラーメッセージにはトークン由来の値が含まれ得るため、分類した理由のみを記録する
+			reason := "invalid"
+			var verr *VerificationError
+			if errors.As(err, &verr) {
+				reason = verr.Reason
+			}
+			slog.WarnContext(r.Context(), "JWT verification failed", slog.String("reason", reason))
+			emitAuthenticationFailure(r, reason)
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
 
-		// Auth0ユーザーIDをヘッダーに追加（下流サービスで使用）
-		r.Header.Set("X-Auth0-User-ID", claims.Subject)
+		// DPoPで送信者制約されたトークンはプルーフを検証し、DPoPを必須とするクライアント・ワークスペースのBearerトークンを拒否する
+		if err := m.VerifySenderConstraint(r, scheme, tokenString, claims); err != nil {
+			var verr *VerificationError
+			if !errors.As(err, &verr) {
+				slog.ErrorContext(r.Context(), "failed to verify sender constraint", slog.String("error", err.Error()))
+				http.Error(w, "Failed to resolve workspace user", http.StatusBadGateway)
+				return
+			}
+			slog.WarnContext(r.Context(), "DPoP verification failed", slog.String("reason", verr.Reason))
+			emitAuthenticationFailure(r, verr.Reason)
+			w.Header().Set("WWW-Authenticate", DPoPChallenge(verr.Reason))
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		// 検証済みのPrincipalをヘッダーとcontextに設定（下流サービスで使用）
+		p := &principal.Principal{
+			Subject: claims.Subject,
+			Scopes:  claims.Scopes(),
+			ACR:     claims.ACR,
+			AMR:     claims.AMR,
+		}
+		if claims.AuthTime != nil {
+			p.AuthTime = claims.AuthTime.Time
+		}
+		p.SetHeader(r.Header)
+		r = r.WithContext(principal.NewContext(r.Context(), p))
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// verify はJWTを署名で検証する
+// イントロスペクションを設定している場合、JWS compact形式ではないトークンはイントロスペクションで検証する
+func (m *JWTMiddleware) verify(ctx context.Context, token string) (*JWTClaims, error) {
+	if m.introspector != nil && !isCompactJWS(token) {
+		return m.VerifyOpaqueToken(ctx, token)
+	}
+	return m.VerifyToken(ctx, token)
+}
+
+// emitAuthenticationFailure はJWT検証の失敗をセキュリティイベントとして記録する
+func emitAuthenticationFailure(r *http.Request, reason string) {
+	logging.EmitSecurityEvent(r.Context(), logging.SecurityEvent{
+		Category: logging.CategoryAuthentication,
+		Action:   logging.ActionJWTVerification,
+		Reason:   reason,
+		SourceIP: clientip.String(r.Context()),
+		Path:     r.URL.Path,
+	})
+}
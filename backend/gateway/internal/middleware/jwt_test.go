@@ -0,0 +1,516 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// testIssuer はテストで信頼する発行者
+	testIssuer = "https://issuer.fuzz.platform-security-poc.local/"
+	// testAudience はテストで検証するトークンのオーディエンス
+	testAudience = "https://fuzz.platform-security-poc.local"
+	// testClientID はテストで許可するクライアント（azp）
+	testClientID = "fuzz-client"
+	// iterations は乱数で入力を変えて検証するテストの試行回数
+	iterations = 50
+)
+
+// テスト用のJWKSに公開する鍵のkid
+const (
+	// kidGood は署名に使用する正しい鍵
+	kidGood = "good"
+	// kidOverflowExponent は正しい鍵のモジュラスと、intに収まらない指数（下位のバイトは65537）の鍵
+	kidOverflowExponent = "overflow-exponent"
+	// kidTinyModulus は64ビットのモジュラスの鍵
+	kidTinyModulus = "tiny-modulus"
+	// kidEncryption は暗号化用（use=enc）の鍵
+	kidEncryption = "encryption"
+	// kidPSS は正しい鍵で、algがPS256の鍵
+	kidPSS = "pss"
+	// kidRS512 は正しい鍵で、algがRS512の鍵（RS256で署名したトークンは拒否する）
+	kidRS512 = "rs512"
+	// kidDuplicate は正しい鍵と別の鍵に同じkidを付与した鍵
+	kidDuplicate = "duplicate"
+)
+
+// testEnvironment は細工した鍵を含むJWKSと、それを信頼するJWTミドルウェア
+// ファジングのワーカー間で発行したトークンが一致するように、鍵はtestdataから読み込み、iatは1時間単位に切り捨てる
+type testEnvironment struct {
+	key  *rsa.PrivateKey
+	jwks []byte
+	jwt  *JWTMiddleware
+	dpop *dpopKey
+}
+
+// roundTripFunc は関数をhttp.RoundTripperとして使用する
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// newTestEnvironment はJWKSをtestIssuerから取得したJWTミドルウェアを作成する
+func newTestEnvironment(tb testing.TB) *testEnvironment {
+	tb.Helper()
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(readTestdata(tb, "signing-key.pem"))
+	if err != nil {
+		tb.Fatalf("failed to parse signing key: %v", err)
+	}
+	dpopKey, err := loadDPoPKey(readTestdata(tb, "dpop-key.pem"))
+	if err != nil {
+		tb.Fatalf("failed to parse DPoP key: %v", err)
+	}
+
+	n := base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+	e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	tiny := new(big.Int).Lsh(big.NewInt(1), 63)
+	tiny.Add(tiny, big.NewInt(1))
+	other := new(big.Int).Add(key.N, big.NewInt(2))
+
+	jwks, err := json.Marshal(JWKS{Keys: []JWKSKey{
+		{Kty: "RSA", Kid: kidGood, Use: "sig", N: n, E: e},
+		{Kty: "RSA", Kid: kidOverflowExponent, Use: "sig", N: n, E: base64.RawURLEncoding.EncodeToString([]byte{1, 0, 0, 0, 0, 0, 1, 0, 1})},
+		{Kty: "RSA", Kid: kidTinyModulus, Use: "sig", N: base64.RawURLEncoding.EncodeToString(tiny.Bytes()), E: e},
+		{Kty: "RSA", Kid: kidEncryption, Use: "enc", N: n, E: e},
+		{Kty: "RSA", Kid: kidPSS, Use: "sig", Alg: "PS256", N: n, E: e},
+		{Kty: "RSA", Kid: kidRS512, Use: "sig", Alg: "RS512", N: n, E: e},
+		{Kty: "RSA", Kid: kidDuplicate, Use: "sig", N: n, E: e},
+		{Kty: "RSA", Kid: kidDuplicate, Use: "sig", N: base64.RawURLEncoding.EncodeToString(other.Bytes()), E: e},
+	}})
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	// JWKSの取得先をメモリ上のレスポンスに差し替える
+	original := jwksClient
+	jwksClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		w := httptest.NewRecorder()
+		if r.URL.String() != testIssuer+".well-known/jwks.json" {
+			http.NotFound(w, r)
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(jwks)
+		}
+		return w.Result(), nil
+	})}
+	tb.Cleanup(func() { jwksClient = original })
+
+	m, err := NewJWTMiddleware(testIssuer, testAudience)
+	if err != nil {
+		tb.Fatalf("failed to create JWT middleware: %v", err)
+	}
+	m = m.WithPolicy(Policy{Claims: ClaimPolicy{AllowedClientIDs: []string{testClientID}}, DPoP: *m.dpop})
+	return &testEnvironment{key: key, jwks: jwks, jwt: m, dpop: dpopKey}
+}
+
+// readTestdata はtestdataのファイルを読み込む
+func readTestdata(tb testing.TB, name string) []byte {
+	tb.Helper()
+	b, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
+
+// claims は検証に成功する標準的なクレームを返す
+func (e *testEnvironment) claims(subject string) jwt.MapClaims {
+	iat := time.Now().Truncate(time.Hour)
+	return jwt.MapClaims{
+		"iss": testIssuer,
+		"aud": testAudience,
+		"sub": subject,
+		"azp": testClientID,
+		"iat": iat.Unix(),
+		"exp": iat.Add(2 * time.Hour).Unix(),
+	}
+}
+
+// sign は正しい鍵でクレームに署名し、ヘッダーのkidを指定されたものにする（空の場合は付与しない）
+func (e *testEnvironment) sign(kid string, claims jwt.Claims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(e.key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+// issue は検証に成功するトークンを発行する
+func (e *testEnvironment) issue(subject string) string {
+	return e.sign(kidGood, e.claims(subject))
+}
+
+// wasIssued はトークンが正しい鍵のkidとRS256でsignが署名したものそのものかどうかを返す
+// RS256の署名は決定的なため、署名し直して比較する
+func (e *testEnvironment) wasIssued(token string) bool {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return false
+	}
+	header, _, _ := strings.Cut(token, ".")
+	b, err := base64.RawURLEncoding.DecodeString(header)
+	if err != nil {
+		return false
+	}
+	var h struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(b, &h); err != nil || h.Alg != "RS256" || h.Kid != kidGood {
+		return false
+	}
+	signature, err := jwt.SigningMethodRS256.Sign(token[:i], e.key)
+	if err != nil {
+		return false
+	}
+	return token[i+1:] == base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// verify はJWTミドルウェアでトークンを検証する
+func (e *testEnvironment) verify(token string) error {
+	_, err := e.jwt.VerifyToken(context.Background(), token)
+	return err
+}
+
+// randomSubject はランダムなsubjectを返す
+func randomSubject(rng *rand.Rand) string {
+	return fmt.Sprintf("auth0|%016x", rng.Uint64())
+}
+
+// splitToken はトークンをヘッダー・ペイロード・署名に分割する
+func splitToken(token string) (header, payload, signature string) {
+	parts := strings.Split(token, ".")
+	return parts[0], parts[1], parts[2]
+}
+
+// encodeSegment は値をJSONにしてbase64urlでエンコードする
+func encodeSegment(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// base64URLAlphabet はbase64urlの文字（インデックスが値）
+const base64URLAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+func TestVerifyTokenAcceptsIssuedToken(t *testing.T) {
+	e := newTestEnvironment(t)
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	// 他のテストが常に拒否されるだけで成功しないように、正しいトークンが受け入れられることを確認する
+	for range iterations {
+		if err := e.verify(e.issue(randomSubject(rng))); err != nil {
+			t.Fatalf("issued token was rejected: %v", err)
+		}
+	}
+}
+
+func TestVerifyTokenRejects(t *testing.T) {
+	e := newTestEnvironment(t)
+
+	tests := []struct {
+		name  string
+		token func(rng *rand.Rand) string
+	}{
+		{
+			name: "alg none",
+			token: func(rng *rand.Rand) string {
+				alg := []string{"none", "None", "NONE", "nOnE"}[rng.IntN(4)]
+				header := encodeSegment(map[string]any{"alg": alg, "typ": "JWT", "kid": kidGood})
+				payload := encodeSegment(e.claims(randomSubject(rng)))
+				signature := []string{"", strings.Split(e.issue("auth0|other"), ".")[2]}[rng.IntN(2)]
+				return header + "." + payload + "." + signature
+			},
+		},
+		{
+			// 公開鍵をHMACの共通鍵として署名する鍵の取り違え
+			name: "HMAC signed with the public key",
+			token: func(rng *rand.Rand) string {
+				der, err := x509.MarshalPKIXPublicKey(&e.key.PublicKey)
+				if err != nil {
+					panic(err)
+				}
+				secrets := [][]byte{der, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), e.key.N.Bytes()}
+				method := []jwt.SigningMethod{jwt.SigningMethodHS256, jwt.SigningMethodHS384, jwt.SigningMethodHS512}[rng.IntN(3)]
+				token := jwt.NewWithClaims(method, e.claims(randomSubject(rng)))
+				token.Header["kid"] = kidGood
+				signed, err := token.SignedString(secrets[rng.IntN(len(secrets))])
+				if err != nil {
+					panic(err)
+				}
+				return signed
+			},
+		},
+		{
+			name: "unknown or missing kid",
+			token: func(rng *rand.Rand) string {
+				kid := ""
+				if rng.IntN(4) > 0 {
+					kid = fmt.Sprintf("unknown-%x", rng.Uint64())
+				}
+				return e.sign(kid, e.claims(randomSubject(rng)))
+			},
+		},
+		{
+			name: "tampered payload",
+			token: func(rng *rand.Rand) string {
+				header, payload, signature := splitToken(e.issue(randomSubject(rng)))
+				if rng.IntN(2) == 0 {
+					// 別のユーザーのクレームに差し替える
+					payload = encodeSegment(e.claims(randomSubject(rng)))
+				} else {
+					// デコードしたペイロードの1ビットを反転する
+					b, _ := base64.RawURLEncoding.DecodeString(payload)
+					b[rng.IntN(len(b))] ^= 1 << rng.IntN(8)
+					payload = base64.RawURLEncoding.EncodeToString(b)
+				}
+				return header + "." + payload + "." + signature
+			},
+		},
+		{
+			name: "tampered signature",
+			token: func(rng *rand.Rand) string {
+				header, payload, signature := splitToken(e.issue(randomSubject(rng)))
+				b, _ := base64.RawURLEncoding.DecodeString(signature)
+				b[rng.IntN(len(b))] ^= 1 << rng.IntN(8)
+				return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(b)
+			},
+		},
+		{
+			// 署名の末尾の文字の未使用のビットを変えても同じバイト列にデコードされるため、厳密なデコードでのみ拒否できる
+			name: "non-canonical signature encoding",
+			token: func(rng *rand.Rand) string {
+				header, payload, signature := splitToken(e.issue(randomSubject(rng)))
+				last := strings.IndexByte(base64URLAlphabet, signature[len(signature)-1])
+				// 256バイトの署名は末尾の文字の下位4ビットが未使用
+				variant := base64URLAlphabet[last|(1+rng.IntN(15))]
+				if variant == signature[len(signature)-1] {
+					variant = base64URLAlphabet[last^1]
+				}
+				return header + "." + payload + "." + signature[:len(signature)-1] + string(variant)
+			},
+		},
+		{
+			name: "key with an oversized exponent",
+			token: func(rng *rand.Rand) string {
+				return e.sign(kidOverflowExponent, e.claims(randomSubject(rng)))
+			},
+		},
+		{
+			name: "key with a tiny modulus",
+			token: func(rng *rand.Rand) string {
+				return e.sign(kidTinyModulus, e.claims(randomSubject(rng)))
+			},
+		},
+		{
+			name: "key whose alg does not match",
+			token: func(rng *rand.Rand) string {
+				kid := []string{kidPSS, kidRS512}[rng.IntN(2)]
+				return e.sign(kid, e.claims(randomSubject(rng)))
+			},
+		},
+		{
+			name: "duplicate kid with different keys",
+			token: func(rng *rand.Rand) string {
+				return e.sign(kidDuplicate, e.claims(randomSubject(rng)))
+			},
+		},
+		{
+			name: "encryption key",
+			token: func(rng *rand.Rand) string {
+				return e.sign(kidEncryption, e.claims(randomSubject(rng)))
+			},
+		},
+		{
+			name: "client that is not allowed",
+			token: func(rng *rand.Rand) string {
+				claims := e.claims(randomSubject(rng))
+				if rng.IntN(2) == 0 {
+					claims["azp"] = fmt.Sprintf("client-%x", rng.Uint64())
+				} else {
+					delete(claims, "azp")
+					claims["client_id"] = fmt.Sprintf("client-%x", rng.Uint64())
+				}
+				return e.sign(kidGood, claims)
+			},
+		},
+		{
+			name: "missing azp and client_id",
+			token: func(rng *rand.Rand) string {
+				claims := e.claims(randomSubject(rng))
+				delete(claims, "azp")
+				return e.sign(kidGood, claims)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rng := rand.New(rand.NewPCG(1, 2))
+			for range iterations {
+				token := tt.token(rng)
+				if err := e.verify(token); err == nil {
+					t.Fatalf("token was accepted: %s", token)
+				}
+			}
+		})
+	}
+}
+
+func TestParseJWKSRejects(t *testing.T) {
+	e := newTestEnvironment(t)
+
+	tests := []struct {
+		name string
+		key  func(rng *rand.Rand) JWKSKey
+	}{
+		{
+			// intに収まらない任意の長さの指数
+			name: "oversized exponent",
+			key: func(rng *rand.Rand) JWKSKey {
+				exponent := make([]byte, 5+rng.IntN(60))
+				for i := range exponent {
+					exponent[i] = byte(rng.IntN(256))
+				}
+				exponent[0] |= 1
+				return JWKSKey{
+					Kty: "RSA", Kid: "random", Use: "sig",
+					N: base64.RawURLEncoding.EncodeToString(e.key.N.Bytes()),
+					E: base64.RawURLEncoding.EncodeToString(exponent),
+				}
+			},
+		},
+		{
+			// 2048ビット未満（255バイト以下）の任意のモジュラス
+			name: "tiny modulus",
+			key: func(rng *rand.Rand) JWKSKey {
+				modulus := make([]byte, 1+rng.IntN(255))
+				for i := range modulus {
+					modulus[i] = byte(rng.IntN(256))
+				}
+				modulus[0] |= 1
+				return JWKSKey{
+					Kty: "RSA", Kid: "random", Use: "sig",
+					N: base64.RawURLEncoding.EncodeToString(modulus),
+					E: "AQAB",
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rng := rand.New(rand.NewPCG(1, 2))
+			for range iterations {
+				key := tt.key(rng)
+				jwks, err := json.Marshal(JWKS{Keys: []JWKSKey{key}})
+				if err != nil {
+					t.Fatal(err)
+				}
+				keys, rejected, err := ParseJWKS(jwks)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(keys) > 0 || len(rejected) != 1 {
+					t.Fatalf("key was ingested: n=%s e=%s", key.N, key.E)
+				}
+			}
+		})
+	}
+}
+
+// FuzzParseAuthorization は取り出したスキームがBearerまたはDPoPで、トークンが空でなく、b64tokenの文字のみで、
+// 再度同じスキームとトークンとして解析できることを検証する
+func FuzzParseAuthorization(f *testing.F) {
+	e := newTestEnvironment(f)
+	f.Add("Bearer " + e.issue("auth0|seed"))
+	f.Add("DPoP " + e.issueBound("auth0|seed"))
+
+	f.Fuzz(func(t *testing.T, header string) {
+		scheme, token, err := ParseAuthorization(header)
+		if err != nil {
+			return
+		}
+		if scheme != SchemeBearer && scheme != SchemeDPoP {
+			t.Fatalf("unexpected scheme %q", scheme)
+		}
+		if token == "" {
+			t.Fatal("accepted an empty token")
+		}
+		for i := 0; i < len(token); i++ {
+			if c := token[i]; c <= ' ' || c >= 0x7f {
+				t.Fatalf("token contains %q", c)
+			}
+		}
+		againScheme, again, err := ParseAuthorization(scheme + " " + token)
+		if err != nil || againScheme != scheme || again != token {
+			t.Fatalf("token does not round-trip: %q", again)
+		}
+	})
+}
+
+// FuzzParseJWKS は取り込んだ全ての鍵が2048ビット以上で、指数がintに収まる3以上の奇数であり、
+// algが未指定かRSAの署名アルゴリズムであることを検証する
+func FuzzParseJWKS(f *testing.F) {
+	e := newTestEnvironment(f)
+	f.Add(e.jwks)
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		keys, _, err := ParseJWKS(input)
+		if err != nil {
+			return
+		}
+		for kid, key := range keys {
+			if kid == "" {
+				t.Fatal("accepted a key without kid")
+			}
+			if key.Key.N.BitLen() < 2048 {
+				t.Fatalf("kid %q: accepted %d-bit modulus", kid, key.Key.N.BitLen())
+			}
+			if key.Key.E < 3 || key.Key.E%2 == 0 || key.Key.E > math.MaxInt32 {
+				t.Fatalf("kid %q: invalid exponent %d", kid, key.Key.E)
+			}
+			if !slices.Contains([]string{"", "RS256", "RS384", "RS512"}, key.Alg) {
+				t.Fatalf("kid %q: accepted alg %q", kid, key.Alg)
+			}
+		}
+	})
+}
+
+// FuzzVerifyToken は発行したトークンそのもの以外を受け入れないことを検証する
+func FuzzVerifyToken(f *testing.F) {
+	e := newTestEnvironment(f)
+	f.Add(e.issue("auth0|seed"))
+	for _, kid := range []string{kidOverflowExponent, kidTinyModulus, kidEncryption, kidRS512, kidDuplicate} {
+		f.Add(e.sign(kid, e.claims("auth0|seed")))
+	}
+
+	f.Fuzz(func(t *testing.T, token string) {
+		if err := e.verify(token); err == nil && !e.wasIssued(token) {
+			t.Fatalf("accepted a token that was not issued: %q", token)
+		}
+	})
+}
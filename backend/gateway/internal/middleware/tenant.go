@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"connectrpc.com/connect"
+	"github.com/kakke18/platform-security-poc/backend/gateway/internal/tenant"
+	"github.com/kakke18/platform-security-poc/backend/platform/clientip"
+	"github.com/kakke18/platform-security-poc/backend/platform/logging"
+	"github.com/kakke18/platform-security-poc/backend/platform/metrics"
+	"github.com/kakke18/platform-security-poc/backend/platform/principal"
+	"github.com/kakke18/platform-security-poc/backend/platform/tenantctx"
+)
+
+// errorWriter はリクエストのプロトコル（Connect・gRPC・gRPC-Web）に合わせてエラーを書き込む
+var errorWriter = connect.NewErrorWriter()
+
+// writeConnectError はConnectのエラーをクライアントのプロトコルに合わせて書き込む
+func writeConnectError(w http.ResponseWriter, r *http.Request, code connect.Code, msg string) {
+	if err := errorWriter.Write(w, r, connect.NewError(code, errors.New(msg))); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write error", slog.String("error", err.Error()))
+	}
+}
+
+// TenantMiddleware はクライアントが選択したテナントへの所属を検証するミドルウェア
+type TenantMiddleware struct {
+	resolver *tenant.Resolver
+}
+
+// NewTenantMiddleware は新しいテナントミドルウェアを作成する
+func NewTenantMiddleware(resolver *tenant.Resolver) *TenantMiddleware {
+	return &TenantMiddleware{
+		resolver: resolver,
+	}
+}
+
+// Middleware はX-Tenant-IDヘッダーで選択されたテナントへの所属を検証し、
+// 検証済みのテナントユーザーIDとロールを下流サービスに転送する
+// JWTミドルウェアの内側で使用する（Principalがcontextに格納済みであること）
+func (m *TenantMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := principal.FromContext(r.Context())
+		if !ok {
+			metrics.RecordAuthzDenial(metrics.ReasonUnauthenticated)
+			writeConnectError(w, r, connect.CodeUnauthenticated, "unauthenticated")
+			return
+		}
+
+		tenantID := r.Header.Get(tenantctx.HeaderTenantID)
+		if tenantID == "" {
+			// テナント未選択の場合はそのまま処理を続ける
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		membership, err := m.resolver.Resolve(r.Context(), p.Subject, tenantID)
+		if err != nil {
+			if errors.Is(err, tenant.ErrNotMember) {
+				slog.WarnContext(r.Context(), "tenant access denied", slog.String("tenant_id", tenantID))
+				metrics.RecordAuthzDenial(metrics.ReasonNotTenantMember)
+				logging.EmitSecurityEvent(r.Context(), logging.SecurityEvent{
+					Category: logging.CategoryAPI,
+					Action:   logging.ActionAuthorization,
+					Reason:   metrics.ReasonNotTenantMember,
+					Subject:  p.Subject,
+					SourceIP: clientip.String(r.Context()),
+					Path:     r.URL.Path,
+				})
+				writeConnectError(w, r, connect.CodePermissionDenied, "tenant access denied")
+				return
+			}
+			slog.ErrorContext(r.Context(), "failed to resolve tenant", slog.String("tenant_id", tenantID), slog.String("error", err.Error()))
+			writeConnectError(w, r, connect.CodeUnavailable, "failed to resolve tenant")
+			return
+		}
+
+		// 検証済みのテナントコンテキストでPrincipalを更新し、ヘッダーとcontextに設定（下流サービスで使用）
+		// 解決済みの所属情報もcontextに格納し、GetMeなどGateway自身のハンドラーで再度問い合わせないようにする
+		resolved := *p
+		resolved.WorkspaceID = membership.WorkspaceID
+		resolved.WorkspaceUserID = membership.WorkspaceUserID
+		resolved.Privileged = membership.Privileged
+		resolved.Tenant = membership.Tenant
+		resolved.SetHeader(r.Header)
+		r = r.WithContext(tenant.NewContext(principal.NewContext(r.Context(), &resolved), membership))
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/kakke18/platform-security-poc/backend/gateway/internal/client"
+	"github.com/kakke18/platform-security-poc/backend/gateway/internal/tenant"
+	identityv1 "github.com/kakke18/platform-security-poc/backend/gen/identity/v1"
+	"github.com/kakke18/platform-security-poc/backend/gen/identity/v1/identityv1connect"
+	userv1 "github.com/kakke18/platform-security-poc/backend/gen/user/v1"
+	"github.com/kakke18/platform-security-poc/backend/gen/user/v1/userv1connect"
+	"github.com/kakke18/platform-security-poc/backend/platform/principal"
+	"github.com/kakke18/platform-security-poc/backend/platform/tenantctx"
+)
+
+// fakeWorkspaceUserClient はGetWorkspaceUserの結果を固定したIdentity APIのクライアント
+type fakeWorkspaceUserClient struct {
+	identityv1connect.WorkspaceUserServiceClient
+	err   error
+	calls int
+}
+
+func (c *fakeWorkspaceUserClient) GetWorkspaceUser(ctx context.Context, req *connect.Request[identityv1.GetWorkspaceUserRequest]) (*connect.Response[identityv1.GetWorkspaceUserResponse], error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return connect.NewResponse(&identityv1.GetWorkspaceUserResponse{WorkspaceId: "ws-1", WorkspaceUserId: "wu-1", Privileged: true}), nil
+}
+
+// fakeTenantUserClient はGetTenantUsersの結果を固定したUser APIのクライアント
+type fakeTenantUserClient struct {
+	userv1connect.TenantUserServiceClient
+	calls int
+}
+
+func (c *fakeTenantUserClient) GetTenantUsers(ctx context.Context, req *connect.Request[userv1.GetTenantUsersRequest]) (*connect.Response[userv1.GetTenantUsersResponse], error) {
+	c.calls++
+	return connect.NewResponse(&userv1.GetTenantUsersResponse{Users: []*userv1.TenantUser{
+		{TenantUserId: "tu-1", TenantId: "tenant-1", Role: userv1.Role_ROLE_MEMBER},
+	}}), nil
+}
+
+func TestTenantMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		principal   *principal.Principal
+		tenantID    string
+		backendErr  error
+		contentType string
+		wantStatus  int
+		wantCode    connect.Code
+		wantTenant  *tenantctx.Context
+		wantCalls   int
+	}{
+		{name: "no tenant header", principal: &principal.Principal{Subject: "auth0|alice"}, wantStatus: http.StatusOK},
+		{
+			name:       "member of the tenant",
+			principal:  &principal.Principal{Subject: "auth0|alice"},
+			tenantID:   "tenant-1",
+			wantStatus: http.StatusOK,
+			wantTenant: &tenantctx.Context{TenantID: "tenant-1", TenantUserID: "tu-1", Role: tenantctx.RoleMember},
+			wantCalls:  1,
+		},
+		{name: "unauthenticated", tenantID: "tenant-1", wantStatus: http.StatusUnauthorized, wantCode: connect.CodeUnauthenticated},
+		{name: "tenant the user does not belong to", principal: &principal.Principal{Subject: "auth0|alice"}, tenantID: "tenant-9", wantStatus: http.StatusForbidden, wantCode: connect.CodePermissionDenied, wantCalls: 1},
+		{name: "not a workspace member", principal: &principal.Principal{Subject: "auth0|alice"}, tenantID: "tenant-1", backendErr: connect.NewError(connect.CodeNotFound, errors.New("not found")), wantStatus: http.StatusForbidden, wantCode: connect.CodePermissionDenied},
+		{name: "backend failure", principal: &principal.Principal{Subject: "auth0|alice"}, tenantID: "tenant-1", backendErr: connect.NewError(connect.CodeUnavailable, errors.New("down")), wantStatus: http.StatusServiceUnavailable, wantCode: connect.CodeUnavailable},
+		{name: "backend failure over grpc", principal: &principal.Principal{Subject: "auth0|alice"}, tenantID: "tenant-1", backendErr: errors.New("down"), contentType: "application/grpc", wantStatus: http.StatusOK, wantCode: connect.CodeUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspaceUsers := &fakeWorkspaceUserClient{err: tt.backendErr}
+			tenantUsers := &fakeTenantUserClient{}
+			m := NewTenantMiddleware(tenant.NewResolver(&client.Clients{WorkspaceUser: workspaceUsers, TenantUser: tenantUsers}))
+
+			var got *http.Request
+			handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/gateway.v1.MeService/GetMe", nil)
+			req.Header.Set("Content-Type", "application/proto")
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.tenantID != "" {
+				req.Header.Set(tenantctx.HeaderTenantID, tt.tenantID)
+			}
+			if tt.principal != nil {
+				req = req.WithContext(principal.NewContext(req.Context(), tt.principal))
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tenantUsers.calls != tt.wantCalls {
+				t.Errorf("GetTenantUsers calls = %d, want %d", tenantUsers.calls, tt.wantCalls)
+			}
+			if tt.wantCode != 0 {
+				if got != nil {
+					t.Fatal("next handler was called for a rejected request")
+				}
+				if code := responseCode(t, rec, tt.contentType); code != tt.wantCode {
+					t.Errorf("code = %v, want %v", code, tt.wantCode)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("next handler was not called")
+			}
+
+			p := principal.MustFrom(got.Context())
+			membership, resolved := tenant.FromContext(got.Context())
+			if tt.wantTenant == nil {
+				if p.Tenant != nil || resolved || workspaceUsers.calls != 0 {
+					t.Errorf("tenant = %+v, resolved = %v, backend calls = %d, want none", p.Tenant, resolved, workspaceUsers.calls)
+				}
+				return
+			}
+			if p.Tenant == nil || *p.Tenant != *tt.wantTenant || p.WorkspaceUserID != "wu-1" || !p.Privileged {
+				t.Errorf("principal = %+v, tenant = %+v", p, p.Tenant)
+			}
+			if !resolved || membership.Tenant != p.Tenant {
+				t.Error("resolved membership is not stored in the context")
+			}
+			if v := got.Header.Get(tenantctx.HeaderTenantUserID); v != tt.wantTenant.TenantUserID {
+				t.Errorf("%s = %q, want %q", tenantctx.HeaderTenantUserID, v, tt.wantTenant.TenantUserID)
+			}
+		})
+	}
+}
+
+// responseCode はプロトコルに合わせて書き込まれたエラーのコードを取り出す
+func responseCode(t *testing.T, rec *httptest.ResponseRecorder, contentType string) connect.Code {
+	t.Helper()
+	if contentType == "application/grpc" {
+		code, err := strconv.Atoi(rec.Header().Get("Grpc-Status"))
+		if err != nil {
+			t.Fatalf("invalid grpc-status %q: %v", rec.Header().Get("Grpc-Status"), err)
+		}
+		return connect.Code(code)
+	}
+	var body struct {
+		Code connect.Code `json:"code"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid error body %q: %v", rec.Body.String(), err)
+	}
+	return body.Code
+}
@@ -0,0 +1,126 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+// ErrCircuitOpen はサーキットブレーカーが開いているためリクエストを送信しなかったことを表す
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+// CircuitBreaker はバックエンドごとの障害を検知して呼び出しを遮断するクライアントインターセプター
+// 連続した失敗がthresholdに達すると一定時間呼び出しを遮断し、その後1件の試行で回復を確認する
+type CircuitBreaker struct {
+	name         string
+	threshold    int
+	openDuration time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+// NewCircuitBreaker は新しいCircuitBreakerを作成する
+func NewCircuitBreaker(name string, threshold int, openDuration time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		name:         name,
+		threshold:    threshold,
+		openDuration: openDuration,
+	}
+}
+
+// Ensure CircuitBreaker implements connect.Interceptor
+var _ connect.Interceptor = (*CircuitBreaker)(nil)
+
+// WrapUnary はブレーカーの状態に応じてUnary RPCを遮断する
+func (b *CircuitBreaker) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if !req.Spec().IsClient {
+			return next(ctx, req)
+		}
+
+		if !b.allow(time.Now()) {
+			return nil, connect.NewError(connect.CodeUnavailable, ErrCircuitOpen)
+		}
+
+		resp, err := next(ctx, req)
+		b.record(err, time.Now())
+		return resp, err
+	}
+}
+
+// WrapStreamingClient はストリーミングRPCをそのまま返す
+func (b *CircuitBreaker) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler はハンドラー側のストリームをそのまま返す
+func (b *CircuitBreaker) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
+
+// allow はリクエストを送信してよいかを返す
+func (b *CircuitBreaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case stateOpen:
+		if now.Sub(b.openedAt) < b.openDuration {
+			return false
+		}
+		// 遮断期間が経過したら1件だけ試行を許可する
+		b.state = stateHalfOpen
+		return true
+	case stateHalfOpen:
+		// 試行中は結果が出るまで遮断する
+		return false
+	default:
+		return true
+	}
+}
+
+// record は呼び出し結果をブレーカーの状態に反映する
+func (b *CircuitBreaker) record(err error, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !isFailure(err) {
+		b.state = stateClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == stateHalfOpen || b.failures >= b.threshold {
+		b.state = stateOpen
+		b.openedAt = now
+	}
+}
+
+// isFailure はバックエンドの障害として数えるエラーかどうかを返す
+// NotFoundなどのアプリケーションエラーは正常な応答として扱う
+func isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch connect.CodeOf(err) {
+	case connect.CodeUnavailable, connect.CodeDeadlineExceeded, connect.CodeInternal, connect.CodeUnknown, connect.CodeResourceExhausted:
+		return true
+	default:
+		return false
+	}
+}
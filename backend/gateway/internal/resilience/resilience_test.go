@@ -0,0 +1,259 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+// specRequest はSpecを差し替えたリクエスト（connect.NewRequestではクライアント側のSpecを設定できないため）
+type specRequest struct {
+	connect.AnyRequest
+	spec connect.Spec
+}
+
+func (r *specRequest) Spec() connect.Spec {
+	return r.spec
+}
+
+// clientRequest はクライアント側のUnary RPCのリクエストを作成する
+func clientRequest(idempotency connect.IdempotencyLevel) connect.AnyRequest {
+	return &specRequest{
+		AnyRequest: connect.NewRequest(&struct{}{}),
+		spec: connect.Spec{
+			Procedure:        "/test.v1.TestService/Call",
+			IsClient:         true,
+			IdempotencyLevel: idempotency,
+		},
+	}
+}
+
+var (
+	errUnavailable = connect.NewError(connect.CodeUnavailable, errors.New("unavailable"))
+	errNotFound    = connect.NewError(connect.CodeNotFound, errors.New("not found"))
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	type step struct {
+		at        time.Duration
+		wantAllow bool
+		// result はwantAllowの場合に記録する呼び出し結果
+		result error
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{name: "opens after consecutive failures", steps: []step{
+			{wantAllow: true, result: errUnavailable},
+			{wantAllow: true, result: errUnavailable},
+			{wantAllow: true, result: errUnavailable},
+			{wantAllow: false},
+			{at: 9 * time.Second, wantAllow: false},
+		}},
+		{name: "success resets the failure count", steps: []step{
+			{wantAllow: true, result: errUnavailable},
+			{wantAllow: true, result: errUnavailable},
+			{wantAllow: true},
+			{wantAllow: true, result: errUnavailable},
+			{wantAllow: true, result: errUnavailable},
+			{wantAllow: true},
+		}},
+		{name: "application errors are not failures", steps: []step{
+			{wantAllow: true, result: errNotFound},
+			{wantAllow: true, result: errNotFound},
+			{wantAllow: true, result: errNotFound},
+			{wantAllow: true},
+		}},
+		{name: "half-open probe closes the breaker", steps: []step{
+			{wantAllow: true, result: errUnavailable},
+			{wantAllow: true, result: errUnavailable},
+			{wantAllow: true, result: errUnavailable},
+			{at: 10 * time.Second, wantAllow: true},
+			{at: 10 * time.Second, wantAllow: true, result: errUnavailable},
+			{at: 10 * time.Second, wantAllow: true},
+		}},
+		{name: "failed half-open probe reopens the breaker", steps: []step{
+			{wantAllow: true, result: errUnavailable},
+			{wantAllow: true, result: errUnavailable},
+			{wantAllow: true, result: errUnavailable},
+			{at: 10 * time.Second, wantAllow: true, result: errUnavailable},
+			{at: 10 * time.Second, wantAllow: false},
+			{at: 19 * time.Second, wantAllow: false},
+			{at: 20 * time.Second, wantAllow: true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewCircuitBreaker("test", 3, 10*time.Second)
+			for i, s := range tt.steps {
+				at := now.Add(s.at)
+				if got := b.allow(at); got != s.wantAllow {
+					t.Fatalf("step %d: allow = %v, want %v", i, got, s.wantAllow)
+				}
+				if s.wantAllow {
+					b.record(s.result, at)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := NewCircuitBreaker("test", 1, 10*time.Second)
+	b.record(errUnavailable, now)
+
+	// 遮断期間の経過後、結果が出るまでは最初の1件のみを試行する
+	now = now.Add(10 * time.Second)
+	if !b.allow(now) {
+		t.Fatal("probe was not allowed after the open duration")
+	}
+	for i := range 3 {
+		if b.allow(now.Add(time.Duration(i) * time.Minute)) {
+			t.Fatalf("request %d was allowed while the probe is in flight", i)
+		}
+	}
+	b.record(nil, now)
+	if !b.allow(now) {
+		t.Fatal("request was not allowed after a successful probe")
+	}
+}
+
+func TestCircuitBreakerWrapUnary(t *testing.T) {
+	b := NewCircuitBreaker("test", 1, time.Hour)
+	calls := 0
+	call := b.WrapUnary(func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		calls++
+		return nil, errUnavailable
+	})
+
+	for range 3 {
+		_, _ = call(context.Background(), clientRequest(connect.IdempotencyNoSideEffects))
+	}
+	_, err := call(context.Background(), clientRequest(connect.IdempotencyNoSideEffects))
+	if calls != 1 {
+		t.Errorf("backend calls = %d, want 1", calls)
+	}
+	if !errors.Is(err, ErrCircuitOpen) || connect.CodeOf(err) != connect.CodeUnavailable {
+		t.Errorf("error = %v, want unavailable ErrCircuitOpen", err)
+	}
+}
+
+func TestRetryInterceptor(t *testing.T) {
+	tests := []struct {
+		name        string
+		idempotency connect.IdempotencyLevel
+		maxRetries  int
+		errs        []error
+		wantCalls   int
+		wantErr     bool
+	}{
+		{name: "retries idempotent calls until success", idempotency: connect.IdempotencyNoSideEffects, maxRetries: 2, errs: []error{errUnavailable, errUnavailable, nil}, wantCalls: 3},
+		{name: "stops after max retries", idempotency: connect.IdempotencyIdempotent, maxRetries: 2, errs: []error{errUnavailable, errUnavailable, errUnavailable, nil}, wantCalls: 3, wantErr: true},
+		{name: "never retries non-idempotent procedures", idempotency: connect.IdempotencyUnknown, maxRetries: 2, errs: []error{errUnavailable, nil}, wantCalls: 1, wantErr: true},
+		{name: "does not retry non-retryable errors", idempotency: connect.IdempotencyNoSideEffects, maxRetries: 2, errs: []error{errNotFound, nil}, wantCalls: 1, wantErr: true},
+		{name: "no retries configured", idempotency: connect.IdempotencyNoSideEffects, errs: []error{errUnavailable, nil}, wantCalls: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := NewRetryInterceptor(tt.maxRetries)
+			i.baseDelay, i.maxDelay = time.Millisecond, time.Millisecond
+			calls := 0
+			call := i.WrapUnary(func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+				err := tt.errs[calls]
+				calls++
+				return nil, err
+			})
+
+			_, err := call(context.Background(), clientRequest(tt.idempotency))
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryInterceptorDeadline(t *testing.T) {
+	i := NewRetryInterceptor(100)
+	i.baseDelay, i.maxDelay = 20*time.Millisecond, 20*time.Millisecond
+	calls := 0
+	call := i.WrapUnary(func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		calls++
+		return nil, errUnavailable
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := call(ctx, clientRequest(connect.IdempotencyNoSideEffects))
+
+	if connect.CodeOf(err) != connect.CodeUnavailable {
+		t.Errorf("error = %v, want the last backend error", err)
+	}
+	// バックオフ後にデッドラインを超える場合は待機せずに終了する
+	if elapsed := time.Since(start); elapsed > 120*time.Millisecond {
+		t.Errorf("retried for %s past the deadline", elapsed)
+	}
+	if calls < 2 {
+		t.Errorf("calls = %d, want retries until the deadline", calls)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	i := NewRetryInterceptor(1)
+	for attempt := range 100 {
+		for range 10 {
+			if d := i.backoff(attempt); d <= 0 || d > defaultRetryMaxDelay {
+				t.Fatalf("backoff(%d) = %s, want (0, %s]", attempt, d, defaultRetryMaxDelay)
+			}
+		}
+	}
+	if d := i.backoff(0); d > defaultRetryBaseDelay {
+		t.Errorf("backoff(0) = %s, want at most %s", d, defaultRetryBaseDelay)
+	}
+}
+
+func TestTimeoutInterceptor(t *testing.T) {
+	tests := []struct {
+		name          string
+		timeout       time.Duration
+		callerTimeout time.Duration
+		want          time.Duration
+	}{
+		{name: "backend deadline", timeout: time.Second, want: time.Second},
+		{name: "shorter caller deadline wins", timeout: time.Minute, callerTimeout: time.Second, want: time.Second},
+		{name: "no timeout keeps the caller deadline", callerTimeout: time.Second, want: time.Second},
+		{name: "no deadline at all"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.callerTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.callerTimeout)
+				defer cancel()
+			}
+
+			var got time.Duration
+			call := NewTimeoutInterceptor(tt.timeout).WrapUnary(func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+				if deadline, ok := ctx.Deadline(); ok {
+					got = time.Until(deadline)
+				}
+				return nil, nil
+			})
+			_, _ = call(ctx, clientRequest(connect.IdempotencyUnknown))
+
+			if got > tt.want || got < tt.want-100*time.Millisecond {
+				t.Errorf("deadline in %s, want about %s", got, tt.want)
+			}
+		})
+	}
+}
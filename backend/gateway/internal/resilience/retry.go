@@ -0,0 +1,92 @@
+package resilience
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+const (
+	defaultRetryBaseDelay = 50 * time.Millisecond
+	defaultRetryMaxDelay  = time.Second
+)
+
+// RetryInterceptor は冪等なUnary RPCを指数バックオフ付きでリトライするクライアントインターセプター
+// protoでidempotency_levelが指定されたRPCのみを対象とする
+type RetryInterceptor struct {
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+}
+
+// NewRetryInterceptor は新しいRetryInterceptorを作成する
+// maxRetriesは初回呼び出しを含まないリトライ回数
+func NewRetryInterceptor(maxRetries int) *RetryInterceptor {
+	return &RetryInterceptor{
+		maxRetries: maxRetries,
+		baseDelay:  defaultRetryBaseDelay,
+		maxDelay:   defaultRetryMaxDelay,
+	}
+}
+
+// Ensure RetryInterceptor implements connect.Interceptor
+var _ connect.Interceptor = (*RetryInterceptor)(nil)
+
+// WrapUnary は冪等なUnary RPCをリトライする
+func (i *RetryInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if !req.Spec().IsClient || req.Spec().IdempotencyLevel == connect.IdempotencyUnknown {
+			return next(ctx, req)
+		}
+
+		for attempt := 0; ; attempt++ {
+			resp, err := next(ctx, req)
+			if err == nil || attempt >= i.maxRetries || !isRetryable(err) {
+				return resp, err
+			}
+
+			// バックオフ後にデッドラインを超える場合はリトライせずに最後のエラーを返す
+			delay := i.backoff(attempt)
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+				return nil, err
+			}
+			select {
+			case <-ctx.Done():
+				return nil, err
+			case <-time.After(delay):
+			}
+		}
+	}
+}
+
+// WrapStreamingClient はストリーミングRPCをリトライせずにそのまま返す
+func (i *RetryInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler はハンドラー側のストリームをそのまま返す
+func (i *RetryInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
+
+// backoff はattempt回目のリトライまでの待機時間をフルジッター付きで返す
+func (i *RetryInterceptor) backoff(attempt int) time.Duration {
+	d := i.maxDelay
+	// 桁あふれしないようにシフト量を制限する
+	if attempt < 32 {
+		d = min(i.baseDelay<<attempt, i.maxDelay)
+	}
+	return time.Duration(rand.Int64N(int64(d)) + 1)
+}
+
+// isRetryable は一時的な障害を表すエラーかどうかを返す
+func isRetryable(err error) bool {
+	switch connect.CodeOf(err) {
+	case connect.CodeUnavailable, connect.CodeResourceExhausted, connect.CodeAborted:
+		return true
+	default:
+		return false
+	}
+}
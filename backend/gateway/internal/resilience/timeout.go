@@ -0,0 +1,47 @@
+package resilience
+
+import (
+	"context"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+// TimeoutInterceptor はバックエンドごとのデッドラインを設定するクライアントインターセプター
+// 呼び出し元のデッドラインの方が短い場合はそちらが優先される
+type TimeoutInterceptor struct {
+	timeout time.Duration
+}
+
+// NewTimeoutInterceptor は新しいTimeoutInterceptorを作成する
+func NewTimeoutInterceptor(timeout time.Duration) *TimeoutInterceptor {
+	return &TimeoutInterceptor{
+		timeout: timeout,
+	}
+}
+
+// Ensure TimeoutInterceptor implements connect.Interceptor
+var _ connect.Interceptor = (*TimeoutInterceptor)(nil)
+
+// WrapUnary はUnary RPCにデッドラインを設定する
+func (i *TimeoutInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if !req.Spec().IsClient || i.timeout <= 0 {
+			return next(ctx, req)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, i.timeout)
+		defer cancel()
+		return next(ctx, req)
+	}
+}
+
+// WrapStreamingClient はストリーミングRPCをそのまま返す
+func (i *TimeoutInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler はハンドラー側のストリームをそのまま返す
+func (i *TimeoutInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
@@ -0,0 +1,245 @@
+package route
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"github.com/kakke18/platform-security-poc/backend/gateway/internal/tenant"
+	"github.com/kakke18/platform-security-poc/backend/platform/clientip"
+	"github.com/kakke18/platform-security-poc/backend/platform/logging"
+	"github.com/kakke18/platform-security-poc/backend/platform/metrics"
+	"github.com/kakke18/platform-security-poc/backend/platform/principal"
+	"github.com/kakke18/platform-security-poc/backend/platform/telemetry"
+	"golang.org/x/net/http2"
+)
+
+// Handler はルーティングテーブルに従ってリクエストをバックエンドに転送するリバースプロキシ
+type Handler struct {
+	table    *Table
+	proxies  map[string]*httputil.ReverseProxy
+	resolver *tenant.Resolver
+
+	// authenticated は認証が必要なルートに適用するミドルウェアを通したプロキシハンドラー
+	authenticated http.Handler
+	// anonymous は認証が不要なルートのプロキシハンドラー
+	anonymous http.Handler
+}
+
+// NewHandler は新しいHandlerを作成する
+// authenticateには認証ミドルウェア（JWT検証 -> テナント検証）を渡す
+func NewHandler(table *Table, resolver *tenant.Resolver, authenticate func(http.Handler) http.Handler) (*Handler, error) {
+	h := &Handler{
+		table:    table,
+		proxies:  make(map[string]*httputil.ReverseProxy, len(table.Backends)),
+		resolver: resolver,
+	}
+
+	for name, backend := range table.Backends {
+		proxy, err := newReverseProxy(name, backend)
+		if err != nil {
+			return nil, fmt.Errorf("backend %q: %w", name, err)
+		}
+		h.proxies[name] = proxy
+	}
+
+	h.authenticated = authenticate(http.HandlerFunc(h.serveAuthenticated))
+	h.anonymous = http.HandlerFunc(h.proxy)
+
+	return h, nil
+}
+
+// ServeHTTP はルートを解決し、認証要件に応じたハンドラーで処理する
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Connect・gRPC・gRPC-WebはGETとPOSTのみを使用するため、それ以外のメソッドは転送しない
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	route, ok := h.table.Match(r.URL.Path)
+	if !ok {
+		// ルーティングテーブルに存在しないプロシージャは転送しない
+		http.NotFound(w, r)
+		return
+	}
+
+	if route.Deny {
+		slog.WarnContext(r.Context(), "denied internal-only procedure", slog.String("path", r.URL.Path))
+		metrics.RecordAuthzDenial(metrics.ReasonRouteDenied)
+		emitDenied(r.Context(), r.URL.Path, "", metrics.ReasonRouteDenied)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	// IPアドレスの許可リストはクライアントIP解決ミドルウェアが格納したアドレスで判定する
+	if len(route.AllowedIPs) > 0 {
+		if addr, ok := clientip.FromContext(r.Context()); !ok || !clientip.Contains(route.AllowedIPs, addr) {
+			slog.WarnContext(r.Context(), "client ip not allowed", slog.String("path", r.URL.Path))
+			metrics.RecordAuthzDenial(metrics.ReasonIPNotAllowed)
+			emitDenied(r.Context(), r.URL.Path, "", metrics.ReasonIPNotAllowed)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+	}
+
+	// ルートごとのボディサイズの上限は認証より前に適用し、未認証のクライアントからの巨大なリクエストも拒否する
+	if route.MaxBodyBytes > 0 {
+		if r.ContentLength > route.MaxBodyBytes {
+			http.Error(w, "Request entity too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, route.MaxBodyBytes)
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), routeKey{}, route))
+
+	if route.Auth == AuthNone {
+		// 認証不要のルートでもクライアントが偽装した検証済みヘッダーは転送しない
+		principal.DelHeader(r.Header)
+		h.anonymous.ServeHTTP(w, r)
+		return
+	}
+	h.authenticated.ServeHTTP(w, r)
+}
+
+// serveAuthenticated は認証済みリクエストの認可要件を検証して転送する
+func (h *Handler) serveAuthenticated(w http.ResponseWriter, r *http.Request) {
+	route := routeFrom(r.Context())
+	p, ok := principal.FromContext(r.Context())
+	if !ok {
+		metrics.RecordAuthzDenial(metrics.ReasonUnauthenticated)
+		http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+		return
+	}
+
+	// 必要なスコープを検証
+	for _, scope := range route.Scopes {
+		if !p.HasScope(scope) {
+			slog.WarnContext(r.Context(), "missing required scope", slog.String("path", r.URL.Path), slog.String("scope", scope))
+			metrics.RecordAuthzDenial(metrics.ReasonMissingScope)
+			emitDenied(r.Context(), r.URL.Path, p.Subject, metrics.ReasonMissingScope)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+	}
+
+	// 重要な操作では直近の多要素認証などの認証の強度と鮮度を要求する
+	if route.StepUp != nil {
+		if unmet := route.StepUp.unmet(p, time.Now()); unmet != "" {
+			slog.WarnContext(r.Context(), "step-up authentication required", slog.String("path", r.URL.Path), slog.String("unmet", unmet))
+			metrics.RecordAuthzDenial(metrics.ReasonStepUpRequired)
+			emitDenied(r.Context(), r.URL.Path, p.Subject, metrics.ReasonStepUpRequired+": "+unmet)
+			if err := writeStepUpRequired(w, r, route.StepUp, unmet); err != nil {
+				slog.ErrorContext(r.Context(), "failed to write step-up error", slog.String("error", err.Error()))
+			}
+			return
+		}
+	}
+
+	// バックエンドがWorkspaceUserIDを必要とする場合は解決して転送
+	if route.WorkspaceUser && p.WorkspaceUserID == "" {
+		membership, err := h.resolver.ResolveWorkspaceUser(r.Context(), p.Subject)
+		if err != nil {
+			if errors.Is(err, tenant.ErrNotMember) {
+				metrics.RecordAuthzDenial(metrics.ReasonNotWorkspaceMember)
+				emitDenied(r.Context(), r.URL.Path, p.Subject, metrics.ReasonNotWorkspaceMember)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			slog.ErrorContext(r.Context(), "failed to resolve workspace user", slog.String("error", err.Error()))
+			http.Error(w, "Failed to resolve workspace user", http.StatusBadGateway)
+			return
+		}
+
+		resolved := *p
+		resolved.WorkspaceID = membership.WorkspaceID
+		resolved.WorkspaceUserID = membership.WorkspaceUserID
+		resolved.Privileged = membership.Privileged
+		resolved.SetHeader(r.Header)
+		r = r.WithContext(principal.NewContext(r.Context(), &resolved))
+	}
+
+	h.proxy(w, r)
+}
+
+// proxy はルートのタイムアウトを適用してバックエンドに転送する
+func (h *Handler) proxy(w http.ResponseWriter, r *http.Request) {
+	route := routeFrom(r.Context())
+
+	if route.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), route.Timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
+	h.proxies[route.Backend].ServeHTTP(w, r)
+}
+
+// emitDenied は認可での拒否をセキュリティイベントとして記録する
+func emitDenied(ctx context.Context, path, subject, reason string) {
+	logging.EmitSecurityEvent(ctx, logging.SecurityEvent{
+		Category: logging.CategoryAPI,
+		Action:   logging.ActionAuthorization,
+		Reason:   reason,
+		Subject:  subject,
+		SourceIP: clientip.String(ctx),
+		Path:     path,
+	})
+}
+
+type routeKey struct{}
+
+// routeFrom はServeHTTPで解決したルートをcontextから取得する
+func routeFrom(ctx context.Context) *Route {
+	return ctx.Value(routeKey{}).(*Route)
+}
+
+// newReverseProxy はバックエンドへのリバースプロキシを作成する
+func newReverseProxy(name string, backend Backend) (*httputil.ReverseProxy, error) {
+	target, err := url.Parse(backend.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			// 元のパスを保持してバックエンドに転送
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			// クライアントが偽装できる値を転送しないよう、解決済みのクライアントIPのみをX-Forwarded-Forで渡す
+			pr.Out.Header.Del(clientip.HeaderForwarded)
+			if ip := clientip.String(pr.In.Context()); ip != "" {
+				pr.Out.Header.Set(clientip.HeaderXForwardedFor, ip)
+			}
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			slog.ErrorContext(r.Context(), "proxy error", slog.String("path", r.URL.Path), slog.String("error", err.Error()))
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+
+	var transport http.RoundTripper = http.DefaultTransport
+	if backend.Protocol == ProtocolH2C {
+		// h2c (HTTP/2 without TLS) でバックエンドと通信し、gRPCのトレーラーも転送できるようにする
+		transport = &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		}
+	}
+	// バックエンドへの転送をスパンとして記録してtraceparentを付与し、所要時間をメトリクスに記録する
+	proxy.Transport = telemetry.Transport(metrics.Transport(name, transport))
+
+	return proxy, nil
+}
@@ -0,0 +1,172 @@
+package route
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/kakke18/platform-security-poc/backend/gateway/internal/client"
+	"github.com/kakke18/platform-security-poc/backend/gateway/internal/tenant"
+	identityv1 "github.com/kakke18/platform-security-poc/backend/gen/identity/v1"
+	"github.com/kakke18/platform-security-poc/backend/gen/identity/v1/identityv1connect"
+	"github.com/kakke18/platform-security-poc/backend/platform/clientip"
+	"github.com/kakke18/platform-security-poc/backend/platform/principal"
+)
+
+// testSubjectHeader はテスト用の認証ミドルウェアがPrincipalとして扱うヘッダー
+const testSubjectHeader = "X-Test-Subject"
+
+// fakeWorkspaceUserClient はサブジェクトごとの所属を返すIdentity APIのクライアント
+type fakeWorkspaceUserClient struct {
+	identityv1connect.WorkspaceUserServiceClient
+}
+
+func (c *fakeWorkspaceUserClient) GetWorkspaceUser(ctx context.Context, req *connect.Request[identityv1.GetWorkspaceUserRequest]) (*connect.Response[identityv1.GetWorkspaceUserResponse], error) {
+	switch req.Header().Get(principal.HeaderSubject) {
+	case "auth0|alice":
+		return connect.NewResponse(&identityv1.GetWorkspaceUserResponse{WorkspaceId: "ws-1", WorkspaceUserId: "wu-1"}), nil
+	case "auth0|broken":
+		return nil, connect.NewError(connect.CodeUnavailable, errors.New("down"))
+	}
+	return nil, connect.NewError(connect.CodeNotFound, errors.New("not found"))
+}
+
+// testAuthenticate はテスト用のヘッダーからPrincipalを設定する認証ミドルウェア
+func testAuthenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject := r.Header.Get(testSubjectHeader)
+		if subject == "" {
+			http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		p := &principal.Principal{Subject: subject, Scopes: strings.Fields(r.Header.Get("X-Test-Scopes"))}
+		principal.DelHeader(r.Header)
+		p.SetHeader(r.Header)
+		next.ServeHTTP(w, r.WithContext(principal.NewContext(r.Context(), p)))
+	})
+}
+
+func TestHandler(t *testing.T) {
+	var reached *http.Request
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = r
+		if strings.HasSuffix(r.URL.Path, "/Slow") {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	table := &Table{
+		Backends: map[string]Backend{"svc": {URL: backend.URL, Protocol: ProtocolHTTP1}},
+		Routes: []Route{
+			{Prefix: "/svc.v1.Service/", Backend: "svc"},
+			{Prefix: "/svc.v1.Service/Internal", Deny: true},
+			{Prefix: "/svc.v1.Service/Public", Backend: "svc", Auth: AuthNone},
+			{Prefix: "/svc.v1.Service/Small", Backend: "svc", MaxBodyBytes: 8},
+			{Prefix: "/svc.v1.Service/Slow", Backend: "svc", Timeout: 50 * time.Millisecond},
+			{Prefix: "/svc.v1.Service/Admin", Backend: "svc", Scopes: []string{"admin"}},
+			{Prefix: "/svc.v1.Service/Members", Backend: "svc", WorkspaceUser: true},
+			{Prefix: "/svc.v1.Service/Office", Backend: "svc", AllowedIPs: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}},
+		},
+	}
+	if err := table.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	resolver := tenant.NewResolver(&client.Clients{WorkspaceUser: &fakeWorkspaceUserClient{}})
+	h, err := NewHandler(table, resolver, testAuthenticate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name             string
+		method           string
+		path             string
+		subject          string
+		scopes           string
+		body             string
+		clientIP         string
+		header           http.Header
+		wantStatus       int
+		wantReached      bool
+		wantForwarded    http.Header
+		wantNotForwarded []string
+	}{
+		{name: "unknown procedure is denied by default", path: "/other.v1.Service/Call", subject: "auth0|alice", wantStatus: http.StatusNotFound},
+		{name: "method other than GET and POST", method: http.MethodPut, path: "/svc.v1.Service/Call", subject: "auth0|alice", wantStatus: http.StatusMethodNotAllowed},
+		{name: "explicitly denied procedure", path: "/svc.v1.Service/Internal", subject: "auth0|alice", wantStatus: http.StatusForbidden},
+		{name: "authenticated route", path: "/svc.v1.Service/Call", subject: "auth0|alice", wantStatus: http.StatusOK, wantReached: true, wantForwarded: http.Header{principal.HeaderSubject: {"auth0|alice"}}},
+		{name: "authenticated route without credentials", path: "/svc.v1.Service/Call", wantStatus: http.StatusUnauthorized},
+		{
+			name:             "anonymous route strips spoofed principal headers",
+			path:             "/svc.v1.Service/Public",
+			header:           http.Header{principal.HeaderSubject: {"auth0|spoofed"}, principal.HeaderWorkspaceUserID: {"wu-spoofed"}},
+			wantStatus:       http.StatusOK,
+			wantReached:      true,
+			wantNotForwarded: []string{principal.HeaderSubject, principal.HeaderWorkspaceUserID},
+		},
+		{name: "body within the route limit", path: "/svc.v1.Service/Small", subject: "auth0|alice", body: "12345678", wantStatus: http.StatusOK, wantReached: true},
+		{name: "body over the route limit", path: "/svc.v1.Service/Small", subject: "auth0|alice", body: "123456789", wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "body over the route limit before authentication", path: "/svc.v1.Service/Small", body: "123456789", wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "route timeout", path: "/svc.v1.Service/Slow", subject: "auth0|alice", wantStatus: http.StatusBadGateway, wantReached: true},
+		{name: "missing scope", path: "/svc.v1.Service/Admin", subject: "auth0|alice", scopes: "read", wantStatus: http.StatusForbidden},
+		{name: "required scope", path: "/svc.v1.Service/Admin", subject: "auth0|alice", scopes: "read admin", wantStatus: http.StatusOK, wantReached: true},
+		{name: "workspace user is resolved and forwarded", path: "/svc.v1.Service/Members", subject: "auth0|alice", wantStatus: http.StatusOK, wantReached: true, wantForwarded: http.Header{principal.HeaderWorkspaceUserID: {"wu-1"}}},
+		{name: "workspace user of a non-member", path: "/svc.v1.Service/Members", subject: "auth0|mallory", wantStatus: http.StatusForbidden},
+		{name: "workspace user backend failure", path: "/svc.v1.Service/Members", subject: "auth0|broken", wantStatus: http.StatusBadGateway},
+		{name: "allowed client ip", path: "/svc.v1.Service/Office", subject: "auth0|alice", clientIP: "192.0.2.10", wantStatus: http.StatusOK, wantReached: true},
+		{name: "client ip not allowed", path: "/svc.v1.Service/Office", subject: "auth0|alice", clientIP: "198.51.100.1", wantStatus: http.StatusForbidden},
+		{name: "unresolved client ip is not allowed", path: "/svc.v1.Service/Office", subject: "auth0|alice", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached = nil
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req := httptest.NewRequest(method, tt.path, strings.NewReader(tt.body))
+			for k, v := range tt.header {
+				req.Header.Set(k, v[0])
+			}
+			if tt.subject != "" {
+				req.Header.Set(testSubjectHeader, tt.subject)
+			}
+			if tt.scopes != "" {
+				req.Header.Set("X-Test-Scopes", tt.scopes)
+			}
+			if tt.clientIP != "" {
+				req = req.WithContext(clientip.NewContext(req.Context(), netip.MustParseAddr(tt.clientIP)))
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if (reached != nil) != tt.wantReached {
+				t.Fatalf("backend reached = %v, want %v", reached != nil, tt.wantReached)
+			}
+			for k, v := range tt.wantForwarded {
+				if got := reached.Header.Get(k); got != v[0] {
+					t.Errorf("forwarded %s = %q, want %q", k, got, v[0])
+				}
+			}
+			for _, k := range tt.wantNotForwarded {
+				if got := reached.Header.Get(k); got != "" {
+					t.Errorf("forwarded %s = %q, want removed", k, got)
+				}
+			}
+		})
+	}
+}
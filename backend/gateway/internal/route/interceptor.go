@@ -0,0 +1,119 @@
+package route
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/kakke18/platform-security-poc/backend/platform/clientip"
+	"github.com/kakke18/platform-security-poc/backend/platform/metrics"
+	"github.com/kakke18/platform-security-poc/backend/platform/principal"
+)
+
+// Interceptor はGateway自身が実装するConnectサービス（MeService）にルーティングテーブルの認可要件を適用するインターセプター
+// プロシージャに一致するルートがあれば、プロキシと同じく拒否・許可IP・スコープ・ステップアップ認証を検証する
+// 一致するルートがない場合はGatewayに登録済みのプロシージャのため、そのまま処理する
+// 設定の再読み込みではルーティングテーブルごとに新しいInterceptorを作成する
+type Interceptor struct {
+	table *Table
+}
+
+// NewInterceptor は新しいInterceptorを作成する
+func NewInterceptor(table *Table) *Interceptor {
+	return &Interceptor{table: table}
+}
+
+// Ensure Interceptor implements connect.Interceptor
+var _ connect.Interceptor = (*Interceptor)(nil)
+
+// WrapUnary はUnary RPCのハンドラーでルートの認可要件を検証する
+func (i *Interceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		if err := i.authorize(ctx, req.Spec().Procedure); err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+// WrapStreamingClient はクライアント側のストリームをそのまま返す
+func (i *Interceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler はStreaming RPCのハンドラーでルートの認可要件を検証する
+func (i *Interceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		if err := i.authorize(ctx, conn.Spec().Procedure); err != nil {
+			return err
+		}
+		return next(ctx, conn)
+	}
+}
+
+// authorize はプロシージャに一致するルートの認可要件を検証する
+func (i *Interceptor) authorize(ctx context.Context, procedure string) error {
+	table := i.table
+	if table == nil {
+		return nil
+	}
+	route, ok := table.Match(procedure)
+	if !ok {
+		return nil
+	}
+
+	if route.Deny {
+		slog.WarnContext(ctx, "route denied", slog.String("path", procedure))
+		metrics.RecordAuthzDenial(metrics.ReasonRouteDenied)
+		emitDenied(ctx, procedure, "", metrics.ReasonRouteDenied)
+		return connect.NewError(connect.CodePermissionDenied, errors.New("permission denied"))
+	}
+
+	if len(route.AllowedIPs) > 0 {
+		addr, ok := clientip.FromContext(ctx)
+		if !ok || !clientip.Contains(route.AllowedIPs, addr) {
+			slog.WarnContext(ctx, "client ip not allowed", slog.String("path", procedure), slog.String("client_ip", clientip.String(ctx)))
+			metrics.RecordAuthzDenial(metrics.ReasonIPNotAllowed)
+			emitDenied(ctx, procedure, "", metrics.ReasonIPNotAllowed)
+			return connect.NewError(connect.CodePermissionDenied, errors.New("permission denied"))
+		}
+	}
+
+	if route.Auth == AuthNone {
+		return nil
+	}
+	p, ok := principal.FromContext(ctx)
+	if !ok {
+		return connect.NewError(connect.CodeUnauthenticated, errors.New("unauthenticated"))
+	}
+
+	for _, scope := range route.Scopes {
+		if !p.HasScope(scope) {
+			slog.WarnContext(ctx, "missing required scope", slog.String("path", procedure), slog.String("scope", scope))
+			metrics.RecordAuthzDenial(metrics.ReasonMissingScope)
+			emitDenied(ctx, procedure, p.Subject, metrics.ReasonMissingScope)
+			return connect.NewError(connect.CodePermissionDenied, errors.New("permission denied"))
+		}
+	}
+
+	if route.StepUp != nil {
+		if unmet := route.StepUp.unmet(p, time.Now()); unmet != "" {
+			slog.WarnContext(ctx, "step-up authentication required", slog.String("path", procedure), slog.String("unmet", unmet))
+			metrics.RecordAuthzDenial(metrics.ReasonStepUpRequired)
+			emitDenied(ctx, procedure, p.Subject, metrics.ReasonStepUpRequired+": "+unmet)
+			connectErr, err := stepUpError(route.StepUp, unmet)
+			if err != nil {
+				return connect.NewError(connect.CodeInternal, err)
+			}
+			// Connectはエラーのメタデータをレスポンスヘッダー（gRPCではトレーラー）として返す
+			connectErr.Meta().Set("WWW-Authenticate", route.StepUp.challenge())
+			return connectErr
+		}
+	}
+	return nil
+}
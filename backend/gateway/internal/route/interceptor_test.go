@@ -0,0 +1,116 @@
+package route
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/kakke18/platform-security-poc/backend/platform/clientip"
+	"github.com/kakke18/platform-security-poc/backend/platform/principal"
+)
+
+// specRequest はSpecを差し替えたリクエスト（connect.NewRequestではプロシージャを設定できないため）
+type specRequest struct {
+	connect.AnyRequest
+	spec connect.Spec
+}
+
+func (r *specRequest) Spec() connect.Spec {
+	return r.spec
+}
+
+func TestInterceptor(t *testing.T) {
+	stepUp := &StepUp{ACR: []string{"mfa"}, MaxAge: 5 * time.Minute}
+	table := &Table{
+		Routes: []Route{
+			{Prefix: "/gateway.v1.MeService/Internal", Deny: true},
+			{Prefix: "/gateway.v1.MeService/Admin", Scopes: []string{"admin"}},
+			{Prefix: "/gateway.v1.MeService/UpdateMe", StepUp: stepUp},
+			{Prefix: "/gateway.v1.MeService/Office", Auth: AuthNone, AllowedIPs: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}},
+		},
+	}
+	if err := table.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	recent := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name          string
+		procedure     string
+		principal     *principal.Principal
+		clientIP      string
+		nilTable      bool
+		wantCode      connect.Code
+		wantChallenge bool
+	}{
+		{name: "procedure without a route", procedure: "/gateway.v1.MeService/GetMe", principal: &principal.Principal{Subject: "auth0|alice"}},
+		{name: "no table", procedure: "/gateway.v1.MeService/Internal", nilTable: true},
+		{name: "denied procedure", procedure: "/gateway.v1.MeService/Internal", principal: &principal.Principal{Subject: "auth0|alice"}, wantCode: connect.CodePermissionDenied},
+		{name: "missing scope", procedure: "/gateway.v1.MeService/Admin", principal: &principal.Principal{Subject: "auth0|alice"}, wantCode: connect.CodePermissionDenied},
+		{name: "required scope", procedure: "/gateway.v1.MeService/Admin", principal: &principal.Principal{Subject: "auth0|alice", Scopes: []string{"admin"}}},
+		{name: "authenticated route without a principal", procedure: "/gateway.v1.MeService/Admin", wantCode: connect.CodeUnauthenticated},
+		{
+			name:          "step-up required",
+			procedure:     "/gateway.v1.MeService/UpdateMe",
+			principal:     &principal.Principal{Subject: "auth0|alice", ACR: "pwd", AuthTime: recent},
+			wantCode:      connect.CodeUnauthenticated,
+			wantChallenge: true,
+		},
+		{name: "step-up satisfied", procedure: "/gateway.v1.MeService/UpdateMe", principal: &principal.Principal{Subject: "auth0|alice", ACR: "mfa", AuthTime: recent}},
+		{name: "allowed client ip", procedure: "/gateway.v1.MeService/Office", clientIP: "192.0.2.10"},
+		{name: "client ip not allowed", procedure: "/gateway.v1.MeService/Office", clientIP: "198.51.100.1", wantCode: connect.CodePermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := NewInterceptor(table)
+			if tt.nilTable {
+				i = NewInterceptor(nil)
+			}
+			called := false
+			call := i.WrapUnary(func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+				called = true
+				return nil, nil
+			})
+
+			ctx := context.Background()
+			if tt.principal != nil {
+				ctx = principal.NewContext(ctx, tt.principal)
+			}
+			if tt.clientIP != "" {
+				ctx = clientip.NewContext(ctx, netip.MustParseAddr(tt.clientIP))
+			}
+			_, err := call(ctx, &specRequest{AnyRequest: connect.NewRequest(&struct{}{}), spec: connect.Spec{Procedure: tt.procedure}})
+
+			if tt.wantCode == 0 {
+				if err != nil || !called {
+					t.Fatalf("error = %v, called = %v, want the handler to be called", err, called)
+				}
+				return
+			}
+			if called {
+				t.Fatal("handler was called for a rejected request")
+			}
+			if connect.CodeOf(err) != tt.wantCode {
+				t.Fatalf("error = %v, want code %v", err, tt.wantCode)
+			}
+			var connectErr *connect.Error
+			if !errors.As(err, &connectErr) {
+				t.Fatalf("error = %v, want *connect.Error", err)
+			}
+			challenge := connectErr.Meta().Get("WWW-Authenticate")
+			if tt.wantChallenge {
+				if challenge != stepUp.challenge() {
+					t.Errorf("WWW-Authenticate = %q", challenge)
+				}
+				if len(connectErr.Details()) != 1 {
+					t.Errorf("details = %v, want the ErrorInfo", connectErr.Details())
+				}
+			} else if challenge != "" {
+				t.Errorf("WWW-Authenticate = %q, want none", challenge)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package route
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/kakke18/platform-security-poc/backend/platform/principal"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+const (
+	// StepUpErrorReason はステップアップ認証が必要なことを示すErrorInfoのReason
+	StepUpErrorReason = "STEP_UP_REQUIRED"
+
+	// StepUpErrorDomain はErrorInfoのDomain
+	StepUpErrorDomain = "gateway.platform-security-poc"
+)
+
+// ステップアップ認証で満たしていない要件（ErrorInfoのMetadataのunmetに設定する）
+const (
+	unmetACR      = "acr"
+	unmetAMR      = "amr"
+	unmetAuthTime = "auth_time"
+)
+
+// StepUp はルートが要求する認証の強度と鮮度（ステップアップ認証）
+// 満たしていない場合はUnauthenticatedとし、再認証で要求するacr_valuesとmax_ageをエラーの詳細で返す
+type StepUp struct {
+	// ACR は許可するacrの値（いずれかに一致すればよい、省略時は検証しない）
+	ACR []string `yaml:"acr"`
+
+	// AMR は必要な認証方式（全て含む必要がある、省略時は検証しない）
+	AMR []string `yaml:"amr"`
+
+	// MaxAge はauth_timeからの経過時間の上限（省略時は検証しない）
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+// validate はステップアップ認証の要件の妥当性を検証する
+func (s *StepUp) validate() error {
+	var errs []error
+	if len(s.ACR) == 0 && len(s.AMR) == 0 && s.MaxAge == 0 {
+		errs = append(errs, errors.New("step_up requires acr, amr or max_age"))
+	}
+	if slices.Contains(s.ACR, "") || slices.Contains(s.AMR, "") {
+		errs = append(errs, errors.New("step_up acr and amr must not contain empty values"))
+	}
+	if s.MaxAge < 0 {
+		errs = append(errs, errors.New("step_up max_age must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// unmet はPrincipalが満たしていない要件を返す（全て満たしている場合は空文字列）
+func (s *StepUp) unmet(p *principal.Principal, now time.Time) string {
+	if len(s.ACR) > 0 && !slices.Contains(s.ACR, p.ACR) {
+		return unmetACR
+	}
+	for _, amr := range s.AMR {
+		if !slices.Contains(p.AMR, amr) {
+			return unmetAMR
+		}
+	}
+	if s.MaxAge > 0 {
+		// 未来のauth_timeは認証した時刻として信頼できないため満たしていないものとする
+		if p.AuthTime.IsZero() || p.AuthTime.After(now) || now.Sub(p.AuthTime) > s.MaxAge {
+			return unmetAuthTime
+		}
+	}
+	return ""
+}
+
+// challenge はRFC 9470のWWW-Authenticateヘッダーの値を返す
+func (s *StepUp) challenge() string {
+	params := []string{`error="insufficient_user_authentication"`}
+	if len(s.ACR) > 0 {
+		params = append(params, fmt.Sprintf("acr_values=%q", strings.Join(s.ACR, " ")))
+	}
+	if s.MaxAge > 0 {
+		params = append(params, "max_age="+s.maxAgeSeconds())
+	}
+	return "Bearer " + strings.Join(params, ", ")
+}
+
+// maxAgeSeconds はmax_ageを秒単位の文字列で返す
+func (s *StepUp) maxAgeSeconds() string {
+	return strconv.FormatInt(int64(s.MaxAge/time.Second), 10)
+}
+
+// errorInfo はフロントエンドが再認証で要求する値を伝えるエラーの詳細を返す
+// acr_valuesとamrはスペース区切り、max_ageは秒数で、要件がない場合はキーを含めない
+func (s *StepUp) errorInfo(unmet string) *errdetails.ErrorInfo {
+	metadata := map[string]string{"unmet": unmet}
+	if len(s.ACR) > 0 {
+		metadata["acr_values"] = strings.Join(s.ACR, " ")
+	}
+	if len(s.AMR) > 0 {
+		metadata["amr"] = strings.Join(s.AMR, " ")
+	}
+	if s.MaxAge > 0 {
+		metadata["max_age"] = s.maxAgeSeconds()
+	}
+	return &errdetails.ErrorInfo{
+		Reason:   StepUpErrorReason,
+		Domain:   StepUpErrorDomain,
+		Metadata: metadata,
+	}
+}
+
+// errorWriter はリクエストのプロトコル（Connect・gRPC・gRPC-Web）に合わせてエラーを書き込む
+var errorWriter = connect.NewErrorWriter()
+
+// stepUpError はステップアップ認証が必要なことを示すConnectのエラーを作成する
+func stepUpError(s *StepUp, unmet string) (*connect.Error, error) {
+	connectErr := connect.NewError(connect.CodeUnauthenticated, errors.New("step-up authentication required"))
+	detail, err := connect.NewErrorDetail(s.errorInfo(unmet))
+	if err != nil {
+		return nil, err
+	}
+	connectErr.AddDetail(detail)
+	return connectErr, nil
+}
+
+// writeStepUpRequired はステップアップ認証が必要なことをConnectのエラーとして返す
+func writeStepUpRequired(w http.ResponseWriter, r *http.Request, s *StepUp, unmet string) error {
+	connectErr, err := stepUpError(s, unmet)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("WWW-Authenticate", s.challenge())
+	return errorWriter.Write(w, r, connectErr)
+}
@@ -0,0 +1,179 @@
+package route
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/kakke18/platform-security-poc/backend/platform/principal"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestStepUpUnmet(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name      string
+		stepUp    StepUp
+		principal principal.Principal
+		want      string
+	}{
+		{name: "acr matches one of the values", stepUp: StepUp{ACR: []string{"mfa", "phr"}}, principal: principal.Principal{ACR: "phr"}},
+		{name: "acr does not match", stepUp: StepUp{ACR: []string{"mfa"}}, principal: principal.Principal{ACR: "pwd"}, want: unmetACR},
+		{name: "missing acr", stepUp: StepUp{ACR: []string{"mfa"}}, want: unmetACR},
+		{name: "all amr values present", stepUp: StepUp{AMR: []string{"pwd", "otp"}}, principal: principal.Principal{AMR: []string{"otp", "pwd", "hwk"}}},
+		{name: "one amr value missing", stepUp: StepUp{AMR: []string{"pwd", "otp"}}, principal: principal.Principal{AMR: []string{"pwd"}}, want: unmetAMR},
+		{name: "recent authentication", stepUp: StepUp{MaxAge: 5 * time.Minute}, principal: principal.Principal{AuthTime: now.Add(-5 * time.Minute)}},
+		{name: "stale authentication", stepUp: StepUp{MaxAge: 5 * time.Minute}, principal: principal.Principal{AuthTime: now.Add(-5*time.Minute - time.Second)}, want: unmetAuthTime},
+		{name: "missing auth_time", stepUp: StepUp{MaxAge: 5 * time.Minute}, want: unmetAuthTime},
+		{name: "auth_time in the future", stepUp: StepUp{MaxAge: 5 * time.Minute}, principal: principal.Principal{AuthTime: now.Add(time.Second)}, want: unmetAuthTime},
+		{
+			name:      "acr is checked before auth_time",
+			stepUp:    StepUp{ACR: []string{"mfa"}, MaxAge: time.Minute},
+			principal: principal.Principal{ACR: "pwd"},
+			want:      unmetACR,
+		},
+		{
+			name:      "all requirements met",
+			stepUp:    StepUp{ACR: []string{"mfa"}, AMR: []string{"otp"}, MaxAge: time.Minute},
+			principal: principal.Principal{ACR: "mfa", AMR: []string{"otp"}, AuthTime: now.Add(-time.Second)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.stepUp.unmet(&tt.principal, now); got != tt.want {
+				t.Errorf("unmet() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStepUpValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		stepUp  StepUp
+		wantErr string
+	}{
+		{name: "acr only", stepUp: StepUp{ACR: []string{"mfa"}}},
+		{name: "max_age only", stepUp: StepUp{MaxAge: time.Minute}},
+		{name: "no requirements", wantErr: "requires acr, amr or max_age"},
+		{name: "empty acr value", stepUp: StepUp{ACR: []string{""}}, wantErr: "must not contain empty values"},
+		{name: "empty amr value", stepUp: StepUp{AMR: []string{"otp", ""}}, wantErr: "must not contain empty values"},
+		{name: "negative max_age", stepUp: StepUp{ACR: []string{"mfa"}, MaxAge: -time.Second}, wantErr: "must not be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.stepUp.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStepUpChallenge(t *testing.T) {
+	tests := []struct {
+		name   string
+		stepUp StepUp
+		want   string
+	}{
+		{name: "acr and max_age", stepUp: StepUp{ACR: []string{"mfa", "phr"}, MaxAge: 10 * time.Minute}, want: `Bearer error="insufficient_user_authentication", acr_values="mfa phr", max_age=600`},
+		{name: "acr only", stepUp: StepUp{ACR: []string{"mfa"}}, want: `Bearer error="insufficient_user_authentication", acr_values="mfa"`},
+		// amrはRFC 9470のパラメーターに含まれないためErrorInfoでのみ伝える
+		{name: "amr only", stepUp: StepUp{AMR: []string{"otp"}}, want: `Bearer error="insufficient_user_authentication"`},
+		{name: "max_age is truncated to seconds", stepUp: StepUp{MaxAge: 90500 * time.Millisecond}, want: `Bearer error="insufficient_user_authentication", max_age=90`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.stepUp.challenge(); got != tt.want {
+				t.Errorf("challenge() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStepUpErrorInfo(t *testing.T) {
+	tests := []struct {
+		name   string
+		stepUp StepUp
+		unmet  string
+		want   map[string]string
+	}{
+		{
+			name:   "all requirements",
+			stepUp: StepUp{ACR: []string{"mfa", "phr"}, AMR: []string{"pwd", "otp"}, MaxAge: 5 * time.Minute},
+			unmet:  unmetAMR,
+			want:   map[string]string{"unmet": "amr", "acr_values": "mfa phr", "amr": "pwd otp", "max_age": "300"},
+		},
+		{name: "omitted requirements have no keys", stepUp: StepUp{MaxAge: time.Minute}, unmet: unmetAuthTime, want: map[string]string{"unmet": "auth_time", "max_age": "60"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := tt.stepUp.errorInfo(tt.unmet)
+			if info.Reason != StepUpErrorReason || info.Domain != StepUpErrorDomain {
+				t.Errorf("reason = %q, domain = %q", info.Reason, info.Domain)
+			}
+			if len(info.Metadata) != len(tt.want) {
+				t.Errorf("metadata = %v, want %v", info.Metadata, tt.want)
+			}
+			for k, v := range tt.want {
+				if info.Metadata[k] != v {
+					t.Errorf("metadata[%s] = %q, want %q", k, info.Metadata[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteStepUpRequired(t *testing.T) {
+	s := &StepUp{ACR: []string{"mfa"}, MaxAge: 5 * time.Minute}
+	req := httptest.NewRequest(http.MethodPost, "/identity.v1.UserService/UpdateMe", nil)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	if err := writeStepUpRequired(rec, req, s, unmetAuthTime); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if got := rec.Header().Values("WWW-Authenticate"); len(got) != 1 || got[0] != s.challenge() {
+		t.Errorf("WWW-Authenticate = %q, want %q", got, s.challenge())
+	}
+
+	var body struct {
+		Code    connect.Code `json:"code"`
+		Details []struct {
+			Type  string `json:"type"`
+			Value string `json:"value"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid error body %q: %v", rec.Body.String(), err)
+	}
+	if body.Code != connect.CodeUnauthenticated || len(body.Details) != 1 {
+		t.Fatalf("body = %s", rec.Body.String())
+	}
+	value, err := base64.RawStdEncoding.DecodeString(body.Details[0].Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info errdetails.ErrorInfo
+	if err := proto.Unmarshal(value, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Reason != StepUpErrorReason || info.Metadata["unmet"] != unmetAuthTime || info.Metadata["acr_values"] != "mfa" {
+		t.Errorf("error info = %v", &info)
+	}
+}
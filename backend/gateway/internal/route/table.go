@@ -0,0 +1,218 @@
+package route
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kakke18/platform-security-poc/backend/gen/gateway/v1/gatewayv1connect"
+	"github.com/kakke18/platform-security-poc/backend/platform/conf"
+)
+
+// Protocol はバックエンドとの通信プロトコル
+type Protocol string
+
+const (
+	// ProtocolHTTP1 はHTTP/1.1で通信する
+	ProtocolHTTP1 Protocol = "http1"
+
+	// ProtocolH2C はHTTP/2 Cleartextで通信する（gRPCを含む全てのConnectプロトコルに対応）
+	ProtocolH2C Protocol = "h2c"
+)
+
+// Auth はルートの認証要件
+type Auth string
+
+const (
+	// AuthRequired はJWTによる認証を必須とする
+	AuthRequired Auth = "required"
+
+	// AuthNone は認証を要求しない
+	AuthNone Auth = "none"
+)
+
+// Backend はルーティング先のバックエンドサービス
+type Backend struct {
+	// URL はバックエンドのベースURL
+	URL string `yaml:"url"`
+
+	// Protocol はバックエンドとの通信プロトコル（省略時はh2c）
+	Protocol Protocol `yaml:"protocol"`
+}
+
+// Route はプロシージャまたはサービスのプレフィックスに対するルーティング規則
+type Route struct {
+	// Prefix はマッチさせるパス
+	// "/identity.v1.UserService/" のように"/"で終わる場合はサービス単位、
+	// "/identity.v1.UserService/GetMe" のような場合はプロシージャ単位で一致する
+	Prefix string `yaml:"prefix"`
+
+	// Backend はルーティング先のバックエンド名（DenyとGateway自身のサービスの場合は不要）
+	Backend string `yaml:"backend"`
+
+	// Auth は認証要件（省略時はrequired）
+	Auth Auth `yaml:"auth"`
+
+	// Scopes はアクセストークンに必要なスコープ
+	Scopes []string `yaml:"scopes"`
+
+	// WorkspaceUser はWorkspaceUserIDを解決してX-Workspace-User-IDヘッダーで転送するかどうか
+	WorkspaceUser bool `yaml:"workspace_user"`
+
+	// Timeout はバックエンド呼び出しのタイムアウト（省略時はタイムアウトなし）
+	Timeout time.Duration `yaml:"timeout"`
+
+	// MaxBodyBytes はリクエストボディの最大サイズ（省略時はサーバー全体の上限のみ）
+	// サーバー全体の上限（server.max_body_bytes）より大きい値は効果がない
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+
+	// StepUp は権限の付与などの重要な操作で要求する認証の強度と鮮度（省略時は要求しない）
+	StepUp *StepUp `yaml:"step_up"`
+
+	// AllowedIPs はアクセスを許可するクライアントIPのCIDR（省略時は制限しない）
+	// クライアントIPは信頼するプロキシの転送ヘッダーやPROXYプロトコルから解決したアドレスで判定する
+	AllowedIPs []netip.Prefix `yaml:"allowed_ips"`
+
+	// Deny は内部専用のプロシージャなど、Gatewayから公開しないことを明示する
+	Deny bool `yaml:"deny"`
+}
+
+// Table はGatewayのルーティングテーブル
+type Table struct {
+	// Backends はバックエンド名からバックエンドへの対応
+	Backends map[string]Backend `yaml:"backends"`
+
+	// Routes はルーティング規則の一覧
+	Routes []Route `yaml:"routes"`
+}
+
+// Default はIdentity APIとUser APIへのデフォルトのルーティングテーブルを返す
+func Default(identityAPIURL, userAPIURL string) *Table {
+	return &Table{
+		Backends: map[string]Backend{
+			"identity": {URL: identityAPIURL, Protocol: ProtocolH2C},
+			"user":     {URL: userAPIURL, Protocol: ProtocolH2C},
+		},
+		Routes: []Route{
+			{Prefix: "/identity.v1.UserService/", Backend: "identity"},
+			{Prefix: "/identity.v1.WorkspaceUserService/ListWorkspaceUsers", Backend: "identity"},
+			// GatewayがWorkspaceUserを解決するための内部専用プロシージャ
+			{Prefix: "/identity.v1.WorkspaceUserService/GetWorkspaceUser", Deny: true},
+			{Prefix: "/user.v1.TenantUserService/GetTenantUsers", Backend: "user", WorkspaceUser: true},
+		},
+	}
+}
+
+// Load は設定ファイルと同じ形式（拡張子で判別するYAML・TOML、YAMLとして読むJSON）のファイルからルーティングテーブルを読み込む
+// バックエンドのURLが省略されている場合はdefaultsの値を使用する
+func Load(path string, defaults *Table) (*Table, error) {
+	var t Table
+	if err := conf.DecodeFile(path, &t); err != nil {
+		return nil, fmt.Errorf("failed to load routes file: %w", err)
+	}
+
+	if t.Backends == nil {
+		t.Backends = make(map[string]Backend)
+	}
+	for name, backend := range defaults.Backends {
+		b, ok := t.Backends[name]
+		if !ok {
+			t.Backends[name] = backend
+			continue
+		}
+		if b.URL == "" {
+			b.URL = backend.URL
+		}
+		t.Backends[name] = b
+	}
+
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Validate はルーティングテーブルの妥当性を検証し、省略された値を補完する
+func (t *Table) Validate() error {
+	var errs []error
+
+	for name, b := range t.Backends {
+		if b.Protocol == "" {
+			b.Protocol = ProtocolH2C
+			t.Backends[name] = b
+		}
+		if b.Protocol != ProtocolH2C && b.Protocol != ProtocolHTTP1 {
+			errs = append(errs, fmt.Errorf("backend %q: unknown protocol %q", name, b.Protocol))
+		}
+		if u, err := url.Parse(b.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("backend %q: invalid url %q", name, b.URL))
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i := range t.Routes {
+		r := &t.Routes[i]
+		if r.Auth == "" {
+			r.Auth = AuthRequired
+		}
+		if !strings.HasPrefix(r.Prefix, "/") {
+			errs = append(errs, fmt.Errorf("route %q: prefix must start with /", r.Prefix))
+		}
+		if seen[r.Prefix] {
+			errs = append(errs, fmt.Errorf("route %q: duplicate prefix", r.Prefix))
+		}
+		seen[r.Prefix] = true
+		if r.Auth != AuthRequired && r.Auth != AuthNone {
+			errs = append(errs, fmt.Errorf("route %q: unknown auth %q", r.Prefix, r.Auth))
+		}
+		if r.Auth == AuthNone && (len(r.Scopes) > 0 || r.WorkspaceUser || r.StepUp != nil) {
+			errs = append(errs, fmt.Errorf("route %q: scopes, workspace_user and step_up require auth", r.Prefix))
+		}
+		if r.StepUp != nil {
+			if err := r.StepUp.validate(); err != nil {
+				errs = append(errs, fmt.Errorf("route %q: %w", r.Prefix, err))
+			}
+		}
+		// Gateway自身のサービスはバックエンドに転送しないためbackendを必要としない
+		if r.Deny || isGatewayService(r.Prefix) {
+			continue
+		}
+		if _, ok := t.Backends[r.Backend]; !ok {
+			errs = append(errs, fmt.Errorf("route %q: unknown backend %q", r.Prefix, r.Backend))
+		}
+		if r.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("route %q: timeout must not be negative", r.Prefix))
+		}
+		if r.MaxBodyBytes < 0 {
+			errs = append(errs, fmt.Errorf("route %q: max_body_bytes must not be negative", r.Prefix))
+		}
+	}
+
+	// 最長一致で検索できるようにプレフィックスの長い順に並べる
+	sort.SliceStable(t.Routes, func(i, j int) bool {
+		return len(t.Routes[i].Prefix) > len(t.Routes[j].Prefix)
+	})
+
+	return errors.Join(errs...)
+}
+
+// Match はパスに最長一致するルートを返す
+func (t *Table) Match(path string) (*Route, bool) {
+	for i := range t.Routes {
+		r := &t.Routes[i]
+		if path == r.Prefix || (strings.HasSuffix(r.Prefix, "/") && strings.HasPrefix(path, r.Prefix)) {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// isGatewayService はプレフィックスがGateway自身のサービス（MeService）を対象とするかどうかを返す
+// これらのルートはリバースプロキシではなくInterceptorで認可要件のみを適用する
+func isGatewayService(prefix string) bool {
+	return strings.HasPrefix(prefix, "/"+gatewayv1connect.MeServiceName+"/")
+}
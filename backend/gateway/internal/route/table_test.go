@@ -0,0 +1,189 @@
+package route
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTableMatch(t *testing.T) {
+	table := Default("http://identity.internal", "http://user.internal")
+	table.Routes = append(table.Routes, Route{Prefix: "/identity.v1.UserService/UpdateMe", Backend: "identity"})
+	if err := table.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path       string
+		wantPrefix string
+		wantOK     bool
+	}{
+		{path: "/identity.v1.UserService/GetMe", wantPrefix: "/identity.v1.UserService/", wantOK: true},
+		{path: "/identity.v1.UserService/UpdateMe", wantPrefix: "/identity.v1.UserService/UpdateMe", wantOK: true},
+		{path: "/identity.v1.WorkspaceUserService/GetWorkspaceUser", wantPrefix: "/identity.v1.WorkspaceUserService/GetWorkspaceUser", wantOK: true},
+		{path: "/identity.v1.WorkspaceUserService/ListWorkspaceUsers", wantPrefix: "/identity.v1.WorkspaceUserService/ListWorkspaceUsers", wantOK: true},
+		// プロシージャ単位のルートはプレフィックスとして一致しない
+		{path: "/identity.v1.WorkspaceUserService/ListWorkspaceUsersAll", wantOK: false},
+		{path: "/identity.v1.WorkspaceUserService/DeleteWorkspaceUser", wantOK: false},
+		{path: "/identity.v1.UserService", wantOK: false},
+		{path: "/user.v1.TenantUserService/GetTenantUsers", wantPrefix: "/user.v1.TenantUserService/GetTenantUsers", wantOK: true},
+		{path: "/", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			r, ok := table.Match(tt.path)
+			if ok != tt.wantOK {
+				t.Fatalf("Match() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && r.Prefix != tt.wantPrefix {
+				t.Errorf("Match() = %q, want %q", r.Prefix, tt.wantPrefix)
+			}
+		})
+	}
+}
+
+func TestTableValidate(t *testing.T) {
+	backends := map[string]Backend{"identity": {URL: "http://identity.internal"}}
+	tests := []struct {
+		name    string
+		routes  []Route
+		wantErr string
+	}{
+		{name: "valid", routes: []Route{{Prefix: "/a.v1.S/", Backend: "identity"}}},
+		{name: "deny needs no backend", routes: []Route{{Prefix: "/a.v1.S/M", Deny: true}}},
+		{name: "gateway service needs no backend", routes: []Route{{Prefix: "/gateway.v1.MeService/GetMe", Scopes: []string{"read"}}}},
+		{name: "prefix without slash", routes: []Route{{Prefix: "a.v1.S/", Backend: "identity"}}, wantErr: "must start with /"},
+		{name: "duplicate prefix", routes: []Route{{Prefix: "/a.v1.S/", Backend: "identity"}, {Prefix: "/a.v1.S/", Backend: "identity"}}, wantErr: "duplicate prefix"},
+		{name: "unknown backend", routes: []Route{{Prefix: "/a.v1.S/", Backend: "user"}}, wantErr: "unknown backend"},
+		{name: "unknown auth", routes: []Route{{Prefix: "/a.v1.S/", Backend: "identity", Auth: "optional"}}, wantErr: "unknown auth"},
+		{name: "scopes without auth", routes: []Route{{Prefix: "/a.v1.S/", Backend: "identity", Auth: AuthNone, Scopes: []string{"read"}}}, wantErr: "require auth"},
+		{name: "workspace user without auth", routes: []Route{{Prefix: "/a.v1.S/", Backend: "identity", Auth: AuthNone, WorkspaceUser: true}}, wantErr: "require auth"},
+		{name: "negative timeout", routes: []Route{{Prefix: "/a.v1.S/", Backend: "identity", Timeout: -time.Second}}, wantErr: "timeout must not be negative"},
+		{name: "negative max body bytes", routes: []Route{{Prefix: "/a.v1.S/", Backend: "identity", MaxBodyBytes: -1}}, wantErr: "max_body_bytes must not be negative"},
+		{name: "empty step up", routes: []Route{{Prefix: "/a.v1.S/", Backend: "identity", StepUp: &StepUp{}}}, wantErr: "requires acr, amr or max_age"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := &Table{Backends: backends, Routes: tt.routes}
+			err := table.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				if r := table.Routes[0]; !r.Deny && r.Auth != AuthRequired {
+					t.Errorf("auth = %q, want the default %q", r.Auth, AuthRequired)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	defaults := Default("http://identity.internal", "http://user.internal")
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{name: "yaml", file: "routes.yaml", content: `
+backends:
+  identity: {}
+  user:
+    url: http://user.example
+    protocol: http1
+routes:
+  - prefix: /identity.v1.UserService/
+    backend: identity
+    timeout: 5s
+    max_body_bytes: 65536
+    allowed_ips: [10.0.0.0/8]
+    step_up:
+      acr: [mfa]
+      max_age: 10m
+  - prefix: /identity.v1.WorkspaceUserService/GetWorkspaceUser
+    deny: true
+`},
+		{name: "toml", file: "routes.toml", content: `
+[backends.identity]
+[backends.user]
+url = "http://user.example"
+protocol = "http1"
+
+[[routes]]
+prefix = "/identity.v1.UserService/"
+backend = "identity"
+timeout = "5s"
+max_body_bytes = 65536
+allowed_ips = ["10.0.0.0/8"]
+step_up = { acr = ["mfa"], max_age = "10m" }
+
+[[routes]]
+prefix = "/identity.v1.WorkspaceUserService/GetWorkspaceUser"
+deny = true
+`},
+		{name: "json is read as yaml", file: "routes.json", content: `{
+  "backends": {"identity": {}, "user": {"url": "http://user.example", "protocol": "http1"}},
+  "routes": [
+    {"prefix": "/identity.v1.UserService/", "backend": "identity", "timeout": "5s", "max_body_bytes": 65536,
+     "allowed_ips": ["10.0.0.0/8"], "step_up": {"acr": ["mfa"], "max_age": "10m"}},
+    {"prefix": "/identity.v1.WorkspaceUserService/GetWorkspaceUser", "deny": true}
+  ]
+}`},
+		{name: "unknown key", file: "routes.yaml", content: "routes:\n  - prefix: /a.v1.S/\n    backend: identity\n    retries: 3\n", wantErr: "retries"},
+		{name: "invalid duration", file: "routes.yaml", content: "routes:\n  - prefix: /a.v1.S/\n    backend: identity\n    timeout: soon\n", wantErr: "soon"},
+		{name: "invalid cidr", file: "routes.yaml", content: "routes:\n  - prefix: /a.v1.S/\n    backend: identity\n    allowed_ips: [10.0.0.1]\n", wantErr: "10.0.0.1"},
+		{name: "validation error", file: "routes.yaml", content: "routes:\n  - prefix: /a.v1.S/\n    backend: billing\n", wantErr: "unknown backend"},
+		{name: "unsupported extension", file: "routes.ini", content: "", wantErr: "unsupported file extension"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			table, err := Load(path, defaults)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			// 省略したバックエンドのURLとプロトコルは補完される
+			if b := table.Backends["identity"]; b.URL != "http://identity.internal" || b.Protocol != ProtocolH2C {
+				t.Errorf("identity backend = %+v", b)
+			}
+			if b := table.Backends["user"]; b.URL != "http://user.example" || b.Protocol != ProtocolHTTP1 {
+				t.Errorf("user backend = %+v", b)
+			}
+
+			r, ok := table.Match("/identity.v1.UserService/GetMe")
+			if !ok {
+				t.Fatal("route not found")
+			}
+			if r.Auth != AuthRequired || r.Timeout != 5*time.Second || r.MaxBodyBytes != 65536 {
+				t.Errorf("route = %+v", r)
+			}
+			if len(r.AllowedIPs) != 1 || r.AllowedIPs[0].String() != "10.0.0.0/8" {
+				t.Errorf("allowed_ips = %v", r.AllowedIPs)
+			}
+			if r.StepUp == nil || r.StepUp.MaxAge != 10*time.Minute || len(r.StepUp.ACR) != 1 {
+				t.Errorf("step_up = %+v", r.StepUp)
+			}
+			if r, ok := table.Match("/identity.v1.WorkspaceUserService/GetWorkspaceUser"); !ok || !r.Deny {
+				t.Errorf("deny route = %+v, %v", r, ok)
+			}
+		})
+	}
+}
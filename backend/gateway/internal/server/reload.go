@@ -0,0 +1,283 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+
+	"connectrpc.com/connect"
+	"github.com/kakke18/platform-security-poc/backend/gateway/internal/config"
+	"github.com/kakke18/platform-security-poc/backend/gateway/internal/middleware"
+	"github.com/kakke18/platform-security-poc/backend/gateway/internal/route"
+	"github.com/kakke18/platform-security-poc/backend/gen/gateway/v1/gatewayv1connect"
+	"github.com/kakke18/platform-security-poc/backend/platform/clientip"
+	"github.com/kakke18/platform-security-poc/backend/platform/conf"
+	platformmiddleware "github.com/kakke18/platform-security-poc/backend/platform/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// configReloads は設定の再読み込みの結果ごとの件数
+	configReloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_config_reloads_total",
+		Help: "Number of configuration reloads, by result.",
+	}, []string{"result"})
+
+	// configLastReload は設定の再読み込みに最後に成功した時刻
+	configLastReload = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gateway_config_last_reload_success_timestamp_seconds",
+		Help: "Unix time of the last successful configuration reload.",
+	})
+)
+
+// snapshot は設定から構築した、再読み込みで一度に差し替える不変の状態
+// リクエストは開始時点のスナップショットで最後まで処理され、新旧の設定が混在しない
+type snapshot struct {
+	// clientIPs は信頼するプロキシに基づいてクライアントIPを解決する
+	clientIPs *clientip.Resolver
+
+	// handler はポリシー（SecurityHeaders -> MaxBytes -> RateLimit -> Timeout -> CORS）を適用したマルチプレクサ
+	handler http.Handler
+
+	// routesFile はルーティングテーブルを読み込んだファイル（変更の監視に使用）
+	routesFile string
+}
+
+// serveSnapshot は現在のスナップショットでリクエストを処理する
+// resolveClientIPが固定したスナップショットがあればそれを使用する
+func (s *Server) serveSnapshot(w http.ResponseWriter, r *http.Request) {
+	snap, ok := r.Context().Value(snapshotKey{}).(*snapshot)
+	if !ok {
+		snap = s.current.Load()
+	}
+	snap.handler.ServeHTTP(w, r)
+}
+
+type snapshotKey struct{}
+
+// resolveClientIP は現在のスナップショットの信頼するプロキシでクライアントIPを解決するミドルウェア
+// 以降の処理で同じスナップショットを使用するよう、contextに固定する
+func (s *Server) resolveClientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		snap := s.current.Load()
+		r = r.WithContext(context.WithValue(r.Context(), snapshotKey{}, snap))
+		snap.clientIPs.Middleware(next).ServeHTTP(w, r)
+	})
+}
+
+// Trusted は現在のスナップショットでaddrが信頼するプロキシかを返す（PROXYプロトコルの受け付けで使用）
+func (s *Server) Trusted(addr netip.Addr) bool {
+	return s.current.Load().clientIPs.Trusted(addr)
+}
+
+// apply は設定からルーティングテーブル・JWT検証・セキュリティヘッダー・CORSなどを構築したスナップショットに差し替える
+// 全ての構築に成功した場合のみ差し替えるため、エラー時は現在のスナップショットがそのまま残る
+func (s *Server) apply(cfg *config.Config) error {
+	// ルーティングテーブルを読み込む
+	routes := route.Default(cfg.IdentityAPIURL, cfg.UserAPIURL)
+	var err error
+	if cfg.RoutesFile != "" {
+		routes, err = route.Load(cfg.RoutesFile, routes)
+	} else {
+		err = routes.Validate()
+	}
+	if err != nil {
+		return fmt.Errorf("invalid routes: %w", err)
+	}
+
+	// JWKSの鍵とキャッシュを共有し、検証の設定のみを差し替えたJWTミドルウェア
+	jwt := s.jwt.WithPolicy(middleware.Policy{
+		RevokedKeyIDs: cfg.RevokedKeyIDs,
+		Claims: middleware.ClaimPolicy{
+			Leeway:           cfg.JWTLeeway,
+			MaxLifetime:      cfg.JWTMaxTokenLifetime,
+			AllowedClientIDs: cfg.JWTAllowedClientIDs,
+		},
+		DPoP: middleware.DPoPPolicy{
+			RequiredClientIDs:    cfg.DPoP.RequiredClientIDs,
+			RequiredWorkspaceIDs: cfg.DPoP.RequiredWorkspaceIDs,
+			ProofMaxAge:          cfg.DPoP.ProofMaxAge,
+			PublicOrigin:         cfg.DPoP.PublicOrigin,
+			ReplayCacheSize:      cfg.DPoP.ReplayCacheSize,
+			ReplayCachePerKey:    cfg.DPoP.ReplayCachePerKey,
+		},
+	})
+
+	// 認証ミドルウェアチェーン: JWT検証 -> テナント検証
+	authenticate := func(next http.Handler) http.Handler {
+		return jwt.Middleware(s.tenant.Middleware(next))
+	}
+
+	// ルーティングテーブルに従うリバースプロキシを作成
+	routeHandler, err := route.NewHandler(routes, s.resolver, authenticate)
+	if err != nil {
+		return err
+	}
+
+	// ポリシーのチェーン: SecurityHeaders -> MaxBytes -> RateLimit -> Timeout -> CORS -> mux
+	// リクエストボディの上限は再起動が必要な項目のため起動時の設定を使用する
+	policy := platformmiddleware.Chain(s.newMux(authenticate, routes, routeHandler),
+		platformmiddleware.SecurityHeaders(cfg.SecurityHeaders),
+		platformmiddleware.MaxBytes(s.config.Server.MaxBodyBytes),
+		s.rateLimiter.Middleware,
+		platformmiddleware.Timeout(cfg.RequestTimeout),
+		middleware.NewCORS(corsPolicies(cfg.CORS)).Middleware,
+	)
+
+	// レート制限はクライアントごとの残りのトークンを維持し、上限のみを差し替える
+	s.rateLimiter.SetLimit(cfg.RateLimit.RequestsPerSecond, cfg.RateLimit.Burst)
+	s.current.Store(&snapshot{
+		clientIPs:  clientip.NewResolver(cfg.TrustedProxies, cfg.ForwardedHeader),
+		handler:    policy,
+		routesFile: cfg.RoutesFile,
+	})
+	return nil
+}
+
+// newMux はMeService・ルーティングテーブルに従うリバースプロキシ・ヘルスチェックを登録したマルチプレクサを作成する
+func (s *Server) newMux(authenticate func(http.Handler) http.Handler, routes *route.Table, routeHandler http.Handler) http.Handler {
+	mux := http.NewServeMux()
+
+	// MeServiceを登録（JWT検証・テナント検証付き）
+	// ルーティングテーブルに一致するルートがあればスコープやステップアップ認証などの要件も適用する
+	mePath, meConnectHandler := gatewayv1connect.NewMeServiceHandler(
+		s.me,
+		connect.WithReadMaxBytes(int(s.config.Server.MaxBodyBytes)),
+		connect.WithInterceptors(append(slices.Clip(s.interceptors), route.NewInterceptor(routes))...),
+	)
+	mux.Handle(mePath, authenticate(meConnectHandler))
+
+	// その他のプロシージャはルーティングテーブルに従ってバックエンドに転送
+	// テーブルに存在しないプロシージャや内部専用のプロシージャは拒否する
+	mux.Handle("/", routeHandler)
+
+	// ライブネスとgRPCヘルスチェック（grpc.health.v1）はいずれも依存先を確認しない
+	// 依存先を含むレディネスは管理ポートの/readyzでのみ公開する
+	mux.Handle("/health", s.checker.LivenessHandler())
+	mux.Handle(s.checker.NewHandler())
+
+	return mux
+}
+
+// corsPolicies は設定からオリジンごとのCORSポリシーを作成する
+// 個別の設定でヘッダーの一覧を省略したオリジンには共通の設定を使用する
+func corsPolicies(c config.CORS) []middleware.CORSPolicy {
+	var policies []middleware.CORSPolicy
+	for _, origin := range c.AllowedOrigins {
+		policies = append(policies, middleware.CORSPolicy{
+			Origin:           origin,
+			AllowedHeaders:   c.AllowedHeaders,
+			ExposedHeaders:   c.ExposedHeaders,
+			AllowCredentials: c.AllowCredentials,
+			MaxAge:           c.MaxAge,
+		})
+	}
+	for _, o := range c.Origins {
+		p := middleware.CORSPolicy{
+			Origin:           o.Origin,
+			AllowedHeaders:   o.AllowedHeaders,
+			ExposedHeaders:   o.ExposedHeaders,
+			AllowCredentials: o.AllowCredentials,
+			MaxAge:           c.MaxAge,
+		}
+		if len(p.AllowedHeaders) == 0 {
+			p.AllowedHeaders = c.AllowedHeaders
+		}
+		if len(p.ExposedHeaders) == 0 {
+			p.ExposedHeaders = c.ExposedHeaders
+		}
+		policies = append(policies, p)
+	}
+	return policies
+}
+
+// Reload は新しい設定を検証し、ルーティングテーブル・セキュリティヘッダー・CORS・レート制限・信頼するプロキシ・失効させた鍵・クレームとDPoPの検証を差し替える
+// 失敗した場合は現在の設定を維持する。再起動が必要な項目の変更は反映せず、警告を記録する
+func (s *Server) Reload(ctx context.Context, cfg *config.Config) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	if err := s.apply(cfg); err != nil {
+		configReloads.WithLabelValues("failure").Inc()
+		return err
+	}
+
+	// 起動時の設定と比較し、反映されていない変更を警告する
+	if keys := s.config.RestartRequired(cfg); len(keys) > 0 {
+		slog.WarnContext(ctx, "config changes require restart and were not applied", slog.Any("keys", keys))
+	}
+	configReloads.WithLabelValues("success").Inc()
+	configLastReload.SetToCurrentTime()
+	return nil
+}
+
+// WatchConfig は設定ファイル・ルーティングテーブルの変更とSIGHUPを監視し、設定を再読み込みする
+// 読み込みや検証に失敗した場合はエラーを記録して現在の設定を維持する。ctxがキャンセルされるまでブロックする
+// 再読み込みでルーティングテーブルのファイルが変わった場合は、新しいファイルを監視し直す
+func (s *Server) WatchConfig(ctx context.Context, args []string) {
+	reload := func(trigger string) {
+		cfg, err := config.Load(args)
+		if err == nil {
+			err = s.Reload(ctx, cfg)
+		} else {
+			configReloads.WithLabelValues("failure").Inc()
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "config reload failed, keeping current config", slog.String("trigger", trigger), slog.String("error", err.Error()))
+			return
+		}
+		slog.InfoContext(ctx, "config reloaded", slog.String("trigger", trigger))
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	// ファイルの変更は監視のgoroutineから通知し、再読み込みはこのループで直列に行う
+	changed := make(chan struct{}, 1)
+	watch := func(routesFile string) context.CancelFunc {
+		watchCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			paths := []string{conf.File(args), routesFile}
+			err := conf.Watch(watchCtx, paths, func() {
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			})
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to watch config files", slog.String("error", err.Error()))
+			}
+		}()
+		return cancel
+	}
+
+	watched := s.current.Load().routesFile
+	stop := watch(watched)
+	defer func() { stop() }()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			reload("sighup")
+		case <-changed:
+			reload("file")
+		}
+
+		if routesFile := s.current.Load().routesFile; routesFile != watched {
+			stop()
+			watched = routesFile
+			stop = watch(watched)
+			slog.InfoContext(ctx, "watching new routes file", slog.String("routes_file", watched))
+		}
+	}
+}
@@ -2,100 +2,211 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
+	"sync"
+	"sync/atomic"
 
-	"github.com/kakke18/platform-security-poc/backend/gen/gateway/v1/gatewayv1connect"
+	"connectrpc.com/connect"
+	"github.com/kakke18/platform-security-poc/backend/gateway/internal/client"
 	"github.com/kakke18/platform-security-poc/backend/gateway/internal/config"
 	"github.com/kakke18/platform-security-poc/backend/gateway/internal/me"
 	"github.com/kakke18/platform-security-poc/backend/gateway/internal/middleware"
-	"github.com/rs/cors"
+	"github.com/kakke18/platform-security-poc/backend/gateway/internal/tenant"
+	"github.com/kakke18/platform-security-poc/backend/gen/gateway/v1/gatewayv1connect"
+	"github.com/kakke18/platform-security-poc/backend/platform/clientip"
+	"github.com/kakke18/platform-security-poc/backend/platform/event"
+	"github.com/kakke18/platform-security-poc/backend/platform/health"
+	"github.com/kakke18/platform-security-poc/backend/platform/metrics"
+	platformmiddleware "github.com/kakke18/platform-security-poc/backend/platform/middleware"
+	"github.com/kakke18/platform-security-poc/backend/platform/principal"
+	"github.com/kakke18/platform-security-poc/backend/platform/requestid"
+	"github.com/kakke18/platform-security-poc/backend/platform/telemetry"
+	"golang.org/x/net/http2"
 )
 
 // Server はHTTPサーバーを表す
 type Server struct {
-	config     *config.Config
-	httpServer *http.Server
+	config      *config.Config
+	httpServer  *http.Server
+	adminServer *http.Server
+
+	// 設定の再読み込みをまたいで共有し、スナップショットの構築に使用する状態
+	jwt          *middleware.JWTMiddleware
+	resolver     *tenant.Resolver
+	tenant       *middleware.TenantMiddleware
+	me           *me.Handler
+	checker      *health.Checker
+	interceptors []connect.Interceptor
+	rateLimiter  *platformmiddleware.RateLimiter
+
+	// current は設定から構築したスナップショット（再読み込みでは1回のStoreで差し替える）
+	current atomic.Pointer[snapshot]
+
+	// reloadMu は設定の再読み込みを直列化する
+	reloadMu sync.Mutex
 }
 
 // New は新しいサーバーを作成する
 func New(cfg *config.Config) (*Server, error) {
 	// JWTミドルウェアを初期化
-	jwtMiddleware, err := middleware.NewJWTMiddleware(cfg.Auth0Domain, cfg.Auth0Audience)
+	jwtMiddleware, err := middleware.NewJWTMiddleware(cfg.Issuer(), cfg.Auth0Audience)
 	if err != nil {
 		return nil, err
 	}
 
-	// Identity APIのURLをパース
-	identityURL, err := url.Parse(cfg.IdentityAPIURL)
-	if err != nil {
-		return nil, err
+	// opaqueトークンはイントロスペクションで検証する
+	if cfg.Introspection.Endpoint != "" {
+		jwtMiddleware.SetIntrospector(middleware.NewIntrospector(middleware.IntrospectionConfig{
+			Endpoint:     cfg.Introspection.Endpoint,
+			ClientID:     cfg.Introspection.ClientID,
+			ClientSecret: cfg.Introspection.ClientSecret,
+			Timeout:      cfg.Introspection.Timeout,
+			CacheTTL:     cfg.Introspection.CacheTTL,
+			CacheSize:    cfg.Introspection.CacheSize,
+		}))
+	}
+
+	// バックエンドサービスのクライアントを初期化
+	clients := client.New(cfg)
+
+	// テナントミドルウェアを初期化
+	resolver := tenant.NewResolver(clients)
+	// ワークスペースごとにDPoPを必須とする場合は所属するワークスペースを解決する
+	jwtMiddleware.SetWorkspaceLookup(resolver)
+
+	// 依存先のチェックを登録: JWKSの鮮度と下流サービスのgRPCヘルスチェック（下流サービスのライブネス）
+	checker := health.NewChecker(gatewayv1connect.MeServiceName)
+	checker.Add("jwks", jwtMiddleware.CheckJWKS)
+	h2cClient := client.NewH2CClient()
+	checker.Add("identity", health.Downstream(h2cClient, cfg.IdentityAPIURL, connect.WithGRPC()))
+	checker.Add("user", health.Downstream(h2cClient, cfg.UserAPIURL, connect.WithGRPC()))
+
+	// GetMeキャッシュを初期化
+	var meCache *me.Cache
+	if cfg.GetMeCacheTTL > 0 {
+		meCache = me.NewCache(cfg.GetMeCacheTTL, cfg.GetMeCacheSize)
 	}
 
-	// リバースプロキシを作成
-	identityProxy := httputil.NewSingleHostReverseProxy(identityURL)
+	s := &Server{
+		config:   cfg,
+		jwt:      jwtMiddleware,
+		resolver: resolver,
+		tenant:   middleware.NewTenantMiddleware(resolver),
+		// Me APIハンドラーを初期化
+		me:      me.NewHandler(clients, cfg.GetMePartialResponse, meCache),
+		checker: checker,
+		// MeServiceのインターセプター（ルーティングテーブルの認可要件はスナップショットごとに追加する）
+		interceptors: []connect.Interceptor{
+			telemetry.Interceptor(),
+			metrics.NewInterceptor(),
+			platformmiddleware.NewRecoverInterceptor(),
+			principal.NewInterceptor(principal.RequireSubject),
+		},
+		// クライアントごとのトークンは再読み込みをまたいで維持し、上限のみを差し替える
+		rateLimiter: platformmiddleware.NewRateLimiter(cfg.RateLimit.RequestsPerSecond, cfg.RateLimit.Burst),
+	}
 
-	// ヘッダーを保持するようにプロキシをカスタマイズ
-	identityProxy.Director = func(req *http.Request) {
-		req.URL.Scheme = identityURL.Scheme
-		req.URL.Host = identityURL.Host
-		req.Host = identityURL.Host
-		// 元のパスを保持
-		// req.URL.Path はすでに設定されている
+	// ルーティングテーブル・CORS・レート制限などのポリシーを設定から構築
+	if err := s.apply(cfg); err != nil {
+		return nil, err
 	}
 
-	// Me APIハンドラーを初期化
-	meHandler := me.NewHandler(cfg.IdentityAPIURL, cfg.UserAPIURL)
-
-	// マルチプレクサを作成
-	mux := http.NewServeMux()
-
-	// MeServiceを登録（JWT検証付き）
-	mePath, meConnectHandler := gatewayv1connect.NewMeServiceHandler(meHandler)
-	mux.Handle(mePath, jwtMiddleware.Middleware(meConnectHandler))
-
-	// /identity.v1.UserService/* をIdentity APIにルーティング（JWT検証付き）
-	mux.Handle("/identity.v1.UserService/", jwtMiddleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		identityProxy.ServeHTTP(w, r)
-	})))
-
-	// ヘルスチェックエンドポイント
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
-
-	// CORS設定 - 開発用にすべてのヘッダーを許可
-	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3000"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "HEAD"},
-		AllowedHeaders:   []string{"*"},
-		ExposedHeaders:   []string{"*"},
-		AllowCredentials: true,
-		MaxAge:           86400, // 24時間
-	})
-
-	// ハンドラーチェーンを構築: AccessLog -> CORS -> mux
-	handler := middleware.AccessLog(c.Handler(mux))
-
-	httpServer := &http.Server{
-		Addr:    ":" + cfg.Port,
-		Handler: handler,
+	// ハンドラーチェーンを構築: Tracing -> ClientIP -> RequestID -> AccessLog -> Recover -> ポリシー（SecurityHeaders -> MaxBytes -> RateLimit -> Timeout -> CORS） -> mux
+	// ClientIP以降はリクエストの開始時点のスナップショットで処理する
+	handler := platformmiddleware.Chain(http.HandlerFunc(s.serveSnapshot),
+		telemetry.Middleware("gateway"),
+		s.resolveClientIP,
+		requestid.Middleware,
+		platformmiddleware.AccessLog,
+		platformmiddleware.Recover,
+	)
+
+	// タイムアウトとヘッダーサイズの上限で低速なクライアントによる接続の占有を防ぐ
+	// TLSで待ち受ける場合のHTTP/2にもストリーム数とフレームサイズの上限を適用する
+	s.httpServer = cfg.Server.NewHTTPServer(":"+cfg.Port, handler)
+	if err := http2.ConfigureServer(s.httpServer, cfg.Server.HTTP2Server()); err != nil {
+		return nil, fmt.Errorf("failed to configure HTTP/2: %w", err)
 	}
 
-	return &Server{
-		config:     cfg,
-		httpServer: httpServer,
-	}, nil
+	// 内部向け管理エンドポイント用のマルチプレクサを作成
+	adminMux := http.NewServeMux()
+
+	// Identity API / User APIからの変更イベントを受信してGetMeキャッシュを無効化
+	// 共有シークレット（events_secret）を持たない送信元からのイベントは拒否する
+	adminMux.Handle("/internal/events", event.Handler(cfg.EventsSecret, func(ctx context.Context, e event.Event) {
+		if meCache != nil {
+			meCache.Invalidate(ctx, e)
+		}
+	}))
+
+	// ライブネスと、依存先ごとの詳細を含むレディネス
+	adminMux.Handle("/livez", checker.LivenessHandler())
+	adminMux.Handle("/readyz", checker.ReadinessHandler())
+
+	// Prometheusメトリクス
+	adminMux.Handle("/metrics", metrics.Handler())
+
+	adminHandler := platformmiddleware.Chain(adminMux,
+		telemetry.Middleware("gateway-admin"),
+		s.resolveClientIP,
+		requestid.Middleware,
+		platformmiddleware.AccessLog,
+		platformmiddleware.Recover,
+	)
+
+	s.adminServer = cfg.Server.NewHTTPServer(":"+cfg.AdminPort, adminHandler)
+
+	return s, nil
 }
 
-// Run はサーバーを起動する
+// Run はサーバーと管理サーバーを設定したポートで起動する
+// いずれかのサーバーが停止した時点でそのエラーを返す
 func (s *Server) Run() error {
-	return s.httpServer.ListenAndServe()
+	ln, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return err
+	}
+	adminLn, err := net.Listen("tcp", s.adminServer.Addr)
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	return s.Serve(ln, adminLn)
+}
+
+// Serve は待ち受け済みのlnで公開ポート、adminLnで管理ポートのサーバーを起動する
+// いずれかのサーバーが停止した時点でそのエラーを返す
+func (s *Server) Serve(ln, adminLn net.Listener) error {
+	// PROXYプロトコルが有効な場合は信頼するプロキシからの接続でヘッダーを解釈する
+	if s.config.ProxyProtocol {
+		ln = clientip.NewProxyListener(ln, s)
+	}
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- s.adminServer.Serve(adminLn)
+	}()
+	go func() {
+		errCh <- s.serveHTTP(ln)
+	}()
+	return <-errCh
+}
+
+// serveHTTP は公開ポートで待ち受ける
+// 証明書が設定されている場合はTLSで待ち受ける
+func (s *Server) serveHTTP(ln net.Listener) error {
+	if s.config.TLS.Enabled() {
+		return s.httpServer.ServeTLS(ln, s.config.TLS.CertFile, s.config.TLS.KeyFile)
+	}
+	return s.httpServer.Serve(ln)
 }
 
-// Shutdown はサーバーをグレースフルシャットダウンする
+// Shutdown はサーバーと管理サーバーをグレースフルシャットダウンする
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.httpServer.Shutdown(ctx)
+	return errors.Join(
+		s.httpServer.Shutdown(ctx),
+		s.adminServer.Shutdown(ctx),
+	)
 }
@@ -0,0 +1,140 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"connectrpc.com/connect"
+	"github.com/kakke18/platform-security-poc/backend/gateway/internal/client"
+	identityv1 "github.com/kakke18/platform-security-poc/backend/gen/identity/v1"
+	userv1 "github.com/kakke18/platform-security-poc/backend/gen/user/v1"
+	"github.com/kakke18/platform-security-poc/backend/platform/principal"
+	"github.com/kakke18/platform-security-poc/backend/platform/tenantctx"
+)
+
+// ErrNotMember はユーザーが指定されたテナントに所属していないことを表す
+var ErrNotMember = errors.New("user is not a member of the tenant")
+
+// Membership はユーザーが選択したテナントへの所属情報を表す
+type Membership struct {
+	// WorkspaceID はワークスペースID
+	WorkspaceID string
+
+	// WorkspaceUserID はワークスペースユーザーID
+	WorkspaceUserID string
+
+	// Privileged は特権ユーザー（ワークスペース管理者）かどうか
+	Privileged bool
+
+	// Email はメールアドレス
+	Email string
+
+	// Name は表示名
+	Name string
+
+	// Tenant は選択されたテナントのコンテキスト
+	Tenant *tenantctx.Context
+
+	// Tenants は所属する全てのテナントのコンテキスト（Resolveで取得した場合のみ）
+	Tenants []*tenantctx.Context
+}
+
+type contextKey struct{}
+
+// NewContext は解決済みの所属情報を保持したcontext.Contextを返す
+// 同じリクエストの中でバックエンドを再度呼び出さずに所属情報を参照するために使用する
+func NewContext(ctx context.Context, m *Membership) context.Context {
+	return context.WithValue(ctx, contextKey{}, m)
+}
+
+// FromContext はcontext.Contextから解決済みの所属情報を取得する
+func FromContext(ctx context.Context) (*Membership, bool) {
+	m, ok := ctx.Value(contextKey{}).(*Membership)
+	return m, ok && m != nil
+}
+
+// Resolver はユーザーが選択したテナントへの所属をバックエンドサービスに問い合わせて検証する
+type Resolver struct {
+	clients *client.Clients
+}
+
+// NewResolver は新しいResolverを作成する
+func NewResolver(clients *client.Clients) *Resolver {
+	return &Resolver{
+		clients: clients,
+	}
+}
+
+// ResolveWorkspaceUser はAuth0ユーザーIDに対応するワークスペースへの所属を取得する
+// ワークスペースに所属していない場合はErrNotMemberを返す
+func (r *Resolver) ResolveWorkspaceUser(ctx context.Context, auth0UserID string) (*Membership, error) {
+	// Identity APIからWorkspaceUser情報を取得
+	workspaceUserReq := connect.NewRequest(&identityv1.GetWorkspaceUserRequest{})
+	workspaceUserReq.Header().Set(principal.HeaderSubject, auth0UserID)
+
+	workspaceUserResp, err := r.clients.WorkspaceUser.GetWorkspaceUser(ctx, workspaceUserReq)
+	if err != nil {
+		if connect.CodeOf(err) == connect.CodeNotFound {
+			return nil, ErrNotMember
+		}
+		return nil, fmt.Errorf("failed to get workspace user: %w", err)
+	}
+
+	return &Membership{
+		WorkspaceID:     workspaceUserResp.Msg.WorkspaceId,
+		WorkspaceUserID: workspaceUserResp.Msg.WorkspaceUserId,
+		Privileged:      workspaceUserResp.Msg.Privileged,
+		Email:           workspaceUserResp.Msg.Email,
+		Name:            workspaceUserResp.Msg.Name,
+	}, nil
+}
+
+// Resolve はAuth0ユーザーIDのユーザーがtenantIDのテナントに所属しているかを検証する
+// 所属していない場合はErrNotMemberを返す
+func (r *Resolver) Resolve(ctx context.Context, auth0UserID, tenantID string) (*Membership, error) {
+	membership, err := r.ResolveWorkspaceUser(ctx, auth0UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// User APIからTenantUser情報を取得
+	tenantUsersReq := connect.NewRequest(&userv1.GetTenantUsersRequest{})
+	tenantUsersReq.Header().Set(principal.HeaderWorkspaceUserID, membership.WorkspaceUserID)
+
+	tenantUsersResp, err := r.clients.TenantUser.GetTenantUsers(ctx, tenantUsersReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tenant users: %w", err)
+	}
+
+	// 所属テナントの中から選択されたテナントを探す
+	membership.Tenants = make([]*tenantctx.Context, len(tenantUsersResp.Msg.Users))
+	for i, tu := range tenantUsersResp.Msg.Users {
+		membership.Tenants[i] = &tenantctx.Context{
+			TenantID:     tu.TenantId,
+			TenantUserID: tu.TenantUserId,
+			Role:         convertRole(tu.Role),
+		}
+		if tu.TenantId == tenantID {
+			membership.Tenant = membership.Tenants[i]
+		}
+	}
+	if membership.Tenant == nil {
+		return nil, ErrNotMember
+	}
+	return membership, nil
+}
+
+// convertRole はUser ServiceのRoleをテナントコンテキストのRoleに変換する
+func convertRole(role userv1.Role) tenantctx.Role {
+	switch role {
+	case userv1.Role_ROLE_ADMIN:
+		return tenantctx.RoleAdmin
+	case userv1.Role_ROLE_MEMBER:
+		return tenantctx.RoleMember
+	case userv1.Role_ROLE_VIEWER:
+		return tenantctx.RoleViewer
+	default:
+		return ""
+	}
+}
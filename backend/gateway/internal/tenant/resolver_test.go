@@ -0,0 +1,132 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/kakke18/platform-security-poc/backend/gateway/internal/client"
+	identityv1 "github.com/kakke18/platform-security-poc/backend/gen/identity/v1"
+	"github.com/kakke18/platform-security-poc/backend/gen/identity/v1/identityv1connect"
+	userv1 "github.com/kakke18/platform-security-poc/backend/gen/user/v1"
+	"github.com/kakke18/platform-security-poc/backend/gen/user/v1/userv1connect"
+	"github.com/kakke18/platform-security-poc/backend/platform/principal"
+	"github.com/kakke18/platform-security-poc/backend/platform/tenantctx"
+)
+
+// fakeWorkspaceUserClient はGetWorkspaceUserの結果を固定したIdentity APIのクライアント
+type fakeWorkspaceUserClient struct {
+	identityv1connect.WorkspaceUserServiceClient
+	resp    *identityv1.GetWorkspaceUserResponse
+	err     error
+	subject string
+}
+
+func (c *fakeWorkspaceUserClient) GetWorkspaceUser(ctx context.Context, req *connect.Request[identityv1.GetWorkspaceUserRequest]) (*connect.Response[identityv1.GetWorkspaceUserResponse], error) {
+	c.subject = req.Header().Get(principal.HeaderSubject)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return connect.NewResponse(c.resp), nil
+}
+
+// fakeTenantUserClient はGetTenantUsersの結果を固定したUser APIのクライアント
+type fakeTenantUserClient struct {
+	userv1connect.TenantUserServiceClient
+	resp            *userv1.GetTenantUsersResponse
+	err             error
+	workspaceUserID string
+}
+
+func (c *fakeTenantUserClient) GetTenantUsers(ctx context.Context, req *connect.Request[userv1.GetTenantUsersRequest]) (*connect.Response[userv1.GetTenantUsersResponse], error) {
+	c.workspaceUserID = req.Header().Get(principal.HeaderWorkspaceUserID)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return connect.NewResponse(c.resp), nil
+}
+
+func TestResolve(t *testing.T) {
+	workspaceUser := &identityv1.GetWorkspaceUserResponse{
+		WorkspaceId:     "ws-1",
+		WorkspaceUserId: "wu-1",
+		Email:           "alice@example.com",
+		Name:            "Alice",
+		Privileged:      true,
+	}
+	tenantUsers := &userv1.GetTenantUsersResponse{Users: []*userv1.TenantUser{
+		{TenantUserId: "tu-1", TenantId: "tenant-1", Role: userv1.Role_ROLE_ADMIN},
+		{TenantUserId: "tu-2", TenantId: "tenant-2", Role: userv1.Role_ROLE_VIEWER},
+	}}
+	tests := []struct {
+		name             string
+		workspaceUserErr error
+		tenantUsersErr   error
+		tenantID         string
+		wantTenant       *tenantctx.Context
+		wantNotMember    bool
+		wantErr          bool
+	}{
+		{name: "member of the tenant", tenantID: "tenant-2", wantTenant: &tenantctx.Context{TenantID: "tenant-2", TenantUserID: "tu-2", Role: tenantctx.RoleViewer}},
+		{name: "tenant the user does not belong to", tenantID: "tenant-9", wantNotMember: true},
+		{name: "not a workspace member", workspaceUserErr: connect.NewError(connect.CodeNotFound, errors.New("not found")), tenantID: "tenant-1", wantNotMember: true},
+		{name: "identity api failure", workspaceUserErr: connect.NewError(connect.CodeUnavailable, errors.New("down")), tenantID: "tenant-1", wantErr: true},
+		{name: "user api failure", tenantUsersErr: connect.NewError(connect.CodeUnavailable, errors.New("down")), tenantID: "tenant-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspaceUsers := &fakeWorkspaceUserClient{resp: workspaceUser, err: tt.workspaceUserErr}
+			tenantUserClient := &fakeTenantUserClient{resp: tenantUsers, err: tt.tenantUsersErr}
+			r := NewResolver(&client.Clients{WorkspaceUser: workspaceUsers, TenantUser: tenantUserClient})
+
+			m, err := r.Resolve(context.Background(), "auth0|alice", tt.tenantID)
+			if workspaceUsers.subject != "auth0|alice" {
+				t.Errorf("GetWorkspaceUser subject = %q, want %q", workspaceUsers.subject, "auth0|alice")
+			}
+			switch {
+			case tt.wantNotMember:
+				if !errors.Is(err, ErrNotMember) {
+					t.Fatalf("error = %v, want ErrNotMember", err)
+				}
+				return
+			case tt.wantErr:
+				if err == nil || errors.Is(err, ErrNotMember) {
+					t.Fatalf("error = %v, want a backend error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+
+			if tenantUserClient.workspaceUserID != "wu-1" {
+				t.Errorf("GetTenantUsers workspace user = %q, want %q", tenantUserClient.workspaceUserID, "wu-1")
+			}
+			if m.WorkspaceID != "ws-1" || m.WorkspaceUserID != "wu-1" || !m.Privileged || m.Email != "alice@example.com" || m.Name != "Alice" {
+				t.Errorf("membership = %+v", m)
+			}
+			if *m.Tenant != *tt.wantTenant {
+				t.Errorf("tenant = %+v, want %+v", m.Tenant, tt.wantTenant)
+			}
+			if len(m.Tenants) != len(tenantUsers.Users) {
+				t.Errorf("tenants = %d, want %d", len(m.Tenants), len(tenantUsers.Users))
+			}
+		})
+	}
+}
+
+func TestResolveWorkspaceUser(t *testing.T) {
+	r := NewResolver(&client.Clients{
+		WorkspaceUser: &fakeWorkspaceUserClient{resp: &identityv1.GetWorkspaceUserResponse{WorkspaceId: "ws-1", WorkspaceUserId: "wu-1"}},
+		TenantUser:    &fakeTenantUserClient{err: errors.New("must not be called")},
+	})
+
+	m, err := r.ResolveWorkspaceUser(context.Background(), "auth0|alice")
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if m.WorkspaceUserID != "wu-1" || m.Tenant != nil || m.Tenants != nil {
+		t.Errorf("membership = %+v, want only the workspace user", m)
+	}
+}
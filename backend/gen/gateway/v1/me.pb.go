@@ -191,9 +191,12 @@ type GetMeResponse struct {
 	// name は表示名 (from Identity)
 	Name string `protobuf:"bytes,4,opt,name=name,proto3" json:"name,omitempty"`
 	// tenants は所属する Tenant の一覧 (from User Service)
-	Tenants       []*TenantUserInfo `protobuf:"bytes,5,rep,name=tenants,proto3" json:"tenants,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	Tenants []*TenantUserInfo `protobuf:"bytes,5,rep,name=tenants,proto3" json:"tenants,omitempty"`
+	// degraded_fields は部分応答時に取得できなかったフィールド名の一覧 (例: "tenants")
+	// 全てのフィールドを取得できた場合は空
+	DegradedFields []string `protobuf:"bytes,6,rep,name=degraded_fields,json=degradedFields,proto3" json:"degraded_fields,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
 }
 
 func (x *GetMeResponse) Reset() {
@@ -261,6 +264,13 @@ func (x *GetMeResponse) GetTenants() []*TenantUserInfo {
 	return nil
 }
 
+func (x *GetMeResponse) GetDegradedFields() []string {
+	if x != nil {
+		return x.DegradedFields
+	}
+	return nil
+}
+
 // ListWorkspaceUsersRequest は ListWorkspaceUsers のリクエスト
 type ListWorkspaceUsersRequest struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -445,13 +455,14 @@ const file_gateway_v1_me_proto_rawDesc = "" +
 	"\x0eTenantUserInfo\x12\x1b\n" +
 	"\ttenant_id\x18\x01 \x01(\tR\btenantId\x12$\n" +
 	"\x0etenant_user_id\x18\x02 \x01(\tR\ftenantUserId\x12$\n" +
-	"\x04role\x18\x03 \x01(\x0e2\x10.gateway.v1.RoleR\x04role\"\xbe\x01\n" +
+	"\x04role\x18\x03 \x01(\x0e2\x10.gateway.v1.RoleR\x04role\"\xe7\x01\n" +
 	"\rGetMeResponse\x12!\n" +
 	"\fworkspace_id\x18\x01 \x01(\tR\vworkspaceId\x12*\n" +
 	"\x11workspace_user_id\x18\x02 \x01(\tR\x0fworkspaceUserId\x12\x14\n" +
 	"\x05email\x18\x03 \x01(\tR\x05email\x12\x12\n" +
 	"\x04name\x18\x04 \x01(\tR\x04name\x124\n" +
-	"\atenants\x18\x05 \x03(\v2\x1a.gateway.v1.TenantUserInfoR\atenants\"W\n" +
+	"\atenants\x18\x05 \x03(\v2\x1a.gateway.v1.TenantUserInfoR\atenants\x12'\n" +
+	"\x0fdegraded_fields\x18\x06 \x03(\tR\x0edegradedFields\"W\n" +
 	"\x19ListWorkspaceUsersRequest\x12\x1b\n" +
 	"\tpage_size\x18\x01 \x01(\x05R\bpageSize\x12\x1d\n" +
 	"\n" +
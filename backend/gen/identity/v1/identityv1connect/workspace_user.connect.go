@@ -65,12 +65,14 @@ func NewWorkspaceUserServiceClient(httpClient connect.HTTPClient, baseURL string
 			httpClient,
 			baseURL+WorkspaceUserServiceGetWorkspaceUserProcedure,
 			connect.WithSchema(workspaceUserServiceMethods.ByName("GetWorkspaceUser")),
+			connect.WithIdempotency(connect.IdempotencyNoSideEffects),
 			connect.WithClientOptions(opts...),
 		),
 		listWorkspaceUsers: connect.NewClient[v1.ListWorkspaceUsersRequest, v1.ListWorkspaceUsersResponse](
 			httpClient,
 			baseURL+WorkspaceUserServiceListWorkspaceUsersProcedure,
 			connect.WithSchema(workspaceUserServiceMethods.ByName("ListWorkspaceUsers")),
+			connect.WithIdempotency(connect.IdempotencyNoSideEffects),
 			connect.WithClientOptions(opts...),
 		),
 	}
@@ -112,12 +114,14 @@ func NewWorkspaceUserServiceHandler(svc WorkspaceUserServiceHandler, opts ...con
 		WorkspaceUserServiceGetWorkspaceUserProcedure,
 		svc.GetWorkspaceUser,
 		connect.WithSchema(workspaceUserServiceMethods.ByName("GetWorkspaceUser")),
+		connect.WithIdempotency(connect.IdempotencyNoSideEffects),
 		connect.WithHandlerOptions(opts...),
 	)
 	workspaceUserServiceListWorkspaceUsersHandler := connect.NewUnaryHandler(
 		WorkspaceUserServiceListWorkspaceUsersProcedure,
 		svc.ListWorkspaceUsers,
 		connect.WithSchema(workspaceUserServiceMethods.ByName("ListWorkspaceUsers")),
+		connect.WithIdempotency(connect.IdempotencyNoSideEffects),
 		connect.WithHandlerOptions(opts...),
 	)
 	return "/identity.v1.WorkspaceUserService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -68,7 +68,9 @@ type GetWorkspaceUserResponse struct {
 	// email はメールアドレス
 	Email string `protobuf:"bytes,3,opt,name=email,proto3" json:"email,omitempty"`
 	// name は表示名
-	Name          string `protobuf:"bytes,4,opt,name=name,proto3" json:"name,omitempty"`
+	Name string `protobuf:"bytes,4,opt,name=name,proto3" json:"name,omitempty"`
+	// privileged は特権ユーザー（ワークスペース管理者）かどうか
+	Privileged    bool `protobuf:"varint,5,opt,name=privileged,proto3" json:"privileged,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -131,6 +133,13 @@ func (x *GetWorkspaceUserResponse) GetName() string {
 	return ""
 }
 
+func (x *GetWorkspaceUserResponse) GetPrivileged() bool {
+	if x != nil {
+		return x.Privileged
+	}
+	return false
+}
+
 // ListWorkspaceUsersRequest は ListWorkspaceUsers のリクエスト
 type ListWorkspaceUsersRequest struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -310,12 +319,15 @@ var File_identity_v1_workspace_user_proto protoreflect.FileDescriptor
 const file_identity_v1_workspace_user_proto_rawDesc = "" +
 	"\n" +
 	" identity/v1/workspace_user.proto\x12\videntity.v1\"\x19\n" +
-	"\x17GetWorkspaceUserRequest\"\x93\x01\n" +
+	"\x17GetWorkspaceUserRequest\"\xb3\x01\n" +
 	"\x18GetWorkspaceUserResponse\x12!\n" +
 	"\fworkspace_id\x18\x01 \x01(\tR\vworkspaceId\x12*\n" +
 	"\x11workspace_user_id\x18\x02 \x01(\tR\x0fworkspaceUserId\x12\x14\n" +
 	"\x05email\x18\x03 \x01(\tR\x05email\x12\x12\n" +
-	"\x04name\x18\x04 \x01(\tR\x04name\"W\n" +
+	"\x04name\x18\x04 \x01(\tR\x04name\x12\x1e\n" +
+	"\n" +
+	"privileged\x18\x05 \x01(\bR\n" +
+	"privileged\"W\n" +
 	"\x19ListWorkspaceUsersRequest\x12\x1b\n" +
 	"\tpage_size\x18\x01 \x01(\x05R\bpageSize\x12\x1d\n" +
 	"\n" +
@@ -326,10 +338,10 @@ const file_identity_v1_workspace_user_proto_rawDesc = "" +
 	"\x04name\x18\x03 \x01(\tR\x04name\"v\n" +
 	"\x1aListWorkspaceUsersResponse\x120\n" +
 	"\x05users\x18\x01 \x03(\v2\x1a.identity.v1.WorkspaceUserR\x05users\x12&\n" +
-	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken2\xde\x01\n" +
-	"\x14WorkspaceUserService\x12_\n" +
-	"\x10GetWorkspaceUser\x12$.identity.v1.GetWorkspaceUserRequest\x1a%.identity.v1.GetWorkspaceUserResponse\x12e\n" +
-	"\x12ListWorkspaceUsers\x12&.identity.v1.ListWorkspaceUsersRequest\x1a'.identity.v1.ListWorkspaceUsersResponseBMZKgithub.com/kakke18/platform-security-poc/backend/gen/identity/v1;identityv1b\x06proto3"
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken2\xe8\x01\n" +
+	"\x14WorkspaceUserService\x12d\n" +
+	"\x10GetWorkspaceUser\x12$.identity.v1.GetWorkspaceUserRequest\x1a%.identity.v1.GetWorkspaceUserResponse\"\x03\x90\x02\x01\x12j\n" +
+	"\x12ListWorkspaceUsers\x12&.identity.v1.ListWorkspaceUsersRequest\x1a'.identity.v1.ListWorkspaceUsersResponse\"\x03\x90\x02\x01BMZKgithub.com/kakke18/platform-security-poc/backend/gen/identity/v1;identityv1b\x06proto3"
 
 var (
 	file_identity_v1_workspace_user_proto_rawDescOnce sync.Once
@@ -60,6 +60,7 @@ func NewTenantUserServiceClient(httpClient connect.HTTPClient, baseURL string, o
 			httpClient,
 			baseURL+TenantUserServiceGetTenantUsersProcedure,
 			connect.WithSchema(tenantUserServiceMethods.ByName("GetTenantUsers")),
+			connect.WithIdempotency(connect.IdempotencyNoSideEffects),
 			connect.WithClientOptions(opts...),
 		),
 	}
@@ -93,6 +94,7 @@ func NewTenantUserServiceHandler(svc TenantUserServiceHandler, opts ...connect.H
 		TenantUserServiceGetTenantUsersProcedure,
 		svc.GetTenantUsers,
 		connect.WithSchema(tenantUserServiceMethods.ByName("GetTenantUsers")),
+		connect.WithIdempotency(connect.IdempotencyNoSideEffects),
 		connect.WithHandlerOptions(opts...),
 	)
 	return "/user.v1.TenantUserService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
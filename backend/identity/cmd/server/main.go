@@ -12,6 +12,9 @@ import (
 
 	"github.com/kakke18/platform-security-poc/backend/identity/internal/config"
 	"github.com/kakke18/platform-security-poc/backend/identity/internal/server"
+	"github.com/kakke18/platform-security-poc/backend/platform/conf"
+	"github.com/kakke18/platform-security-poc/backend/platform/logging"
+	"github.com/kakke18/platform-security-poc/backend/platform/telemetry"
 )
 
 const (
@@ -19,13 +22,31 @@ const (
 )
 
 func main() {
-	// 環境変数から設定を読み込む
-	cfg, err := config.Load()
+	// 設定ファイル・環境変数・コマンドラインフラグから設定を読み込む
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, conf.ErrPrinted) {
+		return
+	}
 	if err != nil {
 		slog.Error("Failed to load config", "error", err)
 		panic(err)
 	}
 
+	// PIIを削除・ハッシュ化し、全てのログにリクエストIDとトレースIDを付与する
+	closeLogging, err := logging.Setup("identity", cfg.Logging)
+	if err != nil {
+		slog.Error("Failed to initialize logging", "error", err)
+		panic(err)
+	}
+	defer closeLogging()
+
+	// トレースの出力先を設定
+	shutdownTracing, err := telemetry.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		slog.Error("Failed to initialize tracing", "error", err)
+		panic(err)
+	}
+
 	// サーバーを作成
 	srv, err := server.New(cfg)
 	if err != nil {
@@ -57,5 +78,10 @@ func main() {
 		return
 	}
 
+	// 未送信のスパンを出力
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("Failed to shutdown tracing", "error", err)
+	}
+
 	slog.Info("Server exited properly")
 }
@@ -1,27 +1,103 @@
 package config
 
 import (
-	"os"
-)
+	"time"
 
-const (
-	defaultPort = "8081"
+	"github.com/kakke18/platform-security-poc/backend/platform/clientip"
+	"github.com/kakke18/platform-security-poc/backend/platform/conf"
+	"github.com/kakke18/platform-security-poc/backend/platform/logging"
+	"github.com/kakke18/platform-security-poc/backend/platform/telemetry"
 )
 
 // Config はアプリケーション設定を保持する
+// 設定ファイル（-config・CONFIG_FILE）、環境変数、コマンドラインフラグの順で上書きする
 type Config struct {
 	// Port はサーバーのポート番号
-	Port string
+	Port string `yaml:"port" env:"PORT" usage:"公開ポート"`
+
+	// AdminPort はメトリクスなど内部向けエンドポイントを公開する管理サーバーのポート番号
+	AdminPort string `yaml:"admin_port" env:"ADMIN_PORT" usage:"管理ポート"`
+
+	// RequestTimeout はリクエスト全体の処理に設定するデッドライン
+	RequestTimeout time.Duration `yaml:"request_timeout" env:"REQUEST_TIMEOUT" usage:"リクエスト全体のデッドライン"`
+
+	// TrustedProxies はX-Forwarded-For・Forwarded・PROXYプロトコルを信頼するプロキシ（Gatewayなど）のアドレス範囲
+	TrustedProxies clientip.Prefixes `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" usage:"転送ヘッダーを信頼するプロキシのCIDR（カンマ区切り）"`
+
+	// ForwardedHeader は信頼するプロキシがクライアントのアドレスを付与する転送ヘッダー（GatewayはX-Forwarded-Forを付与する）
+	ForwardedHeader clientip.Header `yaml:"forwarded_header" env:"FORWARDED_HEADER" usage:"クライアントのアドレスを読む転送ヘッダー（x-forwarded-for・forwarded）"`
+
+	// ProxyProtocol はPROXYプロトコル（v1・v2）のヘッダーを受け付けるかどうか
+	ProxyProtocol bool `yaml:"proxy_protocol" env:"PROXY_PROTOCOL" usage:"PROXYプロトコルを受け付ける"`
+
+	// EventsURL はプロフィール変更などのイベントの通知先URL（GatewayのAdminポート）
+	// 未設定の場合はイベントを通知しない
+	EventsURL string `yaml:"events_url" env:"EVENTS_URL" usage:"変更イベントの通知先URL"`
+
+	// EventsSecret はイベントの通知先（Gatewayのevents_secret）と共有するシークレット（EVENTS_SECRET_FILEでファイルから読み込める）
+	// events_urlを設定する場合は必須
+	EventsSecret string `yaml:"events_secret" env:"EVENTS_SECRET" secret:"true" usage:"変更イベントの通知先と共有するシークレット"`
+
+	// SeedFile はリポジトリに登録するシードデータ（YAML）のパス
+	// 未設定の場合は組み込みのシードデータを使用する
+	SeedFile string `yaml:"seed_file" env:"SEED_FILE" usage:"シードデータ（YAML）のパス（未設定の場合は組み込みのデータ）"`
+
+	// Server はタイムアウトとリクエストサイズの上限
+	Server conf.Server `yaml:"server"`
+
+	// Logging はログ出力の設定
+	Logging logging.Config `yaml:"logging"`
+
+	// Tracing はトレースの設定
+	Tracing telemetry.Config `yaml:"tracing"`
 }
 
-// Load は環境変数から設定を読み込む
-func Load() (*Config, error) {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = defaultPort
+// defaultConfig はデフォルト設定を返す
+func defaultConfig() *Config {
+	return &Config{
+		Port:            "8081",
+		AdminPort:       "9081",
+		RequestTimeout:  30 * time.Second,
+		ForwardedHeader: clientip.XForwardedFor,
+		Server:          conf.DefaultServer(),
+		Logging:         logging.DefaultConfig(),
+		Tracing:         telemetry.DefaultConfig("identity"),
 	}
+}
 
-	return &Config{
-		Port: port,
-	}, nil
+// Load は設定ファイル・環境変数・コマンドラインフラグから設定を読み込む
+// -print-configが指定された場合は有効な設定を出力してconf.ErrPrintedを返す
+func Load(args []string) (*Config, error) {
+	cfg := defaultConfig()
+	if err := conf.Load(cfg, args); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate は設定の妥当性を検証し、全てのエラーをまとめて返す
+func (c *Config) Validate() error {
+	var errs conf.Errors
+	errs.Port("port", c.Port)
+	errs.Port("admin_port", c.AdminPort)
+	if c.AdminPort == c.Port {
+		errs.Addf("admin_port", "must differ from port")
+	}
+	errs.Positive("request_timeout", c.RequestTimeout)
+	if err := c.ForwardedHeader.Validate(); err != nil {
+		errs.Addf("forwarded_header", "%v", err)
+	}
+	errs.Server("server", c.Server)
+	errs.File("seed_file", c.SeedFile)
+	errs.OptionalURL("events_url", c.EventsURL)
+	if c.EventsURL != "" {
+		errs.Required("events_secret", c.EventsSecret)
+	}
+	if err := c.Logging.Validate(); err != nil {
+		errs.Addf("logging", "%v", err)
+	}
+	if err := c.Tracing.Validate(); err != nil {
+		errs.Addf("tracing", "%v", err)
+	}
+	return errs.Err()
 }
@@ -2,76 +2,204 @@ package server
 
 import (
 	"context"
+	"errors"
+	"log/slog"
+	"net"
 	"net/http"
 
-	"golang.org/x/net/http2"
+	"connectrpc.com/connect"
 	"golang.org/x/net/http2/h2c"
 
 	"github.com/kakke18/platform-security-poc/backend/gen/identity/v1/identityv1connect"
 	"github.com/kakke18/platform-security-poc/backend/identity/internal/config"
-	"github.com/kakke18/platform-security-poc/backend/identity/internal/middleware"
 	"github.com/kakke18/platform-security-poc/backend/identity/internal/user"
 	"github.com/kakke18/platform-security-poc/backend/identity/internal/workspace"
 	"github.com/kakke18/platform-security-poc/backend/identity/internal/workspaceuser"
+	"github.com/kakke18/platform-security-poc/backend/platform/clientip"
+	"github.com/kakke18/platform-security-poc/backend/platform/event"
+	"github.com/kakke18/platform-security-poc/backend/platform/health"
+	"github.com/kakke18/platform-security-poc/backend/platform/metrics"
+	"github.com/kakke18/platform-security-poc/backend/platform/middleware"
+	"github.com/kakke18/platform-security-poc/backend/platform/principal"
+	"github.com/kakke18/platform-security-poc/backend/platform/requestid"
+	"github.com/kakke18/platform-security-poc/backend/platform/seed"
+	"github.com/kakke18/platform-security-poc/backend/platform/telemetry"
 )
 
 // Server はHTTPサーバーを表す
 type Server struct {
-	config     *config.Config
-	httpServer *http.Server
+	config      *config.Config
+	httpServer  *http.Server
+	adminServer *http.Server
+	clientIPs   *clientip.Resolver
+	publisher   event.Publisher
 }
 
 // New は新しいサーバーを作成する
 func New(cfg *config.Config) (*Server, error) {
+	// 信頼するプロキシを考慮してクライアントIPを解決する
+	clientIPs := clientip.NewResolver(cfg.TrustedProxies, cfg.ForwardedHeader)
+
+	// 変更イベントの通知先を初期化
+	var publisher event.Publisher = event.NopPublisher{}
+	if cfg.EventsURL != "" {
+		publisher = event.NewHTTPPublisher(cfg.EventsURL, cfg.EventsSecret)
+	}
+
+	// シードデータを読み込み、サービスを跨ぐ参照を検証する
+	data, err := seed.Load(cfg.SeedFile)
+	if err != nil {
+		return nil, err
+	}
+
 	// ユーザー機能を初期化
 	userRepo := user.NewMockRepository()
-	userHandler := user.NewHandler(userRepo)
+	userHandler := user.NewHandler(userRepo, publisher)
 
 	// Workspace機能を初期化
 	workspaceRepo := workspace.NewMockRepository()
 
 	// WorkspaceUser機能を初期化
 	workspaceUserRepo := workspaceuser.NewMockRepository()
-	workspaceUserHandler := workspaceuser.NewHandler(workspaceUserRepo, workspaceRepo)
+	workspaceUserHandler := workspaceuser.NewHandler(workspaceUserRepo, workspaceRepo, userRepo)
+
+	// リポジトリにシードデータを登録
+	ctx := context.Background()
+	if err := workspace.Seed(ctx, workspaceRepo, data); err != nil {
+		return nil, err
+	}
+	if err := user.Seed(ctx, userRepo, data); err != nil {
+		return nil, err
+	}
+	if err := workspaceuser.Seed(ctx, workspaceUserRepo, data); err != nil {
+		return nil, err
+	}
+	// 起動後の所属の変更は対象のユーザーを指定して通知する
+	workspaceUserRepo.SetPublisher(publisher)
+
+	// 依存先のチェックを登録
+	checker := health.NewChecker(identityv1connect.UserServiceName, identityv1connect.WorkspaceUserServiceName)
+	checker.Add("user_repository", userRepo.Ping)
+	checker.Add("workspace_repository", workspaceRepo.Ping)
+	checker.Add("workspace_user_repository", workspaceUserRepo.Ping)
+
+	// Gatewayで検証済みのヘッダーからPrincipalを復元するインターセプター
+	// リクエストのメッセージには圧縮の展開後のサイズで上限を適用する
+	interceptors := connect.WithHandlerOptions(
+		connect.WithReadMaxBytes(int(cfg.Server.MaxBodyBytes)),
+		connect.WithInterceptors(
+			telemetry.Interceptor(),
+			metrics.NewInterceptor(),
+			middleware.NewRecoverInterceptor(),
+			principal.NewInterceptor(principal.RequireSubject),
+		),
+	)
 
 	// マルチプレクサを作成
 	mux := http.NewServeMux()
 
 	// UserServiceを登録（Gatewayで認証済み）
-	userPath, userConnectHandler := identityv1connect.NewUserServiceHandler(userHandler)
+	userPath, userConnectHandler := identityv1connect.NewUserServiceHandler(userHandler, interceptors)
 	mux.Handle(userPath, userConnectHandler)
 
 	// WorkspaceUserServiceを登録（Gatewayで認証済み）
-	workspaceUserPath, workspaceUserConnectHandler := identityv1connect.NewWorkspaceUserServiceHandler(workspaceUserHandler)
+	workspaceUserPath, workspaceUserConnectHandler := identityv1connect.NewWorkspaceUserServiceHandler(workspaceUserHandler, interceptors)
 	mux.Handle(workspaceUserPath, workspaceUserConnectHandler)
 
-	// ヘルスチェックエンドポイント
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
+	// ライブネスとgRPCヘルスチェック（grpc.health.v1）はいずれも依存先を確認しない
+	// 依存先を含むレディネスは管理ポートの/readyzでのみ公開する
+	mux.Handle("/health", checker.LivenessHandler())
+	mux.Handle(checker.NewHandler())
 
-	// ハンドラーチェーンを構築: h2c -> AccessLog -> mux
+	// ハンドラーチェーンを構築: h2c -> Tracing -> ClientIP -> RequestID -> AccessLog -> Recover -> MaxBytes -> Timeout -> mux
 	// h2cハンドラーを最外層に配置することで、HTTP/2接続の確立を優先
-	finalHandler := h2c.NewHandler(middleware.AccessLog(mux), &http2.Server{})
+	handler := middleware.Chain(mux,
+		telemetry.Middleware("identity"),
+		clientIPs.Middleware,
+		requestid.Middleware,
+		middleware.AccessLog,
+		middleware.Recover,
+		middleware.MaxBytes(cfg.Server.MaxBodyBytes),
+		middleware.Timeout(cfg.RequestTimeout),
+	)
+	finalHandler := h2c.NewHandler(handler, cfg.Server.HTTP2Server())
 
-	httpServer := &http.Server{
-		Addr:    ":" + cfg.Port,
-		Handler: finalHandler,
-	}
+	// タイムアウトとヘッダーサイズの上限で低速なクライアントによる接続の占有を防ぐ
+	httpServer := cfg.Server.NewHTTPServer(":"+cfg.Port, finalHandler)
+
+	// 内部向け管理エンドポイント用のマルチプレクサを作成
+	adminMux := http.NewServeMux()
+
+	// ライブネスと、依存先ごとの詳細を含むレディネス
+	adminMux.Handle("/livez", checker.LivenessHandler())
+	adminMux.Handle("/readyz", checker.ReadinessHandler())
+
+	// Prometheusメトリクス
+	adminMux.Handle("/metrics", metrics.Handler())
+
+	adminServer := cfg.Server.NewHTTPServer(":"+cfg.AdminPort, adminMux)
 
 	return &Server{
-		config:     cfg,
-		httpServer: httpServer,
+		config:      cfg,
+		httpServer:  httpServer,
+		adminServer: adminServer,
+		clientIPs:   clientIPs,
+		publisher:   publisher,
 	}, nil
 }
 
-// Run はサーバーを起動する
+// Run はサーバーと管理サーバーを設定したポートで起動する
+// いずれかのサーバーが停止した時点でそのエラーを返す
 func (s *Server) Run() error {
-	return s.httpServer.ListenAndServe()
+	ln, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return err
+	}
+	adminLn, err := net.Listen("tcp", s.adminServer.Addr)
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	return s.Serve(ln, adminLn)
+}
+
+// Serve は待ち受け済みのlnで公開ポート、adminLnで管理ポートのサーバーを起動する
+// いずれかのサーバーが停止した時点でそのエラーを返す
+func (s *Server) Serve(ln, adminLn net.Listener) error {
+	// PROXYプロトコルが有効な場合は信頼するプロキシからの接続でヘッダーを解釈する
+	if s.config.ProxyProtocol {
+		ln = clientip.NewProxyListener(ln, s.clientIPs)
+	}
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- s.adminServer.Serve(adminLn)
+	}()
+	go func() {
+		errCh <- s.serveHTTP(ln)
+	}()
+	// 再起動前の所属を保持したGatewayのキャッシュを無効化し、起動時に読み込んだ所属を反映させる
+	go s.publishMembershipChanged()
+	return <-errCh
+}
+
+// publishMembershipChanged は対象を指定しない所属の変更イベントを通知する
+// 通知の失敗は起動に影響させない
+func (s *Server) publishMembershipChanged() {
+	ctx := context.Background()
+	if err := s.publisher.Publish(ctx, event.Event{Type: event.TypeMembershipChanged}); err != nil {
+		slog.WarnContext(ctx, "failed to publish membership changed event", slog.String("error", err.Error()))
+	}
+}
+
+// serveHTTP は公開ポートで待ち受ける
+func (s *Server) serveHTTP(ln net.Listener) error {
+	return s.httpServer.Serve(ln)
 }
 
-// Shutdown はサーバーをグレースフルシャットダウンする
+// Shutdown はサーバーと管理サーバーをグレースフルシャットダウンする
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.httpServer.Shutdown(ctx)
+	return errors.Join(
+		s.httpServer.Shutdown(ctx),
+		s.adminServer.Shutdown(ctx),
+	)
 }
@@ -2,20 +2,25 @@ package user
 
 import (
 	"context"
+	"log/slog"
 
 	"connectrpc.com/connect"
 	identityv1 "github.com/kakke18/platform-security-poc/backend/gen/identity/v1"
+	"github.com/kakke18/platform-security-poc/backend/platform/event"
+	"github.com/kakke18/platform-security-poc/backend/platform/principal"
 )
 
 // Handler はUserServiceの実装
 type Handler struct {
-	repo Repository
+	repo      Repository
+	publisher event.Publisher
 }
 
 // NewHandler は新しいユーザーハンドラーを作成する
-func NewHandler(repo Repository) *Handler {
+func NewHandler(repo Repository, publisher event.Publisher) *Handler {
 	return &Handler{
-		repo: repo,
+		repo:      repo,
+		publisher: publisher,
 	}
 }
 
@@ -24,11 +29,8 @@ func (h *Handler) GetMe(
 	ctx context.Context,
 	req *connect.Request[identityv1.GetMeRequest],
 ) (*connect.Response[identityv1.GetMeResponse], error) {
-	// ヘッダーからAuth0ユーザーIDを取得（Gatewayで検証済み）
-	userID := req.Header().Get("X-Auth0-User-ID")
-	if userID == "" {
-		return nil, connect.NewError(connect.CodeUnauthenticated, nil)
-	}
+	// インターセプターで検証済みのPrincipalからAuth0ユーザーIDを取得
+	userID := principal.MustFrom(ctx).Subject
 
 	// Auth0ユーザーIDでデータベースからユーザーを取得
 	user, err := h.repo.FindByAuth0UserID(ctx, userID)
@@ -48,11 +50,8 @@ func (h *Handler) UpdateMe(
 	ctx context.Context,
 	req *connect.Request[identityv1.UpdateMeRequest],
 ) (*connect.Response[identityv1.UpdateMeResponse], error) {
-	// ヘッダーからAuth0ユーザーIDを取得（Gatewayで検証済み）
-	userID := req.Header().Get("X-Auth0-User-ID")
-	if userID == "" {
-		return nil, connect.NewError(connect.CodeUnauthenticated, nil)
-	}
+	// インターセプターで検証済みのPrincipalからAuth0ユーザーIDを取得
+	userID := principal.MustFrom(ctx).Subject
 
 	// データベースから現在のユーザーを取得
 	user, err := h.repo.FindByAuth0UserID(ctx, userID)
@@ -70,6 +69,15 @@ func (h *Handler) UpdateMe(
 		return nil, connect.NewError(connect.CodeInternal, err)
 	}
 
+	// プロフィール変更を通知（Gatewayのキャッシュ無効化などに使用）
+	// 通知の失敗は更新結果に影響させない
+	if err := h.publisher.Publish(ctx, event.Event{
+		Type:    event.TypeProfileChanged,
+		Subject: user.Auth0UserID,
+	}); err != nil {
+		slog.WarnContext(ctx, "failed to publish profile changed event", slog.String("error", err.Error()))
+	}
+
 	return connect.NewResponse(&identityv1.UpdateMeResponse{
 		Auth0UserId: user.Auth0UserID,
 		Email:       user.Email,
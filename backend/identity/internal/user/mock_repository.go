@@ -2,39 +2,67 @@ package user
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"time"
 )
 
 // MockRepository はRepositoryのモック実装
-// テストと開発用に定数値を返す
-type MockRepository struct{}
+// データはシードデータ（Seed）から登録し、更新はメモリ上に保持する
+type MockRepository struct {
+	mu    sync.RWMutex
+	users map[string]*User
+}
 
 // NewMockRepository は新しいモックユーザーリポジトリを作成する
 func NewMockRepository() *MockRepository {
-	return &MockRepository{}
+	return &MockRepository{
+		users: make(map[string]*User),
+	}
 }
 
-// FindByAuth0UserID は定数値を持つモックユーザーを返す
+// FindByAuth0UserID はAuth0ユーザーIDでユーザーを取得する
+// 呼び出し元での変更がUpdateを経由せずに反映されないよう、コピーを返す
 func (r *MockRepository) FindByAuth0UserID(ctx context.Context, auth0UserID string) (*User, error) {
-	// モックデータを返す
-	now := time.Now()
-	return &User{
-		ID:              "llu_001",
-		Auth0UserID:     auth0UserID,
-		WorkspaceID:     "ws-001",
-		IsPrivileged:    false,
-		IdPConnectionID: nil,
-		Email:           "user01@example.com",
-		Name:            "User 01",
-		CreatedAt:       now,
-		UpdatedAt:       now,
-	}, nil
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[auth0UserID]
+	if !ok {
+		return nil, fmt.Errorf("user not found: %s", auth0UserID)
+	}
+	u := *user
+	return &u, nil
+}
+
+// Create はユーザーを登録する
+func (r *MockRepository) Create(ctx context.Context, user *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[user.Auth0UserID]; ok {
+		return fmt.Errorf("user already exists: %s", user.Auth0UserID)
+	}
+	u := *user
+	r.users[user.Auth0UserID] = &u
+	return nil
 }
 
-// Update はモック実装で何もしない
+// Update はユーザー情報を更新する
 func (r *MockRepository) Update(ctx context.Context, user *User) error {
-	// モック実装 - 実際のデータベース更新は行わない
-	// タイムスタンプのみ更新
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[user.Auth0UserID]; !ok {
+		return fmt.Errorf("user not found: %s", user.Auth0UserID)
+	}
 	user.UpdatedAt = time.Now()
+	u := *user
+	r.users[user.Auth0UserID] = &u
+	return nil
+}
+
+// Ping はモックのため常に成功する
+func (r *MockRepository) Ping(ctx context.Context) error {
 	return nil
 }
@@ -9,4 +9,7 @@ type Repository interface {
 
 	// Update はユーザー情報を更新する
 	Update(ctx context.Context, user *User) error
+
+	// Ping はデータストアに接続できるかを確認する（レディネスチェックで使用）
+	Ping(ctx context.Context) error
 }
@@ -0,0 +1,37 @@
+package user
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kakke18/platform-security-poc/backend/platform/seed"
+)
+
+// Seeder はシードデータを登録できるリポジトリ
+type Seeder interface {
+	// Create はユーザーを登録する
+	Create(ctx context.Context, user *User) error
+}
+
+// Seed はシードデータのユーザーをリポジトリに登録する
+func Seed(ctx context.Context, repo Seeder, data *seed.Data) error {
+	for _, u := range data.Users {
+		user := &User{
+			ID:           u.ID,
+			Auth0UserID:  u.Auth0UserID,
+			WorkspaceID:  u.WorkspaceID,
+			IsPrivileged: u.Privileged,
+			Email:        u.Email,
+			Name:         u.Name,
+			CreatedAt:    u.CreatedAt,
+			UpdatedAt:    u.CreatedAt,
+		}
+		if u.IdPConnectionID != "" {
+			user.IdPConnectionID = &u.IdPConnectionID
+		}
+		if err := repo.Create(ctx, user); err != nil {
+			return fmt.Errorf("failed to seed user %s: %w", u.ID, err)
+		}
+	}
+	return nil
+}
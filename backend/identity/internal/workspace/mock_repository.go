@@ -3,27 +3,18 @@ package workspace
 import (
 	"context"
 	"fmt"
-	"time"
 )
 
 // MockRepository はWorkspaceのモックリポジトリ
+// データはシードデータ（Seed）から登録する
 type MockRepository struct {
 	workspaces map[string]*Workspace
 }
 
 // NewMockRepository は新しいモックリポジトリを作成する
 func NewMockRepository() *MockRepository {
-	// モックデータを初期化
-	workspaces := map[string]*Workspace{
-		"ws-001": {
-			ID:        "ws-001",
-			Name:      "My Workspace",
-			CreatedAt: time.Now().Add(-30 * 24 * time.Hour), // 30日前
-		},
-	}
-
 	return &MockRepository{
-		workspaces: workspaces,
+		workspaces: make(map[string]*Workspace),
 	}
 }
 
@@ -35,3 +26,17 @@ func (r *MockRepository) FindByID(ctx context.Context, id string) (*Workspace, e
 	}
 	return workspace, nil
 }
+
+// Create はWorkspaceを登録する
+func (r *MockRepository) Create(ctx context.Context, workspace *Workspace) error {
+	if _, ok := r.workspaces[workspace.ID]; ok {
+		return fmt.Errorf("workspace already exists: %s", workspace.ID)
+	}
+	r.workspaces[workspace.ID] = workspace
+	return nil
+}
+
+// Ping はモックのため常に成功する
+func (r *MockRepository) Ping(ctx context.Context) error {
+	return nil
+}
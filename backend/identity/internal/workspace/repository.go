@@ -6,4 +6,7 @@ import "context"
 type Repository interface {
 	// FindByID はIDでWorkspaceを取得する
 	FindByID(ctx context.Context, id string) (*Workspace, error)
+
+	// Ping はデータストアに接続できるかを確認する（レディネスチェックで使用）
+	Ping(ctx context.Context) error
 }
@@ -0,0 +1,28 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kakke18/platform-security-poc/backend/platform/seed"
+)
+
+// Seeder はシードデータを登録できるリポジトリ
+type Seeder interface {
+	// Create はWorkspaceを登録する
+	Create(ctx context.Context, workspace *Workspace) error
+}
+
+// Seed はシードデータのワークスペースをリポジトリに登録する
+func Seed(ctx context.Context, repo Seeder, data *seed.Data) error {
+	for _, w := range data.Workspaces {
+		if err := repo.Create(ctx, &Workspace{
+			ID:        w.ID,
+			Name:      w.Name,
+			CreatedAt: w.CreatedAt,
+		}); err != nil {
+			return fmt.Errorf("failed to seed workspace %s: %w", w.ID, err)
+		}
+	}
+	return nil
+}
@@ -5,20 +5,24 @@ import (
 
 	"connectrpc.com/connect"
 	identityv1 "github.com/kakke18/platform-security-poc/backend/gen/identity/v1"
+	"github.com/kakke18/platform-security-poc/backend/identity/internal/user"
 	"github.com/kakke18/platform-security-poc/backend/identity/internal/workspace"
+	"github.com/kakke18/platform-security-poc/backend/platform/principal"
 )
 
 // Handler はWorkspaceUserServiceの実装
 type Handler struct {
 	workspaceUserRepo Repository
 	workspaceRepo     workspace.Repository
+	userRepo          user.Repository
 }
 
 // NewHandler は新しいWorkspaceUserハンドラーを作成する
-func NewHandler(workspaceUserRepo Repository, workspaceRepo workspace.Repository) *Handler {
+func NewHandler(workspaceUserRepo Repository, workspaceRepo workspace.Repository, userRepo user.Repository) *Handler {
 	return &Handler{
 		workspaceUserRepo: workspaceUserRepo,
 		workspaceRepo:     workspaceRepo,
+		userRepo:          userRepo,
 	}
 }
 
@@ -27,11 +31,8 @@ func (h *Handler) GetWorkspaceUser(
 	ctx context.Context,
 	req *connect.Request[identityv1.GetWorkspaceUserRequest],
 ) (*connect.Response[identityv1.GetWorkspaceUserResponse], error) {
-	// ヘッダーからAuth0ユーザーIDを取得（Gatewayで検証済み）
-	auth0UserID := req.Header().Get("X-Auth0-User-ID")
-	if auth0UserID == "" {
-		return nil, connect.NewError(connect.CodeUnauthenticated, nil)
-	}
+	// インターセプターで検証済みのPrincipalからAuth0ユーザーIDを取得
+	auth0UserID := principal.MustFrom(ctx).Subject
 
 	// Auth0ユーザーIDでWorkspaceUserを取得
 	workspaceUser, err := h.workspaceUserRepo.FindByAuth0UserID(ctx, auth0UserID)
@@ -45,11 +46,18 @@ func (h *Handler) GetWorkspaceUser(
 		return nil, connect.NewError(connect.CodeInternal, err)
 	}
 
+	// 特権ユーザーかどうかはユーザー情報から取得する（GatewayがPrincipalに設定して下流サービスに伝える）
+	u, err := h.userRepo.FindByAuth0UserID(ctx, auth0UserID)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
 	return connect.NewResponse(&identityv1.GetWorkspaceUserResponse{
 		WorkspaceId:     workspace.ID,
 		WorkspaceUserId: workspaceUser.ID,
 		Email:           workspaceUser.Email,
 		Name:            workspaceUser.Name,
+		Privileged:      u.IsPrivileged,
 	}), nil
 }
 
@@ -58,11 +66,8 @@ func (h *Handler) ListWorkspaceUsers(
 	ctx context.Context,
 	req *connect.Request[identityv1.ListWorkspaceUsersRequest],
 ) (*connect.Response[identityv1.ListWorkspaceUsersResponse], error) {
-	// ヘッダーからAuth0ユーザーIDを取得（Gatewayで検証済み）
-	auth0UserID := req.Header().Get("X-Auth0-User-ID")
-	if auth0UserID == "" {
-		return nil, connect.NewError(connect.CodeUnauthenticated, nil)
-	}
+	// インターセプターで検証済みのPrincipalからAuth0ユーザーIDを取得
+	auth0UserID := principal.MustFrom(ctx).Subject
 
 	// 現在のユーザーのWorkspaceUserを取得してWorkspaceIDを取得
 	workspaceUser, err := h.workspaceUserRepo.FindByAuth0UserID(ctx, auth0UserID)
@@ -3,49 +3,33 @@ package workspaceuser
 import (
 	"context"
 	"fmt"
-	"time"
+	"log/slog"
+
+	"github.com/kakke18/platform-security-poc/backend/platform/event"
 )
 
 // MockRepository はWorkspaceUserのモックリポジトリ
+// データはシードデータ（Seed）から登録する
 type MockRepository struct {
 	users map[string]*WorkspaceUser
+
+	// publisher は所属の変更を通知する先（SetPublisherの呼び出し前の登録は通知しない）
+	publisher event.Publisher
 }
 
 // NewMockRepository は新しいモックリポジトリを作成する
 func NewMockRepository() *MockRepository {
-	// モックデータを初期化
-	users := map[string]*WorkspaceUser{
-		"auth0|6952b421821fed371daac9df": {
-			ID:          "wsu-001",
-			WorkspaceID: "ws-001",
-			Auth0UserID: "auth0|6952b421821fed371daac9df",
-			Email:       "user01@example.com",
-			Name:        "User 01",
-			CreatedAt:   time.Now().Add(-10 * 24 * time.Hour), // 10日前
-		},
-		"auth0|user002": {
-			ID:          "wsu-002",
-			WorkspaceID: "ws-001",
-			Auth0UserID: "auth0|user002",
-			Email:       "user02@example.com",
-			Name:        "User 02",
-			CreatedAt:   time.Now().Add(-9 * 24 * time.Hour), // 9日前
-		},
-		"auth0|user003": {
-			ID:          "wsu-003",
-			WorkspaceID: "ws-001",
-			Auth0UserID: "auth0|user003",
-			Email:       "user03@example.com",
-			Name:        "User 03",
-			CreatedAt:   time.Now().Add(-8 * 24 * time.Hour), // 8日前
-		},
-	}
-
 	return &MockRepository{
-		users: users,
+		users: make(map[string]*WorkspaceUser),
 	}
 }
 
+// SetPublisher は登録時に所属の変更イベントを通知する先を設定する
+// シードデータの登録後に設定し、起動時の所属は対象を指定しないイベントで通知する
+func (r *MockRepository) SetPublisher(publisher event.Publisher) {
+	r.publisher = publisher
+}
+
 // FindByAuth0UserID はAuth0ユーザーIDでWorkspaceUserを取得する
 func (r *MockRepository) FindByAuth0UserID(ctx context.Context, auth0UserID string) (*WorkspaceUser, error) {
 	user, ok := r.users[auth0UserID]
@@ -102,3 +86,29 @@ func (r *MockRepository) ListByWorkspaceID(ctx context.Context, workspaceID stri
 
 	return result, nextPageToken, nil
 }
+
+// Create はWorkspaceUserを登録する
+func (r *MockRepository) Create(ctx context.Context, user *WorkspaceUser) error {
+	if _, ok := r.users[user.Auth0UserID]; ok {
+		return fmt.Errorf("workspace user already exists: %s", user.Auth0UserID)
+	}
+	r.users[user.Auth0UserID] = user
+
+	// 所属の変更を通知（GatewayのGetMeキャッシュの無効化に使用）
+	// 通知の失敗は登録結果に影響させない
+	if r.publisher != nil {
+		if err := r.publisher.Publish(ctx, event.Event{
+			Type:            event.TypeMembershipChanged,
+			Subject:         user.Auth0UserID,
+			WorkspaceUserID: user.ID,
+		}); err != nil {
+			slog.WarnContext(ctx, "failed to publish membership changed event", slog.String("error", err.Error()))
+		}
+	}
+	return nil
+}
+
+// Ping はモックのため常に成功する
+func (r *MockRepository) Ping(ctx context.Context) error {
+	return nil
+}
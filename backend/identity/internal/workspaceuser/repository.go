@@ -9,4 +9,7 @@ type Repository interface {
 
 	// ListByWorkspaceID はワークスペースIDでWorkspaceUserの一覧を取得する
 	ListByWorkspaceID(ctx context.Context, workspaceID string, pageSize int32, pageToken string) ([]*WorkspaceUser, string, error)
+
+	// Ping はデータストアに接続できるかを確認する（レディネスチェックで使用）
+	Ping(ctx context.Context) error
 }
@@ -0,0 +1,31 @@
+package workspaceuser
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kakke18/platform-security-poc/backend/platform/seed"
+)
+
+// Seeder はシードデータを登録できるリポジトリ
+type Seeder interface {
+	// Create はWorkspaceUserを登録する
+	Create(ctx context.Context, user *WorkspaceUser) error
+}
+
+// Seed はシードデータのユーザーをワークスペースユーザーとしてリポジトリに登録する
+func Seed(ctx context.Context, repo Seeder, data *seed.Data) error {
+	for _, u := range data.Users {
+		if err := repo.Create(ctx, &WorkspaceUser{
+			ID:          u.WorkspaceUserID,
+			WorkspaceID: u.WorkspaceID,
+			Auth0UserID: u.Auth0UserID,
+			Email:       u.Email,
+			Name:        u.Name,
+			CreatedAt:   u.CreatedAt,
+		}); err != nil {
+			return fmt.Errorf("failed to seed workspace user %s: %w", u.WorkspaceUserID, err)
+		}
+	}
+	return nil
+}
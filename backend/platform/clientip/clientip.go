@@ -0,0 +1,240 @@
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const (
+	// HeaderXForwardedFor はプロキシが経由したクライアントのアドレスを追記するヘッダー
+	HeaderXForwardedFor = "X-Forwarded-For"
+
+	// HeaderForwarded はRFC 7239のForwardedヘッダー
+	HeaderForwarded = "Forwarded"
+)
+
+// ParsePrefixes はカンマ区切りのCIDR（単一のIPアドレスも可）をパースする
+func ParsePrefixes(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", v, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", v, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Prefixes は信頼するプロキシのアドレス範囲の一覧
+// 設定ファイルや環境変数ではカンマ区切りのCIDR（単一のIPアドレスも可）で指定する
+type Prefixes []netip.Prefix
+
+// UnmarshalText はカンマ区切りのCIDRをパースする
+func (p *Prefixes) UnmarshalText(b []byte) error {
+	prefixes, err := ParsePrefixes(string(b))
+	if err != nil {
+		return err
+	}
+	*p = prefixes
+	return nil
+}
+
+// Header は信頼するプロキシがクライアントのアドレスを付与する転送ヘッダー
+// プロキシが付与しない方のヘッダーはクライアントが自由に設定できるため、どちらか一方のみを読む
+type Header string
+
+const (
+	// XForwardedFor はX-Forwarded-Forを読む
+	XForwardedFor Header = "x-forwarded-for"
+
+	// Forwarded はRFC 7239のForwardedを読む
+	Forwarded Header = "forwarded"
+)
+
+// Validate は転送ヘッダーの指定を検証する
+func (h Header) Validate() error {
+	switch h {
+	case XForwardedFor, Forwarded:
+		return nil
+	}
+	return fmt.Errorf("must be %q or %q: %q", XForwardedFor, Forwarded, string(h))
+}
+
+// UnmarshalText は転送ヘッダーの指定を大文字・小文字を区別せずにパースする
+func (h *Header) UnmarshalText(b []byte) error {
+	v := Header(strings.ToLower(strings.TrimSpace(string(b))))
+	if err := v.Validate(); err != nil {
+		return err
+	}
+	*h = v
+	return nil
+}
+
+// Resolver は信頼するプロキシのアドレス範囲に基づいてクライアントのIPアドレスを解決する
+// 設定は不変で、設定を差し替える場合は新しいResolverを作成する
+type Resolver struct {
+	trusted []netip.Prefix
+	header  Header
+}
+
+// NewResolver は新しいResolverを作成する
+// trustedが空の場合は転送ヘッダーを一切信頼せず、接続元のアドレスをクライアントIPとする
+func NewResolver(trusted []netip.Prefix, header Header) *Resolver {
+	return &Resolver{
+		trusted: trusted,
+		header:  header,
+	}
+}
+
+// Trusted はaddrが信頼するプロキシのアドレスかを返す
+func (r *Resolver) Trusted(addr netip.Addr) bool {
+	return Contains(r.trusted, addr)
+}
+
+// Contains はaddrがprefixesのいずれかに含まれるかを返す（IPv4射影アドレスはIPv4として扱う）
+func Contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve はリクエストのクライアントIPアドレスを解決する
+// 接続元が信頼するプロキシの場合のみ設定した転送ヘッダーを右から順にたどり、
+// 信頼するプロキシではない最初のアドレスをクライアントとする
+// 左側の値と設定していない方のヘッダーはクライアントが自由に設定できるため使用しない
+func (r *Resolver) Resolve(req *http.Request) netip.Addr {
+	remote := parseHostPort(req.RemoteAddr)
+	if !remote.IsValid() || !r.Trusted(remote) {
+		return remote
+	}
+
+	var hops []string
+	switch r.header {
+	case Forwarded:
+		hops = forwardedFor(req.Header)
+	default:
+		hops = xForwardedFor(req.Header)
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr := parseHost(hops[i])
+		if !addr.IsValid() {
+			// 信頼するプロキシが付与した値が不正な場合、それより左の値は検証できない
+			break
+		}
+		client = addr
+		if !r.Trusted(addr) {
+			break
+		}
+	}
+	return client
+}
+
+// Middleware はクライアントIPアドレスを解決してcontextに格納するミドルウェア
+func (r *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if addr := r.Resolve(req); addr.IsValid() {
+			req = req.WithContext(NewContext(req.Context(), addr))
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+type contextKey struct{}
+
+// NewContext はクライアントIPアドレスを保持したcontext.Contextを返す
+func NewContext(ctx context.Context, addr netip.Addr) context.Context {
+	return context.WithValue(ctx, contextKey{}, addr)
+}
+
+// FromContext はcontext.ContextからクライアントIPアドレスを取得する
+func FromContext(ctx context.Context) (netip.Addr, bool) {
+	addr, ok := ctx.Value(contextKey{}).(netip.Addr)
+	return addr, ok && addr.IsValid()
+}
+
+// String はcontextのクライアントIPアドレスを文字列で返す（解決されていない場合は空文字列）
+func String(ctx context.Context) string {
+	if addr, ok := FromContext(ctx); ok {
+		return addr.String()
+	}
+	return ""
+}
+
+// xForwardedFor はX-Forwarded-Forの全ての値を経由順に返す
+func xForwardedFor(h http.Header) []string {
+	var hops []string
+	for _, v := range h.Values(HeaderXForwardedFor) {
+		for _, hop := range strings.Split(v, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// forwardedFor はForwardedヘッダーのfor=パラメーターを経由順に返す
+func forwardedFor(h http.Header) []string {
+	var hops []string
+	for _, v := range h.Values(HeaderForwarded) {
+		for _, elem := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(elem, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(key, "for") {
+					continue
+				}
+				hops = append(hops, strings.Trim(value, `"`))
+			}
+		}
+	}
+	return hops
+}
+
+// parseHost はIPアドレス、ポート付きのアドレス、Forwardedの"[IPv6]:port"形式をパースする
+func parseHost(s string) netip.Addr {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Unmap()
+	}
+	if addr := parseHostPort(s); addr.IsValid() {
+		return addr
+	}
+	// Forwardedの"[IPv6]"形式（ポートなし）
+	if addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")); err == nil {
+		return addr.Unmap()
+	}
+	return netip.Addr{}
+}
+
+// parseHostPort は"host:port"形式のアドレスからIPアドレスを取り出す
+func parseHostPort(s string) netip.Addr {
+	host, _, err := net.SplitHostPort(s)
+	if err != nil {
+		return netip.Addr{}
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
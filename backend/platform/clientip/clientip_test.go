@@ -0,0 +1,139 @@
+package clientip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8:ffff::/48"),
+	}
+	tests := []struct {
+		name   string
+		header Header
+		remote string
+		xff    []string
+		fwd    []string
+		want   string
+	}{
+		{name: "untrusted peer without headers", header: XForwardedFor, remote: "192.0.2.1:1234", want: "192.0.2.1"},
+		{name: "untrusted peer with x-forwarded-for is ignored", header: XForwardedFor, remote: "192.0.2.1:1234", xff: []string{"198.51.100.7"}, want: "192.0.2.1"},
+		{name: "trusted peer without headers", header: XForwardedFor, remote: "10.0.0.1:1234", want: "10.0.0.1"},
+		{name: "rightmost untrusted hop", header: XForwardedFor, remote: "10.0.0.1:1234", xff: []string{"198.51.100.7, 10.0.0.2"}, want: "198.51.100.7"},
+		{name: "spoofed leftmost entries are skipped", header: XForwardedFor, remote: "10.0.0.1:1234", xff: []string{"203.0.113.66, 198.51.100.7"}, want: "198.51.100.7"},
+		{name: "multiple header lines are joined in order", header: XForwardedFor, remote: "10.0.0.1:1234", xff: []string{"203.0.113.66", "198.51.100.7, 10.0.0.2"}, want: "198.51.100.7"},
+		{name: "all trusted chain falls back to the leftmost hop", header: XForwardedFor, remote: "10.0.0.1:1234", xff: []string{"10.0.0.3, 10.0.0.2"}, want: "10.0.0.3"},
+		{name: "invalid hop stops the walk", header: XForwardedFor, remote: "10.0.0.1:1234", xff: []string{"198.51.100.7, garbage, 10.0.0.2"}, want: "10.0.0.2"},
+		{name: "ipv4-mapped hop is unmapped", header: XForwardedFor, remote: "10.0.0.1:1234", xff: []string{"::ffff:198.51.100.7"}, want: "198.51.100.7"},
+		{name: "ipv6 peer and hop", header: XForwardedFor, remote: "[2001:db8:ffff::1]:1234", xff: []string{"2001:db8::7"}, want: "2001:db8::7"},
+		{name: "forwarded is ignored when x-forwarded-for is configured", header: XForwardedFor, remote: "10.0.0.1:1234", fwd: []string{"for=198.51.100.7"}, want: "10.0.0.1"},
+		{name: "x-forwarded-for is ignored when forwarded is configured", header: Forwarded, remote: "10.0.0.1:1234", xff: []string{"198.51.100.7"}, want: "10.0.0.1"},
+		{name: "forwarded token", header: Forwarded, remote: "10.0.0.1:1234", fwd: []string{"for=198.51.100.7;proto=https"}, want: "198.51.100.7"},
+		{name: "forwarded quoted with port", header: Forwarded, remote: "10.0.0.1:1234", fwd: []string{`for="198.51.100.7:4711"`}, want: "198.51.100.7"},
+		{name: "forwarded quoted ipv6 with port", header: Forwarded, remote: "10.0.0.1:1234", fwd: []string{`for="[2001:db8::7]:4711"`}, want: "2001:db8::7"},
+		{name: "forwarded quoted ipv6 without port", header: Forwarded, remote: "10.0.0.1:1234", fwd: []string{`For="[2001:db8::7]"`}, want: "2001:db8::7"},
+		{name: "forwarded spoofed leftmost element", header: Forwarded, remote: "10.0.0.1:1234", fwd: []string{"for=203.0.113.66, for=198.51.100.7;by=10.0.0.1, for=10.0.0.2"}, want: "198.51.100.7"},
+		{name: "forwarded obfuscated identifier stops the walk", header: Forwarded, remote: "10.0.0.1:1234", fwd: []string{"for=198.51.100.7, for=_hidden"}, want: "10.0.0.1"},
+		{name: "invalid remote address", header: XForwardedFor, remote: "pipe", xff: []string{"198.51.100.7"}, want: "invalid IP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				req.Header.Add(HeaderXForwardedFor, v)
+			}
+			for _, v := range tt.fwd {
+				req.Header.Add(HeaderForwarded, v)
+			}
+
+			if got := NewResolver(trusted, tt.header).Resolve(req); got.String() != tt.want {
+				t.Errorf("Resolve() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	r := NewResolver([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, XForwardedFor)
+	var got string
+	handler := r.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = String(req.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set(HeaderXForwardedFor, "198.51.100.7")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "198.51.100.7" {
+		t.Errorf("client ip in context = %q, want %q", got, "198.51.100.7")
+	}
+
+	req.RemoteAddr = "pipe"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "" {
+		t.Errorf("client ip in context = %q for an unresolved address, want empty", got)
+	}
+	if _, ok := FromContext(context.Background()); ok {
+		t.Error("FromContext(empty context) ok = true")
+	}
+}
+
+func TestContains(t *testing.T) {
+	prefixes := []netip.Prefix{
+		netip.MustParsePrefix("192.0.2.0/24"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "192.0.2.10", want: true},
+		{addr: "::ffff:192.0.2.10", want: true},
+		{addr: "198.51.100.1", want: false},
+		{addr: "2001:db8::1", want: true},
+		{addr: "2001:db9::1", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := Contains(prefixes, netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("Contains(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{input: "", want: nil},
+		{input: "10.0.0.0/8, 192.0.2.1", want: []string{"10.0.0.0/8", "192.0.2.1/32"}},
+		{input: "10.1.2.3/8,2001:db8::1", want: []string{"10.0.0.0/8", "2001:db8::1/128"}},
+		{input: "10.0.0.0/33", wantErr: true},
+		{input: "proxy.internal", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParsePrefixes(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParsePrefixes() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].String() != tt.want[i] {
+					t.Errorf("prefix %d = %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package clientip
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// proxyHeaderTimeout はPROXYプロトコルのヘッダーを受信するまでの待ち時間
+	proxyHeaderTimeout = 5 * time.Second
+
+	// maxV1HeaderLength はPROXYプロトコルv1のヘッダーの最大長（CRLFを含む）
+	maxV1HeaderLength = 107
+)
+
+// v2Signature はPROXYプロトコルv2のヘッダーの先頭12バイト
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ErrInvalidProxyHeader はPROXYプロトコルのヘッダーが不正であることを表す
+var ErrInvalidProxyHeader = errors.New("invalid PROXY protocol header")
+
+// TrustChecker は接続元のアドレスが信頼するプロキシかを判定する
+// Resolverのほか、設定の再読み込みで差し替えるResolverを参照する実装を渡せる
+type TrustChecker interface {
+	Trusted(addr netip.Addr) bool
+}
+
+// ProxyListener はPROXYプロトコル（v1・v2）のヘッダーから元のクライアントアドレスを取得するnet.Listener
+// ヘッダーは信頼するプロキシからの接続でのみ解釈し、それ以外の接続はそのまま扱う
+type ProxyListener struct {
+	net.Listener
+	resolver TrustChecker
+}
+
+// NewProxyListener は新しいProxyListenerを作成する
+func NewProxyListener(ln net.Listener, resolver TrustChecker) *ProxyListener {
+	return &ProxyListener{
+		Listener: ln,
+		resolver: resolver,
+	}
+}
+
+// Accept は接続を受け付ける
+// ヘッダーの読み取りは接続ごとのゴルーチンで最初にアドレスまたはデータを参照した時点で行う
+func (l *ProxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	remote := parseHostPort(conn.RemoteAddr().String())
+	if !remote.IsValid() || !l.resolver.Trusted(remote) {
+		return conn, nil
+	}
+	return &proxyConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// proxyConn はPROXYプロトコルのヘッダーを読み取ってアドレスを置き換えるnet.Conn
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+
+	once       sync.Once
+	err        error
+	remoteAddr net.Addr
+	localAddr  net.Addr
+}
+
+// Read はヘッダーを読み取った後のデータを返す
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr はヘッダーで通知された元のクライアントアドレスを返す
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr はヘッダーで通知された元の宛先アドレスを返す
+func (c *proxyConn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// readHeader はPROXYプロトコルのヘッダーを読み取る
+// 信頼するプロキシからの接続でヘッダーが不正な場合は接続を使用できないようにする
+func (c *proxyConn) readHeader() {
+	_ = c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+	defer func() { _ = c.Conn.SetReadDeadline(time.Time{}) }()
+
+	c.remoteAddr, c.localAddr, c.err = readProxyHeader(c.reader)
+	if c.err != nil {
+		_ = c.Conn.Close()
+	}
+}
+
+// readProxyHeader は先頭のシグネチャでv1とv2を判別してヘッダーを読み取る
+// 元のアドレスがない接続（v1のUNKNOWN、v2のLOCALなど）ではアドレスはnilになる
+func readProxyHeader(r *bufio.Reader) (remote, local net.Addr, err error) {
+	sig, err := r.Peek(len(v2Signature))
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, nil, err
+	}
+
+	switch {
+	case bytes.Equal(sig, v2Signature):
+		return readV2(r)
+	case bytes.HasPrefix(sig, []byte("PROXY ")):
+		return readV1(r)
+	}
+	return nil, nil, fmt.Errorf("%w: missing header", ErrInvalidProxyHeader)
+}
+
+// readV1 はテキスト形式のPROXYプロトコルv1のヘッダーを読み取る
+// 例: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"
+func readV1(r *bufio.Reader) (remote, local net.Addr, err error) {
+	var line []byte
+	for len(line) < maxV1HeaderLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, fmt.Errorf("%w: v1 header too long", ErrInvalidProxyHeader)
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		// プロキシ自身のヘルスチェックなど、元のアドレスがない接続
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, fmt.Errorf("%w: malformed v1 header", ErrInvalidProxyHeader)
+	}
+
+	src, err := netip.ParseAddr(fields[2])
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid source address", ErrInvalidProxyHeader)
+	}
+	dst, err := netip.ParseAddr(fields[3])
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid destination address", ErrInvalidProxyHeader)
+	}
+	if src.Is4() != (fields[1] == "TCP4") || dst.Is4() != (fields[1] == "TCP4") {
+		return nil, nil, fmt.Errorf("%w: address family mismatch", ErrInvalidProxyHeader)
+	}
+	srcPort, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid source port", ErrInvalidProxyHeader)
+	}
+	dstPort, err := strconv.ParseUint(fields[5], 10, 16)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid destination port", ErrInvalidProxyHeader)
+	}
+
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(src, uint16(srcPort))),
+		net.TCPAddrFromAddrPort(netip.AddrPortFrom(dst, uint16(dstPort))),
+		nil
+}
+
+// readV2 はバイナリ形式のPROXYプロトコルv2のヘッダーを読み取る
+func readV2(r *bufio.Reader) (remote, local net.Addr, err error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+
+	version, command := header[12]>>4, header[12]&0x0f
+	if version != 2 {
+		return nil, nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidProxyHeader, version)
+	}
+	family := header[13]
+	length := binary.BigEndian.Uint16(header[14:16])
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, err
+	}
+
+	switch command {
+	case 0x0:
+		// LOCAL: プロキシ自身の接続のため元のアドレスはない
+		return nil, nil, nil
+	case 0x1:
+	default:
+		return nil, nil, fmt.Errorf("%w: unsupported command %d", ErrInvalidProxyHeader, command)
+	}
+
+	// 上位4ビットはアドレスファミリー、下位4ビットはトランスポート（1: STREAM）
+	var addrLen int
+	switch family {
+	case 0x11:
+		addrLen = 4
+	case 0x21:
+		addrLen = 16
+	default:
+		// UNIXソケットなどは元のアドレスとして扱わない（TLVは読み飛ばし済み）
+		return nil, nil, nil
+	}
+	if len(payload) < 2*addrLen+4 {
+		return nil, nil, fmt.Errorf("%w: address block too short", ErrInvalidProxyHeader)
+	}
+
+	src, _ := netip.AddrFromSlice(payload[:addrLen])
+	dst, _ := netip.AddrFromSlice(payload[addrLen : 2*addrLen])
+	srcPort := binary.BigEndian.Uint16(payload[2*addrLen:])
+	dstPort := binary.BigEndian.Uint16(payload[2*addrLen+2:])
+
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(src, srcPort)),
+		net.TCPAddrFromAddrPort(netip.AddrPortFrom(dst, dstPort)),
+		nil
+}
@@ -0,0 +1,215 @@
+package clientip
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+// v2Header はPROXYプロトコルv2のヘッダーを組み立てる
+func v2Header(versionCommand, family byte, payload []byte) []byte {
+	b := append([]byte{}, v2Signature...)
+	b = append(b, versionCommand, family)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(payload)))
+	return append(b, payload...)
+}
+
+// v2Addresses はPROXYプロトコルv2のアドレスブロックを組み立てる
+func v2Addresses(src, dst string, srcPort, dstPort uint16) []byte {
+	b := append(netip.MustParseAddr(src).AsSlice(), netip.MustParseAddr(dst).AsSlice()...)
+	b = binary.BigEndian.AppendUint16(b, srcPort)
+	return binary.BigEndian.AppendUint16(b, dstPort)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	tcp4 := v2Addresses("192.0.2.1", "198.51.100.1", 56324, 443)
+	tcp6 := v2Addresses("2001:db8::1", "2001:db8::2", 56324, 443)
+	tests := []struct {
+		name       string
+		input      []byte
+		wantRemote string
+		wantLocal  string
+		wantErr    bool
+	}{
+		{name: "v1 tcp4", input: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"), wantRemote: "192.0.2.1:56324", wantLocal: "198.51.100.1:443"},
+		{name: "v1 tcp6", input: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"), wantRemote: "[2001:db8::1]:56324", wantLocal: "[2001:db8::2]:443"},
+		{name: "v1 unknown", input: []byte("PROXY UNKNOWN\r\n")},
+		{name: "v1 unknown with addresses", input: []byte("PROXY UNKNOWN ffff:f...f:ffff ffff:f...f:ffff 65535 65535\r\n")},
+		{name: "v1 without crlf", input: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\n"), wantErr: true},
+		{name: "v1 truncated", input: []byte("PROXY TCP4 192.0.2.1 198.51"), wantErr: true},
+		{name: "v1 too long", input: []byte("PROXY TCP4 " + strings.Repeat("1", maxV1HeaderLength) + "\r\n"), wantErr: true},
+		{name: "v1 missing fields", input: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324\r\n"), wantErr: true},
+		{name: "v1 unknown protocol", input: []byte("PROXY UDP4 192.0.2.1 198.51.100.1 56324 443\r\n"), wantErr: true},
+		{name: "v1 invalid source", input: []byte("PROXY TCP4 192.0.2.256 198.51.100.1 56324 443\r\n"), wantErr: true},
+		{name: "v1 invalid destination", input: []byte("PROXY TCP4 192.0.2.1 example.com 56324 443\r\n"), wantErr: true},
+		{name: "v1 port out of range", input: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 65536 443\r\n"), wantErr: true},
+		{name: "v1 negative port", input: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 -1\r\n"), wantErr: true},
+		{name: "v1 tcp4 with ipv6 address", input: []byte("PROXY TCP4 2001:db8::1 198.51.100.1 56324 443\r\n"), wantErr: true},
+		{name: "v1 tcp6 with ipv4 address", input: []byte("PROXY TCP6 2001:db8::1 198.51.100.1 56324 443\r\n"), wantErr: true},
+		{name: "v2 tcp4", input: v2Header(0x21, 0x11, tcp4), wantRemote: "192.0.2.1:56324", wantLocal: "198.51.100.1:443"},
+		{name: "v2 tcp6", input: v2Header(0x21, 0x21, tcp6), wantRemote: "[2001:db8::1]:56324", wantLocal: "[2001:db8::2]:443"},
+		{name: "v2 tcp4 with tlvs", input: v2Header(0x21, 0x11, append(append([]byte{}, tcp4...), 0x04, 0x00, 0x01, 0x00)), wantRemote: "192.0.2.1:56324", wantLocal: "198.51.100.1:443"},
+		{name: "v2 local", input: v2Header(0x20, 0x11, tcp4)},
+		{name: "v2 local without addresses", input: v2Header(0x20, 0x00, nil)},
+		{name: "v2 unspec", input: v2Header(0x21, 0x00, nil)},
+		{name: "v2 unix", input: v2Header(0x21, 0x31, make([]byte, 216))},
+		{name: "v2 unsupported version", input: v2Header(0x11, 0x11, tcp4), wantErr: true},
+		{name: "v2 unsupported command", input: v2Header(0x22, 0x11, tcp4), wantErr: true},
+		{name: "v2 address block too short", input: v2Header(0x21, 0x21, tcp4), wantErr: true},
+		{name: "v2 truncated payload", input: v2Header(0x21, 0x11, tcp4)[:20], wantErr: true},
+		{name: "v2 truncated header", input: v2Header(0x21, 0x11, tcp4)[:14], wantErr: true},
+		{name: "missing header", input: []byte("GET / HTTP/1.1\r\n\r\n"), wantErr: true},
+		{name: "empty", input: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote, local, err := readProxyHeader(bufio.NewReader(bytes.NewReader(tt.input)))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("readProxyHeader() = %v, %v, want error", remote, local)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readProxyHeader() error = %v", err)
+			}
+			if got := addrString(remote); got != tt.wantRemote {
+				t.Errorf("remote = %q, want %q", got, tt.wantRemote)
+			}
+			if got := addrString(local); got != tt.wantLocal {
+				t.Errorf("local = %q, want %q", got, tt.wantLocal)
+			}
+		})
+	}
+}
+
+// addrString はアドレスを文字列で返す（nilの場合は空文字列）
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+func TestProxyListener(t *testing.T) {
+	tests := []struct {
+		name       string
+		trusted    []netip.Prefix
+		input      string
+		wantRemote string
+		wantData   string
+		wantErr    error
+	}{
+		{
+			name:       "header from a trusted proxy",
+			trusted:    []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+			input:      "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nhello",
+			wantRemote: "192.0.2.1:56324",
+			wantData:   "hello",
+		},
+		{
+			name:     "header from an untrusted peer is not interpreted",
+			input:    "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n",
+			wantData: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n",
+		},
+		{
+			name:    "missing header from a trusted proxy",
+			trusted: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+			input:   "hello",
+			wantErr: ErrInvalidProxyHeader,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ln := NewProxyListener(inner, NewResolver(tt.trusted, XForwardedFor))
+			defer ln.Close()
+
+			client, err := net.Dial("tcp", inner.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.WriteString(client, tt.input); err != nil {
+				t.Fatal(err)
+			}
+			if err := client.(*net.TCPConn).CloseWrite(); err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+
+			conn, err := ln.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			data, err := io.ReadAll(conn)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ReadAll() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			if string(data) != tt.wantData {
+				t.Errorf("data = %q, want %q", data, tt.wantData)
+			}
+			wantRemote := tt.wantRemote
+			if wantRemote == "" {
+				wantRemote = client.LocalAddr().String()
+			}
+			if got := conn.RemoteAddr().String(); got != wantRemote {
+				t.Errorf("RemoteAddr() = %s, want %s", got, wantRemote)
+			}
+		})
+	}
+}
+
+// FuzzReadProxyHeader は受け入れたヘッダーのアドレスが送信元と宛先の組で揃っていて同じアドレスファミリーであり、
+// ヘッダーの後に続くデータを読み進めず、後続のデータによって結果が変わらないことを検証する
+func FuzzReadProxyHeader(f *testing.F) {
+	f.Add([]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"))
+	f.Add([]byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"))
+	f.Add([]byte("PROXY UNKNOWN\r\n"))
+	f.Add(v2Header(0x21, 0x11, v2Addresses("192.0.2.1", "198.51.100.1", 56324, 443)))
+	f.Add(v2Header(0x21, 0x21, v2Addresses("2001:db8::1", "2001:db8::2", 56324, 443)))
+	f.Add(v2Header(0x20, 0x00, nil))
+
+	const trailer = "\r\ntrailer"
+	f.Fuzz(func(t *testing.T, input []byte) {
+		remote, local, err := readProxyHeader(bufio.NewReader(bytes.NewReader(input)))
+		if err != nil {
+			return
+		}
+		if (remote == nil) != (local == nil) {
+			t.Fatalf("only one address is set: remote = %v, local = %v", remote, local)
+		}
+		if remote != nil {
+			src := remote.(*net.TCPAddr).AddrPort().Addr()
+			dst := local.(*net.TCPAddr).AddrPort().Addr()
+			if src.Is4() != dst.Is4() {
+				t.Fatalf("mismatched address families: remote = %v, local = %v", remote, local)
+			}
+		}
+
+		r := bufio.NewReader(io.MultiReader(bytes.NewReader(input), strings.NewReader(trailer)))
+		againRemote, againLocal, err := readProxyHeader(r)
+		if err != nil || addrString(againRemote) != addrString(remote) || addrString(againLocal) != addrString(local) {
+			t.Fatalf("trailing data changed the result: %v, %v, %v", againRemote, againLocal, err)
+		}
+		if rest, _ := io.ReadAll(r); !bytes.HasSuffix(rest, []byte(trailer)) {
+			t.Fatalf("read past the header: rest = %q", rest)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+// fakeidp はローカル環境・CIでAuth0の代わりに使用する偽のOIDCプロバイダー
+// GatewayのAUTH0_ISSUERにこのサーバーの発行者を指定して使用する
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/kakke18/platform-security-poc/backend/platform/conf"
+	"github.com/kakke18/platform-security-poc/backend/platform/fakeidp"
+)
+
+// Config は偽のOIDCプロバイダーの設定
+type Config struct {
+	// Port はサーバーのポート番号
+	Port string `yaml:"port" env:"FAKEIDP_PORT" usage:"ポート"`
+
+	// Issuer は発行者（末尾のスラッシュを含む）。未設定の場合はhttp://localhost:<port>/
+	Issuer string `yaml:"issuer" env:"FAKEIDP_ISSUER" usage:"発行者（未設定の場合はhttp://localhost:<port>/）"`
+}
+
+// Validate は設定の妥当性を検証する
+func (c *Config) Validate() error {
+	var errs conf.Errors
+	errs.Port("port", c.Port)
+	errs.OptionalURL("issuer", c.Issuer)
+	return errs.Err()
+}
+
+func main() {
+	cfg := &Config{Port: "9000"}
+	err := conf.Load(cfg, os.Args[1:])
+	if errors.Is(err, conf.ErrPrinted) {
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		panic(err)
+	}
+	if cfg.Issuer == "" {
+		cfg.Issuer = "http://localhost:" + cfg.Port + "/"
+	}
+
+	idp, err := fakeidp.New(cfg.Issuer)
+	if err != nil {
+		slog.Error("Failed to initialize fake IdP", "error", err)
+		panic(err)
+	}
+
+	srv := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           idp.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		slog.Info("Fake IdP is starting...", "port", cfg.Port, "issuer", cfg.Issuer, "kid", idp.KeyID())
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Fake IdP failed to start", "error", err)
+			panic(err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("Fake IdP forced to shutdown", "error", err)
+	}
+}
@@ -0,0 +1,122 @@
+// seed はローカル環境のシードデータを検証し、登録されるユーザーとテナントへの所属を一覧表示する
+// 偽のIdP（fakeidp）を指定すると、各ユーザーのトークンも発行する
+//
+// Identity API・User APIは起動時にSEED_FILEのシードデータをリポジトリに登録する
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kakke18/platform-security-poc/backend/platform/conf"
+	"github.com/kakke18/platform-security-poc/backend/platform/seed"
+)
+
+// Config はseedコマンドの設定
+type Config struct {
+	// File はシードデータ（YAML）のパス。未設定の場合は組み込みのシードデータ
+	File string `yaml:"file" env:"SEED_FILE" usage:"シードデータ（YAML）のパス（未設定の場合は組み込みのデータ）"`
+
+	// FakeIdPURL はトークンを発行する偽のIdPの発行者（例: http://localhost:9000/）
+	FakeIdPURL string `yaml:"fakeidp_url" env:"FAKEIDP_URL" usage:"トークンを発行する偽のIdPのURL（未設定の場合は発行しない）"`
+
+	// Audience は発行するトークンのオーディエンス
+	Audience string `yaml:"audience" env:"AUTH0_AUDIENCE" usage:"発行するトークンのオーディエンス"`
+}
+
+// Validate は設定の妥当性を検証する
+func (c *Config) Validate() error {
+	var errs conf.Errors
+	errs.File("file", c.File)
+	errs.OptionalURL("fakeidp_url", c.FakeIdPURL)
+	if c.FakeIdPURL != "" {
+		errs.Required("audience", c.Audience)
+	}
+	return errs.Err()
+}
+
+func main() {
+	cfg := &Config{}
+	err := conf.Load(cfg, os.Args[1:])
+	if errors.Is(err, conf.ErrPrinted) {
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		os.Exit(2)
+	}
+
+	data, err := seed.Load(cfg.File)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	printSummary(data)
+
+	if cfg.FakeIdPURL == "" {
+		return
+	}
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AUTH0 USER ID\tTOKEN")
+	for _, u := range data.Users {
+		token, err := mint(cfg.FakeIdPURL, u.Auth0UserID, cfg.Audience)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to mint token for %s: %v\n", u.Auth0UserID, err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", u.Auth0UserID, token)
+	}
+	w.Flush()
+}
+
+// printSummary はワークスペースごとのユーザーとテナントへの所属を出力する
+func printSummary(data *seed.Data) {
+	memberships := make(map[string][]string)
+	for _, m := range data.Memberships {
+		memberships[m.WorkspaceUserID] = append(memberships[m.WorkspaceUserID], m.TenantID+"("+m.Role+")")
+	}
+
+	fmt.Printf("%d workspaces, %d users, %d tenants, %d memberships\n\n",
+		len(data.Workspaces), len(data.Users), len(data.Tenants), len(data.Memberships))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WORKSPACE\tUSER\tWORKSPACE USER\tAUTH0 USER ID\tEMAIL\tPRIVILEGED\tTENANTS")
+	for _, u := range data.Users {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%t\t%s\n",
+			u.WorkspaceID, u.ID, u.WorkspaceUserID, u.Auth0UserID, u.Email, u.Privileged,
+			strings.Join(memberships[u.WorkspaceUserID], ","))
+	}
+	w.Flush()
+}
+
+// mint は偽のIdPでユーザーのトークンを発行する
+func mint(issuer, subject, audience string) (string, error) {
+	body, err := json.Marshal(map[string]any{"sub": subject, "aud": audience})
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.Post(strings.TrimSuffix(issuer, "/")+"/fakeidp/token", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status=%d", resp.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
@@ -0,0 +1,428 @@
+package conf
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrPrinted は-print-config（または-help）が指定され、有効な設定（またはヘルプ）を出力したことを表す
+// 呼び出し元はサーバーを起動せずに終了する
+var ErrPrinted = errors.New("effective config printed")
+
+// Validator は読み込み後の設定を検証するインターフェース
+type Validator interface {
+	// Validate は設定の妥当性を検証し、全てのエラーをまとめて返す
+	Validate() error
+}
+
+// field は設定構造体の1項目
+type field struct {
+	// path はファイル上のキー（ネストしたキーは.で連結）
+	path string
+
+	// env は上書きに使う環境変数名（未設定の場合は環境変数で上書きしない）
+	env string
+
+	// secret は値を出力時に伏せるかどうか
+	secret bool
+
+	// usage はフラグのヘルプに表示する説明
+	usage string
+
+	value reflect.Value
+}
+
+// flagName はフラグ名を返す（例: cors.allowed_origins -> -cors.allowed-origins）
+func (f field) flagName() string {
+	return strings.ReplaceAll(f.path, "_", "-")
+}
+
+// Load はデフォルト値を設定済みのcfgに、設定ファイル・環境変数・コマンドラインフラグの順で値を上書きし、検証する
+//
+// 設定ファイルは-configまたはCONFIG_FILEで指定し、拡張子（.yaml・.yml・.json・.toml）で形式を判別する
+// 項目はタグで定義する:
+//   - yaml: ファイル上のキー（TOMLでも同じキーを使う）
+//   - env: 上書きに使う環境変数名。<env>_FILEを指定した場合はファイルの内容を値とする（シークレット用）
+//   - secret: "true"の場合は出力時に値を伏せる
+//   - usage: フラグのヘルプに表示する説明
+//
+// 構造体の一覧を除く全ての項目は-<キー>（_は-に置換）のフラグでも上書きできる
+// 変換エラーと検証エラーはまとめて返す
+func Load(cfg Validator, args []string) error {
+	fields, err := collect(reflect.ValueOf(cfg), "")
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "設定ファイル（YAML・TOML）のパス（CONFIG_FILE）")
+	printConfig := fs.Bool("print-config", false, "有効な設定をシークレットを伏せて出力し、終了する")
+	flags := make(map[string]*flagValue, len(fields))
+	for i := range fields {
+		f := &fields[i]
+		usage := f.usage
+		if f.env != "" {
+			usage = fmt.Sprintf("%s（%s）", usage, f.env)
+		}
+		fv := &flagValue{f: f}
+		fs.Var(fv, f.flagName(), usage)
+		flags[f.flagName()] = fv
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ErrPrinted
+		}
+		return err
+	}
+
+	if *configFile != "" {
+		if err := DecodeFile(*configFile, cfg); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+
+	// 環境変数で上書き
+	for _, f := range fields {
+		if f.env == "" {
+			continue
+		}
+		if path := os.Getenv(f.env + "_FILE"); path != "" {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s_FILE: %w", f.env, err))
+				continue
+			}
+			if err := set(f.value, strings.TrimSpace(string(b))); err != nil {
+				errs = append(errs, fmt.Errorf("%s_FILE: %w", f.env, err))
+			}
+			continue
+		}
+		if v := os.Getenv(f.env); v != "" {
+			if err := set(f.value, v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", f.env, err))
+			}
+		}
+	}
+
+	// フラグで上書き（値の形式はパース時に検証済み）
+	fs.Visit(func(fl *flag.Flag) {
+		fv, ok := flags[fl.Name]
+		if !ok {
+			return
+		}
+		if err := set(fv.f.value, fv.raw); err != nil {
+			errs = append(errs, fmt.Errorf("-%s: %w", fl.Name, err))
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+
+	if *printConfig {
+		if err := Print(os.Stdout, cfg); err != nil {
+			return err
+		}
+		return ErrPrinted
+	}
+	return nil
+}
+
+// DecodeFile は拡張子で形式を判別してファイルをvにデコードする。未知のキーはエラーとする
+// JSONはYAMLのサブセットとしてYAMLと同じ規則でデコードする
+// ルーティングテーブルなど設定ファイルから参照する別ファイルも同じ形式で読み込むために使用する
+func DecodeFile(path string, v any) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml", ".json":
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("invalid file %s: %w", path, err)
+		}
+	case ".toml":
+		// キーと型の扱いをYAMLと揃えるため、TOMLを汎用の値に変換してからYAMLとしてデコードする
+		var m map[string]any
+		if _, err := toml.Decode(string(b), &m); err != nil {
+			return fmt.Errorf("invalid file %s: %w", path, err)
+		}
+		y, err := yaml.Marshal(m)
+		if err != nil {
+			return fmt.Errorf("invalid file %s: %w", path, err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(y))
+		dec.KnownFields(true)
+		if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("invalid file %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("unsupported file extension: %q", ext)
+	}
+	return nil
+}
+
+// Print は有効な設定をYAMLで出力する。secretタグの付いた項目は値を伏せる
+func Print(w io.Writer, cfg any) error {
+	node, err := toNode(reflect.Indirect(reflect.ValueOf(cfg)))
+	if err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return fmt.Errorf("failed to print config: %w", err)
+	}
+	return enc.Close()
+}
+
+// collect は設定構造体からyamlタグの付いた項目を列挙する
+func collect(v reflect.Value, prefix string) ([]field, error) {
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config must be a pointer to struct: %s", v.Type())
+	}
+
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key := yamlKey(sf)
+		if key == "" || !sf.IsExported() {
+			continue
+		}
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		fv := v.Field(i)
+		if isStructSlice(fv.Type()) {
+			// 構造体の一覧は設定ファイルでのみ指定できる
+			continue
+		}
+		if isLeaf(fv) {
+			fields = append(fields, field{
+				path:   path,
+				env:    sf.Tag.Get("env"),
+				secret: sf.Tag.Get("secret") == "true",
+				usage:  sf.Tag.Get("usage"),
+				value:  fv,
+			})
+			continue
+		}
+
+		nested, err := collect(fv.Addr(), path)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, nested...)
+	}
+	return fields, nil
+}
+
+// yamlKey はyamlタグのキーを返す（タグがない、または"-"の場合は空文字）
+func yamlKey(sf reflect.StructField) string {
+	key, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+	if key == "-" {
+		return ""
+	}
+	return key
+}
+
+// isLeaf は値が1つの項目として扱う型かどうかを返す
+func isLeaf(v reflect.Value) bool {
+	if v.Kind() != reflect.Struct {
+		return true
+	}
+	_, ok := v.Addr().Interface().(encoding.TextUnmarshaler)
+	return ok
+}
+
+// isStructSlice は型が構造体のスライス（環境変数・フラグで指定できない項目）かどうかを返す
+func isStructSlice(t reflect.Type) bool {
+	if t.Kind() != reflect.Slice || t.Elem().Kind() != reflect.Struct {
+		return false
+	}
+	return !reflect.PointerTo(t.Elem()).Implements(reflect.TypeFor[encoding.TextUnmarshaler]())
+}
+
+// set は文字列を項目の型に変換して設定する。スライスはカンマ区切りで指定する
+func set(v reflect.Value, s string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if err := u.UnmarshalText([]byte(s)); err != nil {
+			return fmt.Errorf("invalid value %q: %w", s, err)
+		}
+		return nil
+	}
+
+	if v.Kind() == reflect.Slice {
+		var parts []string
+		for _, p := range strings.Split(s, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				parts = append(parts, p)
+			}
+		}
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, p := range parts {
+			if err := set(slice.Index(i), p); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+
+	if v.Type() == reflect.TypeFor[time.Duration]() {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", s)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported config type: %s", v.Type())
+	}
+	return nil
+}
+
+// format は項目の値を出力用の文字列に変換する
+func format(v reflect.Value) string {
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		b, err := m.MarshalText()
+		if err == nil {
+			return string(b)
+		}
+	}
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// toNode は設定構造体を項目の定義順を保ったYAMLノードに変換する
+func toNode(v reflect.Value) (*yaml.Node, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key := yamlKey(sf)
+		if key == "" || !sf.IsExported() {
+			continue
+		}
+
+		var value *yaml.Node
+		fv := v.Field(i)
+		switch {
+		case sf.Tag.Get("secret") == "true":
+			value = scalar("")
+			if !fv.IsZero() {
+				value = scalar("[REDACTED]")
+			}
+		case !isLeaf(fv):
+			nested, err := toNode(fv)
+			if err != nil {
+				return nil, err
+			}
+			value = nested
+		case isStructSlice(fv.Type()):
+			value = &yaml.Node{Kind: yaml.SequenceNode}
+			for j := 0; j < fv.Len(); j++ {
+				nested, err := toNode(fv.Index(j))
+				if err != nil {
+					return nil, err
+				}
+				value.Content = append(value.Content, nested)
+			}
+		case fv.Kind() == reflect.Slice:
+			value = &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+			for j := 0; j < fv.Len(); j++ {
+				value.Content = append(value.Content, scalar(format(fv.Index(j))))
+			}
+		default:
+			value = scalar(format(fv))
+		}
+		node.Content = append(node.Content, scalar(key), value)
+	}
+	return node, nil
+}
+
+// scalar は文字列のYAMLノードを作成する
+func scalar(s string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: s}
+}
+
+// flagValue はコマンドラインフラグの値
+// 設定ファイルと環境変数より優先するため、パース時は形式の検証のみ行い、値は最後に設定する
+type flagValue struct {
+	f   *field
+	raw string
+}
+
+// String はフラグの値を返す
+func (v *flagValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.raw
+}
+
+// Set はフラグの値を検証して保持する
+func (v *flagValue) Set(s string) error {
+	if err := set(reflect.New(v.f.value.Type()).Elem(), s); err != nil {
+		return err
+	}
+	v.raw = s
+	return nil
+}
+
+// IsBoolFlag はbool型の項目を値なしで指定できるようにする
+func (v *flagValue) IsBoolFlag() bool {
+	return v != nil && v.f != nil && v.f.value.Kind() == reflect.Bool
+}
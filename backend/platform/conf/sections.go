@@ -0,0 +1,49 @@
+package conf
+
+// TLS はサーバーのTLS設定
+// 証明書と秘密鍵の両方を指定した場合のみTLSで待ち受ける
+type TLS struct {
+	// CertFile はサーバー証明書（PEM）のパス
+	CertFile string `yaml:"cert_file" env:"TLS_CERT_FILE" usage:"サーバー証明書（PEM）のパス"`
+
+	// KeyFile はサーバー証明書の秘密鍵（PEM）のパス
+	KeyFile string `yaml:"key_file" env:"TLS_KEY_FILE" usage:"サーバー証明書の秘密鍵（PEM）のパス"`
+}
+
+// Enabled はTLSで待ち受けるかどうかを返す
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// TLS は証明書と秘密鍵が揃って指定され、ファイルが存在することを検証する
+func (e *Errors) TLS(key string, t TLS) {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		e.Addf(key, "cert_file and key_file must be set together")
+	}
+	e.File(key+".cert_file", t.CertFile)
+	e.File(key+".key_file", t.KeyFile)
+}
+
+// RateLimit はクライアントIPごとのレート制限の設定
+type RateLimit struct {
+	// RequestsPerSecond は1秒あたりに許可するリクエスト数（0の場合は制限しない）
+	RequestsPerSecond float64 `yaml:"requests_per_second" env:"RATE_LIMIT_RPS" usage:"クライアントIPごとの1秒あたりのリクエスト数（0で無効）"`
+
+	// Burst は瞬間的に許可するリクエスト数
+	Burst int `yaml:"burst" env:"RATE_LIMIT_BURST" usage:"クライアントIPごとのバースト数"`
+}
+
+// Enabled はレート制限を行うかどうかを返す
+func (r RateLimit) Enabled() bool {
+	return r.RequestsPerSecond > 0
+}
+
+// RateLimit はレート制限の値が妥当であることを検証する
+func (e *Errors) RateLimit(key string, r RateLimit) {
+	if r.RequestsPerSecond < 0 {
+		e.Addf(key+".requests_per_second", "must be non-negative: %v", r.RequestsPerSecond)
+	}
+	if r.Enabled() && r.Burst < 1 {
+		e.Addf(key+".burst", "must be positive when rate limiting is enabled: %d", r.Burst)
+	}
+}
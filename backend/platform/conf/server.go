@@ -0,0 +1,103 @@
+package conf
+
+import (
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// Server はHTTPサーバーのタイムアウトとリクエストサイズの上限
+// 低速なクライアントが接続を占有する攻撃（Slowloris）や巨大なリクエストからサーバーを保護する
+type Server struct {
+	// ReadHeaderTimeout はリクエストヘッダーの読み込みの上限時間
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT" usage:"リクエストヘッダーの読み込みの上限時間"`
+
+	// ReadTimeout はボディを含むリクエスト全体の読み込みの上限時間（HTTP/2ではストリームごと）
+	ReadTimeout time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT" usage:"リクエスト全体の読み込みの上限時間"`
+
+	// WriteTimeout はレスポンスの書き込みの上限時間（HTTP/2ではストリームごと）
+	WriteTimeout time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT" usage:"レスポンスの書き込みの上限時間"`
+
+	// IdleTimeout はキープアライブ接続を待機する上限時間
+	IdleTimeout time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT" usage:"キープアライブ接続の待機の上限時間"`
+
+	// MaxHeaderBytes はリクエストヘッダーの最大サイズ
+	MaxHeaderBytes int `yaml:"max_header_bytes" env:"SERVER_MAX_HEADER_BYTES" usage:"リクエストヘッダーの最大バイト数"`
+
+	// MaxBodyBytes はリクエストボディとConnectのメッセージ（展開後）の最大サイズ
+	MaxBodyBytes int64 `yaml:"max_body_bytes" env:"SERVER_MAX_BODY_BYTES" usage:"リクエストボディの最大バイト数"`
+
+	// HTTP2 はHTTP/2（h2c・TLS）接続の上限
+	HTTP2 HTTP2 `yaml:"http2"`
+}
+
+// HTTP2 はHTTP/2接続の上限
+type HTTP2 struct {
+	// MaxConcurrentStreams は1接続で同時に処理するストリーム数
+	MaxConcurrentStreams int `yaml:"max_concurrent_streams" env:"HTTP2_MAX_CONCURRENT_STREAMS" usage:"HTTP/2の1接続あたりの同時ストリーム数"`
+
+	// MaxReadFrameSize は受信するフレームの最大サイズ
+	MaxReadFrameSize int `yaml:"max_read_frame_size" env:"HTTP2_MAX_READ_FRAME_SIZE" usage:"HTTP/2の受信フレームの最大バイト数"`
+}
+
+// DefaultServer はHTTPサーバーのデフォルトの上限を返す
+// WriteTimeoutはリクエストのデッドライン（REQUEST_TIMEOUT）より長くする
+func DefaultServer() Server {
+	return Server{
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		MaxHeaderBytes:    64 << 10,
+		MaxBodyBytes:      4 << 20,
+		HTTP2: HTTP2{
+			MaxConcurrentStreams: 100,
+			MaxReadFrameSize:     1 << 20,
+		},
+	}
+}
+
+// NewHTTPServer はタイムアウトとヘッダーサイズの上限を設定したhttp.Serverを作成する
+func (s Server) NewHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: s.ReadHeaderTimeout,
+		ReadTimeout:       s.ReadTimeout,
+		WriteTimeout:      s.WriteTimeout,
+		IdleTimeout:       s.IdleTimeout,
+		MaxHeaderBytes:    s.MaxHeaderBytes,
+	}
+}
+
+// HTTP2Server はストリーム数とフレームサイズの上限を設定したhttp2.Serverを作成する
+// 読み込み・書き込みのタイムアウトはh2c・TLSのいずれでもhttp.Serverの値がストリームごとに適用される
+func (s Server) HTTP2Server() *http2.Server {
+	return &http2.Server{
+		MaxConcurrentStreams: uint32(s.HTTP2.MaxConcurrentStreams),
+		MaxReadFrameSize:     uint32(s.HTTP2.MaxReadFrameSize),
+		IdleTimeout:          s.IdleTimeout,
+	}
+}
+
+// Server はHTTPサーバーの上限が妥当であることを検証する
+func (e *Errors) Server(key string, s Server) {
+	e.Positive(key+".read_header_timeout", s.ReadHeaderTimeout)
+	e.NonNegative(key+".read_timeout", s.ReadTimeout)
+	e.NonNegative(key+".write_timeout", s.WriteTimeout)
+	e.NonNegative(key+".idle_timeout", s.IdleTimeout)
+	if s.MaxHeaderBytes < 1 {
+		e.Addf(key+".max_header_bytes", "must be positive: %d", s.MaxHeaderBytes)
+	}
+	if s.MaxBodyBytes < 1 {
+		e.Addf(key+".max_body_bytes", "must be positive: %d", s.MaxBodyBytes)
+	}
+	if s.HTTP2.MaxConcurrentStreams < 1 {
+		e.Addf(key+".http2.max_concurrent_streams", "must be positive: %d", s.HTTP2.MaxConcurrentStreams)
+	}
+	// HTTP/2の仕様で許可されるフレームサイズは16KiB〜16MiB-1
+	if s.HTTP2.MaxReadFrameSize < 16<<10 || s.HTTP2.MaxReadFrameSize > 1<<24-1 {
+		e.Addf(key+".http2.max_read_frame_size", "must be between 16384 and 16777215: %d", s.HTTP2.MaxReadFrameSize)
+	}
+}
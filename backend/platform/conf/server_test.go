@@ -0,0 +1,88 @@
+package conf
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/grpchealth"
+	healthv1 "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// newTestServer はsの上限を設定したhttp.ServerでhandlerをHTTP/1.1で公開する
+func newTestServer(t *testing.T, s Server, handler http.Handler) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(handler)
+	ts.Config = s.NewHTTPServer("", handler)
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestServerReadHeaderTimeout(t *testing.T) {
+	s := DefaultServer()
+	s.ReadHeaderTimeout = 100 * time.Millisecond
+	ts := newTestServer(t, s, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// ヘッダーを送り終えない低速なクライアント（Slowloris）
+	if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: example.com\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = io.ReadAll(conn)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		t.Fatalf("connection was not closed by the server within %s", 5*time.Second)
+	}
+	if elapsed := time.Since(start); elapsed < s.ReadHeaderTimeout {
+		t.Errorf("connection closed after %s, before the read header timeout", elapsed)
+	}
+}
+
+func TestServerConnectReadMaxBytes(t *testing.T) {
+	s := DefaultServer()
+	s.MaxBodyBytes = 64
+	mux := http.NewServeMux()
+	mux.Handle(grpchealth.NewHandler(grpchealth.NewStaticChecker(), connect.WithReadMaxBytes(int(s.MaxBodyBytes))))
+	ts := newTestServer(t, s, mux)
+
+	tests := []struct {
+		name     string
+		service  string
+		wantCode connect.Code
+	}{
+		{name: "within the limit", service: "", wantCode: 0},
+		{name: "message over the limit", service: strings.Repeat("a", int(s.MaxBodyBytes)), wantCode: connect.CodeResourceExhausted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](ts.Client(), ts.URL+"/grpc.health.v1.Health/Check")
+			_, err := client.CallUnary(context.Background(), connect.NewRequest(&healthv1.HealthCheckRequest{Service: tt.service}))
+			if tt.wantCode == 0 {
+				if err != nil {
+					t.Fatalf("Check() error = %v", err)
+				}
+				return
+			}
+			if got := connect.CodeOf(err); got != tt.wantCode {
+				t.Errorf("Check() code = %v, want %v (error: %v)", got, tt.wantCode, err)
+			}
+		})
+	}
+}
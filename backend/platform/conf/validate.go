@@ -0,0 +1,77 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Errors は設定の検証エラーを集約する
+type Errors []error
+
+// Addf は検証エラーを追加する
+func (e *Errors) Addf(key, format string, args ...any) {
+	*e = append(*e, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+}
+
+// Required は値が空でないことを検証する
+func (e *Errors) Required(key, v string) {
+	if v == "" {
+		e.Addf(key, "is required")
+	}
+}
+
+// URL はhttp・httpsの絶対URLであることを検証する
+func (e *Errors) URL(key, v string) {
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		e.Addf(key, "must be an absolute http(s) URL: %q", v)
+	}
+}
+
+// OptionalURL は値が空でなければhttp・httpsの絶対URLであることを検証する
+func (e *Errors) OptionalURL(key, v string) {
+	if v != "" {
+		e.URL(key, v)
+	}
+}
+
+// Port はポート番号であることを検証する
+func (e *Errors) Port(key, v string) {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > 65535 {
+		e.Addf(key, "must be a port number: %q", v)
+	}
+}
+
+// Positive は時間が正であることを検証する
+func (e *Errors) Positive(key string, d time.Duration) {
+	if d <= 0 {
+		e.Addf(key, "must be a positive duration: %s", d)
+	}
+}
+
+// NonNegative は時間が0以上であることを検証する
+func (e *Errors) NonNegative(key string, d time.Duration) {
+	if d < 0 {
+		e.Addf(key, "must be a non-negative duration: %s", d)
+	}
+}
+
+// File は値が空でなければファイルが存在することを検証する
+func (e *Errors) File(key, path string) {
+	if path == "" {
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		e.Addf(key, "%v", err)
+	}
+}
+
+// Err は集約した検証エラーを返す（エラーがない場合はnil）
+func (e Errors) Err() error {
+	return errors.Join(e...)
+}
@@ -0,0 +1,96 @@
+package conf
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce はファイルの変更を検知してからonChangeを呼び出すまでの待ち時間
+// エディタの保存などで短時間に連続する変更をまとめる
+const watchDebounce = 500 * time.Millisecond
+
+// File はコマンドライン引数（-config）またはCONFIG_FILEから設定ファイルのパスを返す
+func File(args []string) string {
+	path := os.Getenv("CONFIG_FILE")
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "config" {
+			continue
+		}
+		if hasValue {
+			path = value
+		} else if i+1 < len(args) {
+			path = args[i+1]
+		}
+	}
+	return path
+}
+
+// Watch はファイルの変更を監視し、変更されるたびにonChangeを呼び出す
+// アトミックな置き換え（リネーム）やKubernetesのConfigMapの更新も検知するため、親ディレクトリを監視する
+// ctxがキャンセルされるまでブロックする。空のパスは無視する
+func Watch(ctx context.Context, paths []string, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	targets := make(map[string]bool)
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", p, err)
+		}
+		targets[abs] = true
+		if err := watcher.Add(filepath.Dir(abs)); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", p, err)
+		}
+	}
+	if len(targets) == 0 {
+		<-ctx.Done()
+		return nil
+	}
+
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// ConfigMapは..dataのシンボリックリンクを差し替えるため、ディレクトリ内の変更も対象とする
+			if targets[filepath.Clean(e.Name)] || strings.Contains(filepath.Base(e.Name), "..data") {
+				timer.Reset(watchDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.WarnContext(ctx, "config file watcher error", slog.String("error", err.Error()))
+		case <-timer.C:
+			onChange()
+		}
+	}
+}
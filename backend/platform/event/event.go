@@ -0,0 +1,161 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kakke18/platform-security-poc/backend/platform/requestid"
+	"github.com/kakke18/platform-security-poc/backend/platform/telemetry"
+)
+
+// Type はイベントの種類
+type Type string
+
+const (
+	// TypeProfileChanged はユーザーのプロフィールが変更されたことを表す
+	TypeProfileChanged Type = "profile.changed"
+
+	// TypeMembershipChanged はワークスペースやテナントへの所属が変更されたことを表す
+	// 対象のユーザーを指定しない場合は全てのユーザーの所属が変更された可能性があることを表す
+	TypeMembershipChanged Type = "membership.changed"
+)
+
+const (
+	// publishTimeout はイベント送信のタイムアウト
+	publishTimeout = 3 * time.Second
+
+	// maxEventBytes は受信するイベントの最大サイズ
+	maxEventBytes = 64 << 10
+
+	// bearerPrefix は共有シークレットを送るAuthorizationヘッダーのスキーム
+	bearerPrefix = "Bearer "
+)
+
+// Event はサービス間で通知する変更イベント
+type Event struct {
+	// Type はイベントの種類
+	Type Type `json:"type"`
+
+	// Subject は変更されたユーザーのAuth0ユーザーID
+	Subject string `json:"subject,omitempty"`
+
+	// WorkspaceUserID は変更されたユーザーのワークスペースユーザーID
+	WorkspaceUserID string `json:"workspace_user_id,omitempty"`
+
+	// OccurredAt はイベントの発生日時
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// Publisher はイベントを通知するインターフェース
+type Publisher interface {
+	// Publish はイベントを通知する
+	Publish(ctx context.Context, e Event) error
+}
+
+// NopPublisher は何も通知しないPublisher
+type NopPublisher struct{}
+
+// Publish は何もしない
+func (NopPublisher) Publish(ctx context.Context, e Event) error {
+	return nil
+}
+
+// HTTPPublisher はイベントをJSONとしてHTTP POSTで通知するPublisher
+// 受信側と共有するシークレットをAuthorizationヘッダーで送信する
+type HTTPPublisher struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewHTTPPublisher は新しいHTTPPublisherを作成する
+func NewHTTPPublisher(url, secret string) *HTTPPublisher {
+	return &HTTPPublisher{
+		url:    url,
+		secret: secret,
+		client: &http.Client{
+			Timeout:   publishTimeout,
+			Transport: telemetry.Transport(http.DefaultTransport),
+		},
+	}
+}
+
+// Publish はイベントを送信する
+func (p *HTTPPublisher) Publish(ctx context.Context, e Event) error {
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now()
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create event request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", bearerPrefix+p.secret)
+	requestid.SetHeader(ctx, req.Header)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("failed to publish event: status=%d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Handler はHTTPPublisherから送信されたイベントを受信してhandleに渡すハンドラーを返す
+// secretと一致する共有シークレットを持たないリクエストは拒否する（secretが空の場合は全て拒否する）
+func Handler(secret string, handle func(ctx context.Context, e Event)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorized(r, secret) {
+			slog.WarnContext(r.Context(), "event rejected: invalid secret")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var e Event
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEventBytes)).Decode(&e); err != nil {
+			http.Error(w, "Invalid event", http.StatusBadRequest)
+			return
+		}
+		if e.Type == "" {
+			http.Error(w, "Missing event type", http.StatusBadRequest)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "event received", slog.String("type", string(e.Type)))
+		handle(r.Context(), e)
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// authorized はリクエストのAuthorizationヘッダーの共有シークレットがsecretと一致するかを返す
+func authorized(r *http.Request, secret string) bool {
+	if secret == "" {
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, bearerPrefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(auth[len(bearerPrefix):]), []byte(secret)) == 1
+}
@@ -0,0 +1,79 @@
+package event
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPPublisher(t *testing.T) {
+	var got []Event
+	srv := httptest.NewServer(Handler("secret", func(ctx context.Context, e Event) {
+		got = append(got, e)
+	}))
+	defer srv.Close()
+
+	e := Event{Type: TypeMembershipChanged, Subject: "auth0|alice", WorkspaceUserID: "wu-1"}
+	if err := NewHTTPPublisher(srv.URL, "secret").Publish(context.Background(), e); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Type != e.Type || got[0].Subject != e.Subject || got[0].WorkspaceUserID != e.WorkspaceUserID || got[0].OccurredAt.IsZero() {
+		t.Fatalf("received = %+v", got)
+	}
+
+	// シークレットが一致しない場合は送信元にエラーを返す
+	if err := NewHTTPPublisher(srv.URL, "wrong").Publish(context.Background(), e); err == nil || !strings.Contains(err.Error(), "status=401") {
+		t.Errorf("Publish() error = %v, want status=401", err)
+	}
+	if len(got) != 1 {
+		t.Errorf("received %d events, want the rejected event not to be handled", len(got))
+	}
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		secret        string
+		method        string
+		authorization string
+		body          string
+		wantStatus    int
+	}{
+		{name: "valid event", secret: "secret", authorization: "Bearer secret", body: `{"type":"profile.changed"}`, wantStatus: http.StatusAccepted},
+		{name: "missing authorization", secret: "secret", body: `{"type":"profile.changed"}`, wantStatus: http.StatusUnauthorized},
+		{name: "wrong secret", secret: "secret", authorization: "Bearer secret2", body: `{"type":"profile.changed"}`, wantStatus: http.StatusUnauthorized},
+		{name: "other scheme", secret: "secret", authorization: "Basic secret", body: `{"type":"profile.changed"}`, wantStatus: http.StatusUnauthorized},
+		{name: "no secret configured rejects everything", authorization: "Bearer ", body: `{"type":"profile.changed"}`, wantStatus: http.StatusUnauthorized},
+		{name: "method other than POST", secret: "secret", method: http.MethodGet, authorization: "Bearer secret", wantStatus: http.StatusMethodNotAllowed},
+		{name: "invalid json", secret: "secret", authorization: "Bearer secret", body: `{`, wantStatus: http.StatusBadRequest},
+		{name: "missing type", secret: "secret", authorization: "Bearer secret", body: `{}`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled := false
+			h := Handler(tt.secret, func(ctx context.Context, e Event) {
+				handled = true
+			})
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req := httptest.NewRequest(method, "/internal/events", strings.NewReader(tt.body))
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if handled != (tt.wantStatus == http.StatusAccepted) {
+				t.Errorf("handled = %v", handled)
+			}
+		})
+	}
+}
@@ -0,0 +1,407 @@
+// Package fakeidp はネットワークに接続できない環境で統合テストを実行するためのローカルのOIDCプロバイダー
+// JWKSとOIDCディスカバリーを提供し、任意のクレームのトークンの発行、署名鍵のローテーション、障害の再現ができる
+// opaqueトークンを発行し、トークンイントロスペクション（RFC 7662）で検証することもできる
+package fakeidp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// keyBits は署名鍵のサイズ
+const keyBits = 2048
+
+// DefaultTokenLifetime はexpを指定せずに発行したトークンの有効期間
+const DefaultTokenLifetime = time.Hour
+
+// IntrospectionClientID・IntrospectionClientSecret はイントロスペクションエンドポイントのクライアント認証に使用する資格情報
+const (
+	IntrospectionClientID     = "fakeidp-introspection"
+	IntrospectionClientSecret = "fakeidp-introspection-secret"
+)
+
+// signingKey はkidを付与した署名鍵
+type signingKey struct {
+	kid string
+	key *rsa.PrivateKey
+}
+
+// IdP は偽のOIDCプロバイダー
+type IdP struct {
+	mu      sync.RWMutex
+	issuer  string
+	keys    []signingKey
+	outage  int
+	latency time.Duration
+	server  *httptest.Server
+
+	// opaque は発行したopaqueトークンのクレーム
+	opaque map[string]map[string]any
+	// introspections はイントロスペクションエンドポイントへの問い合わせの回数
+	introspections atomic.Int64
+}
+
+// New は指定された発行者（末尾のスラッシュを含む）の偽のOIDCプロバイダーを作成する
+func New(issuer string) (*IdP, error) {
+	p := &IdP{issuer: issuer, opaque: make(map[string]map[string]any)}
+	if _, err := p.RotateKey(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Start は空いているポートで偽のOIDCプロバイダーを起動する
+// 発行者は起動したサーバーのURLになる。使用後はCloseで停止する
+func Start() (*IdP, error) {
+	p, err := New("")
+	if err != nil {
+		return nil, err
+	}
+	p.server = httptest.NewServer(p.Handler())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.issuer = p.server.URL + "/"
+	return p, nil
+}
+
+// Close はStartで起動したサーバーを停止する
+func (p *IdP) Close() {
+	if p.server != nil {
+		p.server.Close()
+	}
+}
+
+// Issuer は発行者を返す
+func (p *IdP) Issuer() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.issuer
+}
+
+// KeyID は署名に使用している鍵のkidを返す
+func (p *IdP) KeyID() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.keys[0].kid
+}
+
+// RotateKey は新しい署名鍵を作成して以降のトークンの署名に使用する
+// 以前の鍵はRetireKeysを呼ぶまでJWKSで公開し続けるため、発行済みのトークンは引き続き検証できる
+func (p *IdP) RotateKey() (string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate kid: %w", err)
+	}
+	kid := hex.EncodeToString(b)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = append([]signingKey{{kid: kid, key: key}}, p.keys...)
+	return kid, nil
+}
+
+// RetireKeys は署名に使用している鍵以外をJWKSから削除する
+func (p *IdP) RetireKeys() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = p.keys[:1]
+}
+
+// SetOutage はJWKS・ディスカバリー・イントロスペクションのエンドポイントが指定したステータスコードを返すようにする（0で復旧）
+func (p *IdP) SetOutage(status int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.outage = status
+}
+
+// SetLatency はJWKS・ディスカバリー・イントロスペクションのエンドポイントの応答を遅延させる（0で復旧）
+func (p *IdP) SetLatency(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.latency = d
+}
+
+// Mint は任意のクレームのトークンを署名に使用している鍵で発行する
+// iss・iat・expを省略した場合は発行者・現在時刻・DefaultTokenLifetime後を設定する
+// 値がnilのクレームは削除する（expやiatのないトークンを発行する場合に使用する）
+func (p *IdP) Mint(claims map[string]any) (string, error) {
+	p.mu.RLock()
+	key := p.keys[0]
+	issuer := p.issuer
+	p.mu.RUnlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims(withDefaults(claims, issuer)))
+	token.Header["kid"] = key.kid
+	signed, err := token.SignedString(key.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return signed, nil
+}
+
+// withDefaults はiss・iat・expのデフォルト値にクレームを上書きし、値がnilのクレームを削除する
+func withDefaults(claims map[string]any, issuer string) map[string]any {
+	now := time.Now()
+	c := map[string]any{
+		"iss": issuer,
+		"iat": now.Unix(),
+		"exp": now.Add(DefaultTokenLifetime).Unix(),
+	}
+	for k, v := range claims {
+		if v == nil {
+			delete(c, k)
+			continue
+		}
+		c[k] = v
+	}
+	return c
+}
+
+// MintOpaque は任意のクレームのopaqueトークンを発行する
+// クレームはイントロスペクションのレスポンスで返し、省略時の値と削除はMintと同じ
+func (p *IdP) MintOpaque(claims map[string]any) string {
+	token := rand.Text()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.opaque[token] = withDefaults(claims, p.issuer)
+	return token
+}
+
+// RevokeOpaque はopaqueトークンを失効させる（以降のイントロスペクションではactive=falseを返す）
+func (p *IdP) RevokeOpaque(token string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.opaque, token)
+}
+
+// Introspections はイントロスペクションエンドポイントへの問い合わせの回数を返す
+func (p *IdP) Introspections() int64 {
+	return p.introspections.Load()
+}
+
+// Handler はOIDCディスカバリー・JWKSと、トークンの発行・鍵のローテーション・障害の再現を操作するエンドポイントを返す
+//
+//	GET  /.well-known/openid-configuration
+//	GET  /.well-known/jwks.json
+//	POST /oauth/introspect  トークンイントロスペクション（IntrospectionClientIDのBasic認証が必要）
+//	POST /fakeidp/token     リクエストボディのJSONをクレームとしてトークンを発行する（?format=opaqueでopaqueトークン）
+//	POST /fakeidp/rotate    署名鍵をローテーションする
+//	POST /fakeidp/retire    署名に使用している鍵以外をJWKSから削除する
+//	POST /fakeidp/revoke    ?token=... でopaqueトークンを失効させる
+//	POST /fakeidp/outage    ?status=503 でJWKS・ディスカバリー・イントロスペクションを障害状態にする（status=0で復旧）
+//	POST /fakeidp/latency   ?duration=2s でJWKS・ディスカバリー・イントロスペクションの応答を遅延させる
+func (p *IdP) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /.well-known/openid-configuration", p.wellKnown(p.handleDiscovery))
+	mux.Handle("GET /.well-known/jwks.json", p.wellKnown(p.handleJWKS))
+	mux.Handle("POST /oauth/introspect", p.wellKnown(p.handleIntrospect))
+	mux.HandleFunc("POST /fakeidp/token", p.handleToken)
+	mux.HandleFunc("POST /fakeidp/rotate", p.handleRotate)
+	mux.HandleFunc("POST /fakeidp/revoke", func(w http.ResponseWriter, r *http.Request) {
+		p.RevokeOpaque(r.URL.Query().Get("token"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /fakeidp/retire", func(w http.ResponseWriter, r *http.Request) {
+		p.RetireKeys()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /fakeidp/outage", p.handleOutage)
+	mux.HandleFunc("POST /fakeidp/latency", p.handleLatency)
+	return mux
+}
+
+// wellKnown は設定された障害・遅延を再現してからハンドラーを実行する
+func (p *IdP) wellKnown(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.RLock()
+		outage, latency := p.outage, p.latency
+		p.mu.RUnlock()
+
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if outage != 0 {
+			http.Error(w, http.StatusText(outage), outage)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// handleDiscovery はOIDCディスカバリーのメタデータを返す
+func (p *IdP) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	issuer := p.Issuer()
+	writeJSON(w, map[string]any{
+		"issuer":                                issuer,
+		"jwks_uri":                              issuer + ".well-known/jwks.json",
+		"token_endpoint":                        issuer + "fakeidp/token",
+		"introspection_endpoint":                issuer + "oauth/introspect",
+		"response_types_supported":              []string{"code", "token", "id_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+// handleJWKS は公開している署名鍵の一覧を返す
+func (p *IdP) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	p.mu.RLock()
+	keys := make([]map[string]string, 0, len(p.keys))
+	for _, k := range p.keys {
+		keys = append(keys, map[string]string{
+			"kty": "RSA",
+			"kid": k.kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(k.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.key.E)).Bytes()),
+		})
+	}
+	p.mu.RUnlock()
+
+	writeJSON(w, map[string]any{"keys": keys})
+}
+
+// handleToken はリクエストボディのクレームでトークンを発行する
+func (p *IdP) handleToken(w http.ResponseWriter, r *http.Request) {
+	claims := make(map[string]any)
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&claims); err != nil {
+		http.Error(w, "invalid claims: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.URL.Query().Get("format") == "opaque" {
+		writeJSON(w, map[string]any{
+			"access_token": p.MintOpaque(claims),
+			"token_type":   "Bearer",
+		})
+		return
+	}
+	token, err := p.Mint(claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{
+		"access_token": token,
+		"token_type":   "Bearer",
+	})
+}
+
+// handleIntrospect はopaqueトークンのクレームを返す（RFC 7662）
+// 未知・失効済み・expを過ぎたトークンはactive=falseのみを返す
+func (p *IdP) handleIntrospect(w http.ResponseWriter, r *http.Request) {
+	p.introspections.Add(1)
+
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	}
+	if !ok || id != IntrospectionClientID || secret != IntrospectionClientSecret {
+		w.Header().Set("WWW-Authenticate", `Basic realm="fakeidp"`)
+		http.Error(w, "invalid client", http.StatusUnauthorized)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p.mu.RLock()
+	claims, ok := p.opaque[r.PostForm.Get("token")]
+	p.mu.RUnlock()
+	if !ok {
+		writeJSON(w, map[string]any{"active": false})
+		return
+	}
+	if exp, isNumber := unixTime(claims["exp"]); isNumber && time.Now().Unix() >= exp {
+		writeJSON(w, map[string]any{"active": false})
+		return
+	}
+
+	resp := maps.Clone(claims)
+	resp["active"] = true
+	writeJSON(w, resp)
+}
+
+// unixTime はクレームの数値（Goの整数またはJSONから読み込んだ浮動小数点数）をUNIX時刻として返す
+func unixTime(v any) (int64, bool) {
+	switch t := v.(type) {
+	case int64:
+		return t, true
+	case int:
+		return int64(t), true
+	case float64:
+		return int64(t), true
+	default:
+		return 0, false
+	}
+}
+
+// handleRotate は署名鍵をローテーションして新しいkidを返す
+func (p *IdP) handleRotate(w http.ResponseWriter, r *http.Request) {
+	kid, err := p.RotateKey()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "signing key rotated", slog.String("kid", kid))
+	writeJSON(w, map[string]string{"kid": kid})
+}
+
+// handleOutage はJWKS・ディスカバリーが返すステータスコードを設定する
+func (p *IdP) handleOutage(w http.ResponseWriter, r *http.Request) {
+	status, err := strconv.Atoi(r.URL.Query().Get("status"))
+	if err != nil || (status != 0 && (status < 400 || status > 599)) {
+		http.Error(w, "status must be 0 or an error status code", http.StatusBadRequest)
+		return
+	}
+	p.SetOutage(status)
+	slog.InfoContext(r.Context(), "outage configured", slog.Int("status", status))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleLatency はJWKS・ディスカバリーの応答の遅延を設定する
+func (p *IdP) handleLatency(w http.ResponseWriter, r *http.Request) {
+	d, err := time.ParseDuration(r.URL.Query().Get("duration"))
+	if err != nil || d < 0 {
+		http.Error(w, "duration must be a non-negative duration such as 2s", http.StatusBadRequest)
+		return
+	}
+	p.SetLatency(d)
+	slog.InfoContext(r.Context(), "latency configured", slog.Duration("latency", d))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeJSON はJSONのレスポンスを書き込む
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("failed to write response", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,384 @@
+package fakeidp
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testIssuer = "https://fakeidp.test/"
+
+// jwks はJWKSエンドポイントのレスポンス
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Alg string `json:"alg"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// fetchJWKS はハンドラーからJWKSを取得する
+func fetchJWKS(t *testing.T, h http.Handler) jwks {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("jwks status = %d", rec.Code)
+	}
+	var set jwks
+	if err := json.Unmarshal(rec.Body.Bytes(), &set); err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+// kids はJWKSで公開している鍵のkidを返す
+func (s jwks) kids() []string {
+	var kids []string
+	for _, k := range s.Keys {
+		kids = append(kids, k.Kid)
+	}
+	return kids
+}
+
+func TestRotateKey(t *testing.T) {
+	p, err := New(testIssuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := p.Handler()
+
+	old := p.KeyID()
+	oldToken, err := p.Mint(map[string]any{"sub": "auth0|alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kid, err := p.RotateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid == old || p.KeyID() != kid {
+		t.Fatalf("KeyID() = %q after rotating from %q to %q", p.KeyID(), old, kid)
+	}
+	newToken, err := p.Mint(map[string]any{"sub": "auth0|alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := headerKid(t, newToken); got != kid {
+		t.Errorf("kid of a token minted after rotation = %q, want %q", got, kid)
+	}
+
+	// ローテーション後も以前の鍵を公開し続け、発行済みのトークンを検証できる
+	set := fetchJWKS(t, h)
+	if got := set.kids(); len(got) != 2 || got[0] != kid || got[1] != old {
+		t.Fatalf("jwks kids = %v, want [%s %s]", got, kid, old)
+	}
+	for _, token := range []string{oldToken, newToken} {
+		if err := verify(t, set, token); err != nil {
+			t.Errorf("verify() error = %v", err)
+		}
+	}
+
+	// 退役させた鍵はJWKSから削除され、その鍵のトークンは検証できない
+	p.RetireKeys()
+	set = fetchJWKS(t, h)
+	if got := set.kids(); len(got) != 1 || got[0] != kid {
+		t.Fatalf("jwks kids after retire = %v, want [%s]", got, kid)
+	}
+	if err := verify(t, set, oldToken); err == nil {
+		t.Error("token signed with a retired key was verified")
+	}
+	if err := verify(t, set, newToken); err != nil {
+		t.Errorf("verify() error = %v", err)
+	}
+}
+
+// headerKid はトークンのヘッダーのkidを返す
+func headerKid(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+// verify はJWKSで公開している鍵でトークンを検証する
+func verify(t *testing.T, set jwks, token string) error {
+	t.Helper()
+	_, err := jwt.Parse(token, func(token *jwt.Token) (any, error) {
+		for _, k := range set.Keys {
+			if k.Kid != token.Header["kid"] {
+				continue
+			}
+			n, err := base64.RawURLEncoding.DecodeString(k.N)
+			if err != nil {
+				return nil, err
+			}
+			e, err := base64.RawURLEncoding.DecodeString(k.E)
+			if err != nil {
+				return nil, err
+			}
+			return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+		}
+		return nil, errors.New("kid is not published")
+	}, jwt.WithValidMethods([]string{"RS256"}))
+	return err
+}
+
+func TestMint(t *testing.T) {
+	p, err := New(testIssuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := fetchJWKS(t, p.Handler())
+
+	tests := []struct {
+		name   string
+		claims map[string]any
+		check  func(t *testing.T, claims jwt.MapClaims)
+	}{
+		{
+			name:   "defaults",
+			claims: map[string]any{"sub": "auth0|alice"},
+			check: func(t *testing.T, claims jwt.MapClaims) {
+				if claims["iss"] != testIssuer || claims["sub"] != "auth0|alice" {
+					t.Errorf("claims = %v", claims)
+				}
+				iat, _ := claims.GetIssuedAt()
+				exp, _ := claims.GetExpirationTime()
+				if iat == nil || exp == nil || exp.Sub(iat.Time) != DefaultTokenLifetime {
+					t.Errorf("iat = %v, exp = %v, want a lifetime of %v", iat, exp, DefaultTokenLifetime)
+				}
+			},
+		},
+		{
+			name:   "override defaults",
+			claims: map[string]any{"iss": "https://other.test/", "exp": time.Now().Add(time.Minute).Unix()},
+			check: func(t *testing.T, claims jwt.MapClaims) {
+				exp, _ := claims.GetExpirationTime()
+				if claims["iss"] != "https://other.test/" || exp == nil || time.Until(exp.Time) > time.Minute {
+					t.Errorf("claims = %v", claims)
+				}
+			},
+		},
+		{
+			name:   "nil removes a claim",
+			claims: map[string]any{"iat": nil, "exp": nil},
+			check: func(t *testing.T, claims jwt.MapClaims) {
+				if _, ok := claims["iat"]; ok {
+					t.Errorf("iat = %v, want none", claims["iat"])
+				}
+				if _, ok := claims["exp"]; ok {
+					t.Errorf("exp = %v, want none", claims["exp"])
+				}
+			},
+		},
+		{
+			// DPoPで送信者制約されたトークンは公開鍵のサムプリント（cnf.jkt）を含む
+			name:   "dpop-bound token",
+			claims: map[string]any{"sub": "auth0|alice", "cnf": map[string]any{"jkt": "0ZcOCORZNYy-DWpqq30jZyJGHTN0d2HglBV3uiguA4I"}},
+			check: func(t *testing.T, claims jwt.MapClaims) {
+				cnf, _ := claims["cnf"].(map[string]any)
+				if cnf["jkt"] != "0ZcOCORZNYy-DWpqq30jZyJGHTN0d2HglBV3uiguA4I" {
+					t.Errorf("cnf = %v", claims["cnf"])
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := p.Mint(tt.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := verify(t, set, token); err != nil {
+				t.Fatalf("verify() error = %v", err)
+			}
+			claims := jwt.MapClaims{}
+			if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, claims)
+		})
+	}
+}
+
+func TestHandleToken(t *testing.T) {
+	p, err := New(testIssuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := p.Handler()
+
+	tests := []struct {
+		name       string
+		query      string
+		body       string
+		wantStatus int
+		wantOpaque bool
+	}{
+		{name: "jwt", body: `{"sub":"auth0|alice","cnf":{"jkt":"thumbprint"}}`, wantStatus: http.StatusOK},
+		{name: "opaque", query: "?format=opaque", body: `{"sub":"auth0|alice","client_id":"partner"}`, wantStatus: http.StatusOK, wantOpaque: true},
+		{name: "invalid claims", body: `[`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/fakeidp/token"+tt.query, strings.NewReader(tt.body)))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				AccessToken string `json:"access_token"`
+				TokenType   string `json:"token_type"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.TokenType != "Bearer" || resp.AccessToken == "" {
+				t.Fatalf("response = %s", rec.Body)
+			}
+			if tt.wantOpaque {
+				if status, claims := introspect(t, h, IntrospectionClientID, IntrospectionClientSecret, resp.AccessToken); status != http.StatusOK || claims["active"] != true || claims["client_id"] != "partner" {
+					t.Errorf("introspection = %d %v", status, claims)
+				}
+				return
+			}
+			claims := jwt.MapClaims{}
+			if _, _, err := jwt.NewParser().ParseUnverified(resp.AccessToken, claims); err != nil {
+				t.Fatal(err)
+			}
+			if cnf, _ := claims["cnf"].(map[string]any); cnf["jkt"] != "thumbprint" || claims["iss"] != testIssuer {
+				t.Errorf("claims = %v", claims)
+			}
+		})
+	}
+}
+
+// introspect はクライアントの資格情報でイントロスペクションエンドポイントに問い合わせる
+func introspect(t *testing.T, h http.Handler, clientID, clientSecret, token string) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/oauth/introspect", strings.NewReader(url.Values{"token": {token}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		return rec.Code, nil
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &claims); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, claims
+}
+
+func TestHandleIntrospect(t *testing.T) {
+	p, err := New(testIssuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := p.Handler()
+
+	active := p.MintOpaque(map[string]any{"sub": "auth0|alice", "scope": "read"})
+	expired := p.MintOpaque(map[string]any{"sub": "auth0|alice", "exp": time.Now().Add(-time.Second).Unix()})
+	revoked := p.MintOpaque(map[string]any{"sub": "auth0|alice"})
+	p.RevokeOpaque(revoked)
+
+	tests := []struct {
+		name         string
+		clientID     string
+		clientSecret string
+		token        string
+		wantStatus   int
+		wantActive   bool
+	}{
+		{name: "active token", clientID: IntrospectionClientID, clientSecret: IntrospectionClientSecret, token: active, wantStatus: http.StatusOK, wantActive: true},
+		{name: "missing client credentials", token: active, wantStatus: http.StatusUnauthorized},
+		{name: "wrong client secret", clientID: IntrospectionClientID, clientSecret: "wrong", token: active, wantStatus: http.StatusUnauthorized},
+		{name: "unknown client", clientID: "other", clientSecret: IntrospectionClientSecret, token: active, wantStatus: http.StatusUnauthorized},
+		{name: "unknown token", clientID: IntrospectionClientID, clientSecret: IntrospectionClientSecret, token: "unknown", wantStatus: http.StatusOK},
+		{name: "expired token", clientID: IntrospectionClientID, clientSecret: IntrospectionClientSecret, token: expired, wantStatus: http.StatusOK},
+		{name: "revoked token", clientID: IntrospectionClientID, clientSecret: IntrospectionClientSecret, token: revoked, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, claims := introspect(t, h, tt.clientID, tt.clientSecret, tt.token)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if status != http.StatusOK {
+				return
+			}
+			if claims["active"] != tt.wantActive {
+				t.Fatalf("active = %v, want %v", claims["active"], tt.wantActive)
+			}
+			if !tt.wantActive {
+				// 無効なトークンはactive以外のクレームを返さない
+				if len(claims) != 1 {
+					t.Errorf("claims = %v, want only active", claims)
+				}
+				return
+			}
+			if claims["sub"] != "auth0|alice" || claims["scope"] != "read" || claims["iss"] != testIssuer {
+				t.Errorf("claims = %v", claims)
+			}
+		})
+	}
+
+	if got := p.Introspections(); got != int64(len(tests)) {
+		t.Errorf("Introspections() = %d, want %d", got, len(tests))
+	}
+}
+
+func TestOutage(t *testing.T) {
+	p, err := New(testIssuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := p.Handler()
+
+	post := func(target string) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, nil))
+		return rec.Code
+	}
+	if got := post("/fakeidp/outage?status=200"); got != http.StatusBadRequest {
+		t.Errorf("outage status=200: status = %d, want %d", got, http.StatusBadRequest)
+	}
+	if got := post("/fakeidp/outage?status=503"); got != http.StatusNoContent {
+		t.Fatalf("outage status = %d", got)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("jwks status during outage = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	if got := post("/fakeidp/outage?status=0"); got != http.StatusNoContent {
+		t.Fatalf("recover status = %d", got)
+	}
+	fetchJWKS(t, h)
+}
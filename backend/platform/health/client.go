@@ -0,0 +1,36 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"connectrpc.com/connect"
+	healthv1 "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// checkProcedure はgRPCヘルスチェックプロトコルのCheckプロシージャ
+const checkProcedure = "/grpc.health.v1.Health/Check"
+
+// ErrNotServing は下流サービスがNOT_SERVINGを返したことを表す
+var ErrNotServing = errors.New("service is not serving")
+
+// Downstream は下流サービスのgRPCヘルスチェックを呼び出すCheckFuncを返す
+func Downstream(httpClient connect.HTTPClient, baseURL string, options ...connect.ClientOption) CheckFunc {
+	client := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+		httpClient,
+		strings.TrimRight(baseURL, "/")+checkProcedure,
+		options...,
+	)
+	return func(ctx context.Context) error {
+		resp, err := client.CallUnary(ctx, connect.NewRequest(&healthv1.HealthCheckRequest{}))
+		if err != nil {
+			return err
+		}
+		if status := resp.Msg.GetStatus(); status != healthv1.HealthCheckResponse_SERVING {
+			return fmt.Errorf("%w: %s", ErrNotServing, status)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,178 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/grpchealth"
+)
+
+const (
+	// defaultCheckTimeout は各チェックのタイムアウト
+	defaultCheckTimeout = 2 * time.Second
+
+	// defaultCacheTTL はレディネスチェックの結果を再利用する期間
+	// 問い合わせのたびに依存先へのチェックが発生しないようにする
+	defaultCacheTTL = time.Second
+)
+
+// Status はチェックの結果
+type Status string
+
+const (
+	StatusOK   Status = "ok"
+	StatusFail Status = "fail"
+)
+
+// CheckFunc は依存先の状態を確認する関数。問題がある場合はエラーを返す
+type CheckFunc func(ctx context.Context) error
+
+// Result は1つのチェックの結果
+type Result struct {
+	Status   Status `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report はレディネスチェックの結果
+type Report struct {
+	Status Status            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker はサービスの依存先の状態を確認し、ライブネス・レディネス・gRPCヘルスチェックに応答する
+type Checker struct {
+	services []string
+	timeout  time.Duration
+	cacheTTL time.Duration
+	checks   []check
+
+	// mu は直近の結果を保護し、チェックの同時実行を防ぐ
+	mu       sync.Mutex
+	last     *Report
+	lastTime time.Time
+}
+
+// NewChecker は新しいCheckerを作成する
+// servicesはgRPCヘルスチェックで応答するサービス名（例: "identity.v1.UserService"）
+func NewChecker(services ...string) *Checker {
+	return &Checker{
+		services: services,
+		timeout:  defaultCheckTimeout,
+		cacheTTL: defaultCacheTTL,
+	}
+}
+
+// Add は依存先のチェックを追加する
+func (c *Checker) Add(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// Run は全てのチェックを並行に実行する
+func (c *Checker) Run(ctx context.Context) *Report {
+	report := &Report{
+		Status: StatusOK,
+		Checks: make(map[string]Result, len(c.checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, ch := range c.checks {
+		wg.Go(func() {
+			ctx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := ch.fn(ctx)
+			result := Result{Status: StatusOK, Duration: time.Since(start).String()}
+			if err != nil {
+				result.Status = StatusFail
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[ch.name] = result
+			if err != nil {
+				report.Status = StatusFail
+			}
+		})
+	}
+	wg.Wait()
+
+	return report
+}
+
+// Report は直近の結果がcacheTTL以内であればそれを返し、そうでなければ全てのチェックを実行する
+// 同時に呼び出された場合もチェックは1回だけ実行し、呼び出し元の切断で結果が失敗にならないようキャンセルは引き継がない
+func (c *Checker) Report(ctx context.Context) *Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last != nil && time.Since(c.lastTime) < c.cacheTTL {
+		return c.last
+	}
+	c.last = c.Run(context.WithoutCancel(ctx))
+	c.lastTime = time.Now()
+	return c.last
+}
+
+// LivenessHandler はプロセスが応答できることのみを返すハンドラー
+// 依存先の障害で再起動されないよう、依存先のチェックは行わない
+func (c *Checker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte(`{"status":"ok"}`))
+	})
+}
+
+// ReadinessHandler は依存先のチェックを実行し、チェックごとの詳細を返すハンドラー
+// いずれかのチェックが失敗した場合は503を返す
+// エラーの詳細を含むため管理ポートにのみ登録すること
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Report(r.Context())
+
+		status := http.StatusOK
+		if report.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+			slog.WarnContext(r.Context(), "readiness check failed", slog.Any("checks", report.Checks))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
+
+// Ensure Checker implements grpchealth.Checker
+var _ grpchealth.Checker = (*Checker)(nil)
+
+// Check はgRPCヘルスチェックプロトコル（grpc.health.v1）の問い合わせに応答する
+// 公開ポートに登録するため、依存先のチェックは行わずプロセスが応答できることのみを返す
+// （問い合わせのたびに依存先へのチェックが増幅されないようにする）
+// 依存先を含む状態は管理ポートのReadinessHandlerで確認する
+func (c *Checker) Check(_ context.Context, req *grpchealth.CheckRequest) (*grpchealth.CheckResponse, error) {
+	if req.Service != "" && !slices.Contains(c.services, req.Service) {
+		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("unknown service: %s", req.Service))
+	}
+	return &grpchealth.CheckResponse{Status: grpchealth.StatusServing}, nil
+}
+
+// NewHandler はライブネスのみを返すgRPCヘルスチェックプロトコルのConnectハンドラーを返す
+func (c *Checker) NewHandler(options ...connect.HandlerOption) (string, http.Handler) {
+	return grpchealth.NewHandler(c, options...)
+}
@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// RedactHandler は属性の分類に従ってPIIと秘密情報を削除またはハッシュ化するslog.Handler
+// メッセージと全ての文字列値からBearer・DPoPスキームのトークンとJWTを削除する
+type RedactHandler struct {
+	slog.Handler
+	redactor *Redactor
+}
+
+// NewRedactHandler は新しいRedactHandlerを作成する
+func NewRedactHandler(h slog.Handler, redactor *Redactor) *RedactHandler {
+	return &RedactHandler{Handler: h, redactor: redactor}
+}
+
+// Handle は属性を変換してログを出力する
+func (h *RedactHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, Scrub(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(h.attr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, out)
+}
+
+// WithAttrs は属性を変換してから追加したRedactHandlerを返す
+func (h *RedactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redactedAttrs := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redactedAttrs[i] = h.attr(a)
+	}
+	return &RedactHandler{Handler: h.Handler.WithAttrs(redactedAttrs), redactor: h.redactor}
+}
+
+// WithGroup はグループを追加したRedactHandlerを返す
+func (h *RedactHandler) WithGroup(name string) slog.Handler {
+	return &RedactHandler{Handler: h.Handler.WithGroup(name), redactor: h.redactor}
+}
+
+// attr は属性を分類に従って変換する
+func (h *RedactHandler) attr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+
+	if v.Kind() == slog.KindGroup {
+		group := v.Group()
+		redactedGroup := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			redactedGroup[i] = h.attr(ga)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redactedGroup...)}
+	}
+
+	class := h.redactor.Classify(a.Key)
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, h.redactor.Value(class, v.String()))
+	case slog.KindAny:
+		// エラーや任意の値は文字列化してトークンが含まれていないかを確認する
+		s := fmt.Sprint(v.Any())
+		if class != ClassSafe {
+			return slog.String(a.Key, h.redactor.Value(class, s))
+		}
+		if scrubbed := Scrub(s); scrubbed != s {
+			return slog.String(a.Key, scrubbed)
+		}
+		return slog.Attr{Key: a.Key, Value: v}
+	default:
+		if class == ClassSecret {
+			return slog.String(a.Key, redacted)
+		}
+		return slog.Attr{Key: a.Key, Value: v}
+	}
+}
@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedactHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		log    func(l *slog.Logger)
+		secret string
+	}{
+		{
+			name:   "token in message",
+			log:    func(l *slog.Logger) { l.Info("rejected Bearer " + testOpaque) },
+			secret: testOpaque,
+		},
+		{
+			name:   "token in string attribute",
+			log:    func(l *slog.Logger) { l.Info("rejected", slog.String("detail", "DPoP "+testOpaque)) },
+			secret: testOpaque,
+		},
+		{
+			name:   "token in error attribute",
+			log:    func(l *slog.Logger) { l.Info("rejected", slog.Any("error", fmt.Errorf("verify %s: expired", testJWT))) },
+			secret: testJWT,
+		},
+		{
+			name: "token in group attribute",
+			log: func(l *slog.Logger) {
+				l.Info("rejected", slog.Group("request", slog.String("header", "Bearer "+testJWT)))
+			},
+			secret: testJWT,
+		},
+		{
+			name:   "token in WithAttrs attribute",
+			log:    func(l *slog.Logger) { l.With(slog.String("body", "token="+testOpaque)).Info("introspection failed") },
+			secret: testOpaque,
+		},
+		{
+			name:   "secret key",
+			log:    func(l *slog.Logger) { l.Info("request", slog.String("Authorization", testOpaque)) },
+			secret: testOpaque,
+		},
+		{
+			name:   "secret key in WithGroup",
+			log:    func(l *slog.Logger) { l.WithGroup("headers").With(slog.String("cookie", testOpaque)).Info("request") },
+			secret: testOpaque,
+		},
+		{
+			name:   "PII",
+			log:    func(l *slog.Logger) { l.Info("request", slog.String("email", "user@example.com")) },
+			secret: "user@example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redactor, err := NewRedactor(ModeRedact, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			tt.log(slog.New(NewRedactHandler(slog.NewJSONHandler(&buf, nil), redactor)))
+
+			out := buf.String()
+			if strings.Contains(out, tt.secret) {
+				t.Errorf("output contains %q: %s", tt.secret, out)
+			}
+			if !strings.Contains(out, redacted) {
+				t.Errorf("output is not redacted: %s", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package logging
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Class はログに出力する項目の分類
+type Class int
+
+const (
+	// ClassSafe はそのまま出力してよい項目
+	ClassSafe Class = iota
+	// ClassPII は個人を識別できる項目（メールアドレス、IPアドレス、ユーザーIDなど）
+	ClassPII
+	// ClassSecret は漏洩すると認証を突破される項目（トークン、Cookie、パスワードなど）。常に削除する
+	ClassSecret
+)
+
+// Mode はPIIの出力方法
+type Mode string
+
+const (
+	// ModeHash はHMAC-SHA256のハッシュに置き換える（同じ値同士は突き合わせできる）
+	ModeHash Mode = "hash"
+	// ModeRedact は削除する
+	ModeRedact Mode = "redact"
+	// ModeKeep はそのまま出力する（ローカル開発用）
+	ModeKeep Mode = "keep"
+)
+
+// redacted は削除した値の代わりに出力する文字列
+const redacted = "[REDACTED]"
+
+// defaultClasses は属性キーごとの分類（キーは小文字）
+var defaultClasses = map[string]Class{
+	"authorization": ClassSecret,
+	"cookie":        ClassSecret,
+	"set-cookie":    ClassSecret,
+	"token":         ClassSecret,
+	"access_token":  ClassSecret,
+	"id_token":      ClassSecret,
+	"refresh_token": ClassSecret,
+	"password":      ClassSecret,
+	"secret":        ClassSecret,
+	"client_secret": ClassSecret,
+
+	"email":         ClassPII,
+	"client_ip":     ClassPII,
+	"ip":            ClassPII,
+	"remote_addr":   ClassPII,
+	"user_agent":    ClassPII,
+	"subject":       ClassPII,
+	"sub":           ClassPII,
+	"auth0_user_id": ClassPII,
+}
+
+// tokenPattern はキーに関係なく値に含まれるBearer・DPoPスキームのトークン（opaqueトークンを含む）とJWTを検出する
+// DPoPは"DPoP proof"のような文中の単語を削除しないよう、16文字以上の値のみをトークンとみなす
+var tokenPattern = regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9\-._~+/]+=*|\bdpop\s+[A-Za-z0-9\-._~+/]{16,}=*|eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+
+// tokenParamPattern はクエリ文字列やフォーム（イントロスペクションのリクエストなど）に含まれるトークンの値を検出する
+var tokenParamPattern = regexp.MustCompile(`(?i)\b((?:access_|refresh_|id_)?token)=[^&\s"']+`)
+
+// Redactor は分類に従ってログに出力する値を削除またはハッシュ化する
+type Redactor struct {
+	piiMode Mode
+	hashKey []byte
+	classes map[string]Class
+}
+
+// NewRedactor は新しいRedactorを作成する
+// hashKeyはModeHashで使用するHMACの鍵で、サービス間でハッシュを突き合わせる場合は同じ鍵を設定する
+func NewRedactor(piiMode Mode, hashKey []byte) (*Redactor, error) {
+	switch piiMode {
+	case ModeHash, ModeRedact, ModeKeep:
+	default:
+		return nil, fmt.Errorf("unknown PII mode: %q", piiMode)
+	}
+	if piiMode == ModeHash && len(hashKey) == 0 {
+		return nil, fmt.Errorf("hash key is required for PII mode %q", piiMode)
+	}
+	return &Redactor{
+		piiMode: piiMode,
+		hashKey: hashKey,
+		classes: defaultClasses,
+	}, nil
+}
+
+// Classify は属性キーの分類を返す
+func (r *Redactor) Classify(key string) Class {
+	return r.classes[strings.ToLower(key)]
+}
+
+// Value は分類に従って出力する値を返す
+func (r *Redactor) Value(class Class, v string) string {
+	switch class {
+	case ClassSecret:
+		return redacted
+	case ClassPII:
+		return r.PII(v)
+	default:
+		return Scrub(v)
+	}
+}
+
+// PII はPIIの値を設定された方法で出力用に変換する
+func (r *Redactor) PII(v string) string {
+	if v == "" {
+		return ""
+	}
+	switch r.piiMode {
+	case ModeKeep:
+		return Scrub(v)
+	case ModeHash:
+		return r.Hash(v)
+	default:
+		return redacted
+	}
+}
+
+// Hash は値のHMAC-SHA256ハッシュ（先頭16桁）を返す
+func (r *Redactor) Hash(v string) string {
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write([]byte(v))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// Scrub は値に含まれるBearer・DPoPスキームのトークン、token=の値とJWTを削除する
+// 分類されていないキーやエラーメッセージにトークンが紛れ込んだ場合でも出力しないための最終防衛線
+func Scrub(v string) string {
+	lower := strings.ToLower(v)
+	if !strings.Contains(v, "eyJ") && !strings.Contains(lower, "bearer") && !strings.Contains(lower, "dpop") && !strings.Contains(lower, "token=") {
+		return v
+	}
+	v = tokenPattern.ReplaceAllString(v, redacted)
+	return tokenParamPattern.ReplaceAllString(v, "${1}="+redacted)
+}
@@ -0,0 +1,188 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kakke18/platform-security-poc/backend/platform/requestid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ecsVersion は出力するElastic Common Schemaのバージョン
+const ecsVersion = "8.11.0"
+
+// Category はセキュリティイベントの分類（ECSのevent.category）
+type Category string
+
+const (
+	// CategoryAuthentication は認証に関するイベント
+	CategoryAuthentication Category = "authentication"
+	// CategoryAPI はAPIへのアクセス制御に関するイベント
+	CategoryAPI Category = "api"
+	// CategoryConfiguration は外部から取り込む設定（JWKSなど）に関するイベント
+	CategoryConfiguration Category = "configuration"
+)
+
+// セキュリティイベントの種類（ECSのevent.action）
+const (
+	// ActionJWTVerification はアクセストークンの検証
+	ActionJWTVerification = "jwt-verification"
+	// ActionAuthorization はプロシージャ・テナントへのアクセスの認可
+	ActionAuthorization = "authorization"
+	// ActionJWKSKeyRejection はJWKSの鍵の取り込みの拒否
+	ActionJWKSKeyRejection = "jwks-key-rejection"
+)
+
+// SecurityEvent は認証失敗や認可での拒否など、監査対象のセキュリティイベント
+type SecurityEvent struct {
+	// Category はイベントの分類
+	Category Category
+
+	// Action はイベントの種類
+	Action string
+
+	// Reason は失敗・拒否の理由
+	Reason string
+
+	// Subject は対象ユーザーのAuth0ユーザーID（PIIとして扱う）
+	Subject string
+
+	// SourceIP はクライアントのIPアドレス（PIIとして扱う）
+	SourceIP string
+
+	// Path はリクエストのパスまたはプロシージャ
+	Path string
+}
+
+// ecsEvent はSecurityEventをElastic Common Schema形式で出力するための構造
+type ecsEvent struct {
+	Timestamp string      `json:"@timestamp"`
+	ECS       ecsVersions `json:"ecs"`
+	Service   ecsService  `json:"service"`
+	Event     ecsDetail   `json:"event"`
+	User      *ecsID      `json:"user,omitempty"`
+	Source    *ecsSource  `json:"source,omitempty"`
+	URL       *ecsURL     `json:"url,omitempty"`
+	HTTP      *ecsHTTP    `json:"http,omitempty"`
+	Trace     *ecsID      `json:"trace,omitempty"`
+}
+
+type ecsVersions struct {
+	Version string `json:"version"`
+}
+
+type ecsService struct {
+	Name string `json:"name"`
+}
+
+type ecsDetail struct {
+	Kind     string   `json:"kind"`
+	Category []string `json:"category"`
+	Type     []string `json:"type"`
+	Action   string   `json:"action"`
+	Outcome  string   `json:"outcome"`
+	Reason   string   `json:"reason,omitempty"`
+}
+
+type ecsID struct {
+	ID string `json:"id"`
+}
+
+type ecsSource struct {
+	// Address はハッシュ化した値もそのまま格納できるようにsource.ipではなくsource.addressを使用する
+	Address string `json:"address"`
+}
+
+type ecsURL struct {
+	Path string `json:"path"`
+}
+
+type ecsHTTP struct {
+	Request ecsID `json:"request"`
+}
+
+// SecurityLogger はセキュリティイベントを通常のログとは別のストリームにECS形式のJSONで出力する
+type SecurityLogger struct {
+	service  string
+	redactor *Redactor
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewSecurityLogger は新しいSecurityLoggerを作成する
+func NewSecurityLogger(w io.Writer, service string, redactor *Redactor) *SecurityLogger {
+	return &SecurityLogger{
+		service:  service,
+		redactor: redactor,
+		enc:      json.NewEncoder(w),
+	}
+}
+
+// Emit はセキュリティイベントを出力する
+// SubjectとSourceIPはPIIとして設定に従って削除またはハッシュ化する
+func (l *SecurityLogger) Emit(ctx context.Context, e SecurityEvent) {
+	out := ecsEvent{
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		ECS:       ecsVersions{Version: ecsVersion},
+		Service:   ecsService{Name: l.service},
+		Event: ecsDetail{
+			Kind:     "event",
+			Category: []string{string(e.Category)},
+			Type:     []string{eventType(e.Category)},
+			Action:   e.Action,
+			Outcome:  "failure",
+			Reason:   Scrub(e.Reason),
+		},
+	}
+	if e.Subject != "" {
+		out.User = &ecsID{ID: l.redactor.PII(e.Subject)}
+	}
+	if e.SourceIP != "" {
+		out.Source = &ecsSource{Address: l.redactor.PII(e.SourceIP)}
+	}
+	if e.Path != "" {
+		out.URL = &ecsURL{Path: Scrub(e.Path)}
+	}
+	if id, ok := requestid.FromContext(ctx); ok {
+		out.HTTP = &ecsHTTP{Request: ecsID{ID: id}}
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		out.Trace = &ecsID{ID: sc.TraceID().String()}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.enc.Encode(out); err != nil {
+		slog.ErrorContext(ctx, "failed to write security event", slog.String("error", err.Error()))
+	}
+}
+
+// eventType はイベントの分類に対応するECSのevent.typeを返す
+func eventType(c Category) string {
+	if c == CategoryAuthentication {
+		return "start"
+	}
+	return "denied"
+}
+
+// defaultSecurityLogger はEmitSecurityEventで使用するSecurityLogger
+var defaultSecurityLogger atomic.Pointer[SecurityLogger]
+
+// SetDefaultSecurityLogger はEmitSecurityEventで使用するSecurityLoggerを設定する
+func SetDefaultSecurityLogger(l *SecurityLogger) {
+	defaultSecurityLogger.Store(l)
+}
+
+// EmitSecurityEvent はデフォルトのSecurityLoggerにセキュリティイベントを出力する
+// SecurityLoggerが設定されていない場合は何もしない
+func EmitSecurityEvent(ctx context.Context, e SecurityEvent) {
+	if l := defaultSecurityLogger.Load(); l != nil {
+		l.Emit(ctx, e)
+	}
+}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSecurityLoggerEmit(t *testing.T) {
+	tests := []struct {
+		name   string
+		event  SecurityEvent
+		secret string
+	}{
+		{
+			name:   "bearer token in reason",
+			event:  SecurityEvent{Reason: "invalid token: Bearer " + testOpaque},
+			secret: testOpaque,
+		},
+		{
+			name:   "DPoP token in reason",
+			event:  SecurityEvent{Reason: "scheme mismatch: DPoP " + testOpaque},
+			secret: testOpaque,
+		},
+		{
+			name:   "jwt in reason",
+			event:  SecurityEvent{Reason: "expired: " + testJWT},
+			secret: testJWT,
+		},
+		{
+			name:   "token in path",
+			event:  SecurityEvent{Path: "/fakeidp/revoke?token=" + testOpaque},
+			secret: testOpaque,
+		},
+		{
+			name:   "subject",
+			event:  SecurityEvent{Subject: "auth0|secret-subject"},
+			secret: "auth0|secret-subject",
+		},
+		{
+			name:   "source IP",
+			event:  SecurityEvent{SourceIP: "203.0.113.7"},
+			secret: "203.0.113.7",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redactor, err := NewRedactor(ModeHash, []byte("key"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			tt.event.Category = CategoryAuthentication
+			tt.event.Action = ActionJWTVerification
+			NewSecurityLogger(&buf, "test", redactor).Emit(context.Background(), tt.event)
+
+			var out ecsEvent
+			if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+				t.Fatalf("invalid ECS event: %v: %s", err, buf.String())
+			}
+			if out.Event.Action != ActionJWTVerification || out.Service.Name != "test" {
+				t.Errorf("unexpected event: %s", buf.String())
+			}
+			if strings.Contains(buf.String(), tt.secret) {
+				t.Errorf("output contains %q: %s", tt.secret, buf.String())
+			}
+		})
+	}
+}
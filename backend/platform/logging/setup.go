@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/kakke18/platform-security-poc/backend/platform/requestid"
+)
+
+// Config はログ出力の設定
+type Config struct {
+	// PIIMode はPIIの出力方法
+	PIIMode Mode `yaml:"pii_mode" env:"LOG_PII_MODE" usage:"PIIの出力方法（hash・redact・keep）"`
+
+	// HashKey はPIIをハッシュ化するHMACの鍵
+	// 未設定の場合はプロセスごとにランダムな鍵を生成する（サービス間・再起動をまたいで突き合わせできない）
+	HashKey string `yaml:"hash_key" env:"LOG_HASH_KEY" secret:"true" usage:"PIIをハッシュ化するHMACの鍵"`
+
+	// SecurityLogFile はセキュリティイベントの出力先ファイル（未設定の場合は標準出力）
+	SecurityLogFile string `yaml:"security_log_file" env:"SECURITY_LOG_FILE" usage:"セキュリティイベントの出力先ファイル"`
+}
+
+// DefaultConfig はログ出力のデフォルト設定を返す
+func DefaultConfig() Config {
+	return Config{PIIMode: ModeHash}
+}
+
+// Validate は設定の妥当性を検証する
+func (c Config) Validate() error {
+	switch c.PIIMode {
+	case ModeHash, ModeRedact, ModeKeep:
+		return nil
+	default:
+		return fmt.Errorf("unknown PII mode: %q", c.PIIMode)
+	}
+}
+
+// Setup はPIIを削除・ハッシュ化するデフォルトのロガーとセキュリティイベントの出力先を設定する
+// 全てのログにはリクエストIDとトレースIDを付与する
+// 戻り値のcloseはサーバー停止時に呼び出す
+func Setup(service string, cfg Config) (close func() error, err error) {
+	hashKey := []byte(cfg.HashKey)
+	if len(hashKey) == 0 {
+		hashKey = make([]byte, 32)
+		_, _ = rand.Read(hashKey)
+	}
+
+	redactor, err := NewRedactor(cfg.PIIMode, hashKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOG_PII_MODE: %w", err)
+	}
+
+	var securityOut io.Writer = os.Stdout
+	close = func() error { return nil }
+	if cfg.SecurityLogFile != "" {
+		f, err := os.OpenFile(cfg.SecurityLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open security log file: %w", err)
+		}
+		securityOut = f
+		close = f.Close
+	}
+
+	slog.SetDefault(slog.New(requestid.NewLogHandler(NewRedactHandler(slog.NewTextHandler(os.Stderr, nil), redactor))))
+	SetDefaultSecurityLogger(NewSecurityLogger(securityOut, service, redactor))
+
+	return close, nil
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// serverRequests はサーバーで処理したRPC数
+	serverRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_server_requests_total",
+		Help: "Number of RPCs handled, by procedure and Connect code.",
+	}, []string{"procedure", "code"})
+
+	// serverDuration はサーバーでのRPCの処理時間
+	serverDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rpc_server_duration_seconds",
+		Help:    "Latency of RPCs handled, by procedure and Connect code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"procedure", "code"})
+
+	// clientRequests はバックエンドサービスへのRPC数
+	clientRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_client_requests_total",
+		Help: "Number of RPCs sent to backend services, by procedure and Connect code.",
+	}, []string{"procedure", "code"})
+
+	// clientDuration はバックエンドサービスへのRPCの所要時間
+	clientDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rpc_client_duration_seconds",
+		Help:    "Latency of RPCs sent to backend services, by procedure and Connect code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"procedure", "code"})
+)
+
+// Interceptor はRPCの件数と所要時間をプロシージャとConnectのエラーコードごとに記録するConnectインターセプター
+// ハンドラーとクライアントのどちらにも使用できる
+type Interceptor struct{}
+
+// NewInterceptor は新しいInterceptorを作成する
+func NewInterceptor() *Interceptor {
+	return &Interceptor{}
+}
+
+// Ensure Interceptor implements connect.Interceptor
+var _ connect.Interceptor = (*Interceptor)(nil)
+
+// WrapUnary はUnary RPCの件数と所要時間を記録する
+func (i *Interceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		start := time.Now()
+		resp, err := next(ctx, req)
+		observe(req.Spec(), start, err)
+		return resp, err
+	}
+}
+
+// WrapStreamingClient はクライアント側のストリームをそのまま返す
+func (i *Interceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler はStreaming RPCの件数と所要時間を記録する
+func (i *Interceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		start := time.Now()
+		err := next(ctx, conn)
+		observe(conn.Spec(), start, err)
+		return err
+	}
+}
+
+// observe はRPCの結果をメトリクスに記録する
+func observe(spec connect.Spec, start time.Time, err error) {
+	code := "ok"
+	if err != nil {
+		code = connect.CodeOf(err).String()
+	}
+
+	requests, duration := serverRequests, serverDuration
+	if spec.IsClient {
+		requests, duration = clientRequests, clientDuration
+	}
+	requests.WithLabelValues(spec.Procedure, code).Inc()
+	duration.WithLabelValues(spec.Procedure, code).Observe(time.Since(start).Seconds())
+}
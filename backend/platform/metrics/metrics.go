@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// 認可で拒否した理由（authz_denials_totalのreasonラベル）
+const (
+	// ReasonUnauthenticated は検証済みのPrincipalが存在しない
+	ReasonUnauthenticated = "unauthenticated"
+	// ReasonRouteDenied はルーティングテーブルで内部専用とされたプロシージャへのアクセス
+	ReasonRouteDenied = "route_denied"
+	// ReasonMissingScope はルートが必要とするスコープが不足している
+	ReasonMissingScope = "missing_scope"
+	// ReasonNotWorkspaceMember はワークスペースに所属していない
+	ReasonNotWorkspaceMember = "not_workspace_member"
+	// ReasonNotTenantMember は選択されたテナントに所属していない
+	ReasonNotTenantMember = "not_tenant_member"
+	// ReasonStepUpRequired はルートが必要とする認証の強度または鮮度を満たしていない
+	ReasonStepUpRequired = "step_up_required"
+	// ReasonIPNotAllowed はクライアントIPがルートの許可リストに含まれていない
+	ReasonIPNotAllowed = "ip_not_allowed"
+)
+
+var (
+	// authzDenials は認可で拒否したリクエスト数
+	authzDenials = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "authz_denials_total",
+		Help: "Number of requests denied by authorization checks.",
+	}, []string{"reason"})
+
+	// backendRequestDuration はリバースプロキシからバックエンドへのリクエストの所要時間
+	backendRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "backend_request_duration_seconds",
+		Help:    "Latency of HTTP requests forwarded to backend services.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"backend", "method", "code"})
+
+	// rateLimited はレート制限で拒否したリクエスト数
+	rateLimited = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "rate_limited_requests_total",
+		Help: "Number of requests rejected by per-client rate limiting.",
+	})
+)
+
+// Handler はPrometheus形式でメトリクスを公開するハンドラーを返す
+// 公開ポートではなく管理ポートに登録すること
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RecordAuthzDenial は認可で拒否したリクエストを記録する
+func RecordAuthzDenial(reason string) {
+	authzDenials.WithLabelValues(reason).Inc()
+}
+
+// RecordRateLimited はレート制限で拒否したリクエストを記録する
+func RecordRateLimited() {
+	rateLimited.Inc()
+}
+
+// Transport はバックエンドへのリクエストの所要時間を記録するhttp.RoundTripperを返す
+func Transport(backend string, base http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := base.RoundTrip(r)
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+		backendRequestDuration.WithLabelValues(backend, methodLabel(r.Method), code).Observe(time.Since(start).Seconds())
+		return resp, err
+	})
+}
+
+// methodLabel はmethodラベルの値を返す
+// クライアントが任意のメソッドでラベルの種類を増やせないよう、GETとPOST以外はotherにまとめる
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodPost:
+		return method
+	default:
+		return "other"
+	}
+}
+
+// roundTripperFunc は関数をhttp.RoundTripperとして扱うアダプター
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip はfを呼び出す
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/kakke18/platform-security-poc/backend/platform/clientip"
+)
+
+// AccessLog はHTTPリクエストをメソッド、パス、ステータス、時間、クライアント情報と共にログ出力する
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// ステータスコードを取得するためにレスポンスライターをラップ
+		wrapped := NewResponseWriter(w)
+
+		// リクエストを処理
+		next.ServeHTTP(wrapped, r)
+
+		// 処理時間を計算
+		duration := time.Since(start)
+
+		// 信頼するプロキシを考慮して解決済みのクライアントIPを取得
+		clientIP := clientip.String(r.Context())
+		if clientIP == "" {
+			clientIP, _, _ = net.SplitHostPort(r.RemoteAddr)
+		}
+
+		// アクセスログを出力
+		slog.InfoContext(r.Context(), "access",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", wrapped.StatusCode()),
+			slog.Duration("duration", duration),
+			slog.String("client_ip", clientIP),
+			slog.String("user_agent", r.UserAgent()),
+			slog.Int64("bytes", wrapped.Written()),
+		)
+	})
+}
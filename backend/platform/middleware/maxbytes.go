@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// MaxBytes はリクエストボディのサイズを制限するミドルウェアを返す
+// Content-Lengthが上限を超える場合は読み込まずに413を返し、それ以外は上限を超えた時点で読み込みをエラーにする
+// nが0以下の場合は制限しない
+func MaxBytes(n int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		if n <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				http.Error(w, "Request entity too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxBytes(t *testing.T) {
+	const limit = 16
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		wantStatus    int
+		wantReadError bool
+	}{
+		{name: "within the limit", body: strings.Repeat("a", limit), contentLength: limit, wantStatus: http.StatusOK},
+		{name: "Content-Length over the limit", body: strings.Repeat("a", limit+1), contentLength: limit + 1, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "streamed body within the limit", body: strings.Repeat("a", limit), contentLength: -1, wantStatus: http.StatusOK},
+		{name: "streamed body over the limit", body: strings.Repeat("a", limit+1), contentLength: -1, wantStatus: http.StatusOK, wantReadError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			var readErr error
+			handler := MaxBytes(limit)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				_, readErr = io.ReadAll(r.Body)
+			}))
+
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.ContentLength = tt.contentLength
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusRequestEntityTooLarge {
+				if called {
+					t.Error("handler was called for an oversized Content-Length")
+				}
+				return
+			}
+			var maxBytesErr *http.MaxBytesError
+			if got := errors.As(readErr, &maxBytesErr); got != tt.wantReadError {
+				t.Errorf("read error = %v, want MaxBytesError: %v", readErr, tt.wantReadError)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// Middleware はhttp.Handlerをラップするミドルウェア
+type Middleware func(http.Handler) http.Handler
+
+// Chain はミドルウェアをhandlerに適用する
+// 先頭のミドルウェアが最も外側でリクエストを受け取る
+func Chain(handler http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
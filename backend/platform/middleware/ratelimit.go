@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/kakke18/platform-security-poc/backend/platform/clientip"
+	"github.com/kakke18/platform-security-poc/backend/platform/metrics"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// limiterIdleTTL は使われなくなったクライアントのリミッターを破棄するまでの期間
+	limiterIdleTTL = 10 * time.Minute
+
+	// maxLimiters は保持するクライアントごとのリミッターの数の上限
+	maxLimiters = 100000
+
+	// ipv6PrefixBits はIPv6のクライアントをまとめるプレフィックス長
+	// 1つのサイトに割り当てられる/64の中ではアドレスを自由に変えられるため、/64を1つのクライアントとして扱う
+	ipv6PrefixBits = 64
+)
+
+// RateLimiter はクライアントIPごとにトークンバケットでリクエスト数を制限する
+// 設定の再読み込みではSetLimitで上限のみを差し替え、クライアントごとの残りのトークンを維持する
+type RateLimiter struct {
+	limiters *limiters
+}
+
+// NewRateLimiter は新しいRateLimiterを作成する。rpsが0以下の場合は制限しない
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		limiters: newLimiters(rate.Limit(rps), burst, maxLimiters),
+	}
+}
+
+// SetLimit は上限を差し替える（保持しているクライアントのリミッターにも適用する）
+func (l *RateLimiter) SetLimit(rps float64, burst int) {
+	l.limiters.setLimit(rate.Limit(rps), burst, time.Now())
+}
+
+// Middleware は上限を超えたリクエストに429を返すミドルウェア
+// クライアントIPはclientip.Middlewareで解決した値を使用するため、その後に配置する
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, ok := clientip.FromContext(r.Context())
+		if !ok {
+			addrPort, _ := netip.ParseAddrPort(r.RemoteAddr)
+			addr = addrPort.Addr()
+		}
+		if !l.limiters.allow(clientKey(addr), time.Now()) {
+			metrics.RecordRateLimited()
+			slog.WarnContext(r.Context(), "rate limit exceeded", slog.String("path", r.URL.Path))
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientKey はクライアントのアドレスからリミッターのキーを返す（IPv6は/64、IPv4はアドレスそのもの）
+func clientKey(addr netip.Addr) netip.Prefix {
+	addr = addr.Unmap()
+	if addr.Is6() {
+		prefix, _ := addr.Prefix(ipv6PrefixBits)
+		return prefix
+	}
+	prefix, _ := addr.Prefix(addr.BitLen())
+	return prefix
+}
+
+// limiterEntry はクライアントごとのリミッター
+type limiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// limiters はクライアントごとのリミッターを保持する
+type limiters struct {
+	size int
+
+	mu sync.Mutex
+	// rps・burstは再読み込みで差し替える上限（0以下のrpsは制限しない）
+	rps       rate.Limit
+	burst     int
+	entries   map[netip.Prefix]*limiterEntry
+	lastSweep time.Time
+	// overflow は上限に達した後の新しいクライアントが共有するリミッター
+	overflow *rate.Limiter
+}
+
+// newLimiters は最大size個のクライアントのリミッターを保持するlimitersを作成する
+func newLimiters(rps rate.Limit, burst, size int) *limiters {
+	return &limiters{
+		rps:      rps,
+		burst:    burst,
+		size:     size,
+		entries:  make(map[netip.Prefix]*limiterEntry),
+		overflow: rate.NewLimiter(rps, burst),
+	}
+}
+
+// allow はクライアントのリクエストを許可するかどうかを返す
+// リミッターの数が上限に達している場合、新しいクライアントは共有のリミッターで制限する
+// （既存のクライアントのリミッターを破棄すると、多数のアドレスから送信してリミッターを初期化できるため）
+func (l *limiters) allow(key netip.Prefix, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rps <= 0 {
+		return true
+	}
+
+	// 一定期間ごとに使われなくなったリミッターを破棄する
+	if now.Sub(l.lastSweep) > limiterIdleTTL {
+		l.sweep(now)
+	}
+
+	e, ok := l.entries[key]
+	if !ok {
+		// 上限に達した場合は破棄できるリミッターを探す（全件の走査は1秒に1回まで）
+		if len(l.entries) >= l.size && now.Sub(l.lastSweep) > time.Second {
+			l.sweep(now)
+		}
+		if len(l.entries) >= l.size {
+			return l.overflow.AllowN(now, 1)
+		}
+		e = &limiterEntry{limiter: rate.NewLimiter(l.rps, l.burst)}
+		l.entries[key] = e
+	}
+	e.lastSeen = now
+	return e.limiter.AllowN(now, 1)
+}
+
+// setLimit は上限を差し替え、保持しているリミッターに適用する
+// 残りのトークンは維持するため、再読み込みで上限までリセットされない
+func (l *limiters) setLimit(rps rate.Limit, burst int, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rps = rps
+	l.burst = burst
+	for _, e := range l.entries {
+		e.limiter.SetLimitAt(now, rps)
+		e.limiter.SetBurstAt(now, burst)
+	}
+	l.overflow.SetLimitAt(now, rps)
+	l.overflow.SetBurstAt(now, burst)
+}
+
+// sweep は使われなくなったリミッターを破棄する（l.muを保持して呼び出す）
+func (l *limiters) sweep(now time.Time) {
+	for k, e := range l.entries {
+		if now.Sub(e.lastSeen) > limiterIdleTTL {
+			delete(l.entries, k)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestClientKey(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{addr: "192.0.2.1", want: "192.0.2.1/32"},
+		{addr: "::ffff:192.0.2.1", want: "192.0.2.1/32"},
+		{addr: "2001:db8:1:2:3:4:5:6", want: "2001:db8:1:2::/64"},
+		{addr: "2001:db8:1:2:ffff::1", want: "2001:db8:1:2::/64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := clientKey(netip.MustParseAddr(tt.addr)); got.String() != tt.want {
+				t.Errorf("clientKey(%s) = %s, want %s", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitersAllow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	key := func(s string) netip.Prefix { return clientKey(netip.MustParseAddr(s)) }
+	type request struct {
+		addr string
+		at   time.Duration
+		want bool
+	}
+	tests := []struct {
+		name     string
+		requests []request
+	}{
+		{name: "addresses in the same /64 share a limiter", requests: []request{
+			{addr: "2001:db8::1", want: true},
+			{addr: "2001:db8::2", want: false},
+			{addr: "2001:db8:0:1::1", want: true},
+		}},
+		{name: "new clients share the overflow limiter when full", requests: []request{
+			{addr: "192.0.2.1", want: true},
+			{addr: "192.0.2.2", want: true},
+			{addr: "192.0.2.3", want: true},
+			{addr: "192.0.2.4", want: false},
+			{addr: "192.0.2.1", at: time.Second, want: true},
+		}},
+		{name: "idle limiters are swept when full", requests: []request{
+			{addr: "192.0.2.1", want: true},
+			{addr: "192.0.2.2", want: true},
+			{addr: "192.0.2.3", at: limiterIdleTTL + 2*time.Second, want: true},
+			{addr: "192.0.2.4", at: limiterIdleTTL + 2*time.Second, want: true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLimiters(1, 1, 2)
+			l.lastSweep = now
+			for i, r := range tt.requests {
+				if got := l.allow(key(r.addr), now.Add(r.at)); got != r.want {
+					t.Errorf("request %d from %s = %v, want %v", i, r.addr, got, r.want)
+				}
+			}
+			if len(l.entries) > l.size {
+				t.Errorf("%d limiters, want at most %d", len(l.entries), l.size)
+			}
+		})
+	}
+}
+
+func TestLimitersSetLimit(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	key := clientKey(netip.MustParseAddr("192.0.2.1"))
+	l := newLimiters(1, 2, 10)
+	l.lastSweep = now
+
+	// バーストを使い切った状態は上限の差し替え後も維持する
+	for i, want := range []bool{true, true, false} {
+		if got := l.allow(key, now); got != want {
+			t.Fatalf("request %d = %v, want %v", i, got, want)
+		}
+	}
+	l.setLimit(10, 5, now)
+	if l.allow(key, now) {
+		t.Error("exhausted client was reset by setLimit")
+	}
+	// 差し替えた上限でトークンが補充される
+	if !l.allow(key, now.Add(100*time.Millisecond)) {
+		t.Error("token was not refilled at the new rate")
+	}
+
+	// 0以下のrpsは制限しない
+	l.setLimit(0, 0, now)
+	for i := range 10 {
+		if !l.allow(key, now) {
+			t.Fatalf("request %d was limited with the limit disabled", i)
+		}
+	}
+}
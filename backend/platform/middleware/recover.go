@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"connectrpc.com/connect"
+)
+
+// Recover はハンドラーのpanicを回復してログに記録し、500を返すミドルウェア
+// レスポンスを書き込み済みの場合は接続を切断する
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wrapped := NewResponseWriter(w)
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// net/httpが意図的な中断に使用するpanicはそのまま伝える
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			slog.ErrorContext(r.Context(), "panic recovered",
+				slog.String("path", r.URL.Path),
+				slog.Any("panic", v),
+				slog.String("stack", string(debug.Stack())),
+			)
+
+			if wrapped.WroteHeader() {
+				// 途中まで書き込んだレスポンスを正常終了として扱わせない
+				panic(http.ErrAbortHandler)
+			}
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(wrapped, r)
+	})
+}
+
+// RecoverInterceptor はConnectハンドラーのpanicを回復してログに記録し、Internalエラーを返すConnectインターセプター
+type RecoverInterceptor struct{}
+
+// NewRecoverInterceptor は新しいRecoverInterceptorを作成する
+func NewRecoverInterceptor() *RecoverInterceptor {
+	return &RecoverInterceptor{}
+}
+
+// Ensure RecoverInterceptor implements connect.Interceptor
+var _ connect.Interceptor = (*RecoverInterceptor)(nil)
+
+// WrapUnary はUnary RPCのハンドラーのpanicを回復する
+func (i *RecoverInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (resp connect.AnyResponse, err error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		defer func() {
+			if v := recover(); v != nil {
+				err = recovered(ctx, req.Spec(), v)
+			}
+		}()
+		return next(ctx, req)
+	}
+}
+
+// WrapStreamingClient はクライアント側のストリームをそのまま返す
+func (i *RecoverInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler はStreaming RPCのハンドラーのpanicを回復する
+func (i *RecoverInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) (err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				err = recovered(ctx, conn.Spec(), v)
+			}
+		}()
+		return next(ctx, conn)
+	}
+}
+
+// recovered はpanicをログに記録し、クライアントに返すエラーに変換する
+// panicの内容は内部情報を含む可能性があるためクライアントには返さない
+func recovered(ctx context.Context, spec connect.Spec, v any) error {
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+	slog.ErrorContext(ctx, "panic recovered",
+		slog.String("procedure", spec.Procedure),
+		slog.String("panic", fmt.Sprint(v)),
+		slog.String("stack", string(debug.Stack())),
+	)
+	return connect.NewError(connect.CodeInternal, errors.New("internal error"))
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// ResponseWriter はステータスコードと書き込みバイト数を記録するためにhttp.ResponseWriterをラップする
+// http.Flusherとhttp.Hijackerを元のResponseWriterに委譲し、ストリーミングRPCやリバースプロキシでも使用できる
+type ResponseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	written     int64
+	wroteHeader bool
+}
+
+// NewResponseWriter は新しいResponseWriterを作成する
+func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	return &ResponseWriter{
+		ResponseWriter: w,
+		statusCode:     http.StatusOK,
+	}
+}
+
+// Ensure ResponseWriter implements optional interfaces
+var (
+	_ http.Flusher  = (*ResponseWriter)(nil)
+	_ http.Hijacker = (*ResponseWriter)(nil)
+)
+
+// StatusCode はレスポンスのステータスコードを返す
+func (rw *ResponseWriter) StatusCode() int {
+	return rw.statusCode
+}
+
+// Written はレスポンスボディの書き込みバイト数を返す
+func (rw *ResponseWriter) Written() int64 {
+	return rw.written
+}
+
+// WroteHeader はレスポンスヘッダーを書き込み済みかを返す
+func (rw *ResponseWriter) WroteHeader() bool {
+	return rw.wroteHeader
+}
+
+// WriteHeader はステータスコードを記録して書き込む
+func (rw *ResponseWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.statusCode = code
+		// 1xxの情報レスポンスは最終的なステータスではない
+		rw.wroteHeader = code >= http.StatusOK
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// Write は書き込みバイト数を記録して書き込む
+func (rw *ResponseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.written += int64(n)
+	return n, err
+}
+
+// Flush はバッファされたデータをクライアントに送信する
+func (rw *ResponseWriter) Flush() {
+	rw.wroteHeader = true
+	_ = http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// Hijack は元のResponseWriterがサポートしている場合に接続を引き渡す
+func (rw *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
+
+// Unwrap はhttp.ResponseControllerのために元のResponseWriterを返す
+func (rw *ResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SecurityHeadersConfig はブラウザ向けのセキュリティヘッダーの設定
+type SecurityHeadersConfig struct {
+	// HSTSMaxAge はStrict-Transport-Securityのmax-age（0の場合は付与しない）
+	// ブラウザはHTTPSのレスポンスでのみ有効にする
+	HSTSMaxAge time.Duration `yaml:"hsts_max_age" env:"HSTS_MAX_AGE" usage:"Strict-Transport-Securityのmax-age（0で無効）"`
+
+	// HSTSIncludeSubdomains はサブドメインにもHSTSを適用するかどうか
+	HSTSIncludeSubdomains bool `yaml:"hsts_include_subdomains" env:"HSTS_INCLUDE_SUBDOMAINS" usage:"サブドメインにもHSTSを適用する"`
+
+	// HSTSPreload はHSTSプリロードリストへの登録を許可するかどうか
+	HSTSPreload bool `yaml:"hsts_preload" env:"HSTS_PRELOAD" usage:"HSTSプリロードリストへの登録を許可する"`
+
+	// FrameOptions はX-Frame-Options（空の場合は付与しない）
+	FrameOptions string `yaml:"frame_options" env:"FRAME_OPTIONS" usage:"X-Frame-Options"`
+
+	// ReferrerPolicy はReferrer-Policy（空の場合は付与しない）
+	ReferrerPolicy string `yaml:"referrer_policy" env:"REFERRER_POLICY" usage:"Referrer-Policy"`
+
+	// ContentSecurityPolicy はHTMLのレスポンスに付与するContent-Security-Policy（空の場合は付与しない）
+	ContentSecurityPolicy string `yaml:"content_security_policy" env:"CONTENT_SECURITY_POLICY" usage:"HTMLのレスポンスに付与するContent-Security-Policy"`
+}
+
+// DefaultSecurityHeadersConfig はセキュリティヘッダーのデフォルト設定を返す
+// APIレスポンスはHTMLとして解釈・埋め込みさせず、エラーページなどのHTMLからはリソースを読み込ませない
+func DefaultSecurityHeadersConfig() SecurityHeadersConfig {
+	return SecurityHeadersConfig{
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		FrameOptions:          "DENY",
+		ReferrerPolicy:        "no-referrer",
+		ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'",
+	}
+}
+
+// Validate は設定の妥当性を検証する
+func (c SecurityHeadersConfig) Validate() error {
+	if c.HSTSMaxAge < 0 {
+		return fmt.Errorf("hsts_max_age must be non-negative: %s", c.HSTSMaxAge)
+	}
+	if c.HSTSPreload && (c.HSTSMaxAge < 365*24*time.Hour || !c.HSTSIncludeSubdomains) {
+		return fmt.Errorf("hsts_preload requires hsts_max_age of at least 1 year and hsts_include_subdomains")
+	}
+	return nil
+}
+
+// hsts はStrict-Transport-Securityの値を返す
+func (c SecurityHeadersConfig) hsts() string {
+	if c.HSTSMaxAge <= 0 {
+		return ""
+	}
+	v := fmt.Sprintf("max-age=%d", int64(c.HSTSMaxAge.Seconds()))
+	if c.HSTSIncludeSubdomains {
+		v += "; includeSubDomains"
+	}
+	if c.HSTSPreload {
+		v += "; preload"
+	}
+	return v
+}
+
+// SecurityHeaders はブラウザ向けのセキュリティヘッダーをレスポンスに付与するミドルウェアを返す
+// 認証情報（AuthorizationヘッダーまたはCookie）を含むリクエストへのレスポンスはキャッシュさせない
+func SecurityHeaders(cfg SecurityHeadersConfig) Middleware {
+	hsts := cfg.hsts()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("X-Content-Type-Options", "nosniff")
+			if hsts != "" {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+			if cfg.FrameOptions != "" {
+				h.Set("X-Frame-Options", cfg.FrameOptions)
+			}
+			if cfg.ReferrerPolicy != "" {
+				h.Set("Referrer-Policy", cfg.ReferrerPolicy)
+			}
+			if r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" {
+				h.Set("Cache-Control", "no-store")
+			}
+			if cfg.ContentSecurityPolicy != "" {
+				w = &cspWriter{ResponseWriter: w, policy: cfg.ContentSecurityPolicy}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// cspWriter はContent-TypeがHTMLのレスポンスにContent-Security-Policyを付与する
+type cspWriter struct {
+	http.ResponseWriter
+	policy      string
+	wroteHeader bool
+}
+
+// WriteHeader はContent-Typeに応じてContent-Security-Policyを付与してから書き込む
+func (w *cspWriter) WriteHeader(code int) {
+	if !w.wroteHeader && code >= http.StatusOK {
+		w.wroteHeader = true
+		h := w.Header()
+		if strings.HasPrefix(strings.ToLower(h.Get("Content-Type")), "text/html") {
+			h.Set("Content-Security-Policy", w.policy)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write はヘッダーが未送信の場合にWriteHeaderを経由して書き込む
+func (w *cspWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush はバッファされたデータをクライアントに送信する
+func (w *cspWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap はhttp.ResponseControllerのために元のResponseWriterを返す
+func (w *cspWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Timeout はリクエストのcontextにデッドラインを設定するミドルウェアを返す
+// http.TimeoutHandlerと異なりレスポンスをバッファしないため、ストリーミングRPCやリバースプロキシでも使用できる
+// クライアントがより短いデッドライン（Connect-Timeout-Msなど）を指定した場合はそちらが優先される
+func Timeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		if d <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
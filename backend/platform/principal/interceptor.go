@@ -0,0 +1,104 @@
+package principal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"connectrpc.com/connect"
+	"github.com/kakke18/platform-security-poc/backend/platform/clientip"
+	"github.com/kakke18/platform-security-poc/backend/platform/logging"
+	"github.com/kakke18/platform-security-poc/backend/platform/metrics"
+)
+
+// Requirement はハンドラーが必要とするPrincipalの条件を表す
+type Requirement func(p *Principal) bool
+
+// RequireSubject はAuth0ユーザーIDが存在することを要求する
+func RequireSubject(p *Principal) bool {
+	return p.Subject != ""
+}
+
+// RequireWorkspaceUser はワークスペースユーザーIDが存在することを要求する
+func RequireWorkspaceUser(p *Principal) bool {
+	return p.WorkspaceUserID != ""
+}
+
+// NewUnauthenticatedError は認証情報が存在しない場合のConnectエラーを返す
+func NewUnauthenticatedError() *connect.Error {
+	return connect.NewError(connect.CodeUnauthenticated, errors.New("unauthenticated"))
+}
+
+// Interceptor は検証済みヘッダーを一度だけ解析してPrincipalをcontext.Contextに格納するConnectインターセプター
+type Interceptor struct {
+	require Requirement
+}
+
+// NewInterceptor は新しいInterceptorを作成する
+// requireを満たさないリクエストはUnauthenticatedエラーで拒否する
+func NewInterceptor(require Requirement) *Interceptor {
+	return &Interceptor{
+		require: require,
+	}
+}
+
+// Ensure Interceptor implements connect.Interceptor
+var _ connect.Interceptor = (*Interceptor)(nil)
+
+// WrapUnary はUnary RPCのハンドラーにPrincipalを渡す
+func (i *Interceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+
+		ctx, err := i.authenticate(ctx, req.Spec(), req.Peer(), req.Header())
+		if err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+// WrapStreamingClient はクライアント側のストリームをそのまま返す
+func (i *Interceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler はStreaming RPCのハンドラーにPrincipalを渡す
+func (i *Interceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		ctx, err := i.authenticate(ctx, conn.Spec(), conn.Peer(), conn.RequestHeader())
+		if err != nil {
+			return err
+		}
+		return next(ctx, conn)
+	}
+}
+
+// authenticate はPrincipalを取得して要件を検証する
+// 前段のミドルウェアでcontextに格納済みの場合はそれを優先し、なければヘッダーから復元する
+// 要件を満たさない場合はセキュリティイベントとして記録する
+func (i *Interceptor) authenticate(ctx context.Context, spec connect.Spec, peer connect.Peer, h http.Header) (context.Context, error) {
+	p, ok := FromContext(ctx)
+	if !ok {
+		p = FromHeader(h)
+	}
+	if !i.require(p) {
+		metrics.RecordAuthzDenial(metrics.ReasonUnauthenticated)
+		sourceIP := clientip.String(ctx)
+		if sourceIP == "" {
+			sourceIP = peer.Addr
+		}
+		logging.EmitSecurityEvent(ctx, logging.SecurityEvent{
+			Category: logging.CategoryAPI,
+			Action:   logging.ActionAuthorization,
+			Reason:   metrics.ReasonUnauthenticated,
+			Subject:  p.Subject,
+			SourceIP: sourceIP,
+			Path:     spec.Procedure,
+		})
+		return ctx, NewUnauthenticatedError()
+	}
+	return NewContext(ctx, p), nil
+}
@@ -0,0 +1,143 @@
+package principal
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kakke18/platform-security-poc/backend/platform/tenantctx"
+)
+
+const (
+	// HeaderSubject はGatewayで検証済みのAuth0ユーザーID (sub claim) を伝えるヘッダー
+	HeaderSubject = "X-Auth0-User-ID"
+
+	// HeaderWorkspaceID はGatewayで検証済みのワークスペースIDを伝えるヘッダー
+	HeaderWorkspaceID = "X-Workspace-ID"
+
+	// HeaderWorkspaceUserID はGatewayで検証済みのワークスペースユーザーIDを伝えるヘッダー
+	HeaderWorkspaceUserID = "X-Workspace-User-ID"
+
+	// HeaderPrivileged は特権ユーザーかどうかを伝えるヘッダー
+	HeaderPrivileged = "X-Privileged"
+
+	// HeaderScopes はアクセストークンに付与されたスコープをスペース区切りで伝えるヘッダー
+	HeaderScopes = "X-Scopes"
+)
+
+// Principal は認証済みのリクエスト主体を表す
+type Principal struct {
+	// Subject はAuth0ユーザーID (sub claim)
+	Subject string
+
+	// WorkspaceID はワークスペースID（解決済みの場合のみ）
+	WorkspaceID string
+
+	// WorkspaceUserID はワークスペースユーザーID（解決済みの場合のみ）
+	WorkspaceUserID string
+
+	// Tenant は選択中のテナントのコンテキスト（テナント選択時のみ）
+	Tenant *tenantctx.Context
+
+	// Privileged は特権ユーザーかどうか
+	Privileged bool
+
+	// Scopes はアクセストークンに付与されたスコープ
+	Scopes []string
+
+	// ACR はユーザーの認証のコンテキストクラス (acr claim)
+	// ACR・AMR・AuthTimeはGatewayでのステップアップ認証の判定にのみ使用し、下流サービスには伝えない
+	ACR string
+
+	// AMR はユーザーの認証に使用した方式 (amr claim)
+	AMR []string
+
+	// AuthTime はユーザーが認証した時刻 (auth_time claim、存在しない場合はゼロ値)
+	AuthTime time.Time
+}
+
+// HasScope は指定されたスコープを持っているかを返す
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// NewContext はPrincipalを保持したcontext.Contextを返す
+// テナントが選択されている場合はテナントコンテキストも合わせて格納する
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	if p.Tenant != nil {
+		ctx = tenantctx.NewContext(ctx, p.Tenant)
+	}
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext はcontext.ContextからPrincipalを取得する
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// MustFrom はcontext.ContextからPrincipalを取得する
+// Interceptorを通過したハンドラー内でのみ使用し、Principalが存在しない場合はpanicする
+func MustFrom(ctx context.Context) *Principal {
+	p, ok := FromContext(ctx)
+	if !ok {
+		panic("principal: no principal in context")
+	}
+	return p
+}
+
+// FromHeader はGatewayが付与した検証済みヘッダーからPrincipalを復元する
+func FromHeader(h http.Header) *Principal {
+	p := &Principal{
+		Subject:         h.Get(HeaderSubject),
+		WorkspaceID:     h.Get(HeaderWorkspaceID),
+		WorkspaceUserID: h.Get(HeaderWorkspaceUserID),
+		Scopes:          strings.Fields(h.Get(HeaderScopes)),
+	}
+	p.Privileged, _ = strconv.ParseBool(h.Get(HeaderPrivileged))
+	if tc, ok := tenantctx.FromHeader(h); ok {
+		p.Tenant = tc
+	}
+	return p
+}
+
+// SetHeader はPrincipalを下流サービス向けのヘッダーに設定する
+// 値が空のフィールドはヘッダーを設定しない
+func (p *Principal) SetHeader(h http.Header) {
+	setIfNotEmpty(h, HeaderSubject, p.Subject)
+	setIfNotEmpty(h, HeaderWorkspaceID, p.WorkspaceID)
+	setIfNotEmpty(h, HeaderWorkspaceUserID, p.WorkspaceUserID)
+	setIfNotEmpty(h, HeaderScopes, strings.Join(p.Scopes, " "))
+	if p.Privileged {
+		h.Set(HeaderPrivileged, "true")
+	}
+	if p.Tenant != nil {
+		tenantctx.SetHeader(h, p.Tenant)
+	}
+}
+
+// DelHeader はGatewayのみが設定できる検証済みヘッダーを全て削除する
+// クライアントが偽装したヘッダーを下流サービスに転送しないために使用する
+func DelHeader(h http.Header) {
+	h.Del(HeaderSubject)
+	h.Del(HeaderWorkspaceID)
+	h.Del(HeaderWorkspaceUserID)
+	h.Del(HeaderPrivileged)
+	h.Del(HeaderScopes)
+	tenantctx.DelVerifiedHeader(h)
+}
+
+func setIfNotEmpty(h http.Header, key, value string) {
+	if value != "" {
+		h.Set(key, value)
+	}
+}
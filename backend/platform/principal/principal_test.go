@@ -0,0 +1,135 @@
+package principal
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/kakke18/platform-security-poc/backend/platform/tenantctx"
+)
+
+func TestHeaderRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		p    *Principal
+	}{
+		{name: "subject only", p: &Principal{Subject: "auth0|alice", Scopes: []string{}}},
+		{name: "workspace user", p: &Principal{
+			Subject:         "auth0|alice",
+			WorkspaceID:     "ws-1",
+			WorkspaceUserID: "wu-1",
+			Scopes:          []string{"read:me", "write:me"},
+		}},
+		{name: "privileged user with a tenant", p: &Principal{
+			Subject:         "auth0|admin",
+			WorkspaceID:     "ws-1",
+			WorkspaceUserID: "wu-2",
+			Privileged:      true,
+			Scopes:          []string{"admin"},
+			Tenant: &tenantctx.Context{
+				TenantID:     "tenant-1",
+				TenantUserID: "tu-1",
+				Role:         tenantctx.RoleAdmin,
+			},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			tt.p.SetHeader(h)
+			if got := FromHeader(h); !reflect.DeepEqual(got, tt.p) {
+				t.Errorf("FromHeader(SetHeader(p)) = %+v, want %+v", got, tt.p)
+			}
+		})
+	}
+}
+
+func TestFromHeaderPrivileged(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{value: "", want: false},
+		{value: "true", want: true},
+		{value: "false", want: false},
+		{value: "yes", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			h := http.Header{}
+			h.Set(HeaderPrivileged, tt.value)
+			if got := FromHeader(h).Privileged; got != tt.want {
+				t.Errorf("Privileged = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDelHeader(t *testing.T) {
+	h := http.Header{}
+	(&Principal{
+		Subject:         "auth0|alice",
+		WorkspaceID:     "ws-1",
+		WorkspaceUserID: "wu-1",
+		Privileged:      true,
+		Scopes:          []string{"read:me"},
+		Tenant:          &tenantctx.Context{TenantID: "tenant-1", TenantUserID: "tu-1", Role: tenantctx.RoleAdmin},
+	}).SetHeader(h)
+	h.Set("Content-Type", "application/proto")
+
+	DelHeader(h)
+
+	for _, key := range []string{HeaderSubject, HeaderWorkspaceID, HeaderWorkspaceUserID, HeaderPrivileged, HeaderScopes, tenantctx.HeaderTenantUserID, tenantctx.HeaderTenantRole} {
+		if v := h.Values(key); len(v) != 0 {
+			t.Errorf("%s = %q after DelHeader, want removed", key, v)
+		}
+	}
+	if h.Get("Content-Type") == "" {
+		t.Error("DelHeader removed an unrelated header")
+	}
+}
+
+func TestInterceptor(t *testing.T) {
+	tests := []struct {
+		name     string
+		require  Requirement
+		header   *Principal
+		wantCode connect.Code
+	}{
+		{name: "subject present", require: RequireSubject, header: &Principal{Subject: "auth0|alice"}},
+		{name: "subject missing", require: RequireSubject, header: &Principal{}, wantCode: connect.CodeUnauthenticated},
+		{name: "workspace user present", require: RequireWorkspaceUser, header: &Principal{Subject: "auth0|alice", WorkspaceUserID: "wu-1"}},
+		{name: "workspace user missing", require: RequireWorkspaceUser, header: &Principal{Subject: "auth0|alice"}, wantCode: connect.CodeUnauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *Principal
+			handler := NewInterceptor(tt.require).WrapUnary(func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+				got = MustFrom(ctx)
+				return nil, nil
+			})
+
+			req := connect.NewRequest(&struct{}{})
+			tt.header.SetHeader(req.Header())
+			_, err := handler(context.Background(), req)
+
+			if tt.wantCode != 0 {
+				if connect.CodeOf(err) != tt.wantCode {
+					t.Fatalf("error = %v, want code %v", err, tt.wantCode)
+				}
+				if got != nil {
+					t.Error("handler was called for a rejected request")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if got == nil || got.Subject != tt.header.Subject || got.WorkspaceUserID != tt.header.WorkspaceUserID {
+				t.Errorf("principal = %+v, want %+v", got, tt.header)
+			}
+		})
+	}
+}
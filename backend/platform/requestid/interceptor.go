@@ -0,0 +1,42 @@
+package requestid
+
+import (
+	"context"
+
+	"connectrpc.com/connect"
+)
+
+// ClientInterceptor はcontextのリクエストIDを下流サービスへのリクエストに付与するConnectインターセプター
+type ClientInterceptor struct{}
+
+// NewClientInterceptor は新しいClientInterceptorを作成する
+func NewClientInterceptor() *ClientInterceptor {
+	return &ClientInterceptor{}
+}
+
+// Ensure ClientInterceptor implements connect.Interceptor
+var _ connect.Interceptor = (*ClientInterceptor)(nil)
+
+// WrapUnary はUnary RPCのリクエストヘッダーにリクエストIDを設定する
+func (i *ClientInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			SetHeader(ctx, req.Header())
+		}
+		return next(ctx, req)
+	}
+}
+
+// WrapStreamingClient はストリーミングRPCのリクエストヘッダーにリクエストIDを設定する
+func (i *ClientInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		conn := next(ctx, spec)
+		SetHeader(ctx, conn.RequestHeader())
+		return conn
+	}
+}
+
+// WrapStreamingHandler はハンドラー側のストリームをそのまま返す
+func (i *ClientInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
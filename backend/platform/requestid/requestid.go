@@ -0,0 +1,77 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+const (
+	// HeaderRequestID はリクエストIDを伝えるヘッダー
+	HeaderRequestID = "X-Request-ID"
+
+	// maxRequestIDLength は受け入れるリクエストIDの最大長
+	maxRequestIDLength = 128
+)
+
+type requestIDKey struct{}
+
+// NewContext はリクエストIDを保持したcontext.Contextを返す
+func NewContext(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// FromContext はcontext.ContextからリクエストIDを取得する
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+// SetHeader はcontextのリクエストIDを下流サービス向けのヘッダーに設定する
+// traceparentの伝播はOpenTelemetryのプロパゲーターが行う
+func SetHeader(ctx context.Context, h http.Header) {
+	if id, ok := FromContext(ctx); ok {
+		h.Set(HeaderRequestID, id)
+	}
+}
+
+// Middleware はリクエストIDを受け入れるか生成してcontextに格納し、
+// レスポンスヘッダーでリクエストIDを返す
+// 下流サービスへ転送されるようにリクエストヘッダーも更新する
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(HeaderRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		ctx := NewContext(r.Context(), id)
+		SetHeader(ctx, r.Header)
+		w.Header().Set(HeaderRequestID, id)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID はクライアントから受け取ったリクエストIDをログに含めても安全かを返す
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID は新しいリクエストIDを生成する
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
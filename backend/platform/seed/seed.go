@@ -0,0 +1,237 @@
+// Package seed はローカル環境・統合テスト用のリポジトリの初期データ（シードデータ）を読み込む
+// ワークスペース・ユーザー・テナント・テナントへの所属を1つのYAMLファイルで記述し、サービス間の参照を検証する
+package seed
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultData はSEED_FILEを指定しない場合に使用するシードデータ
+//
+//go:embed default.yaml
+var defaultData []byte
+
+// Roles はテナント内で指定できるロール
+var Roles = []string{"admin", "member", "viewer"}
+
+// Data はシードデータ
+type Data struct {
+	// Workspaces はワークスペース（Identity API）
+	Workspaces []Workspace `yaml:"workspaces"`
+
+	// Users はワークスペースに所属するユーザー（Identity API）
+	Users []User `yaml:"users"`
+
+	// Tenants はテナント（User API）
+	Tenants []Tenant `yaml:"tenants"`
+
+	// Memberships はユーザーのテナントへの所属（User API）
+	Memberships []Membership `yaml:"memberships"`
+}
+
+// Workspace はワークスペース
+type Workspace struct {
+	ID        string    `yaml:"id"`
+	Name      string    `yaml:"name"`
+	CreatedAt time.Time `yaml:"created_at"`
+}
+
+// User はワークスペースに所属するユーザー
+// Identity APIのユーザーとワークスペースユーザーの両方をこの定義から作成する
+type User struct {
+	// ID はユーザーID（例: llu_001）
+	ID string `yaml:"id"`
+
+	// WorkspaceUserID はワークスペースユーザーID（例: wsu-001）
+	WorkspaceUserID string `yaml:"workspace_user_id"`
+
+	// Auth0UserID はAuth0のsubject claim
+	Auth0UserID string `yaml:"auth0_user_id"`
+
+	// WorkspaceID は所属するワークスペースID
+	WorkspaceID string `yaml:"workspace_id"`
+
+	Email string `yaml:"email"`
+	Name  string `yaml:"name"`
+
+	// Privileged は特権ユーザー（ワークスペース管理者）かどうか
+	Privileged bool `yaml:"privileged"`
+
+	// IdPConnectionID はAuth0のSSO Connection ID（特権ユーザーには指定できない）
+	IdPConnectionID string `yaml:"idp_connection_id"`
+
+	CreatedAt time.Time `yaml:"created_at"`
+}
+
+// Tenant はテナント
+type Tenant struct {
+	ID          string    `yaml:"id"`
+	WorkspaceID string    `yaml:"workspace_id"`
+	Name        string    `yaml:"name"`
+	CreatedAt   time.Time `yaml:"created_at"`
+}
+
+// Membership はユーザーのテナントへの所属（テナントユーザー）
+type Membership struct {
+	// ID はテナントユーザーID
+	ID string `yaml:"id"`
+
+	TenantID        string    `yaml:"tenant_id"`
+	WorkspaceUserID string    `yaml:"workspace_user_id"`
+	Role            string    `yaml:"role"`
+	CreatedAt       time.Time `yaml:"created_at"`
+}
+
+// Load はシードデータを読み込んで検証する
+// pathが空の場合は組み込みのシードデータを使用する
+func Load(path string) (*Data, error) {
+	b := defaultData
+	if path != "" {
+		var err error
+		if b, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read seed file: %w", err)
+		}
+	}
+	return Parse(b)
+}
+
+// Parse はYAMLのシードデータを解析して検証する
+// 未知のキーはエラーとし、created_atを省略した場合は現在時刻を設定する
+func Parse(b []byte) (*Data, error) {
+	var d Data
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&d); err != nil {
+		return nil, fmt.Errorf("failed to decode seed data: %w", err)
+	}
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for i := range d.Workspaces {
+		defaultTime(&d.Workspaces[i].CreatedAt, now)
+	}
+	for i := range d.Users {
+		defaultTime(&d.Users[i].CreatedAt, now)
+	}
+	for i := range d.Tenants {
+		defaultTime(&d.Tenants[i].CreatedAt, now)
+	}
+	for i := range d.Memberships {
+		defaultTime(&d.Memberships[i].CreatedAt, now)
+	}
+	return &d, nil
+}
+
+// defaultTime は未指定の時刻にデフォルト値を設定する
+func defaultTime(t *time.Time, now time.Time) {
+	if t.IsZero() {
+		*t = now
+	}
+}
+
+// Validate は必須項目、IDの重複、サービスを跨ぐ参照を検証し、全てのエラーをまとめて返す
+func (d *Data) Validate() error {
+	var errs []error
+	addf := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	unique := func(kind string) func(id string) {
+		seen := make(map[string]bool)
+		return func(id string) {
+			if seen[id] {
+				addf("%s: duplicate id %q", kind, id)
+			}
+			seen[id] = true
+		}
+	}
+
+	workspaces := make(map[string]bool)
+	uniqueWorkspace := unique("workspaces")
+	for i, w := range d.Workspaces {
+		if w.ID == "" {
+			addf("workspaces[%d]: id is required", i)
+			continue
+		}
+		uniqueWorkspace(w.ID)
+		workspaces[w.ID] = true
+	}
+
+	users := make(map[string]User)
+	uniqueUser, uniqueAuth0 := unique("users"), unique("users.auth0_user_id")
+	for i, u := range d.Users {
+		if u.ID == "" || u.WorkspaceUserID == "" || u.Auth0UserID == "" {
+			addf("users[%d]: id, workspace_user_id and auth0_user_id are required", i)
+			continue
+		}
+		uniqueUser(u.ID)
+		uniqueAuth0(u.Auth0UserID)
+		if _, ok := users[u.WorkspaceUserID]; ok {
+			addf("users: duplicate workspace_user_id %q", u.WorkspaceUserID)
+		}
+		users[u.WorkspaceUserID] = u
+		if !workspaces[u.WorkspaceID] {
+			addf("users[%s]: unknown workspace_id %q", u.ID, u.WorkspaceID)
+		}
+		if u.Privileged && u.IdPConnectionID != "" {
+			addf("users[%s]: privileged users cannot have idp_connection_id", u.ID)
+		}
+	}
+
+	tenants := make(map[string]Tenant)
+	uniqueTenant := unique("tenants")
+	for i, t := range d.Tenants {
+		if t.ID == "" {
+			addf("tenants[%d]: id is required", i)
+			continue
+		}
+		uniqueTenant(t.ID)
+		tenants[t.ID] = t
+		if !workspaces[t.WorkspaceID] {
+			addf("tenants[%s]: unknown workspace_id %q", t.ID, t.WorkspaceID)
+		}
+	}
+
+	uniqueMembership := unique("memberships")
+	memberOf := make(map[[2]string]bool)
+	for i, m := range d.Memberships {
+		if m.ID == "" {
+			addf("memberships[%d]: id is required", i)
+			continue
+		}
+		uniqueMembership(m.ID)
+		t, tenantOK := tenants[m.TenantID]
+		u, userOK := users[m.WorkspaceUserID]
+		if !tenantOK {
+			addf("memberships[%s]: unknown tenant_id %q", m.ID, m.TenantID)
+		}
+		if !userOK {
+			addf("memberships[%s]: unknown workspace_user_id %q", m.ID, m.WorkspaceUserID)
+		}
+		if tenantOK && userOK && t.WorkspaceID != u.WorkspaceID {
+			addf("memberships[%s]: user %q (workspace %q) cannot join tenant %q of workspace %q", m.ID, m.WorkspaceUserID, u.WorkspaceID, m.TenantID, t.WorkspaceID)
+		}
+		key := [2]string{m.TenantID, m.WorkspaceUserID}
+		if memberOf[key] {
+			addf("memberships[%s]: user %q already belongs to tenant %q", m.ID, m.WorkspaceUserID, m.TenantID)
+		}
+		memberOf[key] = true
+		if !slices.Contains(Roles, m.Role) {
+			addf("memberships[%s]: role must be one of %v: %q", m.ID, Roles, m.Role)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid seed data: %w", errors.Join(errs...))
+	}
+	return nil
+}
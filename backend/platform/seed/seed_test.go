@@ -0,0 +1,170 @@
+package seed
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadDefault(t *testing.T) {
+	d, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(d.Workspaces) != 1 || len(d.Users) != 3 || len(d.Tenants) != 3 || len(d.Memberships) != 3 {
+		t.Errorf("counts = %d workspaces, %d users, %d tenants, %d memberships", len(d.Workspaces), len(d.Users), len(d.Tenants), len(d.Memberships))
+	}
+	if got := d.Users[0]; got.ID != "llu_001" || got.WorkspaceUserID != "wsu-001" || got.Auth0UserID != "auth0|6952b421821fed371daac9df" {
+		t.Errorf("users[0] = %+v", got)
+	}
+	if want := time.Date(2025, 1, 11, 0, 0, 0, 0, time.UTC); !d.Tenants[0].CreatedAt.Equal(want) {
+		t.Errorf("tenants[0].created_at = %v, want %v", d.Tenants[0].CreatedAt, want)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "seed.yaml")
+	if err := os.WriteFile(path, []byte(`
+workspaces:
+  - id: ws-a
+users:
+  - id: u-a
+    workspace_user_id: wsu-a
+    auth0_user_id: auth0|a
+    workspace_id: ws-a
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(d.Workspaces) != 1 || len(d.Users) != 1 || d.Users[0].ID != "u-a" {
+		t.Errorf("data = %+v", d)
+	}
+	// created_atを省略した場合は現在時刻を設定する
+	if d.Workspaces[0].CreatedAt.IsZero() || d.Users[0].CreatedAt.IsZero() {
+		t.Errorf("created_at was not defaulted: %+v", d)
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing.yaml")); err == nil || !strings.Contains(err.Error(), "failed to read seed file") {
+		t.Errorf("Load(missing) error = %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{name: "empty data", yaml: `workspaces: []`},
+		{name: "unknown key", yaml: "workspaces:\n  - id: ws-a\n    owner: alice\n", wantErr: "field owner not found"},
+		{name: "invalid yaml", yaml: "workspaces: [", wantErr: "failed to decode seed data"},
+		{name: "invalid reference", yaml: "tenants:\n  - id: t-a\n    workspace_id: ws-x\n", wantErr: `tenants[t-a]: unknown workspace_id "ws-x"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Parse() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// validData は検証に成功する最小のシードデータを返す
+func validData() *Data {
+	return &Data{
+		Workspaces: []Workspace{{ID: "ws-a"}, {ID: "ws-b"}},
+		Users: []User{
+			{ID: "u-a", WorkspaceUserID: "wsu-a", Auth0UserID: "auth0|a", WorkspaceID: "ws-a"},
+			{ID: "u-b", WorkspaceUserID: "wsu-b", Auth0UserID: "auth0|b", WorkspaceID: "ws-b", Privileged: true},
+		},
+		Tenants: []Tenant{{ID: "t-a", WorkspaceID: "ws-a"}, {ID: "t-b", WorkspaceID: "ws-b"}},
+		Memberships: []Membership{
+			{ID: "m-a", TenantID: "t-a", WorkspaceUserID: "wsu-a", Role: "admin"},
+			{ID: "m-b", TenantID: "t-b", WorkspaceUserID: "wsu-b", Role: "viewer"},
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(d *Data)
+		wantErr []string
+	}{
+		{name: "valid data", modify: func(d *Data) {}},
+		{name: "missing workspace id", modify: func(d *Data) { d.Workspaces[0].ID = "" }, wantErr: []string{"workspaces[0]: id is required"}},
+		{name: "duplicate workspace id", modify: func(d *Data) { d.Workspaces[1].ID = "ws-a" }, wantErr: []string{`workspaces: duplicate id "ws-a"`}},
+		{name: "missing user ids", modify: func(d *Data) { d.Users[1].Auth0UserID = "" }, wantErr: []string{"users[1]: id, workspace_user_id and auth0_user_id are required"}},
+		{name: "duplicate user id", modify: func(d *Data) { d.Users[1].ID = "u-a" }, wantErr: []string{`users: duplicate id "u-a"`}},
+		{name: "duplicate auth0 user id", modify: func(d *Data) { d.Users[1].Auth0UserID = "auth0|a" }, wantErr: []string{`users.auth0_user_id: duplicate id "auth0|a"`}},
+		{name: "duplicate workspace user id", modify: func(d *Data) { d.Users[1].WorkspaceUserID = "wsu-a" }, wantErr: []string{`users: duplicate workspace_user_id "wsu-a"`}},
+		{name: "user in unknown workspace", modify: func(d *Data) { d.Users[0].WorkspaceID = "ws-x" }, wantErr: []string{`users[u-a]: unknown workspace_id "ws-x"`}},
+		{
+			name:    "privileged user with sso connection",
+			modify:  func(d *Data) { d.Users[1].IdPConnectionID = "con_123" },
+			wantErr: []string{"users[u-b]: privileged users cannot have idp_connection_id"},
+		},
+		{name: "duplicate tenant id", modify: func(d *Data) { d.Tenants[1].ID = "t-a" }, wantErr: []string{`tenants: duplicate id "t-a"`}},
+		{name: "tenant in unknown workspace", modify: func(d *Data) { d.Tenants[0].WorkspaceID = "ws-x" }, wantErr: []string{`tenants[t-a]: unknown workspace_id "ws-x"`}},
+		{name: "missing membership id", modify: func(d *Data) { d.Memberships[0].ID = "" }, wantErr: []string{"memberships[0]: id is required"}},
+		{name: "duplicate membership id", modify: func(d *Data) { d.Memberships[1].ID = "m-a" }, wantErr: []string{`memberships: duplicate id "m-a"`}},
+		{name: "membership of unknown tenant", modify: func(d *Data) { d.Memberships[0].TenantID = "t-x" }, wantErr: []string{`memberships[m-a]: unknown tenant_id "t-x"`}},
+		{name: "membership of unknown user", modify: func(d *Data) { d.Memberships[0].WorkspaceUserID = "wsu-x" }, wantErr: []string{`memberships[m-a]: unknown workspace_user_id "wsu-x"`}},
+		{
+			name:    "membership across workspaces",
+			modify:  func(d *Data) { d.Memberships[0].TenantID = "t-b" },
+			wantErr: []string{`memberships[m-a]: user "wsu-a" (workspace "ws-a") cannot join tenant "t-b" of workspace "ws-b"`},
+		},
+		{
+			name: "duplicate membership",
+			modify: func(d *Data) {
+				d.Memberships = append(d.Memberships, Membership{ID: "m-c", TenantID: "t-a", WorkspaceUserID: "wsu-a", Role: "member"})
+			},
+			wantErr: []string{`memberships[m-c]: user "wsu-a" already belongs to tenant "t-a"`},
+		},
+		{name: "unknown role", modify: func(d *Data) { d.Memberships[0].Role = "owner" }, wantErr: []string{`memberships[m-a]: role must be one of [admin member viewer]: "owner"`}},
+		{
+			name: "all errors are reported",
+			modify: func(d *Data) {
+				d.Tenants[0].WorkspaceID = "ws-x"
+				d.Memberships[1].Role = ""
+			},
+			wantErr: []string{`tenants[t-a]: unknown workspace_id "ws-x"`, `memberships[m-b]: role must be one of`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := validData()
+			tt.modify(d)
+			err := d.Validate()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() error = nil, want %q", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error = %v, want %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/otelconnect"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporter はスパンの出力先
+type Exporter string
+
+const (
+	// ExporterNone はスパンを出力しない（トレースIDの生成と伝播のみ行う）
+	ExporterNone Exporter = "none"
+	// ExporterOTLP はOTLP/HTTPでコレクターに送信する（送信先はOTEL_EXPORTER_OTLP_ENDPOINTで指定）
+	ExporterOTLP Exporter = "otlp"
+	// ExporterStdout は標準出力にJSONで出力する（ローカル開発用）
+	ExporterStdout Exporter = "stdout"
+	// ExporterFile はファイルにJSONで出力する（ローカル開発用）
+	ExporterFile Exporter = "file"
+)
+
+// Config はトレースの設定
+type Config struct {
+	// ServiceName はスパンに付与するサービス名
+	ServiceName string `yaml:"-"`
+
+	// Exporter はスパンの出力先
+	Exporter Exporter `yaml:"exporter" env:"OTEL_TRACES_EXPORTER" usage:"スパンの出力先（none・otlp・stdout・file）"`
+
+	// FilePath はExporterFileの出力先ファイル（未設定の場合は<サービス名>-traces.json）
+	FilePath string `yaml:"file" env:"OTEL_TRACES_FILE" usage:"exporter=fileの出力先ファイル"`
+}
+
+// DefaultConfig はトレースのデフォルト設定を返す
+func DefaultConfig(serviceName string) Config {
+	return Config{
+		ServiceName: serviceName,
+		Exporter:    ExporterNone,
+	}
+}
+
+// Validate は設定の妥当性を検証する
+func (c Config) Validate() error {
+	switch c.Exporter {
+	case ExporterNone, ExporterOTLP, ExporterStdout, ExporterFile:
+		return nil
+	default:
+		return fmt.Errorf("unknown exporter: %q", c.Exporter)
+	}
+}
+
+// Setup はグローバルのTracerProviderとW3C Trace Contextのプロパゲーターを設定する
+// 戻り値のshutdownはサーバー停止時に呼び出し、未送信のスパンを出力する
+func Setup(ctx context.Context, cfg Config) (shutdown func(context.Context) error, err error) {
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	opts := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	var closer io.Closer
+
+	switch cfg.Exporter {
+	case ExporterNone:
+	case ExporterOTLP:
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create otlp exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	case ExporterFile:
+		path := cfg.FilePath
+		if path == "" {
+			path = cfg.ServiceName + "-traces.json"
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to create file exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+		closer = f
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER: %q", cfg.Exporter)
+	}
+
+	// エクスポーターがなくてもTracerProviderを設定し、トレースIDを生成してログと下流サービスに伝播させる
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closer != nil {
+			err = errors.Join(err, closer.Close())
+		}
+		return err
+	}, nil
+}
+
+// Tracer はグローバルのTracerProviderからTracerを取得する
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// Middleware はHTTPリクエストごとにサーバースパンを開始し、上流のtraceparentを引き継ぐミドルウェアを返す
+// ヘルスチェックはトレースしない
+func Middleware(operation string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return otelhttp.NewHandler(next, operation,
+			otelhttp.WithFilter(func(r *http.Request) bool {
+				switch r.URL.Path {
+				case "/health", "/livez", "/readyz", "/grpc.health.v1.Health/Check":
+					return false
+				}
+				return true
+			}),
+		)
+	}
+}
+
+// Transport はリクエストごとにクライアントスパンを開始し、traceparentを付与するhttp.RoundTripperを返す
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base)
+}
+
+// Interceptor はConnect RPCごとにスパンを作成するインターセプターを返す
+// クライアントでは下流サービスへのtraceparentの付与も行う
+func Interceptor() connect.Interceptor {
+	interceptor, err := otelconnect.NewInterceptor(
+		// 上流はGatewayまたは同一システム内のサービスのため、受け取ったトレースを親スパンとして扱う
+		otelconnect.WithTrustRemote(),
+		otelconnect.WithoutMetrics(),
+	)
+	if err != nil {
+		// オプションにメトリクスを含めていないため発生しない
+		panic(err)
+	}
+	return interceptor
+}
@@ -0,0 +1,79 @@
+package tenantctx
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	// HeaderTenantID はクライアントが操作対象として選択したテナントIDを指定するヘッダー
+	HeaderTenantID = "X-Tenant-ID"
+
+	// HeaderTenantUserID はGatewayで検証済みのテナントユーザーIDを下流サービスに伝えるヘッダー
+	HeaderTenantUserID = "X-Tenant-User-ID"
+
+	// HeaderTenantRole はGatewayで検証済みのテナント内ロールを下流サービスに伝えるヘッダー
+	HeaderTenantRole = "X-Tenant-Role"
+)
+
+// Role はテナント内でのユーザーのロール
+type Role string
+
+const (
+	RoleAdmin  Role = "admin"
+	RoleMember Role = "member"
+	RoleViewer Role = "viewer"
+)
+
+// Context はリクエストが操作対象としているテナントの情報を表す
+type Context struct {
+	// TenantID はテナントID
+	TenantID string
+
+	// TenantUserID はテナントユーザーID
+	TenantUserID string
+
+	// Role はテナント内でのロール
+	Role Role
+}
+
+type contextKey struct{}
+
+// NewContext はテナントコンテキストを保持したcontext.Contextを返す
+func NewContext(ctx context.Context, tc *Context) context.Context {
+	return context.WithValue(ctx, contextKey{}, tc)
+}
+
+// FromContext はcontext.Contextからテナントコンテキストを取得する
+func FromContext(ctx context.Context) (*Context, bool) {
+	tc, ok := ctx.Value(contextKey{}).(*Context)
+	return tc, ok && tc != nil
+}
+
+// FromHeader はGatewayが付与した検証済みヘッダーからテナントコンテキストを復元する
+// テナントが選択されていない場合はfalseを返す
+func FromHeader(h http.Header) (*Context, bool) {
+	tc := &Context{
+		TenantID:     h.Get(HeaderTenantID),
+		TenantUserID: h.Get(HeaderTenantUserID),
+		Role:         Role(h.Get(HeaderTenantRole)),
+	}
+	if tc.TenantID == "" || tc.TenantUserID == "" {
+		return nil, false
+	}
+	return tc, true
+}
+
+// SetHeader はテナントコンテキストを下流サービス向けのヘッダーに設定する
+func SetHeader(h http.Header, tc *Context) {
+	h.Set(HeaderTenantID, tc.TenantID)
+	h.Set(HeaderTenantUserID, tc.TenantUserID)
+	h.Set(HeaderTenantRole, string(tc.Role))
+}
+
+// DelVerifiedHeader はGatewayのみが設定できる検証済みヘッダーを削除する
+// クライアントが偽装したヘッダーを下流サービスに転送しないために使用する
+func DelVerifiedHeader(h http.Header) {
+	h.Del(HeaderTenantUserID)
+	h.Del(HeaderTenantRole)
+}
@@ -0,0 +1,46 @@
+// Package app はUser APIをプロセス内で起動するためのエントリーポイント
+// internalパッケージを参照できない他のモジュール（統合テストなど）から使用する
+package app
+
+import (
+	"context"
+	"net"
+
+	"github.com/kakke18/platform-security-poc/backend/user/internal/config"
+	"github.com/kakke18/platform-security-poc/backend/user/internal/server"
+)
+
+// Server はプロセス内で起動したUser API
+type Server struct {
+	srv  *server.Server
+	done chan error
+}
+
+// Start はargs（コマンドラインフラグ）と環境変数から設定を読み込み、待ち受け済みのlnとadminLnでサーバーを起動する
+// ポートの設定は使用せず、ログとトレースは呼び出し元の設定を使用する
+func Start(args []string, ln, adminLn net.Listener) (*Server, error) {
+	cfg, err := config.Load(args)
+	if err != nil {
+		return nil, err
+	}
+	srv, err := server.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{srv: srv, done: make(chan error, 1)}
+	go func() {
+		s.done <- srv.Serve(ln, adminLn)
+	}()
+	return s, nil
+}
+
+// Done はいずれかのサーバーが停止した時点でそのエラーを受け取るチャネルを返す
+func (s *Server) Done() <-chan error {
+	return s.done
+}
+
+// Shutdown はサーバーと管理サーバーをグレースフルシャットダウンする
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
@@ -1,37 +1,103 @@
 package config
 
 import (
-	"fmt"
-	"os"
+	"time"
+
+	"github.com/kakke18/platform-security-poc/backend/platform/clientip"
+	"github.com/kakke18/platform-security-poc/backend/platform/conf"
+	"github.com/kakke18/platform-security-poc/backend/platform/logging"
+	"github.com/kakke18/platform-security-poc/backend/platform/telemetry"
 )
 
-// Config はアプリケーション設定
+// Config はアプリケーション設定を保持する
+// 設定ファイル（-config・CONFIG_FILE）、環境変数、コマンドラインフラグの順で上書きする
 type Config struct {
-	Port string
-}
+	// Port はサーバーのポート番号
+	Port string `yaml:"port" env:"PORT" usage:"公開ポート"`
 
-// Load は環境変数から設定を読み込む
-func Load() (*Config, error) {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8082"
-	}
+	// AdminPort はメトリクスなど内部向けエンドポイントを公開する管理サーバーのポート番号
+	AdminPort string `yaml:"admin_port" env:"ADMIN_PORT" usage:"管理ポート"`
 
-	cfg := &Config{
-		Port: port,
-	}
+	// RequestTimeout はリクエスト全体の処理に設定するデッドライン
+	RequestTimeout time.Duration `yaml:"request_timeout" env:"REQUEST_TIMEOUT" usage:"リクエスト全体のデッドライン"`
+
+	// TrustedProxies はX-Forwarded-For・Forwarded・PROXYプロトコルを信頼するプロキシ（Gatewayなど）のアドレス範囲
+	TrustedProxies clientip.Prefixes `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" usage:"転送ヘッダーを信頼するプロキシのCIDR（カンマ区切り）"`
+
+	// ForwardedHeader は信頼するプロキシがクライアントのアドレスを付与する転送ヘッダー（GatewayはX-Forwarded-Forを付与する）
+	ForwardedHeader clientip.Header `yaml:"forwarded_header" env:"FORWARDED_HEADER" usage:"クライアントのアドレスを読む転送ヘッダー（x-forwarded-for・forwarded）"`
+
+	// ProxyProtocol はPROXYプロトコル（v1・v2）のヘッダーを受け付けるかどうか
+	ProxyProtocol bool `yaml:"proxy_protocol" env:"PROXY_PROTOCOL" usage:"PROXYプロトコルを受け付ける"`
+
+	// EventsURL は所属の変更などのイベントの通知先URL（GatewayのAdminポート）
+	// 未設定の場合はイベントを通知しない
+	EventsURL string `yaml:"events_url" env:"EVENTS_URL" usage:"変更イベントの通知先URL"`
+
+	// EventsSecret はイベントの通知先（Gatewayのevents_secret）と共有するシークレット（EVENTS_SECRET_FILEでファイルから読み込める）
+	// events_urlを設定する場合は必須
+	EventsSecret string `yaml:"events_secret" env:"EVENTS_SECRET" secret:"true" usage:"変更イベントの通知先と共有するシークレット"`
+
+	// SeedFile はリポジトリに登録するシードデータ（YAML）のパス
+	// 未設定の場合は組み込みのシードデータを使用する
+	SeedFile string `yaml:"seed_file" env:"SEED_FILE" usage:"シードデータ（YAML）のパス（未設定の場合は組み込みのデータ）"`
 
-	if err := cfg.validate(); err != nil {
-		return nil, fmt.Errorf("invalid config: %w", err)
+	// Server はタイムアウトとリクエストサイズの上限
+	Server conf.Server `yaml:"server"`
+
+	// Logging はログ出力の設定
+	Logging logging.Config `yaml:"logging"`
+
+	// Tracing はトレースの設定
+	Tracing telemetry.Config `yaml:"tracing"`
+}
+
+// defaultConfig はデフォルト設定を返す
+func defaultConfig() *Config {
+	return &Config{
+		Port:            "8082",
+		AdminPort:       "9082",
+		RequestTimeout:  30 * time.Second,
+		ForwardedHeader: clientip.XForwardedFor,
+		Server:          conf.DefaultServer(),
+		Logging:         logging.DefaultConfig(),
+		Tracing:         telemetry.DefaultConfig("user"),
 	}
+}
 
+// Load は設定ファイル・環境変数・コマンドラインフラグから設定を読み込む
+// -print-configが指定された場合は有効な設定を出力してconf.ErrPrintedを返す
+func Load(args []string) (*Config, error) {
+	cfg := defaultConfig()
+	if err := conf.Load(cfg, args); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
 
-// validate は設定の妥当性を検証する
-func (c *Config) validate() error {
-	if c.Port == "" {
-		return fmt.Errorf("PORT is required")
+// Validate は設定の妥当性を検証し、全てのエラーをまとめて返す
+func (c *Config) Validate() error {
+	var errs conf.Errors
+	errs.Port("port", c.Port)
+	errs.Port("admin_port", c.AdminPort)
+	if c.AdminPort == c.Port {
+		errs.Addf("admin_port", "must differ from port")
+	}
+	errs.Positive("request_timeout", c.RequestTimeout)
+	if err := c.ForwardedHeader.Validate(); err != nil {
+		errs.Addf("forwarded_header", "%v", err)
+	}
+	errs.Server("server", c.Server)
+	errs.File("seed_file", c.SeedFile)
+	errs.OptionalURL("events_url", c.EventsURL)
+	if c.EventsURL != "" {
+		errs.Required("events_secret", c.EventsSecret)
+	}
+	if err := c.Logging.Validate(); err != nil {
+		errs.Addf("logging", "%v", err)
+	}
+	if err := c.Tracing.Validate(); err != nil {
+		errs.Addf("tracing", "%v", err)
 	}
-	return nil
+	return errs.Err()
 }
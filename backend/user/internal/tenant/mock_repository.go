@@ -3,40 +3,18 @@ package tenant
 import (
 	"context"
 	"fmt"
-	"time"
 )
 
 // MockRepository はTenantのモックリポジトリ
+// データはシードデータ（Seed）から登録する
 type MockRepository struct {
 	tenants map[string]*Tenant
 }
 
 // NewMockRepository は新しいモックリポジトリを作成する
 func NewMockRepository() *MockRepository {
-	// モックデータを初期化
-	tenants := map[string]*Tenant{
-		"tenant-001": {
-			ID:          "tenant-001",
-			WorkspaceID: "ws-001",
-			Name:        "Production",
-			CreatedAt:   time.Now().Add(-20 * 24 * time.Hour), // 20日前
-		},
-		"tenant-002": {
-			ID:          "tenant-002",
-			WorkspaceID: "ws-001",
-			Name:        "Staging",
-			CreatedAt:   time.Now().Add(-15 * 24 * time.Hour), // 15日前
-		},
-		"tenant-003": {
-			ID:          "tenant-003",
-			WorkspaceID: "ws-001",
-			Name:        "Development",
-			CreatedAt:   time.Now().Add(-10 * 24 * time.Hour), // 10日前
-		},
-	}
-
 	return &MockRepository{
-		tenants: tenants,
+		tenants: make(map[string]*Tenant),
 	}
 }
 
@@ -48,3 +26,12 @@ func (r *MockRepository) FindByID(ctx context.Context, id string) (*Tenant, erro
 	}
 	return tenant, nil
 }
+
+// Create はTenantを登録する
+func (r *MockRepository) Create(ctx context.Context, tenant *Tenant) error {
+	if _, ok := r.tenants[tenant.ID]; ok {
+		return fmt.Errorf("tenant already exists: %s", tenant.ID)
+	}
+	r.tenants[tenant.ID] = tenant
+	return nil
+}
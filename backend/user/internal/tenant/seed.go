@@ -0,0 +1,29 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kakke18/platform-security-poc/backend/platform/seed"
+)
+
+// Seeder はシードデータを登録できるリポジトリ
+type Seeder interface {
+	// Create はTenantを登録する
+	Create(ctx context.Context, tenant *Tenant) error
+}
+
+// Seed はシードデータのテナントをリポジトリに登録する
+func Seed(ctx context.Context, repo Seeder, data *seed.Data) error {
+	for _, t := range data.Tenants {
+		if err := repo.Create(ctx, &Tenant{
+			ID:          t.ID,
+			WorkspaceID: t.WorkspaceID,
+			Name:        t.Name,
+			CreatedAt:   t.CreatedAt,
+		}); err != nil {
+			return fmt.Errorf("failed to seed tenant %s: %w", t.ID, err)
+		}
+	}
+	return nil
+}
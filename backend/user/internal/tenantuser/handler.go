@@ -5,6 +5,7 @@ import (
 
 	"connectrpc.com/connect"
 	userv1 "github.com/kakke18/platform-security-poc/backend/gen/user/v1"
+	"github.com/kakke18/platform-security-poc/backend/platform/principal"
 )
 
 // Handler はTenantUserServiceの実装
@@ -24,11 +25,8 @@ func (h *Handler) GetTenantUsers(
 	ctx context.Context,
 	req *connect.Request[userv1.GetTenantUsersRequest],
 ) (*connect.Response[userv1.GetTenantUsersResponse], error) {
-	// ヘッダーからWorkspaceUserIDを取得（Gatewayで検証済み）
-	workspaceUserID := req.Header().Get("X-Workspace-User-ID")
-	if workspaceUserID == "" {
-		return nil, connect.NewError(connect.CodeUnauthenticated, nil)
-	}
+	// インターセプターで検証済みのPrincipalからWorkspaceUserIDを取得
+	workspaceUserID := principal.MustFrom(ctx).WorkspaceUserID
 
 	// WorkspaceUserIDでTenantUserのリストを取得
 	tenantUsers, err := h.repo.FindByWorkspaceUserID(ctx, workspaceUserID)
@@ -2,45 +2,30 @@ package tenantuser
 
 import (
 	"context"
-	"time"
+	"fmt"
+	"log/slog"
+
+	"github.com/kakke18/platform-security-poc/backend/platform/event"
 )
 
 // MockRepository はTenantUserのモックリポジトリ
+// データはシードデータ（Seed）から登録する
 type MockRepository struct {
 	tenantUsers []*TenantUser
+
+	// publisher は所属の変更を通知する先（SetPublisherの呼び出し前の登録は通知しない）
+	publisher event.Publisher
 }
 
 // NewMockRepository は新しいモックリポジトリを作成する
 func NewMockRepository() *MockRepository {
-	// モックデータを初期化
-	tenantUsers := []*TenantUser{
-		// WorkspaceUser: wsu-001 (User 01) の所属テナント
-		{
-			ID:              "tu-001",
-			TenantID:        "tenant-001",
-			WorkspaceUserID: "wsu-001",
-			Role:            RoleAdmin,
-			CreatedAt:       time.Now().Add(-10 * 24 * time.Hour), // 10日前
-		},
-		{
-			ID:              "tu-002",
-			TenantID:        "tenant-002",
-			WorkspaceUserID: "wsu-001",
-			Role:            RoleMember,
-			CreatedAt:       time.Now().Add(-8 * 24 * time.Hour), // 8日前
-		},
-		{
-			ID:              "tu-003",
-			TenantID:        "tenant-003",
-			WorkspaceUserID: "wsu-001",
-			Role:            RoleViewer,
-			CreatedAt:       time.Now().Add(-5 * 24 * time.Hour), // 5日前
-		},
-	}
+	return &MockRepository{}
+}
 
-	return &MockRepository{
-		tenantUsers: tenantUsers,
-	}
+// SetPublisher は登録時に所属の変更イベントを通知する先を設定する
+// シードデータの登録後に設定し、起動時の所属は対象を指定しないイベントで通知する
+func (r *MockRepository) SetPublisher(publisher event.Publisher) {
+	r.publisher = publisher
 }
 
 // FindByWorkspaceUserID はWorkspaceUserIDでTenantUserのリストを取得する
@@ -53,3 +38,30 @@ func (r *MockRepository) FindByWorkspaceUserID(ctx context.Context, workspaceUse
 	}
 	return result, nil
 }
+
+// Create はTenantUserを登録する
+func (r *MockRepository) Create(ctx context.Context, tenantUser *TenantUser) error {
+	for _, tu := range r.tenantUsers {
+		if tu.ID == tenantUser.ID {
+			return fmt.Errorf("tenant user already exists: %s", tenantUser.ID)
+		}
+	}
+	r.tenantUsers = append(r.tenantUsers, tenantUser)
+
+	// テナントへの所属の変更を通知（GatewayのGetMeキャッシュの無効化に使用）
+	// 通知の失敗は登録結果に影響させない
+	if r.publisher != nil {
+		if err := r.publisher.Publish(ctx, event.Event{
+			Type:            event.TypeMembershipChanged,
+			WorkspaceUserID: tenantUser.WorkspaceUserID,
+		}); err != nil {
+			slog.WarnContext(ctx, "failed to publish membership changed event", slog.String("error", err.Error()))
+		}
+	}
+	return nil
+}
+
+// Ping はモックのため常に成功する
+func (r *MockRepository) Ping(ctx context.Context) error {
+	return nil
+}
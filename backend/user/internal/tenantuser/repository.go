@@ -6,4 +6,7 @@ import "context"
 type Repository interface {
 	// FindByWorkspaceUserID はWorkspaceUserIDでTenantUserのリストを取得する
 	FindByWorkspaceUserID(ctx context.Context, workspaceUserID string) ([]*TenantUser, error)
+
+	// Ping はデータストアに接続できるかを確認する（レディネスチェックで使用）
+	Ping(ctx context.Context) error
 }
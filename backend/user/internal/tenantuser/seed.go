@@ -0,0 +1,30 @@
+package tenantuser
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kakke18/platform-security-poc/backend/platform/seed"
+)
+
+// Seeder はシードデータを登録できるリポジトリ
+type Seeder interface {
+	// Create はTenantUserを登録する
+	Create(ctx context.Context, tenantUser *TenantUser) error
+}
+
+// Seed はシードデータのテナントへの所属をテナントユーザーとしてリポジトリに登録する
+func Seed(ctx context.Context, repo Seeder, data *seed.Data) error {
+	for _, m := range data.Memberships {
+		if err := repo.Create(ctx, &TenantUser{
+			ID:              m.ID,
+			TenantID:        m.TenantID,
+			WorkspaceUserID: m.WorkspaceUserID,
+			Role:            Role(m.Role),
+			CreatedAt:       m.CreatedAt,
+		}); err != nil {
+			return fmt.Errorf("failed to seed tenant user %s: %w", m.ID, err)
+		}
+	}
+	return nil
+}
@@ -10,7 +10,7 @@ import type { Message } from "@bufbuild/protobuf";
  * Describes the file gateway/v1/me.proto.
  */
 export const file_gateway_v1_me: GenFile = /*@__PURE__*/
-  fileDesc("ChNnYXRld2F5L3YxL21lLnByb3RvEgpnYXRld2F5LnYxIg4KDEdldE1lUmVxdWVzdCJbCg5UZW5hbnRVc2VySW5mbxIRCgl0ZW5hbnRfaWQYASABKAkSFgoOdGVuYW50X3VzZXJfaWQYAiABKAkSHgoEcm9sZRgDIAEoDjIQLmdhdGV3YXkudjEuUm9sZSKKAQoNR2V0TWVSZXNwb25zZRIUCgx3b3Jrc3BhY2VfaWQYASABKAkSGQoRd29ya3NwYWNlX3VzZXJfaWQYAiABKAkSDQoFZW1haWwYAyABKAkSDAoEbmFtZRgEIAEoCRIrCgd0ZW5hbnRzGAUgAygLMhouZ2F0ZXdheS52MS5UZW5hbnRVc2VySW5mbyJCChlMaXN0V29ya3NwYWNlVXNlcnNSZXF1ZXN0EhEKCXBhZ2Vfc2l6ZRgBIAEoBRISCgpwYWdlX3Rva2VuGAIgASgJIkcKDVdvcmtzcGFjZVVzZXISGQoRd29ya3NwYWNlX3VzZXJfaWQYASABKAkSDQoFZW1haWwYAiABKAkSDAoEbmFtZRgDIAEoCSJfChpMaXN0V29ya3NwYWNlVXNlcnNSZXNwb25zZRIoCgV1c2VycxgBIAMoCzIZLmdhdGV3YXkudjEuV29ya3NwYWNlVXNlchIXCg9uZXh0X3BhZ2VfdG9rZW4YAiABKAkqTgoEUm9sZRIUChBST0xFX1VOU1BFQ0lGSUVEEAASDgoKUk9MRV9BRE1JThABEg8KC1JPTEVfTUVNQkVSEAISDwoLUk9MRV9WSUVXRVIQAzKuAQoJTWVTZXJ2aWNlEjwKBUdldE1lEhguZ2F0ZXdheS52MS5HZXRNZVJlcXVlc3QaGS5nYXRld2F5LnYxLkdldE1lUmVzcG9uc2USYwoSTGlzdFdvcmtzcGFjZVVzZXJzEiUuZ2F0ZXdheS52MS5MaXN0V29ya3NwYWNlVXNlcnNSZXF1ZXN0GiYuZ2F0ZXdheS52MS5MaXN0V29ya3NwYWNlVXNlcnNSZXNwb25zZUJLWklnaXRodWIuY29tL2tha2tlMTgvcGxhdGZvcm0tc2VjdXJpdHktcG9jL2JhY2tlbmQvZ2VuL2dhdGV3YXkvdjE7Z2F0ZXdheXYxYgZwcm90bzM");
+  fileDesc("ChNnYXRld2F5L3YxL21lLnByb3RvEgpnYXRld2F5LnYxIg4KDEdldE1lUmVxdWVzdCJbCg5UZW5hbnRVc2VySW5mbxIRCgl0ZW5hbnRfaWQYASABKAkSFgoOdGVuYW50X3VzZXJfaWQYAiABKAkSHgoEcm9sZRgDIAEoDjIQLmdhdGV3YXkudjEuUm9sZSKjAQoNR2V0TWVSZXNwb25zZRIUCgx3b3Jrc3BhY2VfaWQYASABKAkSGQoRd29ya3NwYWNlX3VzZXJfaWQYAiABKAkSDQoFZW1haWwYAyABKAkSDAoEbmFtZRgEIAEoCRIrCgd0ZW5hbnRzGAUgAygLMhouZ2F0ZXdheS52MS5UZW5hbnRVc2VySW5mbxIXCg9kZWdyYWRlZF9maWVsZHMYBiADKAkiQgoZTGlzdFdvcmtzcGFjZVVzZXJzUmVxdWVzdBIRCglwYWdlX3NpemUYASABKAUSEgoKcGFnZV90b2tlbhgCIAEoCSJHCg1Xb3Jrc3BhY2VVc2VyEhkKEXdvcmtzcGFjZV91c2VyX2lkGAEgASgJEg0KBWVtYWlsGAIgASgJEgwKBG5hbWUYAyABKAkiXwoaTGlzdFdvcmtzcGFjZVVzZXJzUmVzcG9uc2USKAoFdXNlcnMYASADKAsyGS5nYXRld2F5LnYxLldvcmtzcGFjZVVzZXISFwoPbmV4dF9wYWdlX3Rva2VuGAIgASgJKk4KBFJvbGUSFAoQUk9MRV9VTlNQRUNJRklFRBAAEg4KClJPTEVfQURNSU4QARIPCgtST0xFX01FTUJFUhACEg8KC1JPTEVfVklFV0VSEAMyrgEKCU1lU2VydmljZRI8CgVHZXRNZRIYLmdhdGV3YXkudjEuR2V0TWVSZXF1ZXN0GhkuZ2F0ZXdheS52MS5HZXRNZVJlc3BvbnNlEmMKEkxpc3RXb3Jrc3BhY2VVc2VycxIlLmdhdGV3YXkudjEuTGlzdFdvcmtzcGFjZVVzZXJzUmVxdWVzdBomLmdhdGV3YXkudjEuTGlzdFdvcmtzcGFjZVVzZXJzUmVzcG9uc2VCS1pJZ2l0aHViLmNvbS9rYWtrZTE4L3BsYXRmb3JtLXNlY3VyaXR5LXBvYy9iYWNrZW5kL2dlbi9nYXRld2F5L3YxO2dhdGV3YXl2MWIGcHJvdG8z");
 
 /**
  * GetMeRequest は GetMe のリクエスト
@@ -104,6 +104,14 @@ export type GetMeResponse = Message<"gateway.v1.GetMeResponse"> & {
    * @generated from field: repeated gateway.v1.TenantUserInfo tenants = 5;
    */
   tenants: TenantUserInfo[];
+
+  /**
+   * degraded_fields は部分応答時に取得できなかったフィールド名の一覧 (例: "tenants")
+   * 全てのフィールドを取得できた場合は空
+   *
+   * @generated from field: repeated string degraded_fields = 6;
+   */
+  degradedFields: string[];
 };
 
 /**
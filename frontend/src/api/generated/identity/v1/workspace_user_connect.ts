@@ -4,7 +4,7 @@
 // @ts-nocheck
 
 import { GetWorkspaceUserRequest, GetWorkspaceUserResponse, ListWorkspaceUsersRequest, ListWorkspaceUsersResponse } from "./workspace_user_pb.js";
-import { MethodKind } from "@bufbuild/protobuf";
+import { MethodIdempotency, MethodKind } from "@bufbuild/protobuf";
 
 /**
  * WorkspaceUserService は Workspace User の管理を担当するサービス
@@ -25,6 +25,7 @@ export const WorkspaceUserService = {
       I: GetWorkspaceUserRequest,
       O: GetWorkspaceUserResponse,
       kind: MethodKind.Unary,
+      idempotency: MethodIdempotency.NoSideEffects,
     },
     /**
      * ListWorkspaceUsers はワークスペース内のユーザー一覧を取得する
@@ -36,6 +37,7 @@ export const WorkspaceUserService = {
       I: ListWorkspaceUsersRequest,
       O: ListWorkspaceUsersResponse,
       kind: MethodKind.Unary,
+      idempotency: MethodIdempotency.NoSideEffects,
     },
   }
 } as const;
@@ -10,7 +10,7 @@ import type { Message } from "@bufbuild/protobuf";
  * Describes the file identity/v1/workspace_user.proto.
  */
 export const file_identity_v1_workspace_user: GenFile = /*@__PURE__*/
-  fileDesc("CiBpZGVudGl0eS92MS93b3Jrc3BhY2VfdXNlci5wcm90bxILaWRlbnRpdHkudjEiGQoXR2V0V29ya3NwYWNlVXNlclJlcXVlc3QiaAoYR2V0V29ya3NwYWNlVXNlclJlc3BvbnNlEhQKDHdvcmtzcGFjZV9pZBgBIAEoCRIZChF3b3Jrc3BhY2VfdXNlcl9pZBgCIAEoCRINCgVlbWFpbBgDIAEoCRIMCgRuYW1lGAQgASgJIkIKGUxpc3RXb3Jrc3BhY2VVc2Vyc1JlcXVlc3QSEQoJcGFnZV9zaXplGAEgASgFEhIKCnBhZ2VfdG9rZW4YAiABKAkiRwoNV29ya3NwYWNlVXNlchIZChF3b3Jrc3BhY2VfdXNlcl9pZBgBIAEoCRINCgVlbWFpbBgCIAEoCRIMCgRuYW1lGAMgASgJImAKGkxpc3RXb3Jrc3BhY2VVc2Vyc1Jlc3BvbnNlEikKBXVzZXJzGAEgAygLMhouaWRlbnRpdHkudjEuV29ya3NwYWNlVXNlchIXCg9uZXh0X3BhZ2VfdG9rZW4YAiABKAky3gEKFFdvcmtzcGFjZVVzZXJTZXJ2aWNlEl8KEEdldFdvcmtzcGFjZVVzZXISJC5pZGVudGl0eS52MS5HZXRXb3Jrc3BhY2VVc2VyUmVxdWVzdBolLmlkZW50aXR5LnYxLkdldFdvcmtzcGFjZVVzZXJSZXNwb25zZRJlChJMaXN0V29ya3NwYWNlVXNlcnMSJi5pZGVudGl0eS52MS5MaXN0V29ya3NwYWNlVXNlcnNSZXF1ZXN0GicuaWRlbnRpdHkudjEuTGlzdFdvcmtzcGFjZVVzZXJzUmVzcG9uc2VCTVpLZ2l0aHViLmNvbS9rYWtrZTE4L3BsYXRmb3JtLXNlY3VyaXR5LXBvYy9iYWNrZW5kL2dlbi9pZGVudGl0eS92MTtpZGVudGl0eXYxYgZwcm90bzM");
+  fileDesc("CiBpZGVudGl0eS92MS93b3Jrc3BhY2VfdXNlci5wcm90bxILaWRlbnRpdHkudjEiGQoXR2V0V29ya3NwYWNlVXNlclJlcXVlc3QifAoYR2V0V29ya3NwYWNlVXNlclJlc3BvbnNlEhQKDHdvcmtzcGFjZV9pZBgBIAEoCRIZChF3b3Jrc3BhY2VfdXNlcl9pZBgCIAEoCRINCgVlbWFpbBgDIAEoCRIMCgRuYW1lGAQgASgJEhIKCnByaXZpbGVnZWQYBSABKAgiQgoZTGlzdFdvcmtzcGFjZVVzZXJzUmVxdWVzdBIRCglwYWdlX3NpemUYASABKAUSEgoKcGFnZV90b2tlbhgCIAEoCSJHCg1Xb3Jrc3BhY2VVc2VyEhkKEXdvcmtzcGFjZV91c2VyX2lkGAEgASgJEg0KBWVtYWlsGAIgASgJEgwKBG5hbWUYAyABKAkiYAoaTGlzdFdvcmtzcGFjZVVzZXJzUmVzcG9uc2USKQoFdXNlcnMYASADKAsyGi5pZGVudGl0eS52MS5Xb3Jrc3BhY2VVc2VyEhcKD25leHRfcGFnZV90b2tlbhgCIAEoCTLoAQoUV29ya3NwYWNlVXNlclNlcnZpY2USZAoQR2V0V29ya3NwYWNlVXNlchIkLmlkZW50aXR5LnYxLkdldFdvcmtzcGFjZVVzZXJSZXF1ZXN0GiUuaWRlbnRpdHkudjEuR2V0V29ya3NwYWNlVXNlclJlc3BvbnNlIgOQAgESagoSTGlzdFdvcmtzcGFjZVVzZXJzEiYuaWRlbnRpdHkudjEuTGlzdFdvcmtzcGFjZVVzZXJzUmVxdWVzdBonLmlkZW50aXR5LnYxLkxpc3RXb3Jrc3BhY2VVc2Vyc1Jlc3BvbnNlIgOQAgFCTVpLZ2l0aHViLmNvbS9rYWtrZTE4L3BsYXRmb3JtLXNlY3VyaXR5LXBvYy9iYWNrZW5kL2dlbi9pZGVudGl0eS92MTtpZGVudGl0eXYxYgZwcm90bzM");
 
 /**
  * GetWorkspaceUserRequest は GetWorkspaceUser のリクエスト
@@ -62,6 +62,13 @@ export type GetWorkspaceUserResponse = Message<"identity.v1.GetWorkspaceUserResp
    * @generated from field: string name = 4;
    */
   name: string;
+
+  /**
+   * privileged は特権ユーザー（ワークスペース管理者）かどうか
+   *
+   * @generated from field: bool privileged = 5;
+   */
+  privileged: boolean;
 };
 
 /**
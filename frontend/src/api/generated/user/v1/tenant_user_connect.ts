@@ -4,7 +4,7 @@
 // @ts-nocheck
 
 import { GetTenantUsersRequest, GetTenantUsersResponse } from "./tenant_user_pb.js";
-import { MethodKind } from "@bufbuild/protobuf";
+import { MethodIdempotency, MethodKind } from "@bufbuild/protobuf";
 
 /**
  * TenantUserService は Tenant User の管理を担当するサービス
@@ -25,6 +25,7 @@ export const TenantUserService = {
       I: GetTenantUsersRequest,
       O: GetTenantUsersResponse,
       kind: MethodKind.Unary,
+      idempotency: MethodIdempotency.NoSideEffects,
     },
   }
 } as const;
@@ -10,7 +10,7 @@ import type { Message } from "@bufbuild/protobuf";
  * Describes the file user/v1/tenant_user.proto.
  */
 export const file_user_v1_tenant_user: GenFile = /*@__PURE__*/
-  fileDesc("Chl1c2VyL3YxL3RlbmFudF91c2VyLnByb3RvEgd1c2VyLnYxIhcKFUdldFRlbmFudFVzZXJzUmVxdWVzdCJUCgpUZW5hbnRVc2VyEhEKCXRlbmFudF9pZBgBIAEoCRIWCg50ZW5hbnRfdXNlcl9pZBgCIAEoCRIbCgRyb2xlGAMgASgOMg0udXNlci52MS5Sb2xlIjwKFkdldFRlbmFudFVzZXJzUmVzcG9uc2USIgoFdXNlcnMYASADKAsyEy51c2VyLnYxLlRlbmFudFVzZXIqTgoEUm9sZRIUChBST0xFX1VOU1BFQ0lGSUVEEAASDgoKUk9MRV9BRE1JThABEg8KC1JPTEVfTUVNQkVSEAISDwoLUk9MRV9WSUVXRVIQAzJmChFUZW5hbnRVc2VyU2VydmljZRJRCg5HZXRUZW5hbnRVc2VycxIeLnVzZXIudjEuR2V0VGVuYW50VXNlcnNSZXF1ZXN0Gh8udXNlci52MS5HZXRUZW5hbnRVc2Vyc1Jlc3BvbnNlQkVaQ2dpdGh1Yi5jb20va2Fra2UxOC9wbGF0Zm9ybS1zZWN1cml0eS1wb2MvYmFja2VuZC9nZW4vdXNlci92MTt1c2VydjFiBnByb3RvMw");
+  fileDesc("Chl1c2VyL3YxL3RlbmFudF91c2VyLnByb3RvEgd1c2VyLnYxIhcKFUdldFRlbmFudFVzZXJzUmVxdWVzdCJUCgpUZW5hbnRVc2VyEhEKCXRlbmFudF9pZBgBIAEoCRIWCg50ZW5hbnRfdXNlcl9pZBgCIAEoCRIbCgRyb2xlGAMgASgOMg0udXNlci52MS5Sb2xlIjwKFkdldFRlbmFudFVzZXJzUmVzcG9uc2USIgoFdXNlcnMYASADKAsyEy51c2VyLnYxLlRlbmFudFVzZXIqTgoEUm9sZRIUChBST0xFX1VOU1BFQ0lGSUVEEAASDgoKUk9MRV9BRE1JThABEg8KC1JPTEVfTUVNQkVSEAISDwoLUk9MRV9WSUVXRVIQAzJrChFUZW5hbnRVc2VyU2VydmljZRJWCg5HZXRUZW5hbnRVc2VycxIeLnVzZXIudjEuR2V0VGVuYW50VXNlcnNSZXF1ZXN0Gh8udXNlci52MS5HZXRUZW5hbnRVc2Vyc1Jlc3BvbnNlIgOQAgFCRVpDZ2l0aHViLmNvbS9rYWtrZTE4L3BsYXRmb3JtLXNlY3VyaXR5LXBvYy9iYWNrZW5kL2dlbi91c2VyL3YxO3VzZXJ2MWIGcHJvdG8z");
 
 /**
  * GetTenantUsersRequest は GetTenantUsers のリクエスト